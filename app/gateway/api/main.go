@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -27,22 +29,74 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/gateway/caldav"
+	"github.com/crazyfrankie/todolist/app/gateway/config"
+	"github.com/crazyfrankie/todolist/app/gateway/export"
 	"github.com/crazyfrankie/todolist/app/gateway/mws"
-	"github.com/crazyfrankie/todolist/app/task/rpc_gen/task"
-	"github.com/crazyfrankie/todolist/app/user/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/gateway/oidc"
 )
 
+const (
+	configFile    = "config/config.yaml"
+	refreshCookie = "todolist_refresh"
+	refreshPath   = "/api/user/refresh"
+	// Cookie 有效期与用户服务签发的令牌有效期一致
+	accessMaxAge  = 15 * 60
+	refreshMaxAge = 30 * 86400
+	// keyRefresh 校验令牌的公钥的缓存时间, 遇到未知的 kid 时会提前更新
+	keyRefresh = 5 * time.Minute
+	// revocationTTL 令牌检查结果的缓存时间, 即吊销最长的生效延迟
+	revocationTTL = 30 * time.Second
+	// sessionReportInterval 会话最近使用时间的上报周期
+	sessionReportInterval = time.Minute
+	// accessTokenTTL 个人访问令牌校验结果的缓存时间
+	accessTokenTTL = 30 * time.Second
+)
+
+// accessTokenScopes 个人访问令牌可以访问的路由, 未列出的路由 (账号设置、令牌管理等) 只能登录后访问
+var accessTokenScopes = []mws.ScopeRule{
+	// 日历订阅令牌相当于新的凭证, 不允许通过个人访问令牌创建
+	{Path: "/api/tasks/calendar/*"},
+	{Path: "/api/tasks/*", Read: "tasks:read", Write: "tasks:write"},
+	{Path: "/api/projects/*", Read: "tasks:read", Write: "tasks:write"},
+	{Path: "/api/filters/*", Read: "tasks:read", Write: "tasks:write"},
+	{Path: "/api/templates/*", Read: "tasks:read", Write: "tasks:write"},
+	{Path: "/api/user", Read: "user:read"},
+}
+
+// adminRoles 管理接口只允许管理员与客服访问, 各接口的具体权限由用户服务校验
+var adminRoles = mws.RoleRule{Prefix: "/api/admin/", Roles: []string{"admin", "support"}}
+
 var (
 	userService = "service/user"
 	taskService = "service/task"
 	connMap     sync.Map
+	// internalKey 签名调用各服务的内部凭证, 在创建连接之前初始化
+	internalKey *principal.Key
 )
 
 func main() {
+	conf, err := config.Load(configFile)
+	if err != nil {
+		panic(err)
+	}
+	internalKey, err = principal.NewKey(conf.Internal.Key)
+	if err != nil {
+		panic("invalid internal.key: " + err.Error())
+	}
+	if err := mws.TrustProxies(conf.TrustedProxies); err != nil {
+		panic("invalid trustedProxies: " + err.Error())
+	}
+
 	mux := runtime.NewServeMux(serverMuxOpt()...)
 
 	cli, err := clientv3.New(clientv3.Config{
@@ -61,6 +115,14 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	err = user.RegisterAdminServiceHandlerClient(context.Background(), mux, initAdminClient(cli))
+	if err != nil {
+		panic(err)
+	}
+	err = user.RegisterWorkspaceServiceHandlerClient(context.Background(), mux, initWorkspaceClient(cli))
+	if err != nil {
+		panic(err)
+	}
 
 	// 单机部署不需要处理跨域
 	//handler := mws.CORS(mws.NewAuthBuilder().
@@ -74,10 +136,47 @@ func main() {
 		propagation.Baggage{},
 	))
 	// use otelhttp
-	handler := otelhttp.NewHandler(mws.NewAuthBuilder().
+	// CalDAV 使用应用专用密码鉴权, 不经过 JWT 中间件
+	sessions := mws.NewSessionTracker(touchSessions(u), sessionReportInterval)
+	keys := mws.NewKeySet(fetchKeys(u), keyRefresh)
+	revocation := mws.NewRevocationCache(checkToken(u), revocationTTL)
+	accessTokens := mws.NewAccessTokenCache(verifyAccessToken(u), accessTokenTTL)
+	root := http.NewServeMux()
+	root.Handle("/dav/", caldav.NewHandler("/dav", u, t))
+	root.Handle("/.well-known/caldav", http.RedirectHandler("/dav/", http.StatusMovedPermanently))
+	root.Handle("/", mws.NewAuthBuilder().
 		IgnorePath("/api/user/login").
 		IgnorePath("/api/user/register").
-		Auth(mux), "todolist/gateway")
+		IgnorePath("/api/user/login/2fa").
+		IgnorePath(refreshPath).
+		IgnorePath("/api/user/password/reset").
+		IgnorePath("/api/user/password/reset/confirm").
+		IgnorePath("/api/user/email/verify").
+		IgnorePath("/api/user/jwks").
+		// 日历订阅使用独立的令牌鉴权
+		IgnorePath("/api/tasks/calendar.ics").
+		Keys(keys).
+		Revocation(revocation).
+		Sessions(sessions).
+		AccessTokens(accessTokens, accessTokenScopes).
+		Roles(adminRoles).
+		Auth(mux))
+	// 外部身份登录的入口与回调不需要登录, 关联身份需要
+	oidcHandler := oidc.NewHandler(conf.OIDC, oidcLogin(u), setTokens)
+	oidcAuth := mws.NewAuthBuilder().Keys(keys).Revocation(revocation).Sessions(sessions)
+	for _, path := range oidcHandler.PublicPaths() {
+		oidcAuth.IgnorePath(path)
+	}
+	root.Handle(oidcHandler.Prefix(), oidcAuth.Auth(oidcHandler))
+	// 数据导出只能登录后发起, 下载链接自带签名
+	exportHandler := export.NewHandler(conf.Export, u, t)
+	exportAuth := mws.NewAuthBuilder().Keys(keys).Revocation(revocation).Sessions(sessions)
+	for _, path := range exportHandler.PublicPaths() {
+		exportAuth.IgnorePath(path)
+	}
+	root.Handle(exportHandler.Prefix(), exportAuth.Auth(exportHandler))
+	root.Handle(exportHandler.Prefix()+"/", exportAuth.Auth(exportHandler))
+	handler := otelhttp.NewHandler(root, "todolist/gateway")
 
 	//handler := mws.Trace("todolist/gateway", mws.NewAuthBuilder().
 	//	IgnorePath("/api/user/login").
@@ -107,28 +206,74 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("Server forced shutting down err:%s\n", err)
 	}
+	sessions.Close()
+	exportHandler.Close()
 
 	log.Println("Server exited gracefully")
 }
 
+// reservedMetadata 由网关设置的 metadata, 客户端不能通过 Grpc-Metadata- 请求头传入
+var reservedMetadata = map[string]bool{
+	"user_id":             true,
+	"token_id":            true,
+	"session_id":          true,
+	"impersonator_id":     true,
+	"workspace_id":        true,
+	"user_agent":          true,
+	"client_ip":           true,
+	"refresh_token":       true,
+	principal.MetadataKey: true,
+}
+
 func serverMuxOpt() []runtime.ServeMuxOption {
 	return []runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			h, ok := runtime.DefaultHeaderMatcher(key)
+			if ok && reservedMetadata[strings.ToLower(h)] {
+				return "", false
+			}
+			return h, ok
+		}),
 		runtime.WithMetadata(func(ctx context.Context, request *http.Request) metadata.MD {
+			// 调用方身份由 callerFromMetadata 签入内部凭证
 			md := metadata.MD{}
 
 			if userID, ok := request.Context().Value("user_id").(string); ok {
 				md.Set("user_id", userID)
 			}
+			if tokenID, ok := request.Context().Value("token_id").(string); ok {
+				md.Set("token_id", tokenID)
+			}
+			if sessionID, ok := request.Context().Value("session_id").(string); ok {
+				md.Set("session_id", sessionID)
+			}
+			if impersonator, ok := request.Context().Value("impersonator_id").(string); ok {
+				md.Set("impersonator_id", impersonator)
+			}
+			// 请求工作区中的任务时由任务服务确认调用方是成员
+			if workspaceID := request.Header.Get("X-Workspace-Id"); workspaceID != "" {
+				md.Set("workspace_id", workspaceID)
+			}
 			md.Set("user_agent", request.Header.Get("User-Agent"))
+			md.Set("client_ip", mws.ClientIP(request))
+			// 刷新令牌的 Cookie 只在刷新接口上携带
+			if cookie, err := request.Cookie(refreshCookie); err == nil {
+				md.Set("refresh_token", cookie.Value)
+			}
 
 			return md
 		}),
 		// OutgoingHeaderMatcher 是 grpc gateway 内部进行 metadata 转换到 http 头部的匹配器
 		// 传入特定实现可以跳过某些字段不使用 grpc 的设置
 		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
-			if key == "Set-Auth-Token" {
+			// 令牌只写入 Cookie, 不以 Grpc-Metadata 头的形式返回
+			if strings.EqualFold(key, "Set-Auth-Token") || strings.EqualFold(key, "Set-Refresh-Token") {
 				return "", false
 			}
+			// 登录被限制时告知客户端需要等待的时间
+			if strings.EqualFold(key, "Retry-After") {
+				return "Retry-After", true
+			}
 			return runtime.DefaultHeaderMatcher(key)
 		}),
 		runtime.WithForwardResponseOption(func(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
@@ -138,27 +283,169 @@ func serverMuxOpt() []runtime.ServeMuxOption {
 			}
 
 			if tokens := md.HeaderMD.Get("Set-Auth-Token"); len(tokens) > 0 {
-				http.SetCookie(w, &http.Cookie{
-					Name:     "todolist_auth",
-					Value:    tokens[0],
-					Path:     "/",
-					HttpOnly: true,
-					Secure:   true,
-					SameSite: http.SameSiteStrictMode,
-					MaxAge:   86400,
-				})
+				setTokenCookie(w, "todolist_auth", "/", tokens[0], accessMaxAge)
+			}
+			if tokens := md.HeaderMD.Get("Set-Refresh-Token"); len(tokens) > 0 {
+				setTokenCookie(w, refreshCookie, refreshPath, tokens[0], refreshMaxAge)
 			}
 			return nil
 		}),
 	}
 }
 
+func fetchKeys(u user.UserServiceClient) mws.FetchKeysFunc {
+	return func(ctx context.Context) ([]mws.JWK, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		resp, err := u.GetJWKS(ctx, &user.GetJWKSRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]mws.JWK, 0, len(resp.GetKeys()))
+		for _, k := range resp.GetKeys() {
+			keys = append(keys, mws.JWK{
+				Kty: k.GetKty(),
+				Kid: k.GetKid(),
+				Alg: k.GetAlg(),
+				Crv: k.GetCrv(),
+				X:   k.GetX(),
+				N:   k.GetN(),
+				E:   k.GetE(),
+			})
+		}
+		return keys, nil
+	}
+}
+
+func checkToken(u user.UserServiceClient) mws.CheckFunc {
+	return func(ctx context.Context, uid int, jti, session string, generation int64) (bool, error) {
+		resp, err := u.CheckToken(ctx, &user.CheckTokenRequest{
+			UserId:     int32(uid),
+			TokenId:    jti,
+			Generation: generation,
+			SessionId:  session,
+		})
+		if err != nil {
+			return false, err
+		}
+		return resp.GetValid(), nil
+	}
+}
+
+func verifyAccessToken(u user.UserServiceClient) mws.VerifyFunc {
+	return func(ctx context.Context, token string) (mws.AccessTokenInfo, error) {
+		resp, err := u.VerifyAccessToken(ctx, &user.VerifyAccessTokenRequest{Token: token})
+		if err != nil {
+			return mws.AccessTokenInfo{}, err
+		}
+		return mws.AccessTokenInfo{
+			Valid:     resp.GetValid(),
+			UserId:    int(resp.GetUserId()),
+			TokenId:   int(resp.GetTokenId()),
+			Scopes:    resp.GetScopes(),
+			ExpiresAt: time.Unix(resp.GetExpiresAt(), 0),
+		}, nil
+	}
+}
+
+func touchSessions(u user.UserServiceClient) func([]mws.SessionSeen) {
+	return func(seen []mws.SessionSeen) {
+		req := &user.TouchSessionsRequest{Seen: make([]*user.SessionSeen, 0, len(seen))}
+		for _, s := range seen {
+			req.Seen = append(req.Seen, &user.SessionSeen{
+				UserId:    int32(s.UserId),
+				SessionId: s.Session,
+				Ip:        s.Ip,
+				SeenAt:    s.SeenAt,
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if _, err := u.TouchSessions(ctx, req); err != nil {
+			log.Printf("failed to report session activity: %s", err)
+		}
+	}
+}
+
+func setTokens(w http.ResponseWriter, access, refresh string) {
+	setTokenCookie(w, "todolist_auth", "/", access, accessMaxAge)
+	setTokenCookie(w, refreshCookie, refreshPath, refresh, refreshMaxAge)
+}
+
+func oidcLogin(u user.UserServiceClient) oidc.LoginFunc {
+	return func(r *http.Request, id oidc.Identity) (oidc.Result, error) {
+		ctx := metadata.NewOutgoingContext(r.Context(), metadata.Pairs(
+			"user_agent", r.Header.Get("User-Agent"),
+			"client_ip", mws.ClientIP(r),
+		))
+		resp, err := u.OIDCLogin(ctx, &user.OIDCLoginRequest{
+			Provider:      id.Provider,
+			Subject:       id.Subject,
+			Email:         id.Email,
+			EmailVerified: id.EmailVerified,
+			Name:          id.Name,
+			LinkUserId:    int32(id.LinkUserId),
+		})
+		switch status.Code(err) {
+		case codes.OK:
+		case codes.FailedPrecondition:
+			return oidc.Result{}, &oidc.Error{Code: "account_exists"}
+		case codes.AlreadyExists:
+			return oidc.Result{}, &oidc.Error{Code: "identity_linked"}
+		case codes.PermissionDenied:
+			return oidc.Result{}, &oidc.Error{Code: "account_disabled"}
+		case codes.Unauthenticated:
+			return oidc.Result{}, &oidc.Error{Code: "password_reset_required"}
+		default:
+			return oidc.Result{}, err
+		}
+
+		return oidc.Result{
+			Access:    resp.GetAccessToken(),
+			Refresh:   resp.GetRefreshToken(),
+			Challenge: resp.GetChallenge(),
+		}, nil
+	}
+}
+
+// setTokenCookie 写入令牌 Cookie, 令牌为空时 (退出登录) 删除 Cookie
+func setTokenCookie(w http.ResponseWriter, name, path, token string, maxAge int) {
+	if token == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   maxAge,
+	})
+}
+
 func initUserClient(client *clientv3.Client) user.UserServiceClient {
 	cli := user.NewUserServiceClient(getSharedConn(client, userService, "todolist/client/user"))
 
 	return cli
 }
 
+// initAdminClient AdminService 与 UserService 由同一个用户服务提供, 共用连接
+func initAdminClient(client *clientv3.Client) user.AdminServiceClient {
+	cli := user.NewAdminServiceClient(getSharedConn(client, userService, "todolist/client/user"))
+
+	return cli
+}
+
+// initWorkspaceClient WorkspaceService 同样由用户服务提供, 共用连接
+func initWorkspaceClient(client *clientv3.Client) user.WorkspaceServiceClient {
+	cli := user.NewWorkspaceServiceClient(getSharedConn(client, userService, "todolist/client/user"))
+
+	return cli
+}
+
 func initTaskClient(client *clientv3.Client) task.TaskServiceClient {
 	cli := task.NewTaskServiceClient(getSharedConn(client, taskService, "todolist/client/task"))
 
@@ -218,6 +505,7 @@ func grpcClientOption(cli *clientv3.Client, clientname string) []grpc.DialOption
 		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 		grpc.WithChainUnaryInterceptor(
 			logging.UnaryClientInterceptor(initInterceptor(logger), logging.WithFieldsFromContext(logTraceID)),
+			principal.UnaryClientInterceptor(internalKey, principal.IssuerGateway, callerFromMetadata),
 		),
 	}
 
@@ -293,3 +581,29 @@ func newTraceProvider(res *resource.Resource) (*trace.TracerProvider, error) {
 
 	return traceProvider, nil
 }
+
+// callerFromMetadata 把鉴权中间件写入 metadata 的调用方身份签入内部凭证, 并从 metadata 中移除,
+// 各服务只信任内部凭证中的身份
+func callerFromMetadata(ctx context.Context) (context.Context, principal.Principal) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx, principal.Principal{}
+	}
+	md = md.Copy()
+	first := func(key string) string {
+		v := md.Get(key)
+		md.Delete(key)
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0]
+	}
+
+	var p principal.Principal
+	p.UserId, _ = strconv.Atoi(first("user_id"))
+	p.TokenId = first("token_id")
+	p.SessionId = first("session_id")
+	p.ImpersonatorId, _ = strconv.Atoi(first("impersonator_id"))
+
+	return metadata.NewOutgoingContext(ctx, md), p
+}
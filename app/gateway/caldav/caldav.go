@@ -0,0 +1,522 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+)
+
+const (
+	maxBodySize = 1 << 20
+
+	// inbox 不属于任何项目的任务所在的集合
+	inbox     = "inbox"
+	inboxName = "Tasks"
+
+	calendarContentType = "text/calendar; charset=utf-8; component=vtodo"
+)
+
+// Handler 基于 TaskService 的 CalDAV 服务, 集合对应项目, VTODO 资源对应任务
+//
+// 资源布局:
+//
+//	{prefix}/                       根, 用于发现当前用户主体
+//	{prefix}/principal/             用户主体
+//	{prefix}/calendars/             日历主目录
+//	{prefix}/calendars/{col}/       集合, inbox 或项目 id
+//	{prefix}/calendars/{col}/{obj}  VTODO 资源
+type Handler struct {
+	prefix string
+	users  user.UserServiceClient
+	tasks  task.TaskServiceClient
+}
+
+func NewHandler(prefix string, users user.UserServiceClient, tasks task.TaskServiceClient) *Handler {
+	return &Handler{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		users:  users,
+		tasks:  tasks,
+	}
+}
+
+type collection struct {
+	seg       string
+	projectId int32
+	name      string
+	ctag      string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	segs := splitPath(strings.TrimPrefix(r.URL.Path, h.prefix))
+	switch {
+	case len(segs) == 0:
+		h.serveStatic(w, r, h.prefix+"/", rootProps(h))
+	case len(segs) == 1 && segs[0] == "principal":
+		h.serveStatic(w, r, h.principalHref(), principalProps(h))
+	case len(segs) == 1 && segs[0] == "calendars":
+		h.serveHome(ctx, w, r)
+	case len(segs) == 2 && segs[0] == "calendars":
+		h.serveCollection(ctx, w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "calendars":
+		h.serveObject(ctx, w, r, segs[1], segs[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authenticate 使用 Basic 认证校验应用专用密码, 成功后将用户 id 写入 gRPC metadata
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	name, password, ok := r.BasicAuth()
+	if ok {
+		resp, err := h.users.VerifyAppPassword(r.Context(), &user.VerifyAppPasswordRequest{
+			Name:     name,
+			Password: password,
+		})
+		if err == nil {
+			uid := strconv.Itoa(int(resp.GetUserId()))
+			return metadata.AppendToOutgoingContext(r.Context(), "user_id", uid), true
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			zap.L().Error("Failed to verify app password", zap.Error(err))
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="todolist", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return nil, false
+}
+
+func (h *Handler) serveStatic(w http.ResponseWriter, r *http.Request, href string, p props) {
+	if r.Method != "PROPFIND" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req propfind
+	if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ms := newMultistatus()
+	ms.add(href, p, req.Prop.names())
+	ms.writeTo(w)
+}
+
+func (h *Handler) serveHome(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req propfind
+	if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requested := req.Prop.names()
+
+	ms := newMultistatus()
+	ms.add(h.homeHref(), homeProps(h), requested)
+	if depth(r) > 0 {
+		cols, err := h.collections(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, col := range cols {
+			ms.add(h.collectionHref(col), h.collectionProps(col), requested)
+		}
+	}
+	ms.writeTo(w)
+}
+
+func (h *Handler) serveCollection(ctx context.Context, w http.ResponseWriter, r *http.Request, seg string) {
+	col, err := h.findCollection(ctx, seg)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		var req propfind
+		if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requested := req.Prop.names()
+
+		ms := newMultistatus()
+		ms.add(h.collectionHref(col), h.collectionProps(col), requested)
+		if depth(r) > 0 {
+			if err := h.addObjects(ctx, ms, col, nil, requested); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		ms.writeTo(w)
+	case "REPORT":
+		var req report
+		if err := decodeBody(r, &req); err != nil {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+		if req.XMLName.Space != nsCalDAV {
+			http.Error(w, "unsupported report", http.StatusForbidden)
+			return
+		}
+
+		var names []string
+		switch req.XMLName.Local {
+		case "calendar-query":
+			// 集合中只有 VTODO, 过滤条件交给客户端处理
+		case "calendar-multiget":
+			names = make([]string, 0, len(req.Hrefs))
+			for _, href := range req.Hrefs {
+				names = append(names, objectName(href))
+			}
+			if len(names) == 0 {
+				newMultistatus().writeTo(w)
+				return
+			}
+		default:
+			http.Error(w, "unsupported report", http.StatusForbidden)
+			return
+		}
+
+		ms := newMultistatus()
+		if err := h.addObjects(ctx, ms, col, names, req.Prop.names()); err != nil {
+			writeError(w, err)
+			return
+		}
+		ms.writeTo(w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveObject(ctx context.Context, w http.ResponseWriter, r *http.Request, seg, name string) {
+	col, err := h.findCollection(ctx, seg)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		resp, err := h.tasks.ListCalendarObjects(ctx, &task.ListCalendarObjectsRequest{
+			ProjectId: col.projectId,
+			Names:     []string{name},
+			WithData:  true,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(resp.GetObjects()) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		obj := resp.GetObjects()[0]
+		w.Header().Set("Content-Type", calendarContentType)
+		w.Header().Set("ETag", etag(obj.GetVersion()))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = io.WriteString(w, obj.GetData())
+		}
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, exists := ifMatch(r)
+		resp, err := h.tasks.PutCalendarObject(ctx, &task.PutCalendarObjectRequest{
+			ProjectId:   col.projectId,
+			Name:        name,
+			Data:        string(body),
+			IfMatch:     version,
+			IfNoneMatch: r.Header.Get("If-None-Match") == "*",
+			IfExists:    exists,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(resp.GetVersion()))
+		if resp.GetCreated() {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		version, exists := ifMatch(r)
+		_, err := h.tasks.DeleteCalendarObject(ctx, &task.DeleteCalendarObjectRequest{
+			ProjectId: col.projectId,
+			Name:      name,
+			IfMatch:   version,
+			IfExists:  exists,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		var req propfind
+		if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ms := newMultistatus()
+		if err := h.addObjects(ctx, ms, col, []string{name}, req.Prop.names()); err != nil {
+			writeError(w, err)
+			return
+		}
+		ms.writeTo(w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// addObjects 将集合中的对象写入响应, names 中不存在的对象返回 404
+func (h *Handler) addObjects(ctx context.Context, ms *multistatus, col collection, names []string, requested []xml.Name) error {
+	withData := false
+	for _, name := range requested {
+		if name == propCalendarData {
+			withData = true
+		}
+	}
+
+	resp, err := h.tasks.ListCalendarObjects(ctx, &task.ListCalendarObjectsRequest{
+		ProjectId: col.projectId,
+		Names:     names,
+		WithData:  withData,
+	})
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]struct{}, len(resp.GetObjects()))
+	for _, obj := range resp.GetObjects() {
+		found[obj.GetName()] = struct{}{}
+		p := props{
+			propResourceType:   "",
+			propGetETag:        escape(etag(obj.GetVersion())),
+			propGetContentType: escape(calendarContentType),
+		}
+		if withData {
+			p[propCalendarData] = escape(obj.GetData())
+		}
+		ms.add(h.objectHref(col, obj.GetName()), p, requested)
+	}
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			ms.addStatus(h.objectHref(col, name), http.StatusNotFound)
+		}
+	}
+
+	return nil
+}
+
+// ifMatch 解析 If-Match 请求头, * 表示对象必须存在, 由任务服务在写入的事务中检查
+func ifMatch(r *http.Request) (version int64, exists bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch header {
+	case "":
+		return 0, false
+	case "*":
+		return 0, true
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil || version == 0 {
+		// 不可能匹配的 ETag
+		return -1, false
+	}
+
+	return version, false
+}
+
+// collections 列出集合, projectIds 不为空时只查询这些集合, 0 为 inbox. ctag 由任务服务一次汇总得到
+func (h *Handler) collections(ctx context.Context, projectIds ...int32) ([]collection, error) {
+	resp, err := h.tasks.ListCalendarCollections(ctx, &task.ListCalendarCollectionsRequest{
+		ProjectIds: projectIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]collection, 0, len(resp.GetCollections()))
+	for _, c := range resp.GetCollections() {
+		col := collection{
+			seg:       strconv.Itoa(int(c.GetProjectId())),
+			projectId: c.GetProjectId(),
+			name:      c.GetName(),
+			ctag:      c.GetCtag(),
+		}
+		if c.GetProjectId() == 0 {
+			col.seg, col.name = inbox, inboxName
+		}
+		cols = append(cols, col)
+	}
+
+	return cols, nil
+}
+
+// findCollection 按路径中的 inbox 或项目 id 查询单个集合
+func (h *Handler) findCollection(ctx context.Context, seg string) (collection, error) {
+	var projectId int32
+	if seg != inbox {
+		id, err := strconv.ParseInt(seg, 10, 32)
+		if err != nil || id <= 0 || strconv.FormatInt(id, 10) != seg {
+			return collection{}, status.Error(codes.NotFound, "collection not found")
+		}
+		projectId = int32(id)
+	}
+
+	cols, err := h.collections(ctx, projectId)
+	if err != nil {
+		return collection{}, err
+	}
+	if len(cols) == 0 {
+		return collection{}, status.Error(codes.NotFound, "collection not found")
+	}
+
+	return cols[0], nil
+}
+
+func (h *Handler) collectionProps(col collection) props {
+	return props{
+		propResourceType:     "<D:collection/><C:calendar/>",
+		propDisplayName:      escape(col.name),
+		propPrincipal:        hrefElement(h.principalHref()),
+		propSupportedCompSet: `<C:comp name="VTODO"/>`,
+		propPrivilegeSet:     "<D:privilege><D:read/></D:privilege><D:privilege><D:write/></D:privilege>",
+		propCTag:             escape(col.ctag),
+		propGetETag:          escape(`"` + col.ctag + `"`),
+	}
+}
+
+func rootProps(h *Handler) props {
+	return props{
+		propResourceType: "<D:collection/>",
+		propPrincipal:    hrefElement(h.principalHref()),
+	}
+}
+
+func principalProps(h *Handler) props {
+	return props{
+		propResourceType: "<D:collection/><D:principal/>",
+		propDisplayName:  "todolist",
+		propPrincipal:    hrefElement(h.principalHref()),
+		propPrincipalURL: hrefElement(h.principalHref()),
+		propCalendarHome: hrefElement(h.homeHref()),
+	}
+}
+
+func homeProps(h *Handler) props {
+	return props{
+		propResourceType: "<D:collection/>",
+		propPrincipal:    hrefElement(h.principalHref()),
+	}
+}
+
+func (h *Handler) principalHref() string {
+	return h.prefix + "/principal/"
+}
+
+func (h *Handler) homeHref() string {
+	return h.prefix + "/calendars/"
+}
+
+func (h *Handler) collectionHref(col collection) string {
+	return h.homeHref() + col.seg + "/"
+}
+
+func (h *Handler) objectHref(col collection, name string) string {
+	return h.collectionHref(col) + url.PathEscape(name)
+}
+
+// objectName 从 multiget 的 href 中取出资源名
+func objectName(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		href = u.Path
+	}
+	if p, err := url.PathUnescape(href); err == nil {
+		href = p
+	}
+
+	return path.Base(href)
+}
+
+func splitPath(p string) []string {
+	var segs []string
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" {
+			continue
+		}
+		if s, err := url.PathUnescape(seg); err == nil {
+			seg = s
+		}
+		segs = append(segs, seg)
+	}
+
+	return segs
+}
+
+func depth(r *http.Request) int {
+	if r.Header.Get("Depth") == "0" {
+		return 0
+	}
+
+	return 1
+}
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch status.Code(err) {
+	case codes.NotFound:
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case codes.FailedPrecondition:
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+	case codes.InvalidArgument:
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	case codes.Unauthenticated:
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	default:
+		zap.L().Error("CalDAV request failed", zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,182 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+var prefixes = map[string]string{
+	nsDAV:    "D",
+	nsCalDAV: "C",
+	nsCS:     "CS",
+}
+
+var (
+	propResourceType     = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName      = xml.Name{Space: nsDAV, Local: "displayname"}
+	propPrincipal        = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL     = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propPrivilegeSet     = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propGetETag          = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType   = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propCalendarHome     = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propCalendarData     = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propSupportedCompSet = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCTag             = xml.Name{Space: nsCS, Local: "getctag"}
+)
+
+// propfind PROPFIND 请求体, 为空时等同于 allprop
+type propfind struct {
+	XMLName xml.Name  `xml:"DAV: propfind"`
+	Prop    *propList `xml:"DAV: prop"`
+}
+
+// report REPORT 请求体, 支持 calendar-query 与 calendar-multiget
+type report struct {
+	XMLName xml.Name
+	Prop    *propList `xml:"DAV: prop"`
+	Hrefs   []string  `xml:"DAV: href"`
+}
+
+type propList struct {
+	Names []anyName `xml:",any"`
+}
+
+type anyName struct {
+	XMLName xml.Name
+}
+
+func (p *propList) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(p.Names))
+	for _, n := range p.Names {
+		names = append(names, n.XMLName)
+	}
+
+	return names
+}
+
+func decodeBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return io.EOF
+	}
+
+	return xml.Unmarshal(body, v)
+}
+
+// props 一个资源的属性集合, 值为已经序列化好的元素内容
+type props map[xml.Name]string
+
+// multistatus 构造 207 Multi-Status 响应
+type multistatus struct {
+	buf bytes.Buffer
+}
+
+func newMultistatus() *multistatus {
+	m := &multistatus{}
+	m.buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	m.buf.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">`)
+	return m
+}
+
+// add 写入一个资源, requested 为空时返回除 calendar-data 之外的全部属性
+func (m *multistatus) add(href string, p props, requested []xml.Name) {
+	m.buf.WriteString("<D:response><D:href>")
+	xml.EscapeText(&m.buf, []byte(href))
+	m.buf.WriteString("</D:href>")
+
+	var found, missing []xml.Name
+	if len(requested) == 0 {
+		for name := range p {
+			if name != propCalendarData {
+				found = append(found, name)
+			}
+		}
+	} else {
+		for _, name := range requested {
+			if _, ok := p[name]; ok {
+				found = append(found, name)
+			} else {
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	if len(found) > 0 {
+		m.buf.WriteString("<D:propstat><D:prop>")
+		for _, name := range found {
+			writeElement(&m.buf, name, p[name])
+		}
+		m.buf.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+	}
+	if len(missing) > 0 {
+		m.buf.WriteString("<D:propstat><D:prop>")
+		for _, name := range missing {
+			writeElement(&m.buf, name, "")
+		}
+		m.buf.WriteString("</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+	}
+
+	m.buf.WriteString("</D:response>")
+}
+
+// addStatus 写入一个只有状态的资源, 例如 multiget 中不存在的对象
+func (m *multistatus) addStatus(href string, code int) {
+	m.buf.WriteString("<D:response><D:href>")
+	xml.EscapeText(&m.buf, []byte(href))
+	m.buf.WriteString("</D:href>")
+	fmt.Fprintf(&m.buf, "<D:status>HTTP/1.1 %d %s</D:status>", code, http.StatusText(code))
+	m.buf.WriteString("</D:response>")
+}
+
+func (m *multistatus) writeTo(w http.ResponseWriter) {
+	m.buf.WriteString("</D:multistatus>")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write(m.buf.Bytes())
+}
+
+func writeElement(buf *bytes.Buffer, name xml.Name, inner string) {
+	prefix, ok := prefixes[name.Space]
+	tag := prefix + ":" + name.Local
+	if !ok {
+		tag = "X:" + name.Local
+	}
+
+	buf.WriteString("<" + tag)
+	if !ok {
+		buf.WriteString(` xmlns:X="`)
+		xml.EscapeText(buf, []byte(name.Space))
+		buf.WriteString(`"`)
+	}
+	if inner == "" {
+		buf.WriteString("/>")
+		return
+	}
+	buf.WriteString(">" + inner + "</" + tag + ">")
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func hrefElement(href string) string {
+	return "<D:href>" + escape(href) + "</D:href>"
+}
@@ -0,0 +1,77 @@
+// Package config 网关配置, 配置文件中的 ${VAR} 会替换为环境变量, 用于提供密钥等敏感信息
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	OIDC     OIDC     `yaml:"oidc"`
+	Export   Export   `yaml:"export"`
+	Internal Internal `yaml:"internal"`
+	// TrustedProxies 部署在网关之前的反向代理, 每项为 IP 或 CIDR. 只信任这些地址转发的
+	// X-Forwarded-For 与 X-Real-IP, 网关直接对外时保持为空
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+// Internal 调用各服务时签发内部凭证的配置
+type Internal struct {
+	// Key 与各服务的 INTERNAL_AUTH_KEY 相同的共享密钥, 至少 32 字节, 不能为空
+	Key string `yaml:"key"`
+}
+
+// OIDC 外部身份提供方登录配置, 没有配置提供方时不开放登录入口
+type OIDC struct {
+	// StateKey 签名授权流程 Cookie 的密钥, 为空时启动时随机生成, 只适合单实例部署
+	StateKey string `yaml:"stateKey"`
+	// SuccessURL 登录或关联成功后跳转的页面
+	SuccessURL string `yaml:"successURL"`
+	// TwoFactorURL 账号开启了两步验证时跳转的页面, 地址后附加 ?challenge=...
+	TwoFactorURL string `yaml:"twoFactorURL"`
+	// ErrorURL 登录失败时跳转的页面, 地址后附加 ?error=...
+	ErrorURL  string         `yaml:"errorURL"`
+	Providers []OIDCProvider `yaml:"providers"`
+}
+
+type OIDCProvider struct {
+	// Name 出现在登录地址 /api/auth/oidc/{name}/login 中, 也是账号关联记录中的提供方名称, 配置后不要修改
+	Name string `yaml:"name"`
+	// Issuer 通过 {issuer}/.well-known/openid-configuration 获取各个端点
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"clientID"`
+	ClientSecret string `yaml:"clientSecret"`
+	// RedirectURL 在身份提供方登记的回调地址, 即 /api/auth/oidc/{name}/callback 的完整地址
+	RedirectURL string `yaml:"redirectURL"`
+	// Scopes 为空时使用 openid email profile
+	Scopes []string `yaml:"scopes"`
+}
+
+// Export 账号数据导出配置
+type Export struct {
+	// LinkKey 签名下载链接的密钥, 为空时启动时随机生成, 只适合单实例部署
+	LinkKey string `yaml:"linkKey"`
+	// TTL 导出文件与下载链接的有效期, 为空时为 24h
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Load 读取配置文件, 文件不存在时返回空配置
+func Load(path string) (*Config, error) {
+	conf := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,99 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+)
+
+// file 导出包中的一个 JSON 文件与读取它的调用
+type file struct {
+	name  string
+	fetch func(ctx context.Context) (proto.Message, error)
+}
+
+var marshaler = protojson.MarshalOptions{Multiline: true, Indent: "  ", EmitUnpopulated: true}
+
+func (h *Handler) files() []file {
+	return []file{
+		{"user.json", func(ctx context.Context) (proto.Message, error) {
+			return h.users.GetUserInfo(ctx, &user.GetUserInfoRequest{})
+		}},
+		{"sessions.json", func(ctx context.Context) (proto.Message, error) {
+			return h.users.ListSessions(ctx, &user.ListSessionsRequest{})
+		}},
+		{"identities.json", func(ctx context.Context) (proto.Message, error) {
+			return h.users.ListIdentities(ctx, &user.ListIdentitiesRequest{})
+		}},
+		{"tasks.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListTasks(ctx, &task.ListTasksRequest{})
+		}},
+		{"archived_tasks.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListArchivedTasks(ctx, &task.ListArchivedTasksRequest{})
+		}},
+		{"snoozed_tasks.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListSnoozedTasks(ctx, &task.ListSnoozedTasksRequest{})
+		}},
+		{"recycle_bin.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.RecycleBin(ctx, &task.RecycleBinRequest{})
+		}},
+		{"workspace_tasks.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ExportWorkspaceTasks(ctx, &task.ExportWorkspaceTasksRequest{})
+		}},
+		{"time_entries.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListTimeEntries(ctx, &task.ListTimeEntriesRequest{})
+		}},
+		{"projects.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListProjects(ctx, &task.ListProjectsRequest{})
+		}},
+		{"templates.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListTemplates(ctx, &task.ListTemplatesRequest{})
+		}},
+		{"filters.json", func(ctx context.Context) (proto.Message, error) {
+			return h.tasks.ListFilters(ctx, &task.ListFiltersRequest{})
+		}},
+	}
+}
+
+// collect 以用户身份从用户服务与任务服务读取数据, 每类数据写入一个 JSON 文件并打包
+func (h *Handler) collect(uid int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "user_id", strconv.Itoa(uid))
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	for _, f := range h.files() {
+		msg, err := f.fetch(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		data, err := marshaler.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
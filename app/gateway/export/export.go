@@ -0,0 +1,315 @@
+// Package export 实现账号数据导出. 导出在后台执行, 客户端轮询任务状态,
+// 完成后通过带签名的下载链接获取包含全部数据 JSON 文件的 zip 包
+package export
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/gateway/config"
+)
+
+const (
+	// prefix 创建任务为 POST {prefix}, 查询状态为 GET {prefix}/{id}, 下载为 GET {prefix}/download?token=...
+	prefix       = "/api/user/export"
+	downloadPath = prefix + "/download"
+
+	defaultTTL = 24 * time.Hour
+	// maxRunning 同时执行的导出任务数, 超出的任务排队等待
+	maxRunning = 4
+	// jobTimeout 单个导出任务从各服务读取数据的最长时间
+	jobTimeout = 2 * time.Minute
+	// cleanInterval 清理过期导出文件的周期
+	cleanInterval = 10 * time.Minute
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// job 一次导出任务, 导出文件保存在内存中, 过期或用户创建新的导出后删除
+type job struct {
+	id        string
+	userId    int
+	status    string
+	err       string
+	data      []byte
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// Job 返回给客户端的任务状态, 完成后带有下载链接
+type Job struct {
+	Id          string `json:"id"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	ExpiresAt   string `json:"expiresAt,omitempty"`
+}
+
+// Handler 导出任务只保存在当前实例的内存中, 多实例部署时需要会话保持.
+// 每个用户只保留最近一次导出, 内存占用不超过用户数乘以单个导出包的大小
+type Handler struct {
+	key   []byte
+	ttl   time.Duration
+	users user.UserServiceClient
+	tasks task.TaskServiceClient
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	// latest 每个用户最近一次导出的任务, 未完成时不创建新的导出
+	latest map[int]string
+
+	sem  chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewHandler(conf config.Export, users user.UserServiceClient, tasks task.TaskServiceClient) *Handler {
+	key := []byte(conf.LinkKey)
+	if len(key) == 0 {
+		log.Printf("Export link key is not configured, using a random key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	h := &Handler{
+		key:    key,
+		ttl:    ttl,
+		users:  users,
+		tasks:  tasks,
+		jobs:   make(map[string]*job),
+		latest: make(map[int]string),
+		sem:    make(chan struct{}, maxRunning),
+		done:   make(chan struct{}),
+	}
+	h.wg.Add(1)
+	go h.clean()
+
+	return h
+}
+
+// Prefix 需要同时挂载到 Prefix 与 Prefix + "/" 下
+func (h *Handler) Prefix() string {
+	return prefix
+}
+
+// PublicPaths 下载链接自带签名, 不需要登录
+func (h *Handler) PublicPaths() []string {
+	return []string{downloadPath}
+}
+
+// Close 停止清理协程并等待正在执行的导出结束
+func (h *Handler) Close() {
+	close(h.done)
+	h.wg.Wait()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == downloadPath {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.download(w, r)
+		return
+	}
+
+	userId, _ := r.Context().Value("user_id").(string)
+	uid, _ := strconv.Atoi(userId)
+	if uid == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	switch {
+	case strings.Contains(id, "/"):
+		http.NotFound(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		h.create(w, uid)
+	case id != "" && r.Method == http.MethodGet:
+		h.status(w, uid, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// create 创建导出任务, 用户已有未完成的任务时直接返回该任务, 否则替换用户之前的导出
+func (h *Handler) create(w http.ResponseWriter, uid int) {
+	h.mu.Lock()
+	if prev, ok := h.jobs[h.latest[uid]]; ok && (prev.status == StatusPending || prev.status == StatusRunning) {
+		j := h.view(prev)
+		h.mu.Unlock()
+		writeJSON(w, http.StatusAccepted, j)
+		return
+	}
+
+	id, err := randomString(16)
+	if err != nil {
+		h.mu.Unlock()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	j := &job{id: id, userId: uid, status: StatusPending, createdAt: time.Now()}
+	delete(h.jobs, h.latest[uid])
+	h.jobs[id] = j
+	h.latest[uid] = id
+	res := h.view(j)
+	h.mu.Unlock()
+
+	h.wg.Add(1)
+	go h.run(j)
+
+	writeJSON(w, http.StatusAccepted, res)
+}
+
+// status 只能查询自己的任务, 其他用户的任务与不存在的任务一样返回 404
+func (h *Handler) status(w http.ResponseWriter, uid int, id string) {
+	h.mu.Lock()
+	j, ok := h.jobs[id]
+	if !ok || j.userId != uid {
+		h.mu.Unlock()
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	res := h.view(j)
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) download(w http.ResponseWriter, r *http.Request) {
+	id, err := verifyLink(h.key, r.URL.Query().Get("token"), time.Now())
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	h.mu.Lock()
+	j, ok := h.jobs[id]
+	var data []byte
+	if ok && j.status == StatusReady {
+		data = j.data
+	}
+	h.mu.Unlock()
+	if data == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="todolist-export-`+j.createdAt.Format("20060102")+`.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// run 排队等待执行, 完成或失败后释放用户的任务
+func (h *Handler) run(j *job) {
+	defer h.wg.Done()
+	select {
+	case h.sem <- struct{}{}:
+	case <-h.done:
+		h.finish(j, nil, errors.New("server is shutting down"))
+		return
+	}
+	defer func() { <-h.sem }()
+
+	h.mu.Lock()
+	j.status = StatusRunning
+	h.mu.Unlock()
+
+	data, err := h.collect(j.userId)
+	if err != nil {
+		log.Printf("export for user %d failed: %s", j.userId, err)
+	}
+	h.finish(j, data, err)
+}
+
+func (h *Handler) finish(j *job, data []byte, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	j.expiresAt = time.Now().Add(h.ttl)
+	if err != nil {
+		j.status = StatusFailed
+		j.err = "export failed, please try again later"
+		return
+	}
+	j.status = StatusReady
+	j.data = data
+}
+
+// clean 定期删除过期的导出文件
+func (h *Handler) clean() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(cleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			h.mu.Lock()
+			for id, j := range h.jobs {
+				if !j.expiresAt.IsZero() && now.After(j.expiresAt) {
+					delete(h.jobs, id)
+					if h.latest[j.userId] == id {
+						delete(h.latest, j.userId)
+					}
+				}
+			}
+			h.mu.Unlock()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// view 调用方需要持有锁
+func (h *Handler) view(j *job) Job {
+	res := Job{
+		Id:        j.id,
+		Status:    j.status,
+		Error:     j.err,
+		CreatedAt: j.createdAt.Format(time.DateTime),
+	}
+	if !j.expiresAt.IsZero() {
+		res.ExpiresAt = j.expiresAt.Format(time.DateTime)
+	}
+	if j.status == StatusReady {
+		res.DownloadURL = downloadPath + "?" + url.Values{"token": {signLink(h.key, j.id, j.expiresAt)}}.Encode()
+	}
+
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
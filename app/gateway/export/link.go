@@ -0,0 +1,58 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidLink = errors.New("invalid or expired download link")
+
+// signLink 下载令牌为 {任务 id}.{过期时间}.{签名}, 任务 id 本身是随机字符串
+func signLink(key []byte, id string, expiresAt time.Time) string {
+	value := id + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return value + "." + base64.RawURLEncoding.EncodeToString(sign(key, value))
+}
+
+// verifyLink 校验签名与有效期, 返回任务 id
+func verifyLink(key []byte, token string, now time.Time) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", errInvalidLink
+	}
+	value, sig := token[:i], token[i+1:]
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, sign(key, value)) {
+		return "", errInvalidLink
+	}
+
+	id, exp, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", errInvalidLink
+	}
+	expire, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || expire < now.Unix() {
+		return "", errInvalidLink
+	}
+
+	return id, nil
+}
+
+func sign(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -2,21 +2,16 @@ module github.com/crazyfrankie/todolist/app/gateway
 
 go 1.23.6
 
-replace (
-	github.com/crazyfrankie/todolist/app/task => ../task
-	github.com/crazyfrankie/todolist/app/user => ../user
-
-)
+replace github.com/crazyfrankie/todolist/app/common => ../common
 
 require (
-	github.com/crazyfrankie/otelgrpcgw v0.1.2
-	github.com/crazyfrankie/todolist/app/task v0.0.0-00010101000000-000000000000
-	github.com/crazyfrankie/todolist/app/user v0.0.0-00010101000000-000000000000
+	github.com/crazyfrankie/todolist/app/common v0.0.0-00010101000000-000000000000
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/grpc-ecosystem/go-grpc-middleware/v2 v2.3.0
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.26.3
 	go.etcd.io/etcd/client/v3 v3.5.18
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.59.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.60.0
 	go.opentelemetry.io/otel v1.35.0
 	go.opentelemetry.io/otel/exporters/zipkin v1.35.0
 	go.opentelemetry.io/otel/sdk v1.35.0
@@ -24,6 +19,7 @@ require (
 	go.uber.org/zap v1.27.0
 	google.golang.org/grpc v1.71.1
 	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -39,7 +35,6 @@ require (
 	go.etcd.io/etcd/api/v3 v3.5.18 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.5.18 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
-	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.60.0 // indirect
 	go.opentelemetry.io/otel/metric v1.35.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/net v0.37.0 // indirect
@@ -0,0 +1,155 @@
+package mws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessTokenPrefix 个人访问令牌的前缀, 与 JWT 区分
+const AccessTokenPrefix = "tdl_pat_"
+
+// AccessTokenInfo 用户服务校验个人访问令牌的结果
+type AccessTokenInfo struct {
+	Valid     bool
+	UserId    int
+	TokenId   int
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// VerifyFunc 向用户服务校验个人访问令牌
+type VerifyFunc func(ctx context.Context, token string) (AccessTokenInfo, error)
+
+// ScopeRule 路由需要的权限范围. Path 以 /* 结尾时匹配该前缀下的全部路径, 否则精确匹配;
+// GET 请求需要 Read, 其他方法需要 Write, 为空时不允许使用个人访问令牌
+type ScopeRule struct {
+	Path  string
+	Read  string
+	Write string
+}
+
+// requiredScope 按顺序查找第一条匹配的规则, ok 为 false 时不允许使用个人访问令牌
+func requiredScope(rules []ScopeRule, r *http.Request) (string, bool) {
+	for _, rule := range rules {
+		if !rule.match(r.URL.Path) {
+			continue
+		}
+		scope := rule.Write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = rule.Read
+		}
+		return scope, scope != ""
+	}
+
+	return "", false
+}
+
+func (r ScopeRule) match(path string) bool {
+	if base, ok := strings.CutSuffix(r.Path, "/*"); ok {
+		return path == base || strings.HasPrefix(path, base+"/")
+	}
+
+	return path == r.Path
+}
+
+// AccessTokenCache 缓存个人访问令牌的校验结果, 吊销最多延迟 ttl 生效.
+// 缓存以令牌的哈希为键, 不在内存中保留明文
+type AccessTokenCache struct {
+	verify VerifyFunc
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]accessTokenEntry
+	lastSweep time.Time
+}
+
+type accessTokenEntry struct {
+	info  AccessTokenInfo
+	until time.Time
+}
+
+func NewAccessTokenCache(verify VerifyFunc, ttl time.Duration) *AccessTokenCache {
+	return &AccessTokenCache{
+		verify:  verify,
+		ttl:     ttl,
+		entries: make(map[string]accessTokenEntry),
+	}
+}
+
+func (c *AccessTokenCache) Verify(ctx context.Context, token string) (AccessTokenInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.until) {
+		return e.info, nil
+	}
+
+	info, err := c.verify(ctx, token)
+	if err != nil {
+		return AccessTokenInfo{}, err
+	}
+	until := now.Add(c.ttl)
+	if info.Valid && info.ExpiresAt.Before(until) {
+		until = info.ExpiresAt
+	}
+
+	c.mu.Lock()
+	c.entries[key] = accessTokenEntry{info: info, until: until}
+	c.sweep(now)
+	c.mu.Unlock()
+
+	return info, nil
+}
+
+func (c *AccessTokenCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for k, e := range c.entries {
+		if !now.Before(e.until) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// authAccessToken 校验个人访问令牌与路由需要的权限范围, 令牌只代表用户, 没有会话
+func (a *AuthBuild) authAccessToken(w http.ResponseWriter, r *http.Request, token string) (*http.Request, bool) {
+	scope, ok := requiredScope(a.scopes, r)
+	if !ok || a.accessTokens == nil {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Forbidden"))
+		return nil, false
+	}
+
+	info, err := a.accessTokens.Verify(r.Context(), token)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Service Unavailable"))
+		return nil, false
+	}
+	if !info.Valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("Unauthorized"))
+		return nil, false
+	}
+	if !slices.Contains(info.Scopes, scope) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Forbidden"))
+		return nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), "user_id", strconv.Itoa(info.UserId))
+	return r.WithContext(ctx), true
+}
@@ -0,0 +1,144 @@
+package mws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testScopes = []ScopeRule{
+	{Path: "/api/tasks/calendar/*"},
+	{Path: "/api/tasks/*", Read: "tasks:read", Write: "tasks:write"},
+	{Path: "/api/user", Read: "user:read"},
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scope  string
+		ok     bool
+	}{
+		{http.MethodGet, "/api/tasks", "tasks:read", true},
+		{http.MethodHead, "/api/tasks/1", "tasks:read", true},
+		{http.MethodPost, "/api/tasks/1/complete", "tasks:write", true},
+		{http.MethodDelete, "/api/tasks/1", "tasks:write", true},
+		// 前缀按路径段匹配
+		{http.MethodGet, "/api/tasksx", "", false},
+		// 先匹配的规则优先, 日历令牌路由不允许使用个人访问令牌
+		{http.MethodGet, "/api/tasks/calendar", "", false},
+		{http.MethodPost, "/api/tasks/calendar/token", "", false},
+		// 精确匹配的规则不包含子路径
+		{http.MethodGet, "/api/user", "user:read", true},
+		{http.MethodGet, "/api/user/sessions", "", false},
+		// 只声明了读权限的路由不允许写
+		{http.MethodPut, "/api/user", "", false},
+		{http.MethodGet, "/api/admin/users", "", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		scope, ok := requiredScope(testScopes, r)
+		if scope != tt.scope || ok != tt.ok {
+			t.Errorf("%s %s = %q, %v, want %q, %v", tt.method, tt.path, scope, ok, tt.scope, tt.ok)
+		}
+	}
+}
+
+func TestAuthAccessToken(t *testing.T) {
+	infos := map[string]AccessTokenInfo{
+		"tdl_pat_read":    {Valid: true, UserId: 1, Scopes: []string{"tasks:read"}, ExpiresAt: time.Now().Add(time.Hour)},
+		"tdl_pat_write":   {Valid: true, UserId: 2, Scopes: []string{"tasks:write"}, ExpiresAt: time.Now().Add(time.Hour)},
+		"tdl_pat_revoked": {},
+	}
+	verify := func(ctx context.Context, token string) (AccessTokenInfo, error) {
+		if token == "tdl_pat_down" {
+			return AccessTokenInfo{}, errors.New("unavailable")
+		}
+		return infos[token], nil
+	}
+	a := NewAuthBuilder().AccessTokens(NewAccessTokenCache(verify, time.Minute), testScopes)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+		user   string
+	}{
+		{http.MethodGet, "/api/tasks", "tdl_pat_read", http.StatusOK, "1"},
+		// tasks:write 不包含 tasks:read
+		{http.MethodGet, "/api/tasks", "tdl_pat_write", http.StatusForbidden, ""},
+		{http.MethodPost, "/api/tasks", "tdl_pat_write", http.StatusOK, "2"},
+		{http.MethodPost, "/api/tasks", "tdl_pat_read", http.StatusForbidden, ""},
+		{http.MethodGet, "/api/user/sessions", "tdl_pat_read", http.StatusForbidden, ""},
+		{http.MethodGet, "/api/tasks", "tdl_pat_revoked", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/api/tasks", "tdl_pat_unknown", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/api/tasks", "tdl_pat_down", http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r, ok := a.authAccessToken(w, httptest.NewRequest(tt.method, tt.path, nil), tt.token)
+		if ok != (tt.status == http.StatusOK) {
+			t.Errorf("%s %s with %s: ok = %v, status %d", tt.method, tt.path, tt.token, ok, w.Code)
+			continue
+		}
+		if !ok {
+			if w.Code != tt.status {
+				t.Errorf("%s %s with %s: status = %d, want %d", tt.method, tt.path, tt.token, w.Code, tt.status)
+			}
+			continue
+		}
+		if got, _ := r.Context().Value("user_id").(string); got != tt.user {
+			t.Errorf("%s %s with %s: user_id = %q, want %q", tt.method, tt.path, tt.token, got, tt.user)
+		}
+	}
+}
+
+func TestAccessTokenCache(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	info := AccessTokenInfo{Valid: true, UserId: 1, Scopes: []string{"tasks:read"}}
+	verify := func(ctx context.Context, token string) (AccessTokenInfo, error) {
+		calls++
+		return info, nil
+	}
+
+	t.Run("cached until ttl", func(t *testing.T) {
+		calls = 0
+		info.ExpiresAt = time.Now().Add(time.Hour)
+		c := NewAccessTokenCache(verify, time.Minute)
+		for i := 0; i < 3; i++ {
+			if _, err := c.Verify(ctx, "tdl_pat_a"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("verify calls = %d, want 1", calls)
+		}
+		// 缓存以哈希为键, 不保留明文
+		for k := range c.entries {
+			if k == "tdl_pat_a" {
+				t.Error("cache key is the plaintext token")
+			}
+		}
+	})
+
+	t.Run("not cached past expiry", func(t *testing.T) {
+		calls = 0
+		info.ExpiresAt = time.Now().Add(-time.Second)
+		c := NewAccessTokenCache(verify, time.Minute)
+		for i := 0; i < 2; i++ {
+			if _, err := c.Verify(ctx, "tdl_pat_b"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("verify calls = %d, want 2", calls)
+		}
+	})
+}
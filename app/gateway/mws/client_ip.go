@@ -0,0 +1,80 @@
+package mws
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies 部署在网关之前的反向代理, 只有来自这些地址的请求才读取转发头部
+var trustedProxies []*net.IPNet
+
+// TrustProxies 设置可信的反向代理, 每项为 IP 或 CIDR, 在开始处理请求之前调用.
+// 网关直接对外时不要配置, 否则客户端可以通过转发头部伪造来源 IP
+func TrustProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+
+	return nil
+}
+
+// ClientIP 返回请求方 IP, 用于会话展示以及用户服务按 IP 限制登录尝试.
+// 默认使用连接的对端地址; 对端是可信代理时从 X-Forwarded-For 的末尾向前跳过可信代理,
+// 取第一个不可信的地址, 没有 X-Forwarded-For 时使用 X-Real-IP
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !trusted(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !trusted(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+
+	return ip
+}
+
+func trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package mws
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownKey      = errors.New("unknown signing key")
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+)
+
+// minRefetch 遇到未知 kid 时重新获取公钥的最短间隔, 避免伪造的令牌频繁触发请求
+const minRefetch = 10 * time.Second
+
+// JWK 用户服务发布的公钥
+type JWK struct {
+	Kty string
+	Kid string
+	Alg string
+	Crv string
+	X   string
+	N   string
+	E   string
+}
+
+// FetchKeysFunc 从用户服务获取当前全部公钥
+type FetchKeysFunc func(ctx context.Context) ([]JWK, error)
+
+type verifyKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// KeySet 缓存校验访问令牌的公钥. 缓存每 refresh 更新一次, 遇到未知的 kid 时立即更新,
+// 因此用户服务轮换密钥后不需要重新部署网关. 获取失败时继续使用之前的公钥
+type KeySet struct {
+	fetch   FetchKeysFunc
+	refresh time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]verifyKey
+	fetchedAt time.Time
+
+	// fetchMu 保证同一时间只有一个请求在获取公钥
+	fetchMu   sync.Mutex
+	attempted time.Time
+}
+
+func NewKeySet(fetch FetchKeysFunc, refresh time.Duration) *KeySet {
+	return &KeySet{fetch: fetch, refresh: refresh}
+}
+
+// Key 返回 kid 对应的公钥与签名算法
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, string, error) {
+	s.mu.RLock()
+	k, ok := s.keys[kid]
+	fresh := time.Since(s.fetchedAt) < s.refresh
+	s.mu.RUnlock()
+	if ok && fresh {
+		return k.key, k.alg, nil
+	}
+
+	err := s.update(ctx, !ok)
+	s.mu.RLock()
+	k, ok = s.keys[kid]
+	s.mu.RUnlock()
+	switch {
+	case ok:
+		return k.key, k.alg, nil
+	case err != nil:
+		return nil, "", fmt.Errorf("%w: %w", ErrKeysUnavailable, err)
+	default:
+		return nil, "", ErrUnknownKey
+	}
+}
+
+// update 重新获取公钥, missing 表示因为未知的 kid 触发, 需要受 minRefetch 限制
+func (s *KeySet) update(ctx context.Context, missing bool) error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// 等待期间其他请求已经更新过
+	s.mu.RLock()
+	fresh := time.Since(s.fetchedAt) < s.refresh
+	s.mu.RUnlock()
+	if (fresh && !missing) || time.Since(s.attempted) < minRefetch {
+		return nil
+	}
+	s.attempted = time.Now()
+
+	jwks, err := s.fetch(ctx)
+	if err != nil {
+		log.Printf("failed to fetch signing keys: %s", err)
+		return err
+	}
+	keys := make(map[string]verifyKey, len(jwks))
+	for _, j := range jwks {
+		k, err := parseJWK(j)
+		if err != nil {
+			log.Printf("skipping signing key %s: %s", j.Kid, err)
+			continue
+		}
+		keys[j.Kid] = k
+	}
+
+	s.mu.Lock()
+	s.keys, s.fetchedAt = keys, time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+func parseJWK(j JWK) (verifyKey, error) {
+	switch {
+	case j.Kty == "OKP" && j.Crv == "Ed25519" && j.Alg == "EdDSA":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verifyKey{}, errors.New("invalid Ed25519 public key")
+		}
+		return verifyKey{alg: j.Alg, key: ed25519.PublicKey(x)}, nil
+	// 部分身份提供方发布的 RSA 公钥没有 alg, 按 RS256 处理
+	case j.Kty == "RSA" && (j.Alg == "RS256" || j.Alg == ""):
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return verifyKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return verifyKey{}, errors.New("invalid RSA exponent")
+		}
+		return verifyKey{alg: "RS256", key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	default:
+		return verifyKey{}, fmt.Errorf("unsupported key type %s/%s", j.Kty, j.Alg)
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var (
-	SecretKey = []byte("sD4pP0qA8sO6fZ2fF9iZ5lN9nM1rF3vL")
-)
-
 type AuthBuild struct {
-	paths map[string]struct{}
+	paths      map[string]struct{}
+	keys       *KeySet
+	revocation *RevocationCache
+	sessions   *SessionTracker
+	// accessTokens 为 nil 时不接受个人访问令牌
+	accessTokens *AccessTokenCache
+	scopes       []ScopeRule
+	roles        []RoleRule
 }
 
 func NewAuthBuilder() *AuthBuild {
@@ -27,6 +30,31 @@ func (a *AuthBuild) IgnorePath(path string) *AuthBuild {
 	return a
 }
 
+// Keys 设置校验令牌签名的公钥, 未设置时拒绝全部令牌
+func (a *AuthBuild) Keys(k *KeySet) *AuthBuild {
+	a.keys = k
+	return a
+}
+
+// Revocation 设置吊销检查, 未设置时只校验令牌签名与有效期
+func (a *AuthBuild) Revocation(c *RevocationCache) *AuthBuild {
+	a.revocation = c
+	return a
+}
+
+// Sessions 设置会话活动的记录
+func (a *AuthBuild) Sessions(t *SessionTracker) *AuthBuild {
+	a.sessions = t
+	return a
+}
+
+// AccessTokens 接受通过 Authorization: Bearer 传入的个人访问令牌, 只能访问 rules 中声明了权限范围的路由
+func (a *AuthBuild) AccessTokens(c *AccessTokenCache, rules []ScopeRule) *AuthBuild {
+	a.accessTokens = c
+	a.scopes = rules
+	return a
+}
+
 func (a *AuthBuild) Auth(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if _, ok := a.paths[r.URL.Path]; ok {
@@ -34,6 +62,15 @@ func (a *AuthBuild) Auth(next http.Handler) http.HandlerFunc {
 			return
 		}
 
+		// 个人访问令牌不是 JWT, 按前缀区分
+		if token := extractToken(r.Header.Get("Authorization")); strings.HasPrefix(token, AccessTokenPrefix) {
+			r, ok := a.authAccessToken(w, r, token)
+			if ok {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
 		cookie, err := r.Cookie("todolist_auth")
 
 		var token string
@@ -44,7 +81,12 @@ func (a *AuthBuild) Auth(next http.Handler) http.HandlerFunc {
 			token = extractToken(tokenHeader)
 		}
 
-		claims, err := parseToken(token)
+		claims, err := a.parseToken(r.Context(), token)
+		if errors.Is(err, ErrKeysUnavailable) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("Service Unavailable"))
+			return
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			_, _ = w.Write([]byte("Unauthorized"))
@@ -59,8 +101,48 @@ func (a *AuthBuild) Auth(next http.Handler) http.HandlerFunc {
 		}
 
 		userId := claims["user_id"].(float64)
+		jti, _ := claims["jti"].(string)
+		session, _ := claims["sid"].(string)
+		if a.revocation != nil {
+			generation, _ := claims["gen"].(float64)
+			expire, _ := claims.GetExpirationTime()
+			// 没有 jti 的令牌无法吊销, 不再接受
+			if jti == "" || expire == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("Unauthorized"))
+				return
+			}
+			valid, err := a.revocation.Valid(r.Context(), int(userId), jti, session, int64(generation), expire.Time)
+			if err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("Service Unavailable"))
+				return
+			}
+			if !valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("Unauthorized"))
+				return
+			}
+		}
+
+		if !a.allowed(r, claims) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Forbidden"))
+			return
+		}
+
+		if a.sessions != nil {
+			a.sessions.Seen(int(userId), session, ClientIP(r))
+		}
+
 		uid := strconv.FormatFloat(userId, 'f', 0, 64)
-		r = r.WithContext(context.WithValue(r.Context(), "user_id", uid))
+		ctx := context.WithValue(r.Context(), "user_id", uid)
+		ctx = context.WithValue(ctx, "token_id", jti)
+		ctx = context.WithValue(ctx, "session_id", session)
+		if impersonator := actor(claims); impersonator != "" {
+			ctx = context.WithValue(ctx, "impersonator_id", impersonator)
+		}
+		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	}
@@ -71,18 +153,31 @@ func extractToken(token string) string {
 		return ""
 	}
 
-	strs := strings.Split(token, " ")
-	if strs[0] == "Bearer" {
-		return strs[1]
+	scheme, value, _ := strings.Cut(token, " ")
+	if scheme == "Bearer" {
+		return value
 	}
 
 	return ""
 }
 
-func parseToken(token string) (jwt.MapClaims, error) {
+func (a *AuthBuild) parseToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	if a.keys == nil {
+		return nil, errors.New("no signing keys configured")
+	}
+
 	tokenClaims, err := jwt.ParseWithClaims(token, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, alg, err := a.keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// 签名算法由公钥决定, 不信任令牌头部声明的算法
+		if token.Method.Alg() != alg {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
 	if err != nil {
 		return nil, err
 	}
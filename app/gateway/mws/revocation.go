@@ -0,0 +1,76 @@
+package mws
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CheckFunc 查询访问令牌是否仍然有效, 即令牌与所属会话都没有被吊销, 代数也不低于用户当前的令牌代数
+type CheckFunc func(ctx context.Context, uid int, jti, session string, generation int64) (bool, error)
+
+// RevocationCache 缓存令牌的检查结果, 避免每个请求都访问用户服务.
+// 有效的结果最多缓存 ttl, 因此吊销最多延迟 ttl 生效; 已吊销的令牌不会恢复, 缓存到令牌过期
+type RevocationCache struct {
+	check CheckFunc
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]revocationEntry
+	lastSweep time.Time
+}
+
+type revocationEntry struct {
+	valid bool
+	until time.Time
+}
+
+func NewRevocationCache(check CheckFunc, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		check:   check,
+		ttl:     ttl,
+		entries: make(map[string]revocationEntry),
+	}
+}
+
+// Valid 判断令牌是否有效, expire 为令牌的过期时间
+func (c *RevocationCache) Valid(ctx context.Context, uid int, jti, session string, generation int64, expire time.Time) (bool, error) {
+	key := strconv.Itoa(uid) + ":" + jti
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.until) {
+		return e.valid, nil
+	}
+
+	valid, err := c.check(ctx, uid, jti, session, generation)
+	if err != nil {
+		return false, err
+	}
+	until := now.Add(c.ttl)
+	if !valid || expire.Before(until) {
+		until = expire
+	}
+
+	c.mu.Lock()
+	c.entries[key] = revocationEntry{valid: valid, until: until}
+	c.sweep(now)
+	c.mu.Unlock()
+
+	return valid, nil
+}
+
+func (c *RevocationCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for k, e := range c.entries {
+		if !now.Before(e.until) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mws
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionSeen 一个会话在上报周期内最后一次出现的时间与 IP
+type SessionSeen struct {
+	UserId  int
+	Session string
+	Ip      string
+	SeenAt  int64
+}
+
+// SessionTracker 在内存中汇总会话活动, 由后台协程定期批量上报, 不增加请求延迟.
+// 同一会话在一个周期内只保留最后一次活动
+type SessionTracker struct {
+	flush    func([]SessionSeen)
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[string]SessionSeen
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewSessionTracker(flush func([]SessionSeen), interval time.Duration) *SessionTracker {
+	t := &SessionTracker{
+		flush:    flush,
+		interval: interval,
+		seen:     make(map[string]SessionSeen),
+		done:     make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run()
+
+	return t
+}
+
+func (t *SessionTracker) Seen(uid int, session, ip string) {
+	if session == "" {
+		return
+	}
+	t.mu.Lock()
+	t.seen[session] = SessionSeen{UserId: uid, Session: session, Ip: ip, SeenAt: time.Now().Unix()}
+	t.mu.Unlock()
+}
+
+// Close 停止后台协程并上报剩余的活动
+func (t *SessionTracker) Close() {
+	close(t.done)
+	t.wg.Wait()
+}
+
+func (t *SessionTracker) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.report()
+		case <-t.done:
+			t.report()
+			return
+		}
+	}
+}
+
+func (t *SessionTracker) report() {
+	t.mu.Lock()
+	if len(t.seen) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	batch := make([]SessionSeen, 0, len(t.seen))
+	for _, s := range t.seen {
+		batch = append(batch, s)
+	}
+	t.seen = make(map[string]SessionSeen)
+	t.mu.Unlock()
+
+	t.flush(batch)
+}
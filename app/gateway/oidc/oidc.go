@@ -0,0 +1,323 @@
+// Package oidc 实现外部身份提供方登录的授权码流程 (Authorization Code + PKCE).
+// 网关负责跳转、换取与校验 ID Token, 账号的登录与关联由用户服务完成
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/crazyfrankie/todolist/app/gateway/config"
+)
+
+// prefix 登录入口为 {prefix}{provider}/login, 关联入口为 {prefix}{provider}/link, 回调为 {prefix}{provider}/callback
+const prefix = "/api/auth/oidc/"
+
+// Identity 校验 ID Token 后得到的外部身份
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// LinkUserId 不为 0 时把身份关联到该用户
+	LinkUserId int
+}
+
+// Result 登录结果, 账号开启了两步验证时只有 Challenge, 关联时都为空
+type Result struct {
+	Access    string
+	Refresh   string
+	Challenge string
+}
+
+// Error 登录失败的原因, Code 作为 error 参数传给错误页
+type Error struct {
+	Code string
+}
+
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// LoginFunc 使用外部身份登录或关联账号
+type LoginFunc func(r *http.Request, id Identity) (Result, error)
+
+// TokenFunc 登录成功后写入令牌 Cookie
+type TokenFunc func(w http.ResponseWriter, access, refresh string)
+
+type Handler struct {
+	conf      config.OIDC
+	key       []byte
+	providers map[string]*provider
+	login     LoginFunc
+	setTokens TokenFunc
+}
+
+func NewHandler(conf config.OIDC, login LoginFunc, setTokens TokenFunc) *Handler {
+	key := []byte(conf.StateKey)
+	if len(key) == 0 {
+		log.Printf("OIDC state key is not configured, using a random key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	providers := make(map[string]*provider, len(conf.Providers))
+	for _, p := range conf.Providers {
+		providers[p.Name] = newProvider(p, client)
+	}
+
+	return &Handler{conf: conf, key: key, providers: providers, login: login, setTokens: setTokens}
+}
+
+// Prefix 需要挂载到该路径下
+func (h *Handler) Prefix() string {
+	return prefix
+}
+
+// PublicPaths 登录入口与回调不需要登录, 关联入口需要
+func (h *Handler) PublicPaths() []string {
+	paths := make([]string, 0, len(h.providers)*2)
+	for name := range h.providers {
+		paths = append(paths, prefix+name+"/login", prefix+name+"/callback")
+	}
+
+	return paths
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	p, ok := h.providers[name]
+	if !ok || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "login":
+		h.start(w, r, p, 0)
+	case "link":
+		userId, _ := r.Context().Value("user_id").(string)
+		uid, _ := strconv.Atoi(userId)
+		if uid == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("Unauthorized"))
+			return
+		}
+		// 模拟登录的管理员不能为用户关联登录方式
+		if impersonator, _ := r.Context().Value("impersonator_id").(string); impersonator != "" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Forbidden"))
+			return
+		}
+		h.start(w, r, p, uid)
+	case "callback":
+		h.callback(w, r, p)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// start 生成 state、nonce 与 PKCE 参数, 跳转到身份提供方的授权页面
+func (h *Handler) start(w http.ResponseWriter, r *http.Request, p *provider, linkUid int) {
+	meta, err := p.metadata(r.Context())
+	if err != nil {
+		log.Printf("OIDC discovery for %s failed: %s", p.conf.Name, err)
+		h.fail(w, r, "provider_unavailable")
+		return
+	}
+	f, err := newFlow(p.conf.Name, linkUid)
+	if err != nil {
+		h.fail(w, r, "server_error")
+		return
+	}
+	if err := setFlowCookie(w, h.key, f); err != nil {
+		h.fail(w, r, "server_error")
+		return
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.conf.ClientID)
+	q.Set("redirect_uri", p.conf.RedirectURL)
+	q.Set("scope", strings.Join(p.conf.Scopes, " "))
+	q.Set("state", f.State)
+	q.Set("nonce", f.Nonce)
+	q.Set("code_challenge", f.challenge())
+	q.Set("code_challenge_method", "S256")
+
+	http.Redirect(w, r, appendQuery(meta.AuthorizationEndpoint, q), http.StatusFound)
+}
+
+func (h *Handler) callback(w http.ResponseWriter, r *http.Request, p *provider) {
+	// 流程状态只能使用一次
+	clearFlowCookie(w)
+
+	q := r.URL.Query()
+	f, err := readFlow(r, h.key, p.conf.Name, q.Get("state"))
+	if err != nil {
+		h.fail(w, r, "invalid_state")
+		return
+	}
+	if q.Get("error") != "" {
+		h.fail(w, r, "access_denied")
+		return
+	}
+
+	id, err := h.exchange(r.Context(), p, q.Get("code"), f)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %s", p.conf.Name, err)
+		h.fail(w, r, "invalid_token")
+		return
+	}
+	id.LinkUserId = f.LinkUserId
+
+	res, err := h.login(r, id)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			h.fail(w, r, e.Code)
+			return
+		}
+		log.Printf("OIDC login with %s failed: %s", p.conf.Name, err)
+		h.fail(w, r, "server_error")
+		return
+	}
+
+	if res.Challenge != "" {
+		http.Redirect(w, r, appendQuery(h.conf.TwoFactorURL, url.Values{"challenge": {res.Challenge}}), http.StatusFound)
+		return
+	}
+	if res.Access != "" {
+		h.setTokens(w, res.Access, res.Refresh)
+	}
+	http.Redirect(w, r, h.conf.SuccessURL, http.StatusFound)
+}
+
+// exchange 使用授权码与 code_verifier 换取 ID Token 并校验
+func (h *Handler) exchange(ctx context.Context, p *provider, code string, f flow) (Identity, error) {
+	if code == "" {
+		return Identity{}, errors.New("missing authorization code")
+	}
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.conf.RedirectURL)
+	form.Set("code_verifier", f.Verifier)
+	if p.conf.ClientSecret == "" {
+		form.Set("client_id", p.conf.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.conf.ClientSecret != "" {
+		// client_secret_basic, 用户名与密码需要先进行表单编码 (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IdToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Identity{}, err
+	}
+	if resp.StatusCode != http.StatusOK || body.IdToken == "" {
+		return Identity{}, fmt.Errorf("token endpoint: %s %s", resp.Status, body.Error)
+	}
+
+	return h.verify(ctx, p, meta, body.IdToken, f.Nonce)
+}
+
+// verify 校验 ID Token 的签名、issuer、audience、有效期与 nonce
+func (h *Handler) verify(ctx context.Context, p *provider, meta *metadata, raw, nonce string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, alg, err := p.keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != alg {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.conf.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return Identity{}, errors.New("nonce mismatch")
+	}
+	// 有多个 audience 时 azp 必须是本客户端 (OpenID Connect Core 3.1.3.7)
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.conf.ClientID {
+			return Identity{}, errors.New("azp mismatch")
+		}
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return Identity{}, errors.New("missing subject")
+	}
+
+	id := Identity{Provider: p.conf.Name, Subject: sub}
+	id.Email, _ = claims["email"].(string)
+	// email_verified 部分身份提供方返回字符串
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	if id.Name, _ = claims["preferred_username"].(string); id.Name == "" {
+		id.Name, _ = claims["name"].(string)
+	}
+
+	return id, nil
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, appendQuery(h.conf.ErrorURL, url.Values{"error": {code}}), http.StatusFound)
+}
+
+func appendQuery(base string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+
+	return base + sep + q.Encode()
+}
@@ -0,0 +1,365 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/crazyfrankie/todolist/app/gateway/config"
+)
+
+const (
+	testClientID   = "todolist"
+	testSecret     = "client-secret"
+	testSuccessURL = "https://app.example/"
+	testErrorURL   = "https://app.example/login"
+)
+
+// issuer 模拟身份提供方, 提供发现文档、JWKS 与令牌端点.
+// 授权端点不需要真实实现, 测试直接调用 authorize 签发授权码
+type issuer struct {
+	t   *testing.T
+	srv *httptest.Server
+	key ed25519.PrivateKey
+
+	mu sync.Mutex
+	// codes 授权码对应的授权请求
+	codes map[string]url.Values
+	// claims 修改签发的 ID Token, 用于构造异常的令牌
+	claims func(jwt.MapClaims)
+	// exchanged 令牌端点收到的换取请求数
+	exchanged int
+}
+
+func newIssuer(t *testing.T) *issuer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := &issuer{t: t, key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 is.srv.URL,
+			"authorization_endpoint": is.srv.URL + "/authorize",
+			"token_endpoint":         is.srv.URL + "/token",
+			"jwks_uri":               is.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"alg": "EdDSA",
+			"use": "sig",
+			"kid": "test",
+			"x":   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		}}})
+	})
+	mux.HandleFunc("/token", is.token)
+	is.srv = httptest.NewServer(mux)
+	t.Cleanup(is.srv.Close)
+
+	return is
+}
+
+// authorize 模拟用户在身份提供方同意授权, 返回授权码
+func (is *issuer) authorize(auth url.Values) string {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	code := "code-" + auth.Get("state")
+	is.codes[code] = auth
+
+	return code
+}
+
+// token 校验客户端凭证、授权码与 PKCE 的 code_verifier 后签发 ID Token
+func (is *issuer) token(w http.ResponseWriter, r *http.Request) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.exchanged++
+
+	user, pass, _ := r.BasicAuth()
+	if user != testClientID || pass != testSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	auth, ok := is.codes[r.PostFormValue("code")]
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != auth.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if auth.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            is.srv.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	if is.claims != nil {
+		is.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "test"
+	raw, err := token.SignedString(is.key)
+	if err != nil {
+		is.t.Error(err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": raw, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type testEnv struct {
+	issuer  *issuer
+	handler *Handler
+	// identities 传给 LoginFunc 的外部身份
+	identities []Identity
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{issuer: newIssuer(t)}
+	env.handler = NewHandler(config.OIDC{
+		StateKey:   "0123456789abcdef0123456789abcdef",
+		SuccessURL: testSuccessURL,
+		ErrorURL:   testErrorURL,
+		Providers: []config.OIDCProvider{{
+			Name:         "mock",
+			Issuer:       env.issuer.srv.URL,
+			ClientID:     testClientID,
+			ClientSecret: testSecret,
+			RedirectURL:  "https://app.example/api/auth/oidc/mock/callback",
+		}},
+	}, func(r *http.Request, id Identity) (Result, error) {
+		env.identities = append(env.identities, id)
+		return Result{Access: "access", Refresh: "refresh"}, nil
+	}, func(w http.ResponseWriter, access, refresh string) {})
+
+	return env
+}
+
+// start 发起登录, 返回跳转到授权端点的参数与流程 Cookie
+func (env *testEnv) start(t *testing.T) (url.Values, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	env.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, prefix+"mock/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", w.Code, http.StatusFound)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != env.issuer.srv.URL+"/authorize" {
+		t.Fatalf("redirected to %s, want the authorization endpoint", got)
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == stateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("flow cookie is not set")
+	}
+
+	return loc.Query(), cookie
+}
+
+// callback 模拟身份提供方跳转回网关, 返回网关跳转的地址
+func (env *testEnv) callback(t *testing.T, query url.Values, cookie *http.Cookie) *url.URL {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, prefix+"mock/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	env.handler.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback status = %d, want %d", w.Code, http.StatusFound)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
+
+// login 完成一次完整的登录流程
+func (env *testEnv) login(t *testing.T) *url.URL {
+	t.Helper()
+	auth, cookie := env.start(t)
+	code := env.issuer.authorize(auth)
+
+	return env.callback(t, url.Values{"code": {code}, "state": {auth.Get("state")}}, cookie)
+}
+
+func assertSuccess(t *testing.T, loc *url.URL) {
+	t.Helper()
+	if loc.String() != testSuccessURL {
+		t.Fatalf("redirected to %s, want %s", loc, testSuccessURL)
+	}
+}
+
+func assertError(t *testing.T, loc *url.URL, code string) {
+	t.Helper()
+	if !strings.HasPrefix(loc.String(), testErrorURL+"?") || loc.Query().Get("error") != code {
+		t.Fatalf("redirected to %s, want error %s", loc, code)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	env := newTestEnv(t)
+	assertSuccess(t, env.login(t))
+
+	if len(env.identities) != 1 {
+		t.Fatalf("login called %d times, want 1", len(env.identities))
+	}
+	want := Identity{Provider: "mock", Subject: "subject-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if env.identities[0] != want {
+		t.Fatalf("identity = %+v, want %+v", env.identities[0], want)
+	}
+}
+
+func TestStateMismatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	t.Run("wrong state", func(t *testing.T) {
+		auth, cookie := env.start(t)
+		code := env.issuer.authorize(auth)
+		assertError(t, env.callback(t, url.Values{"code": {code}, "state": {"forged"}}, cookie), "invalid_state")
+	})
+	t.Run("missing cookie", func(t *testing.T) {
+		auth, _ := env.start(t)
+		code := env.issuer.authorize(auth)
+		assertError(t, env.callback(t, url.Values{"code": {code}, "state": {auth.Get("state")}}, nil), "invalid_state")
+	})
+	t.Run("tampered cookie", func(t *testing.T) {
+		auth, cookie := env.start(t)
+		code := env.issuer.authorize(auth)
+		value, sig, _ := strings.Cut(cookie.Value, ".")
+		payload, _ := base64.RawURLEncoding.DecodeString(value)
+		var f flow
+		_ = json.Unmarshal(payload, &f)
+		f.LinkUserId = 1
+		payload, _ = json.Marshal(f)
+		cookie.Value = base64.RawURLEncoding.EncodeToString(payload) + "." + sig
+		assertError(t, env.callback(t, url.Values{"code": {code}, "state": {auth.Get("state")}}, cookie), "invalid_state")
+	})
+
+	if env.issuer.exchanged != 0 {
+		t.Fatalf("token endpoint called %d times with an invalid state", env.issuer.exchanged)
+	}
+	if len(env.identities) != 0 {
+		t.Fatalf("login called with an invalid state")
+	}
+}
+
+func TestNonceMismatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		env.issuer.claims = func(c jwt.MapClaims) { c["nonce"] = "replayed" }
+		assertError(t, env.login(t), "invalid_token")
+	})
+	t.Run("missing nonce", func(t *testing.T) {
+		env.issuer.claims = func(c jwt.MapClaims) { delete(c, "nonce") }
+		assertError(t, env.login(t), "invalid_token")
+	})
+
+	if len(env.identities) != 0 {
+		t.Fatalf("login called with a nonce mismatch")
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	env := newTestEnv(t)
+
+	t.Run("challenge", func(t *testing.T) {
+		auth, _ := env.start(t)
+		if auth.Get("code_challenge_method") != "S256" {
+			t.Fatalf("code_challenge_method = %q, want S256", auth.Get("code_challenge_method"))
+		}
+		if len(auth.Get("code_challenge")) != base64.RawURLEncoding.EncodedLen(sha256.Size) {
+			t.Fatalf("code_challenge = %q is not a SHA-256 digest", auth.Get("code_challenge"))
+		}
+	})
+	// 授权码被注入到另一个浏览器的流程中时, 该流程的 code_verifier 与授权码的 code_challenge 不一致
+	t.Run("injected code", func(t *testing.T) {
+		victim, _ := env.start(t)
+		code := env.issuer.authorize(victim)
+		attacker, cookie := env.start(t)
+		assertError(t, env.callback(t, url.Values{"code": {code}, "state": {attacker.Get("state")}}, cookie), "invalid_token")
+	})
+
+	if len(env.identities) != 0 {
+		t.Fatalf("login called with a wrong code_verifier")
+	}
+}
+
+func TestAudience(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		ok     bool
+	}{
+		{"other client", func(c jwt.MapClaims) { c["aud"] = "other" }, false},
+		{"multiple audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"} }, false},
+		{"multiple audiences with other azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other"}
+			c["azp"] = "other"
+		}, false},
+		{"multiple audiences with azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other"}
+			c["azp"] = testClientID
+		}, true},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, false},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.issuer.claims = tt.claims
+			loc := env.login(t)
+			if tt.ok {
+				assertSuccess(t, loc)
+				return
+			}
+			assertError(t, loc, "invalid_token")
+			if len(env.identities) != 0 {
+				t.Fatalf("login called with an invalid token")
+			}
+		})
+	}
+}
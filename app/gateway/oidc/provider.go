@@ -0,0 +1,119 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/gateway/config"
+	"github.com/crazyfrankie/todolist/app/gateway/mws"
+)
+
+// keyRefresh 身份提供方公钥的缓存时间, 遇到未知的 kid 时会提前更新
+const keyRefresh = time.Hour
+
+// metadata 身份提供方的发现文档中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type provider struct {
+	conf   config.OIDCProvider
+	client *http.Client
+	keys   *mws.KeySet
+
+	// 发现文档获取成功后缓存, 失败时下次请求重试
+	mu   sync.Mutex
+	meta *metadata
+}
+
+func newProvider(conf config.OIDCProvider, client *http.Client) *provider {
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "email", "profile"}
+	}
+	p := &provider{conf: conf, client: client}
+	p.keys = mws.NewKeySet(p.fetchKeys, keyRefresh)
+
+	return p
+}
+
+func (p *provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var m metadata
+	url := strings.TrimSuffix(p.conf.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, url, &m); err != nil {
+		return nil, err
+	}
+	// 发现文档中的 issuer 必须与配置一致 (OpenID Connect Discovery 4.3)
+	if m.Issuer != p.conf.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %s", m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document for %s", p.conf.Issuer)
+	}
+	p.meta = &m
+
+	return p.meta, nil
+}
+
+func (p *provider) fetchKeys(ctx context.Context) ([]mws.JWK, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, m.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make([]mws.JWK, 0, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		keys = append(keys, mws.JWK{Kty: k.Kty, Kid: k.Kid, Alg: k.Alg, Crv: k.Crv, X: k.X, N: k.N, E: k.E})
+	}
+
+	return keys, nil
+}
+
+func (p *provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
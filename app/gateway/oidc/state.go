@@ -0,0 +1,128 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	stateCookie = "todolist_oidc"
+	// flowTTL 从跳转到身份提供方到回调的最长时间
+	flowTTL = 10 * time.Minute
+)
+
+var errInvalidState = errors.New("invalid or expired login state")
+
+// flow 一次授权流程的状态, 签名后保存在 Cookie 中, 回调时校验 state 与 nonce
+type flow struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	// Verifier PKCE 的 code_verifier, 换取令牌时提交
+	Verifier string `json:"v"`
+	// LinkUserId 不为 0 时把身份关联到该用户
+	LinkUserId int   `json:"l,omitempty"`
+	Expire     int64 `json:"e"`
+}
+
+func newFlow(provider string, linkUid int) (flow, error) {
+	f := flow{Provider: provider, LinkUserId: linkUid, Expire: time.Now().Add(flowTTL).Unix()}
+	for _, v := range []*string{&f.State, &f.Nonce, &f.Verifier} {
+		s, err := randomString(32)
+		if err != nil {
+			return flow{}, err
+		}
+		*v = s
+	}
+
+	return f, nil
+}
+
+// challenge PKCE 的 code_challenge, 使用 S256
+func (f flow) challenge() string {
+	sum := sha256.Sum256([]byte(f.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// setFlowCookie Cookie 限定在回调路径上, SameSite=Lax 以便身份提供方跳转回来时携带
+func setFlowCookie(w http.ResponseWriter, key []byte, f flow) error {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    value + "." + base64.RawURLEncoding.EncodeToString(sign(key, value)),
+		Path:     prefix,
+		MaxAge:   int(flowTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+func clearFlowCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Path:     prefix,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// readFlow 读取并校验 Cookie 中的流程状态, provider 与 state 必须与回调一致
+func readFlow(r *http.Request, key []byte, provider, state string) (flow, error) {
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		return flow{}, errInvalidState
+	}
+	value, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return flow{}, errInvalidState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, sign(key, value)) {
+		return flow{}, errInvalidState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return flow{}, errInvalidState
+	}
+
+	var f flow
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return flow{}, errInvalidState
+	}
+	if f.Provider != provider || f.Expire < time.Now().Unix() ||
+		!hmac.Equal([]byte(f.State), []byte(state)) {
+		return flow{}, errInvalidState
+	}
+
+	return f, nil
+}
+
+func sign(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type AccountRepo struct {
+	dao *dao.AccountDao
+}
+
+func NewAccountRepo(d *dao.AccountDao) *AccountRepo {
+	return &AccountRepo{dao: d}
+}
+
+func (r *AccountRepo) Purge(ctx context.Context, uid int, workspaceIds []int) (int64, error) {
+	return r.dao.Purge(ctx, uid, workspaceIds)
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type CalendarRepo struct {
+	dao *dao.CalendarDao
+}
+
+func NewCalendarRepo(d *dao.CalendarDao) *CalendarRepo {
+	return &CalendarRepo{dao: d}
+}
+
+func (r *CalendarRepo) SaveToken(ctx context.Context, uid int, hash string) error {
+	return r.dao.Upsert(ctx, uid, hash)
+}
+
+func (r *CalendarRepo) RevokeToken(ctx context.Context, uid int) error {
+	return r.dao.DeleteByUid(ctx, uid)
+}
+
+func (r *CalendarRepo) FindByHash(ctx context.Context, hash string) (dao.CalendarToken, error) {
+	return r.dao.FindByHash(ctx, hash)
+}
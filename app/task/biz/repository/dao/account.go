@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// AccountDao 处理整个账号的数据
+type AccountDao struct {
+	db *gorm.DB
+}
+
+func NewAccountDao(db *gorm.DB) *AccountDao {
+	return &AccountDao{db: db}
+}
+
+// Purge 删除用户的个人数据与 workspaceIds 中工作区的任务与项目, 返回删除的任务数. 重复调用是安全的.
+// 用户在其他工作区中创建的任务与项目属于工作区成员共享, 保留不删除, 指派给用户的任务改为未指派
+func (d *AccountDao) Purge(ctx context.Context, uid int, workspaceIds []int) (int64, error) {
+	var tasks int64
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		owned := func(db *gorm.DB) *gorm.DB {
+			personal := db.Where("user_id = ? AND workspace_id = 0", uid)
+			if len(workspaceIds) == 0 {
+				return personal
+			}
+			return personal.Or("workspace_id IN ?", workspaceIds)
+		}
+		session := func() *gorm.DB { return tx.Session(&gorm.Session{NewDB: true}) }
+
+		templates := session().Model(&TaskTemplate{}).Select("id").Where("user_id = ?", uid)
+		if err := tx.Where("template_id IN (?)", templates).Delete(&TemplateItem{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&TaskTemplate{}, &TaskStat{}, &SavedFilter{}, &CalendarToken{}} {
+			if err := tx.Where("user_id = ?", uid).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		ids := session().Model(&Task{}).Select("id").Scopes(owned)
+		if err := tx.Where("task_id IN (?)", ids).Delete(&TaskLabel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR task_id IN (?)", uid, ids).Delete(&TimeEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Scopes(owned).Delete(&Project{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Task{}).Where("assignee_id = ?", uid).UpdateColumn("assignee_id", 0).Error; err != nil {
+			return err
+		}
+
+		res := tx.Scopes(owned).Delete(&Task{})
+		tasks = res.RowsAffected
+		return res.Error
+	})
+
+	return tasks, err
+}
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CalendarToken 日历订阅令牌, 只保存令牌的哈希值
+type CalendarToken struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"uniqueIndex"`
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	Ctime     int64
+	Utime     int64
+}
+
+type CalendarDao struct {
+	db *gorm.DB
+}
+
+func NewCalendarDao(db *gorm.DB) *CalendarDao {
+	return &CalendarDao{db: db}
+}
+
+// Upsert 每个用户只保留一个令牌, 重新生成会使旧令牌失效
+func (d *CalendarDao) Upsert(ctx context.Context, uid int, hash string) error {
+	now := time.Now().Unix()
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{"token_hash": hash, "utime": now}),
+	}).Create(&CalendarToken{
+		UserId:    uid,
+		TokenHash: hash,
+		Ctime:     now,
+		Utime:     now,
+	}).Error
+}
+
+func (d *CalendarDao) DeleteByUid(ctx context.Context, uid int) error {
+	return d.db.WithContext(ctx).Where("user_id = ?", uid).Delete(&CalendarToken{}).Error
+}
+
+func (d *CalendarDao) FindByHash(ctx context.Context, hash string) (CalendarToken, error) {
+	var t CalendarToken
+	err := d.db.WithContext(ctx).Model(&CalendarToken{}).Where("token_hash = ?", hash).First(&t).Error
+	if err != nil {
+		return CalendarToken{}, err
+	}
+
+	return t, nil
+}
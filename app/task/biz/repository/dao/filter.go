@@ -0,0 +1,238 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
+)
+
+// SavedFilter 用户保存的筛选表达式, 查询时再解析, 相对时间按查询时刻计算
+type SavedFilter struct {
+	Id     int    `gorm:"primaryKey,autoIncrement"`
+	UserId int    `gorm:"index"`
+	Name   string `gorm:"type:varchar(128)"`
+	Query  string `gorm:"type:varchar(1024)"`
+	Ctime  int64
+	Utime  int64
+}
+
+type FilterDao struct {
+	db *gorm.DB
+}
+
+func NewFilterDao(db *gorm.DB) *FilterDao {
+	return &FilterDao{db: db}
+}
+
+func (d *FilterDao) Create(ctx context.Context, f *SavedFilter) error {
+	now := time.Now().Unix()
+	f.Ctime = now
+	f.Utime = now
+
+	return d.db.WithContext(ctx).Create(f).Error
+}
+
+func (d *FilterDao) FindByUid(ctx context.Context, uid int) ([]*SavedFilter, error) {
+	var filters []*SavedFilter
+	err := d.db.WithContext(ctx).Model(&SavedFilter{}).Where("user_id = ?", uid).Order("id").Find(&filters).Error
+	if err != nil {
+		return []*SavedFilter{}, err
+	}
+
+	return filters, nil
+}
+
+func (d *FilterDao) FindById(ctx context.Context, uid, id int) (SavedFilter, error) {
+	var f SavedFilter
+	err := d.db.WithContext(ctx).Model(&SavedFilter{}).Where("id = ? AND user_id = ?", id, uid).First(&f).Error
+
+	return f, err
+}
+
+func (d *FilterDao) Update(ctx context.Context, f *SavedFilter) error {
+	res := d.db.WithContext(ctx).Model(&SavedFilter{}).Where("id = ? AND user_id = ?", f.Id, f.UserId).
+		Updates(map[string]any{
+			"name":  f.Name,
+			"query": f.Query,
+			"utime": time.Now().Unix(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (d *FilterDao) Delete(ctx context.Context, uid, id int) error {
+	res := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, uid).Delete(&SavedFilter{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// compiler 把筛选表达式编译为 WHERE 子句, 列名固定写在代码中, 用户输入只作为参数传入
+type compiler struct {
+	scope Scope
+	now   time.Time
+	loc   *time.Location
+	sql   []byte
+	arg   []any
+}
+
+func compileFilter(n filter.Node, s Scope, now time.Time, loc *time.Location) (string, []any) {
+	c := &compiler{scope: s, now: now, loc: loc}
+	c.node(n)
+
+	return string(c.sql), c.arg
+}
+
+func (c *compiler) write(sql string, args ...any) {
+	c.sql = append(c.sql, sql...)
+	c.arg = append(c.arg, args...)
+}
+
+func (c *compiler) node(n filter.Node) {
+	switch n := n.(type) {
+	case *filter.And:
+		c.write("(")
+		c.node(n.Left)
+		c.write(" AND ")
+		c.node(n.Right)
+		c.write(")")
+	case *filter.Or:
+		c.write("(")
+		c.node(n.Left)
+		c.write(" OR ")
+		c.node(n.Right)
+		c.write(")")
+	case *filter.Not:
+		c.write("NOT ")
+		c.node(n.X)
+	case *filter.Text:
+		like := "%" + escapeLike(n.Value) + "%"
+		c.write("(title LIKE ? OR content LIKE ?)", like, like)
+	case *filter.Cond:
+		c.cond(n)
+	}
+}
+
+func (c *compiler) cond(n *filter.Cond) {
+	not := ""
+	if n.Op == filter.OpNe {
+		not = "NOT "
+	}
+
+	switch n.Field {
+	case filter.FieldPriority:
+		c.write("priority "+n.Op+" ?", n.Int)
+	case filter.FieldDue:
+		c.time("due", n, true)
+	case filter.FieldCreated:
+		c.time("ctime", n, false)
+	case filter.FieldUpdated:
+		c.time("utime", n, false)
+	case filter.FieldLabel:
+		if n.Str == "none" {
+			c.write(not + "NOT EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id)")
+			return
+		}
+		c.write(not+"EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id AND task_label.name = ?)", n.Str)
+	case filter.FieldProject:
+		switch {
+		case n.Str == "":
+			c.write("project_id "+n.Op+" ?", n.Int)
+		case n.Str == "none" || n.Str == "inbox":
+			c.write("project_id " + n.Op + " 0")
+		default:
+			where, args := c.scope.clause()
+			c.write("project_id "+not+"IN (SELECT id FROM project WHERE "+where+" AND name = ?)", append(args, n.Str)...)
+		}
+	case filter.FieldAssignee:
+		switch n.Str {
+		case "me":
+			c.write("assignee_id "+n.Op+" ?", c.scope.UserId)
+		case "none":
+			c.write("assignee_id " + n.Op + " 0")
+		default:
+			c.write("assignee_id "+n.Op+" ?", n.Int)
+		}
+	case filter.FieldTitle, filter.FieldContent:
+		c.write(n.Field+" "+not+"LIKE ?", "%"+escapeLike(n.Str)+"%")
+	case filter.FieldIs:
+		c.write(not + "(")
+		switch n.Str {
+		case "open":
+			c.write("completed = 0")
+		case "completed":
+			c.write("completed > 0")
+		case "archived":
+			c.write("archived > 0")
+		case "snoozed":
+			c.write("snooze_until > ?", c.now.Unix())
+		case "recurring":
+			c.write("rrule <> ''")
+		case "subtask":
+			c.write("parent_id <> 0")
+		}
+		c.write(")")
+	case filter.FieldHas:
+		switch n.Str {
+		case "due":
+			c.write(not + "(due <> 0)")
+		case "label":
+			c.write(not + "EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id)")
+		case "rrule":
+			c.write(not + "(rrule <> '')")
+		case "project":
+			c.write(not + "(project_id <> 0)")
+		case "content":
+			c.write(not + "(content <> '')")
+		case "assignee":
+			c.write(not + "(assignee_id <> 0)")
+		}
+	}
+}
+
+// time 编译时间条件, 取值解析为 [from, to) 区间, optional 为 true 时未设置的时间 (0) 不参与比较
+func (c *compiler) time(col string, n *filter.Cond, optional bool) {
+	if n.Time.None {
+		op := "="
+		if n.Op == filter.OpNe {
+			op = "<>"
+		}
+		c.write(col + " " + op + " 0")
+		return
+	}
+
+	from, to := n.Time.Range(c.now, c.loc)
+	c.write("(")
+	if optional {
+		c.write(col + " <> 0 AND ")
+	}
+	switch n.Op {
+	case filter.OpLt:
+		c.write(col+" < ?", from)
+	case filter.OpLe:
+		c.write(col+" < ?", to)
+	case filter.OpGt:
+		c.write(col+" >= ?", to)
+	case filter.OpGe:
+		c.write(col+" >= ?", from)
+	case filter.OpEq:
+		c.write(col+" >= ? AND "+col+" < ?", from, to)
+	case filter.OpNe:
+		c.write("("+col+" < ? OR "+col+" >= ?)", from, to)
+	}
+	c.write(")")
+}
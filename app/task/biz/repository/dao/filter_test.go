@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
+)
+
+func TestCompileFilter(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上海 2026-10-14 10:00
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, shanghai)
+	unix := now.Unix()
+	today := time.Date(2026, 10, 14, 0, 0, 0, 0, shanghai).Unix()
+	tomorrow := today + 24*3600
+	personal := Personal(7)
+	shared := Scope{UserId: 7, WorkspaceId: 3}
+
+	tests := []struct {
+		expr  string
+		scope Scope
+		sql   string
+		args  []any
+	}{
+		// 结构与优先级
+		{"a b OR c", personal,
+			"(((title LIKE ? OR content LIKE ?) AND (title LIKE ? OR content LIKE ?)) OR (title LIKE ? OR content LIKE ?))",
+			[]any{"%a%", "%a%", "%b%", "%b%", "%c%", "%c%"}},
+		{"-(priority:high OR is:open)", personal,
+			"NOT (priority = ? OR (completed = 0))", []any{int64(3)}},
+		{`"50%_off\"`, personal,
+			"(title LIKE ? OR content LIKE ?)", []any{`%50\%\_off\\%`, `%50\%\_off\\%`}},
+		// 字段
+		{"priority>=medium", personal, "priority >= ?", []any{int64(2)}},
+		{"priority!=0", personal, "priority != ?", []any{int64(0)}},
+		{"label:work", personal,
+			"EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id AND task_label.name = ?)", []any{"work"}},
+		{"label!=work", personal,
+			"NOT EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id AND task_label.name = ?)", []any{"work"}},
+		{"label:none", personal,
+			"NOT EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id)", nil},
+		{"project:12", personal, "project_id = ?", []any{int64(12)}},
+		{"project!=inbox", personal, "project_id != 0", nil},
+		{"project:Work", personal,
+			"project_id IN (SELECT id FROM project WHERE user_id = ? AND workspace_id = 0 AND name = ?)", []any{7, "Work"}},
+		{"project!=Work", shared,
+			"project_id NOT IN (SELECT id FROM project WHERE workspace_id = ? AND name = ?)", []any{3, "Work"}},
+		{"assignee:me", shared, "assignee_id = ?", []any{7}},
+		{"assignee:none", personal, "assignee_id = 0", nil},
+		{"assignee!=9", personal, "assignee_id != ?", []any{int64(9)}},
+		{"title!=draft", personal, "title NOT LIKE ?", []any{"%draft%"}},
+		{"is:snoozed", personal, "(snooze_until > ?)", []any{unix}},
+		{"is!=subtask", personal, "NOT (parent_id <> 0)", nil},
+		{"has:label", personal, "EXISTS (SELECT 1 FROM task_label WHERE task_label.task_id = task.id)", nil},
+		{"-has:due", personal, "NOT (due <> 0)", nil},
+		// 时间: 未设置的截止时间不参与比较, 整天取值按 [今天, 明天) 展开
+		{"due:none", personal, "due = 0", nil},
+		{"due!=none", personal, "due <> 0", nil},
+		{"due<7d", personal, "(due <> 0 AND due < ?)", []any{unix + 7*24*3600}},
+		{"due<today", personal, "(due <> 0 AND due < ?)", []any{today}},
+		{"due<=today", personal, "(due <> 0 AND due < ?)", []any{tomorrow}},
+		{"due>today", personal, "(due <> 0 AND due >= ?)", []any{tomorrow}},
+		{"due>=today", personal, "(due <> 0 AND due >= ?)", []any{today}},
+		{"due:today", personal, "(due <> 0 AND due >= ? AND due < ?)", []any{today, tomorrow}},
+		{"due!=today", personal, "(due <> 0 AND (due < ? OR due >= ?))", []any{today, tomorrow}},
+		{"created>-2d", personal, "(ctime >= ?)", []any{unix - 2*24*3600 + 1}},
+		{"updated:2026-10-01", personal, "(utime >= ? AND utime < ?)",
+			[]any{time.Date(2026, 10, 1, 0, 0, 0, 0, shanghai).Unix(), time.Date(2026, 10, 2, 0, 0, 0, 0, shanghai).Unix()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := filter.Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			sql, args := compileFilter(n, tt.scope, now, shanghai)
+			if sql != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
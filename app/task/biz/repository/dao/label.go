@@ -0,0 +1,77 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// TaskLabel 任务与标签的关联, 标签本身不单独建表
+type TaskLabel struct {
+	Id     int    `gorm:"primaryKey,autoIncrement"`
+	TaskId int    `gorm:"uniqueIndex:task_name"`
+	UserId int    `gorm:"index:user_name"`
+	Name   string `gorm:"type:varchar(64);uniqueIndex:task_name;index:user_name"`
+}
+
+type LabelDao struct {
+	db *gorm.DB
+}
+
+func NewLabelDao(db *gorm.DB) *LabelDao {
+	return &LabelDao{db: db}
+}
+
+// FindByTaskIds 批量查询任务的标签
+func (d *LabelDao) FindByTaskIds(ctx context.Context, ids []int) (map[int][]string, error) {
+	res := make(map[int][]string, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	var labels []TaskLabel
+	err := d.db.WithContext(ctx).Model(&TaskLabel{}).Where("task_id IN ?", ids).Order("id").Find(&labels).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		res[l.TaskId] = append(res[l.TaskId], l.Name)
+	}
+
+	return res, nil
+}
+
+// ReplaceLabels 覆盖任务的全部标签
+func (d *LabelDao) ReplaceLabels(ctx context.Context, uid, taskId int, labels []string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id = ?", taskId).Delete(&TaskLabel{}).Error; err != nil {
+			return err
+		}
+		return createLabels(tx, uid, taskId, labels)
+	})
+}
+
+func createLabels(tx *gorm.DB, uid, taskId int, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(labels))
+	rows := make([]TaskLabel, 0, len(labels))
+	for _, name := range labels {
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		rows = append(rows, TaskLabel{
+			TaskId: taskId,
+			UserId: uid,
+			Name:   name,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return tx.Create(&rows).Error
+}
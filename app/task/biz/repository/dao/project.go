@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Project struct {
+	Id     int `gorm:"primaryKey,autoIncrement"`
+	UserId int `gorm:"index"`
+	// WorkspaceId 项目所属的工作区, 为 0 表示个人项目. 工作区中的项目 UserId 为创建者
+	WorkspaceId int    `gorm:"index"`
+	Name        string `gorm:"type:varchar(128)"`
+	Ctime       int64
+	Utime       int64
+}
+
+type ProjectDao struct {
+	db *gorm.DB
+}
+
+func NewProjectDao(db *gorm.DB) *ProjectDao {
+	return &ProjectDao{db: db}
+}
+
+func (d *ProjectDao) Create(ctx context.Context, p *Project) error {
+	now := time.Now().Unix()
+	p.Ctime = now
+	p.Utime = now
+
+	return d.db.WithContext(ctx).Create(p).Error
+}
+
+func (d *ProjectDao) FindByScope(ctx context.Context, s Scope) ([]*Project, error) {
+	var projects []*Project
+	err := s.where(d.db.WithContext(ctx).Model(&Project{})).Order("id").Find(&projects).Error
+	if err != nil {
+		return []*Project{}, err
+	}
+
+	return projects, nil
+}
+
+func (d *ProjectDao) FindById(ctx context.Context, s Scope, id int) (Project, error) {
+	var p Project
+	err := s.where(d.db.WithContext(ctx).Model(&Project{})).Where("id = ?", id).First(&p).Error
+	if err != nil {
+		return Project{}, err
+	}
+
+	return p, nil
+}
+
+// FindByIds 批量查询项目, 与 TaskDao.FindByIds 一样不限定范围
+func (d *ProjectDao) FindByIds(ctx context.Context, ids []int) ([]*Project, error) {
+	var projects []*Project
+	if len(ids) == 0 {
+		return projects, nil
+	}
+	err := d.db.WithContext(ctx).Model(&Project{}).Where("id IN ?", ids).Find(&projects).Error
+	if err != nil {
+		return []*Project{}, err
+	}
+
+	return projects, nil
+}
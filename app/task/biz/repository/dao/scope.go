@@ -0,0 +1,28 @@
+package dao
+
+import "gorm.io/gorm"
+
+// Scope 任务与项目的归属范围. WorkspaceId 为 0 时为用户的个人数据, 否则为工作区全部成员共享的数据,
+// 此时 UserId 只表示调用方, 不参与查询
+type Scope struct {
+	UserId      int
+	WorkspaceId int
+}
+
+// Personal 用户的个人范围, CalDAV 与日历订阅只访问个人数据
+func Personal(uid int) Scope {
+	return Scope{UserId: uid}
+}
+
+// clause 返回限定范围的条件, 列名不带表名, 可以用于子查询
+func (s Scope) clause() (string, []any) {
+	if s.WorkspaceId != 0 {
+		return "workspace_id = ?", []any{s.WorkspaceId}
+	}
+	return "user_id = ? AND workspace_id = 0", []any{s.UserId}
+}
+
+func (s Scope) where(db *gorm.DB) *gorm.DB {
+	query, args := s.clause()
+	return db.Where(query, args...)
+}
@@ -0,0 +1,145 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// slotSeconds 统计时间段的长度. 各时区与 UTC 的偏移都是 15 分钟的整数倍,
+// 因此查询时可以把时间段按任意时区的自然日重新划分
+const slotSeconds = 15 * 60
+
+// TaskStat 按用户与 15 分钟时间段 (UTC) 汇总的任务统计, 由任务的写操作在同一事务中维护.
+// Created 与 Deleted 按事件计数, Completed 与 CompleteSeconds 在取消完成时会回退
+type TaskStat struct {
+	Id              int   `gorm:"primaryKey,autoIncrement"`
+	UserId          int   `gorm:"uniqueIndex:user_slot"`
+	Slot            int64 `gorm:"uniqueIndex:user_slot"`
+	Created         int64
+	Completed       int64
+	Deleted         int64
+	CompleteSeconds int64
+}
+
+type StatDao struct {
+	db *gorm.DB
+}
+
+func NewStatDao(db *gorm.DB) *StatDao {
+	return &StatDao{db: db}
+}
+
+// FindInRange 返回 [start, end) 内有数据的时间段, 按时间排序
+func (d *StatDao) FindInRange(ctx context.Context, uid int, start, end int64) ([]TaskStat, error) {
+	var stats []TaskStat
+	err := d.db.WithContext(ctx).Model(&TaskStat{}).
+		Where("user_id = ? AND slot >= ? AND slot < ?", uid, slotOf(start), end).
+		Order("slot").Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CompletedSlots 返回用户全部有完成任务的时间段, 按时间排序, 用于按用户时区计算连续天数
+func (d *StatDao) CompletedSlots(ctx context.Context, uid int) ([]int64, error) {
+	var slots []int64
+	err := d.db.WithContext(ctx).Model(&TaskStat{}).Where("user_id = ? AND completed > 0", uid).
+		Order("slot").Pluck("slot", &slots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// Rebuild 从任务表重建统计, 只在统计表首次创建时使用; 删除事件只能还原回收站中的任务, 没有删除时间时以更新时间近似
+func (d *StatDao) Rebuild(ctx context.Context) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM task_stat").Error; err != nil {
+			return err
+		}
+		steps := []string{
+			`INSERT INTO task_stat (user_id, slot, created, completed, deleted, complete_seconds)
+			SELECT user_id, ctime - MOD(ctime, @slot) AS slot, COUNT(*), 0, 0, 0 FROM task GROUP BY user_id, slot`,
+			`INSERT INTO task_stat (user_id, slot, created, completed, deleted, complete_seconds)
+			SELECT IF(completed_by > 0, completed_by, user_id) AS member, completed - MOD(completed, @slot) AS slot, 0, COUNT(*), 0,
+			SUM(completed - ctime) FROM task WHERE completed > 0 GROUP BY member, slot
+			ON DUPLICATE KEY UPDATE completed = VALUES(completed), complete_seconds = VALUES(complete_seconds)`,
+			`INSERT INTO task_stat (user_id, slot, created, completed, deleted, complete_seconds)
+			SELECT IF(deleted_by > 0, deleted_by, user_id) AS member, IF(deleted > 0, deleted - MOD(deleted, @slot), utime - MOD(utime, @slot)) AS slot,
+			0, 0, COUNT(*), 0 FROM task WHERE status = 1 GROUP BY member, slot
+			ON DUPLICATE KEY UPDATE deleted = VALUES(deleted)`,
+		}
+		for _, sql := range steps {
+			if err := tx.Exec(sql, map[string]any{"slot": slotSeconds}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bumpStat 累加 at 所在时间段的统计
+func bumpStat(tx *gorm.DB, uid int, at int64, s TaskStat) error {
+	s.UserId = uid
+	s.Slot = slotOf(at)
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "slot"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"created":          gorm.Expr("created + ?", s.Created),
+			"completed":        gorm.Expr("completed + ?", s.Completed),
+			"deleted":          gorm.Expr("deleted + ?", s.Deleted),
+			"complete_seconds": gorm.Expr("complete_seconds + ?", s.CompleteSeconds),
+		}),
+	}).Create(&s).Error
+}
+
+// completeStat 任务完成时间从 old.Completed 变为 completed 时调整统计.
+// 完成计入执行完成的成员 actor, 取消完成时从之前完成的成员的统计中回退
+func completeStat(tx *gorm.DB, old Task, completed int64, actor int) error {
+	if old.Completed == completed {
+		return nil
+	}
+	if old.Completed != 0 {
+		err := bumpStat(tx, memberOf(old.CompletedBy, old), old.Completed,
+			TaskStat{Completed: -1, CompleteSeconds: old.Ctime - old.Completed})
+		if err != nil {
+			return err
+		}
+	}
+	if completed != 0 {
+		return bumpStat(tx, actor, completed, TaskStat{Completed: 1, CompleteSeconds: completed - old.Ctime})
+	}
+
+	return nil
+}
+
+// completedBy 返回任务完成时间变为 completed 后的完成者
+func completedBy(old Task, completed int64, actor int) int {
+	switch {
+	case completed == old.Completed:
+		return old.CompletedBy
+	case completed == 0:
+		return 0
+	default:
+		return actor
+	}
+}
+
+// memberOf 执行操作的成员, 没有记录时 (之前的数据) 按创建者计算
+func memberOf(id int, t Task) int {
+	if id != 0 {
+		return id
+	}
+
+	return t.UserId
+}
+
+func slotOf(at int64) int64 {
+	return at - at%slotSeconds
+}
@@ -2,19 +2,59 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
 )
 
+var ErrVersionConflict = errors.New("task version conflict")
+
 type Task struct {
-	Id      int    `gorm:"primaryKey,autoIncrement"`
-	UserId  int    `gorm:"index:user_utime"`
-	Title   string `gorm:"type:varchar(128)"`
-	Content string
-	Status  int
+	Id     int `gorm:"primaryKey,autoIncrement"`
+	UserId int `gorm:"index:user_utime;index:user_href"`
+	// WorkspaceId 任务所属的工作区, 为 0 表示个人任务. 工作区中的任务 UserId 为创建者
+	WorkspaceId int `gorm:"index:workspace_utime"`
+	ProjectId   int `gorm:"index"`
+	ParentId    int `gorm:"index"`
+	// AssigneeId 负责人, 为 0 表示未指派
+	AssigneeId int    `gorm:"index:assignee_utime"`
+	Title      string `gorm:"type:varchar(128)"`
+	Content    string
+	Status     int
+	// Deleted 移入回收站的时间, DeletedBy 删除任务的成员, 统计计入该成员; 为 0 时按创建者计算
+	Deleted   int64
+	DeletedBy int
+	Due       int64
+	Rrule     string `gorm:"type:varchar(255)"`
+	Completed int64
+	// CompletedBy 完成任务的成员, 统计计入该成员; 为 0 时按创建者计算
+	CompletedBy int
+	Priority    int
+	// Archived 归档时间, 为 0 表示未归档
+	Archived int64
+	// SnoozeUntil 延后到该时间之前不在任务列表中显示, 查询时比较, 无需定时任务恢复
+	SnoozeUntil int64
+	// Uid 与 Href 记录 CalDAV 客户端创建的对象的 UID 与资源名
+	Uid     string `gorm:"type:varchar(255)"`
+	Href    string `gorm:"type:varchar(255);index:user_href"`
+	Version int64  `gorm:"default:1"`
 	Ctime   int64
-	Utime   int64 `gorm:"index:user_utime"`
+	Utime   int64 `gorm:"index:user_utime;index:workspace_utime;index:assignee_utime"`
+	// Labels 保存在 TaskLabel 中, 随任务一起创建
+	Labels []string `gorm:"-"`
+	// TimeSpent 由 TimeEntry 汇总得到
+	TimeSpent int64 `gorm:"-"`
+}
+
+// TaskNode 带有子任务的待创建任务
+type TaskNode struct {
+	Task     *Task
+	Children []*TaskNode
 }
 
 type TaskDao struct {
@@ -26,16 +66,166 @@ func NewTaskDao(db *gorm.DB) *TaskDao {
 }
 
 func (d *TaskDao) Create(ctx context.Context, t *Task) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createTask(tx, t)
+	})
+}
+
+func (d *TaskDao) BatchCreate(ctx context.Context, tasks []*Task) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range tasks {
+			if err := createTask(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateTree 在一个事务中创建任务及其子任务, 返回创建的任务数
+func (d *TaskDao) CreateTree(ctx context.Context, nodes []*TaskNode) (int, error) {
+	count := 0
+	var create func(tx *gorm.DB, nodes []*TaskNode, parentId int) error
+	create = func(tx *gorm.DB, nodes []*TaskNode, parentId int) error {
+		for _, n := range nodes {
+			n.Task.ParentId = parentId
+			if err := createTask(tx, n.Task); err != nil {
+				return err
+			}
+			count++
+			if err := create(tx, n.Children, n.Task.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return create(tx, nodes, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func createTask(tx *gorm.DB, t *Task) error {
 	now := time.Now().Unix()
 	t.Ctime = now
 	t.Utime = now
+	t.Version = 1
+
+	if err := tx.Create(t).Error; err != nil {
+		return err
+	}
+	if err := bumpStat(tx, t.UserId, now, TaskStat{Created: 1}); err != nil {
+		return err
+	}
+
+	return createLabels(tx, t.UserId, t.Id, t.Labels)
+}
+
+func (d *TaskDao) FindByScope(ctx context.Context, s Scope, status int) ([]*Task, error) {
+	var tasks []*Task
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("status = ?", status).Order("utime DESC").Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindVisible 查询任务列表中显示的任务, 不包括已归档与延后中的任务
+func (d *TaskDao) FindVisible(ctx context.Context, s Scope, now int64) ([]*Task, error) {
+	var tasks []*Task
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).
+		Where("status = 0 AND archived = 0 AND snooze_until <= ?", now).
+		Order("utime DESC").Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindArchived 查询已归档的任务, keyword 不为空时按标题与内容搜索
+func (d *TaskDao) FindArchived(ctx context.Context, s Scope, keyword string) ([]*Task, error) {
+	query := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("status = 0 AND archived > 0")
+	if keyword != "" {
+		like := "%" + escapeLike(keyword) + "%"
+		query = query.Where("(title LIKE ? OR content LIKE ?)", like, like)
+	}
+
+	var tasks []*Task
+	if err := query.Order("archived DESC").Find(&tasks).Error; err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindSnoozed 查询延后中的任务, 按恢复时间排序
+func (d *TaskDao) FindSnoozed(ctx context.Context, s Scope, now int64) ([]*Task, error) {
+	var tasks []*Task
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).
+		Where("status = 0 AND archived = 0 AND snooze_until > ?", now).
+		Order("snooze_until").Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindAssigned 查询指派给用户的未完成任务, 包括各个工作区中的任务, 调用方需要排除用户已经离开的工作区
+func (d *TaskDao) FindAssigned(ctx context.Context, uid int, now int64) ([]*Task, error) {
+	var tasks []*Task
+	err := d.db.WithContext(ctx).Model(&Task{}).
+		Where("assignee_id = ? AND status = 0 AND completed = 0 AND archived = 0 AND snooze_until <= ?", uid, now).
+		Order("utime DESC").Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindContributed 查询用户在各个工作区中创建或负责的全部任务, 包括已删除的任务, 调用方需要排除用户已经离开的工作区
+func (d *TaskDao) FindContributed(ctx context.Context, uid int) ([]*Task, error) {
+	var tasks []*Task
+	err := d.db.WithContext(ctx).Model(&Task{}).
+		Where("workspace_id > 0 AND (user_id = ? OR assignee_id = ?)", uid, uid).
+		Order("workspace_id, id").Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+// FindByFilter 按筛选表达式查询任务, 表达式中没有 is:archived 与 is:snoozed 时与任务列表一样排除这两类任务
+func (d *TaskDao) FindByFilter(ctx context.Context, s Scope, n filter.Node, now time.Time, loc *time.Location) ([]*Task, error) {
+	query := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("status = 0")
+	if !filter.Mentions(n, filter.FieldIs, "archived") {
+		query = query.Where("archived = 0")
+	}
+	if !filter.Mentions(n, filter.FieldIs, "snoozed") {
+		query = query.Where("snooze_until <= ?", now.Unix())
+	}
+	where, args := compileFilter(n, s, now, loc)
+
+	var tasks []*Task
+	if err := query.Where(where, args...).Order("utime DESC").Find(&tasks).Error; err != nil {
+		return []*Task{}, err
+	}
 
-	return d.db.WithContext(ctx).Create(t).Error
+	return tasks, nil
 }
 
-func (d *TaskDao) FindByUid(ctx context.Context, uid, status int) ([]*Task, error) {
+func (d *TaskDao) FindByProject(ctx context.Context, s Scope, projectId int) ([]*Task, error) {
 	var tasks []*Task
-	err := d.db.WithContext(ctx).Model(&Task{}).Where("user_id = ? AND status = ?", uid, status).Order("utime DESC").Find(&tasks).Error
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("project_id = ? AND status = 0", projectId).Order("id").Find(&tasks).Error
 	if err != nil {
 		return []*Task{}, err
 	}
@@ -43,7 +233,65 @@ func (d *TaskDao) FindByUid(ctx context.Context, uid, status int) ([]*Task, erro
 	return tasks, nil
 }
 
-func (d *TaskDao) UpdateTask(ctx context.Context, t *Task) error {
+// ProjectVersion 项目中任务的汇总, 用于判断项目中的任务是否变化.
+// Objects 与 Versions 只统计未删除的任务, Utime 包含回收站中的任务, 删除任务也会改变它
+type ProjectVersion struct {
+	ProjectId int
+	Objects   int64
+	Versions  int64
+	Utime     int64
+}
+
+// ProjectVersions 按项目汇总范围内的任务, projectIds 为空时返回全部项目, 没有任务的项目不返回
+func (d *TaskDao) ProjectVersions(ctx context.Context, s Scope, projectIds []int) ([]ProjectVersion, error) {
+	query := s.where(d.db.WithContext(ctx).Model(&Task{})).
+		Select("project_id, SUM(status = 0) AS objects, SUM(IF(status = 0, version, 0)) AS versions, MAX(utime) AS utime")
+	if len(projectIds) > 0 {
+		query = query.Where("project_id IN ?", projectIds)
+	}
+	var versions []ProjectVersion
+	if err := query.Group("project_id").Scan(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (d *TaskDao) FindById(ctx context.Context, s Scope, id int) (Task, error) {
+	var t Task
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("id = ? AND status = 0", id).First(&t).Error
+	if err != nil {
+		return Task{}, err
+	}
+
+	return t, nil
+}
+
+// FindByIds 批量查询任务, 包含已删除的任务. 不限定范围, ids 需要来自调用方有权访问的数据, 如用户自己的计时记录
+func (d *TaskDao) FindByIds(ctx context.Context, ids []int) ([]*Task, error) {
+	var tasks []*Task
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	err := d.db.WithContext(ctx).Model(&Task{}).Where("id IN ?", ids).Find(&tasks).Error
+	if err != nil {
+		return []*Task{}, err
+	}
+
+	return tasks, nil
+}
+
+func (d *TaskDao) FindByHref(ctx context.Context, s Scope, href string) (Task, error) {
+	var t Task
+	err := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("href = ? AND status = 0", href).First(&t).Error
+	if err != nil {
+		return Task{}, err
+	}
+
+	return t, nil
+}
+
+func (d *TaskDao) UpdateTask(ctx context.Context, s Scope, t *Task) error {
 	updates := make(map[string]any)
 	if t.Title != "" {
 		updates["title"] = t.Title
@@ -51,26 +299,218 @@ func (d *TaskDao) UpdateTask(ctx context.Context, t *Task) error {
 	if t.Content != "" {
 		updates["content"] = t.Content
 	}
+	if t.Due != 0 {
+		updates["due"] = t.Due
+	}
+	if t.Rrule != "" {
+		updates["rrule"] = t.Rrule
+	}
 
-	if len(updates) > 0 {
-		updates["utime"] = time.Now().Unix()
+	query := s.where(d.db.WithContext(ctx).Model(&Task{})).Where("id = ?", t.Id)
+	// 没有需要更新的字段时只确认任务存在
+	if len(updates) == 0 {
+		return query.Select("id").First(&Task{}).Error
 	}
+	updates["utime"] = time.Now().Unix()
+	updates["version"] = gorm.Expr("version + 1")
 
-	return d.db.WithContext(ctx).Model(&Task{}).Where("id = ?", t.Id).Updates(updates).Error
+	return affected(query.Updates(updates))
 }
 
-func (d *TaskDao) DeleteTask(ctx context.Context, id int) error {
-	now := time.Now().Unix()
-	return d.db.WithContext(ctx).Model(&Task{}).Where("id = ?", id).UpdateColumns(map[string]any{
-		"status": 1,
-		"utime":  now,
-	}).Error
+// ReplaceTask 整体覆盖任务内容, version 不为 0 时只在版本一致时更新.
+// 任务已删除或不在 t.ProjectId 中时同样返回 ErrVersionConflict, 检查与写入在同一事务中持有行锁
+func (d *TaskDao) ReplaceTask(ctx context.Context, s Scope, t *Task, version int64) (int64, error) {
+	var latest int64
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := s.where(tx.Clauses(clause.Locking{Strength: "UPDATE"})).
+			Where("id = ? AND project_id = ? AND status = 0", t.Id, t.ProjectId)
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		var old Task
+		if err := query.First(&old).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVersionConflict
+			}
+			return err
+		}
+
+		err := tx.Model(&Task{}).Where("id = ?", t.Id).UpdateColumns(map[string]any{
+			"title":        t.Title,
+			"content":      t.Content,
+			"due":          t.Due,
+			"rrule":        t.Rrule,
+			"completed":    t.Completed,
+			"completed_by": completedBy(old, t.Completed, s.UserId),
+			"uid":          t.Uid,
+			"utime":        time.Now().Unix(),
+			"version":      old.Version + 1,
+		}).Error
+		if err != nil {
+			return err
+		}
+		latest = old.Version + 1
+
+		return completeStat(tx, old, t.Completed, s.UserId)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return latest, nil
 }
 
-func (d *TaskDao) RestoreTask(ctx context.Context, id int) error {
+// Archive 归档或取消归档任务, archived 为 0 表示取消归档
+func (d *TaskDao) Archive(ctx context.Context, s Scope, id int, archived int64) error {
+	return d.updateActive(ctx, s, id, map[string]any{"archived": archived})
+}
+
+// Snooze 延后任务到 until, until 为 0 表示取消延后
+func (d *TaskDao) Snooze(ctx context.Context, s Scope, id int, until int64) error {
+	return d.updateActive(ctx, s, id, map[string]any{"snooze_until": until})
+}
+
+// updateActive 更新范围内未删除的任务, 任务不存在时返回 gorm.ErrRecordNotFound
+func (d *TaskDao) updateActive(ctx context.Context, s Scope, id int, updates map[string]any) error {
+	updates["utime"] = time.Now().Unix()
+	updates["version"] = gorm.Expr("version + 1")
+
+	return affected(s.where(d.db.WithContext(ctx).Model(&Task{})).Where("id = ? AND status = 0", id).UpdateColumns(updates))
+}
+
+// Assign 设置任务的负责人, assigneeId 为 0 表示取消指派
+func (d *TaskDao) Assign(ctx context.Context, s Scope, id, assigneeId int) error {
+	return d.updateActive(ctx, s, id, map[string]any{"assignee_id": assigneeId})
+}
+
+func (d *TaskDao) SetPriority(ctx context.Context, s Scope, id, priority int) error {
+	return affected(s.where(d.db.WithContext(ctx).Model(&Task{})).Where("id = ?", id).UpdateColumns(map[string]any{
+		"priority": priority,
+		"utime":    time.Now().Unix(),
+		"version":  gorm.Expr("version + 1"),
+	}))
+}
+
+// CompleteTask 范围内没有该任务时返回 gorm.ErrRecordNotFound
+func (d *TaskDao) CompleteTask(ctx context.Context, s Scope, id int, completed int64) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old Task
+		err := s.where(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("id = ?", id).First(&old).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&Task{}).Where("id = ?", id).UpdateColumns(map[string]any{
+			"completed":    completed,
+			"completed_by": completedBy(old, completed, s.UserId),
+			"utime":        time.Now().Unix(),
+			"version":      gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return completeStat(tx, old, completed, s.UserId)
+	})
+}
+
+// DeleteTask 范围内没有该任务时返回 gorm.ErrRecordNotFound
+func (d *TaskDao) DeleteTask(ctx context.Context, s Scope, id int) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old Task
+		err := s.where(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("id = ?", id).First(&old).Error
+		if err != nil {
+			return err
+		}
+
+		return deleteTask(tx, old, s.UserId)
+	})
+}
+
+// DeleteTaskVersion 与 DeleteTask 相同, version 不为 0 时只在版本一致时删除
+func (d *TaskDao) DeleteTaskVersion(ctx context.Context, s Scope, id int, version int64) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := s.where(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("id = ? AND status = 0", id)
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		var old Task
+		if err := query.First(&old).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVersionConflict
+			}
+			return err
+		}
+
+		return deleteTask(tx, old, s.UserId)
+	})
+}
+
+// deleteTask 把任务移入回收站, 删除统计计入执行删除的成员 actor
+func deleteTask(tx *gorm.DB, old Task, actor int) error {
 	now := time.Now().Unix()
-	return d.db.WithContext(ctx).Model(&Task{}).Where("id = ?", id).UpdateColumns(map[string]any{
-		"status": 0,
-		"utime":  now,
-	}).Error
+	updates := map[string]any{
+		"status":  1,
+		"utime":   now,
+		"version": gorm.Expr("version + 1"),
+	}
+	// 已在回收站中的任务保留之前的删除时间与删除者
+	if old.Status == 0 {
+		updates["deleted"] = now
+		updates["deleted_by"] = actor
+	}
+	err := tx.Model(&Task{}).Where("id = ?", old.Id).UpdateColumns(updates).Error
+	if err != nil || old.Status == 1 {
+		return err
+	}
+
+	return bumpStat(tx, actor, now, TaskStat{Deleted: 1})
+}
+
+// RestoreTask 从回收站恢复任务, 并在同一事务中回退删除时计入的统计, 否则恢复后再次删除会重复计数.
+// 回收站中没有该任务时返回 gorm.ErrRecordNotFound
+func (d *TaskDao) RestoreTask(ctx context.Context, s Scope, id int) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old Task
+		err := s.where(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("id = ? AND status = 1", id).First(&old).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&Task{}).Where("id = ?", id).UpdateColumns(map[string]any{
+			"status":     0,
+			"deleted":    0,
+			"deleted_by": 0,
+			"utime":      time.Now().Unix(),
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// 之前删除的任务没有记录删除时间, 与重建统计时一样以更新时间近似
+		deleted := old.Deleted
+		if deleted == 0 {
+			deleted = old.Utime
+		}
+		return bumpStat(tx, memberOf(old.DeletedBy, old), deleted, TaskStat{Deleted: -1})
+	})
+}
+
+// affected 更新没有命中任何任务时返回 gorm.ErrRecordNotFound, 与查询任务时一致
+func affected(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
 }
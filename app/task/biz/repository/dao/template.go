@@ -0,0 +1,149 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TaskTemplate struct {
+	Id          int    `gorm:"primaryKey,autoIncrement"`
+	UserId      int    `gorm:"index"`
+	Name        string `gorm:"type:varchar(128)"`
+	Description string
+	Ctime       int64
+	Utime       int64
+	Items       []*TemplateItem `gorm:"-"`
+}
+
+// TemplateItem 模板中的一个任务, ParentId 指向同一模板中的父条目
+type TemplateItem struct {
+	Id         int `gorm:"primaryKey,autoIncrement"`
+	TemplateId int `gorm:"index"`
+	ParentId   int
+	Title      string `gorm:"type:varchar(128)"`
+	Content    string
+	DueOffset  *int64
+	// Labels 以逗号分隔
+	Labels   string `gorm:"type:varchar(512)"`
+	Sort     int
+	Subtasks []*TemplateItem `gorm:"-"`
+}
+
+type TemplateDao struct {
+	db *gorm.DB
+}
+
+func NewTemplateDao(db *gorm.DB) *TemplateDao {
+	return &TemplateDao{db: db}
+}
+
+// Create 在一个事务中创建模板及其全部条目
+func (d *TemplateDao) Create(ctx context.Context, t *TaskTemplate) error {
+	now := time.Now().Unix()
+	t.Ctime = now
+	t.Utime = now
+
+	var create func(tx *gorm.DB, items []*TemplateItem, parentId int) error
+	create = func(tx *gorm.DB, items []*TemplateItem, parentId int) error {
+		for i, item := range items {
+			item.TemplateId = t.Id
+			item.ParentId = parentId
+			item.Sort = i
+			if err := tx.Create(item).Error; err != nil {
+				return err
+			}
+			if err := create(tx, item.Subtasks, item.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return create(tx, t.Items, 0)
+	})
+}
+
+func (d *TemplateDao) FindByUid(ctx context.Context, uid int) ([]*TaskTemplate, error) {
+	var templates []*TaskTemplate
+	err := d.db.WithContext(ctx).Model(&TaskTemplate{}).Where("user_id = ?", uid).Order("id").Find(&templates).Error
+	if err != nil {
+		return []*TaskTemplate{}, err
+	}
+	if len(templates) == 0 {
+		return templates, nil
+	}
+
+	ids := make([]int, 0, len(templates))
+	for _, t := range templates {
+		ids = append(ids, t.Id)
+	}
+	items, err := d.findItems(ctx, ids)
+	if err != nil {
+		return []*TaskTemplate{}, err
+	}
+	for _, t := range templates {
+		t.Items = items[t.Id]
+	}
+
+	return templates, nil
+}
+
+func (d *TemplateDao) FindById(ctx context.Context, uid, id int) (*TaskTemplate, error) {
+	var t TaskTemplate
+	err := d.db.WithContext(ctx).Model(&TaskTemplate{}).Where("id = ? AND user_id = ?", id, uid).First(&t).Error
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := d.findItems(ctx, []int{t.Id})
+	if err != nil {
+		return nil, err
+	}
+	t.Items = items[t.Id]
+
+	return &t, nil
+}
+
+func (d *TemplateDao) Delete(ctx context.Context, uid, id int) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND user_id = ?", id, uid).Delete(&TaskTemplate{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("template_id = ?", id).Delete(&TemplateItem{}).Error
+	})
+}
+
+// findItems 查询模板条目并按 ParentId 组装成树
+func (d *TemplateDao) findItems(ctx context.Context, templateIds []int) (map[int][]*TemplateItem, error) {
+	var items []*TemplateItem
+	err := d.db.WithContext(ctx).Model(&TemplateItem{}).Where("template_id IN ?", templateIds).Order("sort, id").Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int]*TemplateItem, len(items))
+	for _, item := range items {
+		byId[item.Id] = item
+	}
+
+	res := make(map[int][]*TemplateItem, len(templateIds))
+	for _, item := range items {
+		if parent, ok := byId[item.ParentId]; ok {
+			parent.Subtasks = append(parent.Subtasks, item)
+			continue
+		}
+		res[item.TemplateId] = append(res[item.TemplateId], item)
+	}
+
+	return res, nil
+}
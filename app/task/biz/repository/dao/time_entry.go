@@ -0,0 +1,190 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTimerRunning = errors.New("another timer is running")
+
+// TimeEntry 任务的一段计时, EndAt 为 0 表示计时仍在运行
+type TimeEntry struct {
+	Id      int   `gorm:"primaryKey,autoIncrement"`
+	UserId  int   `gorm:"index:user_start;uniqueIndex:user_running"`
+	TaskId  int   `gorm:"index"`
+	StartAt int64 `gorm:"index:user_start"`
+	EndAt   int64
+	// Running 运行中为 true, 停止后置为 NULL, 借助唯一索引保证每个用户最多一个运行中的计时
+	Running *bool  `gorm:"uniqueIndex:user_running"`
+	Note    string `gorm:"type:varchar(255)"`
+	Ctime   int64
+	Utime   int64
+}
+
+type TimeEntryDao struct {
+	db *gorm.DB
+}
+
+func NewTimeEntryDao(db *gorm.DB) *TimeEntryDao {
+	return &TimeEntryDao{db: db}
+}
+
+// Start 开始新的计时, 已有运行中的计时会先被停止, 返回被停止的计时
+func (d *TimeEntryDao) Start(ctx context.Context, e *TimeEntry) (*TimeEntry, error) {
+	var stopped *TimeEntry
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+
+		var running TimeEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND running = ?", e.UserId, true).First(&running).Error
+		switch {
+		case err == nil:
+			if err := stopEntry(tx, &running, now); err != nil {
+				return err
+			}
+			stopped = &running
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		on := true
+		e.StartAt = now
+		e.EndAt = 0
+		e.Running = &on
+		e.Ctime = now
+		e.Utime = now
+		return tx.Create(e).Error
+	})
+	// 并发开始计时时由唯一索引兜底
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1062 {
+		return nil, ErrTimerRunning
+	}
+
+	return stopped, err
+}
+
+// Stop 停止用户运行中的计时, 没有时返回 gorm.ErrRecordNotFound
+func (d *TimeEntryDao) Stop(ctx context.Context, uid int) (TimeEntry, error) {
+	var e TimeEntry
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND running = ?", uid, true).First(&e).Error
+		if err != nil {
+			return err
+		}
+		return stopEntry(tx, &e, time.Now().Unix())
+	})
+	if err != nil {
+		return TimeEntry{}, err
+	}
+
+	return e, nil
+}
+
+func stopEntry(tx *gorm.DB, e *TimeEntry, now int64) error {
+	e.EndAt = now
+	e.Running = nil
+	e.Utime = now
+
+	return tx.Model(&TimeEntry{}).Where("id = ?", e.Id).UpdateColumns(map[string]any{
+		"end_at":  now,
+		"running": nil,
+		"utime":   now,
+	}).Error
+}
+
+func (d *TimeEntryDao) FindRunning(ctx context.Context, uid int) (TimeEntry, error) {
+	var e TimeEntry
+	err := d.db.WithContext(ctx).Model(&TimeEntry{}).Where("user_id = ? AND running = ?", uid, true).First(&e).Error
+	if err != nil {
+		return TimeEntry{}, err
+	}
+
+	return e, nil
+}
+
+func (d *TimeEntryDao) Create(ctx context.Context, e *TimeEntry) error {
+	now := time.Now().Unix()
+	e.Running = nil
+	e.Ctime = now
+	e.Utime = now
+
+	return d.db.WithContext(ctx).Create(e).Error
+}
+
+func (d *TimeEntryDao) FindByTask(ctx context.Context, uid, taskId int) ([]*TimeEntry, error) {
+	var entries []*TimeEntry
+	err := d.db.WithContext(ctx).Model(&TimeEntry{}).Where("user_id = ? AND task_id = ?", uid, taskId).Order("start_at").Find(&entries).Error
+	if err != nil {
+		return []*TimeEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// FindByUser 查询用户的全部计时
+func (d *TimeEntryDao) FindByUser(ctx context.Context, uid int) ([]*TimeEntry, error) {
+	var entries []*TimeEntry
+	err := d.db.WithContext(ctx).Model(&TimeEntry{}).Where("user_id = ?", uid).Order("start_at").Find(&entries).Error
+	if err != nil {
+		return []*TimeEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// FindInRange 查询与 [start, end) 有交集的计时
+func (d *TimeEntryDao) FindInRange(ctx context.Context, uid int, start, end int64) ([]*TimeEntry, error) {
+	var entries []*TimeEntry
+	err := d.db.WithContext(ctx).Model(&TimeEntry{}).
+		Where("user_id = ? AND start_at < ? AND (end_at = 0 OR end_at > ?)", uid, end, start).
+		Order("start_at").Find(&entries).Error
+	if err != nil {
+		return []*TimeEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// SumByTaskIds 汇总任务的累计耗时, 运行中的计时按 now 计算
+func (d *TimeEntryDao) SumByTaskIds(ctx context.Context, ids []int, now int64) (map[int]int64, error) {
+	res := make(map[int]int64, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	var rows []struct {
+		TaskId int
+		Total  int64
+	}
+	err := d.db.WithContext(ctx).Model(&TimeEntry{}).
+		Select("task_id, SUM(CASE WHEN end_at = 0 THEN ? ELSE end_at END - start_at) AS total", now).
+		Where("task_id IN ?", ids).Group("task_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		res[r.TaskId] = r.Total
+	}
+
+	return res, nil
+}
+
+func (d *TimeEntryDao) Delete(ctx context.Context, uid, id int) error {
+	res := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, uid).Delete(&TimeEntry{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type FilterRepo struct {
+	dao *dao.FilterDao
+}
+
+func NewFilterRepo(d *dao.FilterDao) *FilterRepo {
+	return &FilterRepo{dao: d}
+}
+
+func (r *FilterRepo) CreateFilter(ctx context.Context, f *dao.SavedFilter) error {
+	return r.dao.Create(ctx, f)
+}
+
+func (r *FilterRepo) FindByUid(ctx context.Context, uid int) ([]*dao.SavedFilter, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *FilterRepo) FindById(ctx context.Context, uid, id int) (dao.SavedFilter, error) {
+	return r.dao.FindById(ctx, uid, id)
+}
+
+func (r *FilterRepo) UpdateFilter(ctx context.Context, f *dao.SavedFilter) error {
+	return r.dao.Update(ctx, f)
+}
+
+func (r *FilterRepo) DeleteFilter(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
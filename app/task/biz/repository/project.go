@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type ProjectRepo struct {
+	dao *dao.ProjectDao
+}
+
+func NewProjectRepo(d *dao.ProjectDao) *ProjectRepo {
+	return &ProjectRepo{dao: d}
+}
+
+func (r *ProjectRepo) CreateProject(ctx context.Context, p *dao.Project) error {
+	return r.dao.Create(ctx, p)
+}
+
+func (r *ProjectRepo) FindByScope(ctx context.Context, s dao.Scope) ([]*dao.Project, error) {
+	return r.dao.FindByScope(ctx, s)
+}
+
+func (r *ProjectRepo) FindById(ctx context.Context, s dao.Scope, id int) (dao.Project, error) {
+	return r.dao.FindById(ctx, s, id)
+}
+
+func (r *ProjectRepo) FindByIds(ctx context.Context, ids []int) ([]*dao.Project, error) {
+	return r.dao.FindByIds(ctx, ids)
+}
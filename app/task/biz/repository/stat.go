@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type StatRepo struct {
+	dao *dao.StatDao
+}
+
+func NewStatRepo(d *dao.StatDao) *StatRepo {
+	return &StatRepo{dao: d}
+}
+
+func (r *StatRepo) FindInRange(ctx context.Context, uid int, start, end int64) ([]dao.TaskStat, error) {
+	return r.dao.FindInRange(ctx, uid, start, end)
+}
+
+func (r *StatRepo) CompletedSlots(ctx context.Context, uid int) ([]int64, error) {
+	return r.dao.CompletedSlots(ctx, uid)
+}
@@ -2,34 +2,175 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
 )
 
 type TaskRepo struct {
-	dao *dao.TaskDao
+	dao      *dao.TaskDao
+	labelDao *dao.LabelDao
+	timeDao  *dao.TimeEntryDao
 }
 
-func NewTaskRepo(d *dao.TaskDao) *TaskRepo {
-	return &TaskRepo{dao: d}
+func NewTaskRepo(d *dao.TaskDao, l *dao.LabelDao, t *dao.TimeEntryDao) *TaskRepo {
+	return &TaskRepo{dao: d, labelDao: l, timeDao: t}
 }
 
 func (r *TaskRepo) CreateTask(ctx context.Context, t *dao.Task) error {
 	return r.dao.Create(ctx, t)
 }
 
-func (r *TaskRepo) FindByUid(ctx context.Context, uid, status int) ([]*dao.Task, error) {
-	return r.dao.FindByUid(ctx, uid, status)
+func (r *TaskRepo) BatchCreateTask(ctx context.Context, tasks []*dao.Task) error {
+	return r.dao.BatchCreate(ctx, tasks)
 }
 
-func (r *TaskRepo) UpdateTask(ctx context.Context, t *dao.Task) error {
-	return r.dao.UpdateTask(ctx, t)
+func (r *TaskRepo) CreateTree(ctx context.Context, nodes []*dao.TaskNode) (int, error) {
+	return r.dao.CreateTree(ctx, nodes)
 }
 
-func (r *TaskRepo) DeleteTask(ctx context.Context, id int) error {
-	return r.dao.DeleteTask(ctx, id)
+func (r *TaskRepo) FindByScope(ctx context.Context, s dao.Scope, status int) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindByScope(ctx, s, status))
 }
 
-func (r *TaskRepo) RestoreTask(ctx context.Context, id int) error {
-	return r.dao.RestoreTask(ctx, id)
+func (r *TaskRepo) FindVisible(ctx context.Context, s dao.Scope, now int64) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindVisible(ctx, s, now))
+}
+
+func (r *TaskRepo) FindByFilter(ctx context.Context, s dao.Scope, n filter.Node, now time.Time, loc *time.Location) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindByFilter(ctx, s, n, now, loc))
+}
+
+func (r *TaskRepo) FindArchived(ctx context.Context, s dao.Scope, keyword string) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindArchived(ctx, s, keyword))
+}
+
+func (r *TaskRepo) FindSnoozed(ctx context.Context, s dao.Scope, now int64) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindSnoozed(ctx, s, now))
+}
+
+func (r *TaskRepo) FindAssigned(ctx context.Context, uid int, now int64) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindAssigned(ctx, uid, now))
+}
+
+func (r *TaskRepo) FindContributed(ctx context.Context, uid int) ([]*dao.Task, error) {
+	return r.withDetails(ctx)(r.dao.FindContributed(ctx, uid))
+}
+
+func (r *TaskRepo) Assign(ctx context.Context, s dao.Scope, id, assigneeId int) error {
+	return r.dao.Assign(ctx, s, id, assigneeId)
+}
+
+func (r *TaskRepo) Archive(ctx context.Context, s dao.Scope, id int, archived int64) error {
+	return r.dao.Archive(ctx, s, id, archived)
+}
+
+func (r *TaskRepo) Snooze(ctx context.Context, s dao.Scope, id int, until int64) error {
+	return r.dao.Snooze(ctx, s, id, until)
+}
+
+func (r *TaskRepo) FindByIds(ctx context.Context, ids []int) ([]*dao.Task, error) {
+	tasks, err := r.dao.FindByIds(ctx, ids)
+	if err != nil {
+		return tasks, err
+	}
+
+	return tasks, r.loadLabels(ctx, tasks)
+}
+
+func (r *TaskRepo) UpdateTask(ctx context.Context, s dao.Scope, t *dao.Task) error {
+	return r.dao.UpdateTask(ctx, s, t)
+}
+
+func (r *TaskRepo) ReplaceLabels(ctx context.Context, uid, taskId int, labels []string) error {
+	return r.labelDao.ReplaceLabels(ctx, uid, taskId, labels)
+}
+
+func (r *TaskRepo) DeleteTask(ctx context.Context, s dao.Scope, id int) error {
+	return r.dao.DeleteTask(ctx, s, id)
+}
+
+func (r *TaskRepo) RestoreTask(ctx context.Context, s dao.Scope, id int) error {
+	return r.dao.RestoreTask(ctx, s, id)
+}
+
+func (r *TaskRepo) FindByProject(ctx context.Context, s dao.Scope, projectId int) ([]*dao.Task, error) {
+	return r.dao.FindByProject(ctx, s, projectId)
+}
+
+func (r *TaskRepo) ProjectVersions(ctx context.Context, s dao.Scope, projectIds []int) ([]dao.ProjectVersion, error) {
+	return r.dao.ProjectVersions(ctx, s, projectIds)
+}
+
+func (r *TaskRepo) FindById(ctx context.Context, s dao.Scope, id int) (dao.Task, error) {
+	return r.dao.FindById(ctx, s, id)
+}
+
+func (r *TaskRepo) FindByHref(ctx context.Context, s dao.Scope, href string) (dao.Task, error) {
+	return r.dao.FindByHref(ctx, s, href)
+}
+
+func (r *TaskRepo) ReplaceTask(ctx context.Context, s dao.Scope, t *dao.Task, version int64) (int64, error) {
+	return r.dao.ReplaceTask(ctx, s, t, version)
+}
+
+func (r *TaskRepo) SetPriority(ctx context.Context, s dao.Scope, id, priority int) error {
+	return r.dao.SetPriority(ctx, s, id, priority)
+}
+
+func (r *TaskRepo) CompleteTask(ctx context.Context, s dao.Scope, id int, completed int64) error {
+	return r.dao.CompleteTask(ctx, s, id, completed)
+}
+
+func (r *TaskRepo) DeleteTaskVersion(ctx context.Context, s dao.Scope, id int, version int64) error {
+	return r.dao.DeleteTaskVersion(ctx, s, id, version)
+}
+
+// withDetails 为查询结果补充标签与累计耗时
+func (r *TaskRepo) withDetails(ctx context.Context) func([]*dao.Task, error) ([]*dao.Task, error) {
+	return func(tasks []*dao.Task, err error) ([]*dao.Task, error) {
+		if err != nil {
+			return tasks, err
+		}
+		if err := r.loadLabels(ctx, tasks); err != nil {
+			return tasks, err
+		}
+
+		return tasks, r.loadTimeSpent(ctx, tasks)
+	}
+}
+
+func (r *TaskRepo) loadLabels(ctx context.Context, tasks []*dao.Task) error {
+	ids := make([]int, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.Id)
+	}
+
+	labels, err := r.labelDao.FindByTaskIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		t.Labels = labels[t.Id]
+	}
+
+	return nil
+}
+
+func (r *TaskRepo) loadTimeSpent(ctx context.Context, tasks []*dao.Task) error {
+	ids := make([]int, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.Id)
+	}
+
+	totals, err := r.timeDao.SumByTaskIds(ctx, ids, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		t.TimeSpent = totals[t.Id]
+	}
+
+	return nil
 }
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type TemplateRepo struct {
+	dao *dao.TemplateDao
+}
+
+func NewTemplateRepo(d *dao.TemplateDao) *TemplateRepo {
+	return &TemplateRepo{dao: d}
+}
+
+func (r *TemplateRepo) CreateTemplate(ctx context.Context, t *dao.TaskTemplate) error {
+	return r.dao.Create(ctx, t)
+}
+
+func (r *TemplateRepo) FindByUid(ctx context.Context, uid int) ([]*dao.TaskTemplate, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *TemplateRepo) FindById(ctx context.Context, uid, id int) (*dao.TaskTemplate, error) {
+	return r.dao.FindById(ctx, uid, id)
+}
+
+func (r *TemplateRepo) DeleteTemplate(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
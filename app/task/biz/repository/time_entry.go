@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type TimeEntryRepo struct {
+	dao *dao.TimeEntryDao
+}
+
+func NewTimeEntryRepo(d *dao.TimeEntryDao) *TimeEntryRepo {
+	return &TimeEntryRepo{dao: d}
+}
+
+func (r *TimeEntryRepo) StartTimer(ctx context.Context, e *dao.TimeEntry) (*dao.TimeEntry, error) {
+	return r.dao.Start(ctx, e)
+}
+
+func (r *TimeEntryRepo) StopTimer(ctx context.Context, uid int) (dao.TimeEntry, error) {
+	return r.dao.Stop(ctx, uid)
+}
+
+func (r *TimeEntryRepo) FindRunning(ctx context.Context, uid int) (dao.TimeEntry, error) {
+	return r.dao.FindRunning(ctx, uid)
+}
+
+func (r *TimeEntryRepo) CreateEntry(ctx context.Context, e *dao.TimeEntry) error {
+	return r.dao.Create(ctx, e)
+}
+
+func (r *TimeEntryRepo) FindByTask(ctx context.Context, uid, taskId int) ([]*dao.TimeEntry, error) {
+	return r.dao.FindByTask(ctx, uid, taskId)
+}
+
+func (r *TimeEntryRepo) FindByUser(ctx context.Context, uid int) ([]*dao.TimeEntry, error) {
+	return r.dao.FindByUser(ctx, uid)
+}
+
+func (r *TimeEntryRepo) FindInRange(ctx context.Context, uid int, start, end int64) ([]*dao.TimeEntry, error) {
+	return r.dao.FindInRange(ctx, uid, start, end)
+}
+
+func (r *TimeEntryRepo) DeleteEntry(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
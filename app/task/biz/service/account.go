@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+)
+
+var (
+	ErrInvalidUser  = errors.New("invalid user id")
+	ErrNotFromUsers = errors.New("only the user service can purge user data")
+)
+
+type AccountService struct {
+	repo *repository.AccountRepo
+}
+
+func NewAccountService(repo *repository.AccountRepo) *AccountService {
+	return &AccountService{repo: repo}
+}
+
+// Purge 用户注销账号后由用户服务调用, 删除该用户的个人任务数据与随账号删除的工作区
+func (s *AccountService) Purge(ctx context.Context, uid int, workspaceIds []int) (int64, error) {
+	if p, _ := principal.FromContext(ctx); p.Issuer != principal.IssuerUser {
+		return 0, ErrNotFromUsers
+	}
+	if uid <= 0 {
+		return 0, ErrInvalidUser
+	}
+
+	return s.repo.Purge(ctx, uid, workspaceIds)
+}
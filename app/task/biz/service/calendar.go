@@ -0,0 +1,436 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/task/pkg/ical"
+)
+
+const (
+	calendarProdID = "-//github.com/crazyfrankie//todolist//CN"
+	calendarUID    = "task-%d@todolist"
+	// objectName 应用内创建的任务在 CalDAV 中的资源名
+	objectName = "task-%d.ics"
+)
+
+var (
+	ErrInvalidCalendarToken = errors.New("invalid calendar token")
+	ErrObjectNotFound       = errors.New("calendar object not found")
+	ErrPreconditionFailed   = errors.New("calendar object precondition failed")
+)
+
+// CalendarObject CalDAV 集合中的一个资源, 对应一个任务
+type CalendarObject struct {
+	Name    string
+	Version int64
+	Data    string
+}
+
+// CalendarCollection CalDAV 集合, 对应一个项目, ProjectId 为 0 表示不属于任何项目的任务
+type CalendarCollection struct {
+	ProjectId int
+	Name      string
+	CTag      string
+}
+
+// CalendarService 日历订阅、导入与 CalDAV 只访问个人任务, 不包含工作区中的任务
+type CalendarService struct {
+	repo        *repository.CalendarRepo
+	taskRepo    *repository.TaskRepo
+	projectRepo *repository.ProjectRepo
+}
+
+func NewCalendarService(repo *repository.CalendarRepo, taskRepo *repository.TaskRepo, projectRepo *repository.ProjectRepo) *CalendarService {
+	return &CalendarService{repo: repo, taskRepo: taskRepo, projectRepo: projectRepo}
+}
+
+// CreateToken 生成新的订阅令牌, 令牌明文只在这里返回一次
+func (s *CalendarService) CreateToken(ctx context.Context) (string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := s.repo.SaveToken(ctx, uId, hashToken(token)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *CalendarService) RevokeToken(ctx context.Context) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeToken(ctx, uId)
+}
+
+// Feed 根据订阅令牌渲染用户的任务日历
+func (s *CalendarService) Feed(ctx context.Context, token, component string) ([]byte, error) {
+	if token == "" {
+		return nil, ErrInvalidCalendarToken
+	}
+	t, err := s.repo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidCalendarToken
+	}
+
+	tasks, err := s.taskRepo.FindByScope(ctx, dao.Personal(t.UserId), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   "todolist",
+		Todos:  make([]ical.Todo, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		cal.Todos = append(cal.Todos, toTodo(task))
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal, strings.ToUpper(component)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Import 将 .ics 文件中的条目导入为当前用户的任务
+func (s *CalendarService) Import(ctx context.Context, data string) (int, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	todos, err := ical.Decode(strings.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	tasks := make([]*dao.Task, 0, len(todos))
+	for _, todo := range todos {
+		if todo.Summary == "" {
+			continue
+		}
+		task := fromTodo(todo)
+		task.UserId = uId
+		tasks = append(tasks, task)
+	}
+	if len(tasks) == 0 {
+		return 0, nil
+	}
+
+	if err := s.taskRepo.BatchCreateTask(ctx, tasks); err != nil {
+		return 0, err
+	}
+
+	return len(tasks), nil
+}
+
+// ListCollections 列出集合及其 ctag, projectIds 不为空时只返回其中存在的集合, 0 表示不属于任何项目的任务.
+// ctag 由一次按项目汇总的查询得到, 不需要逐个列出集合中的对象
+func (s *CalendarService) ListCollections(ctx context.Context, projectIds []int) ([]CalendarCollection, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		projects []*dao.Project
+		inbox    = len(projectIds) == 0
+	)
+	if inbox {
+		projects, err = s.projectRepo.FindByScope(ctx, dao.Personal(uId))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range projectIds {
+		if id == 0 {
+			inbox = true
+			continue
+		}
+		p, err := s.projectRepo.FindById(ctx, dao.Personal(uId), id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, &p)
+	}
+
+	versions, err := s.taskRepo.ProjectVersions(ctx, dao.Personal(uId), projectIds)
+	if err != nil {
+		return nil, err
+	}
+	ctags := make(map[int]string, len(versions))
+	for _, v := range versions {
+		ctags[v.ProjectId] = fmt.Sprintf("%d-%d-%d", v.Objects, v.Versions, v.Utime)
+	}
+	ctag := func(projectId int) string {
+		if c, ok := ctags[projectId]; ok {
+			return c
+		}
+		return "0-0-0"
+	}
+
+	cols := make([]CalendarCollection, 0, len(projects)+1)
+	if inbox {
+		cols = append(cols, CalendarCollection{CTag: ctag(0)})
+	}
+	for _, p := range projects {
+		cols = append(cols, CalendarCollection{ProjectId: p.Id, Name: p.Name, CTag: ctag(p.Id)})
+	}
+
+	return cols, nil
+}
+
+// ListObjects 列出集合中的对象, names 为空时返回集合内全部对象
+func (s *CalendarService) ListObjects(ctx context.Context, projectId int, names []string, withData bool) ([]CalendarObject, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*dao.Task
+	if len(names) == 0 {
+		var err error
+		tasks, err = s.taskRepo.FindByProject(ctx, dao.Personal(uId), projectId)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range names {
+			t, err := s.findObject(ctx, uId, projectId, name)
+			if errors.Is(err, ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, &t)
+		}
+	}
+
+	objects := make([]CalendarObject, 0, len(tasks))
+	for _, t := range tasks {
+		obj := CalendarObject{
+			Name:    nameOf(t),
+			Version: t.Version,
+		}
+		if withData {
+			data, err := encodeObject(t)
+			if err != nil {
+				return nil, err
+			}
+			obj.Data = data
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// PutObject 创建或覆盖集合中的对象, 返回对象的新版本以及是否为新建.
+// ifExists 要求对象存在, 覆盖时在锁定任务的事务中确认任务仍在集合中, 查询与写入之间被删除的对象不会被写回
+func (s *CalendarService) PutObject(ctx context.Context, projectId int, name, data string, ifMatch int64, ifNoneMatch, ifExists bool) (int64, bool, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if projectId != 0 {
+		if _, err := s.projectRepo.FindById(ctx, dao.Personal(uId), projectId); err != nil {
+			return 0, false, ErrProjectNotFound
+		}
+	}
+
+	todos, err := ical.Decode(strings.NewReader(data))
+	if err != nil {
+		return 0, false, err
+	}
+	if len(todos) != 1 {
+		return 0, false, ical.ErrMalformed
+	}
+	t := fromTodo(todos[0])
+	t.UserId = uId
+	t.ProjectId = projectId
+
+	existing, err := s.findObject(ctx, uId, projectId, name)
+	switch {
+	case err == nil:
+		if ifNoneMatch {
+			return 0, false, ErrPreconditionFailed
+		}
+		t.Id = existing.Id
+		version, err := s.taskRepo.ReplaceTask(ctx, dao.Personal(t.UserId), t, ifMatch)
+		if errors.Is(err, dao.ErrVersionConflict) {
+			return 0, false, ErrPreconditionFailed
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		return version, false, nil
+	case errors.Is(err, ErrObjectNotFound):
+		if ifMatch != 0 || ifExists {
+			return 0, false, ErrPreconditionFailed
+		}
+		t.Href = name
+		if err := s.taskRepo.CreateTask(ctx, t); err != nil {
+			return 0, false, err
+		}
+		return t.Version, true, nil
+	default:
+		return 0, false, err
+	}
+}
+
+// DeleteObject 删除集合中的对象, 任务会进入回收站. ifExists 时对象不存在返回 ErrPreconditionFailed
+func (s *CalendarService) DeleteObject(ctx context.Context, projectId int, name string, ifMatch int64, ifExists bool) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.findObject(ctx, uId, projectId, name)
+	if errors.Is(err, ErrObjectNotFound) && (ifMatch != 0 || ifExists) {
+		return ErrPreconditionFailed
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.taskRepo.DeleteTaskVersion(ctx, dao.Personal(uId), t.Id, ifMatch)
+	if errors.Is(err, dao.ErrVersionConflict) {
+		return ErrPreconditionFailed
+	}
+
+	return err
+}
+
+func (s *CalendarService) findObject(ctx context.Context, uid, projectId int, name string) (dao.Task, error) {
+	var (
+		t   dao.Task
+		err error
+		id  int
+	)
+	if _, scanErr := fmt.Sscanf(name, objectName, &id); scanErr == nil && fmt.Sprintf(objectName, id) == name {
+		t, err = s.taskRepo.FindById(ctx, dao.Personal(uid), id)
+		if err == nil && t.Href != "" {
+			err = gorm.ErrRecordNotFound
+		}
+	} else {
+		t, err = s.taskRepo.FindByHref(ctx, dao.Personal(uid), name)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && t.ProjectId != projectId) {
+		return dao.Task{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return dao.Task{}, err
+	}
+
+	return t, nil
+}
+
+func nameOf(t *dao.Task) string {
+	if t.Href != "" {
+		return t.Href
+	}
+
+	return fmt.Sprintf(objectName, t.Id)
+}
+
+func encodeObject(t *dao.Task) (string, error) {
+	var buf bytes.Buffer
+	cal := &ical.Calendar{
+		ProdID: calendarProdID,
+		Todos:  []ical.Todo{toTodo(t)},
+	}
+	if err := ical.Encode(&buf, cal, ical.ComponentTodo); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func toTodo(t *dao.Task) ical.Todo {
+	todo := ical.Todo{
+		UID:          t.Uid,
+		Summary:      t.Title,
+		Description:  t.Content,
+		RRule:        t.Rrule,
+		Created:      time.Unix(t.Ctime, 0),
+		LastModified: time.Unix(t.Utime, 0),
+	}
+	if todo.UID == "" {
+		todo.UID = fmt.Sprintf(calendarUID, t.Id)
+	}
+	if t.Due != 0 {
+		todo.Due = time.Unix(t.Due, 0)
+	}
+	if t.Completed != 0 {
+		todo.Status = ical.StatusCompleted
+		todo.Completed = time.Unix(t.Completed, 0)
+	}
+
+	return todo
+}
+
+func fromTodo(todo ical.Todo) *dao.Task {
+	t := &dao.Task{
+		Uid:     todo.UID,
+		Title:   truncate(todo.Summary, 128),
+		Content: todo.Description,
+		Rrule:   todo.RRule,
+	}
+	if !todo.Due.IsZero() {
+		t.Due = todo.Due.Unix()
+	}
+	if todo.Status == ical.StatusCompleted {
+		t.Completed = time.Now().Unix()
+		if !todo.Completed.IsZero() {
+			t.Completed = todo.Completed.Unix()
+		}
+	}
+
+	return t
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
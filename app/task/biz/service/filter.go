@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
+)
+
+var (
+	ErrFilterNotFound = errors.New("filter not found")
+	ErrEmptyName      = errors.New("empty name")
+)
+
+type FilterService struct {
+	repo *repository.FilterRepo
+}
+
+func NewFilterService(repo *repository.FilterRepo) *FilterService {
+	return &FilterService{repo: repo}
+}
+
+// AddFilter 保存筛选表达式, 保存前先解析一次以便尽早返回语法错误
+func (s *FilterService) AddFilter(ctx context.Context, f *dao.SavedFilter) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := normalizeFilter(f); err != nil {
+		return err
+	}
+	f.UserId = uId
+
+	return s.repo.CreateFilter(ctx, f)
+}
+
+func (s *FilterService) List(ctx context.Context) ([]*dao.SavedFilter, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUid(ctx, uId)
+}
+
+func (s *FilterService) UpdateFilter(ctx context.Context, f *dao.SavedFilter) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := normalizeFilter(f); err != nil {
+		return err
+	}
+	f.UserId = uId
+
+	err = s.repo.UpdateFilter(ctx, f)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFilterNotFound
+	}
+
+	return err
+}
+
+func (s *FilterService) DeleteFilter(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteFilter(ctx, uId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFilterNotFound
+	}
+
+	return err
+}
+
+func normalizeFilter(f *dao.SavedFilter) error {
+	f.Name = truncate(strings.TrimSpace(f.Name), 128)
+	f.Query = strings.TrimSpace(f.Query)
+	if f.Name == "" {
+		return ErrEmptyName
+	}
+	_, err := filter.Parse(f.Query)
+
+	return err
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+type ProjectService struct {
+	repo *repository.ProjectRepo
+}
+
+func NewProjectService(repo *repository.ProjectRepo) *ProjectService {
+	return &ProjectService{repo: repo}
+}
+
+func (s *ProjectService) AddProject(ctx context.Context, name string) (*dao.Project, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &dao.Project{
+		UserId:      scope.UserId,
+		WorkspaceId: scope.WorkspaceId,
+		Name:        name,
+	}
+	if err := s.repo.CreateProject(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *ProjectService) List(ctx context.Context) ([]*dao.Project, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByScope(ctx, scope)
+}
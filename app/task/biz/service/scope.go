@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+const (
+	// membershipTTL 成员身份的缓存时间, 即移除成员最长的生效延迟
+	membershipTTL = 30 * time.Second
+	// maxMemberships 缓存的成员身份数量上限, 超出时清空
+	maxMemberships = 10000
+)
+
+var (
+	ErrNotMember        = errors.New("not a member of the workspace")
+	ErrInvalidWorkspace = errors.New("invalid workspace id")
+)
+
+type scopeKey struct{}
+
+type membership struct {
+	userId      int
+	workspaceId int
+}
+
+// MembershipChecker 请求带有 workspace_id 时通过用户服务确认调用方是工作区成员, 只缓存确认成功的结果
+type MembershipChecker struct {
+	users user.WorkspaceServiceClient
+
+	mu    sync.Mutex
+	cache map[membership]time.Time
+}
+
+func NewMembershipChecker(users user.WorkspaceServiceClient) *MembershipChecker {
+	return &MembershipChecker{users: users, cache: make(map[membership]time.Time)}
+}
+
+// Authorize 由 gRPC 拦截器在校验内部凭证之后执行, 把调用方的查询范围写入 ctx.
+// 没有登录用户的调用 (日历订阅、清除数据等) 不写入范围, 由方法自行鉴权
+func (c *MembershipChecker) Authorize(ctx context.Context) (context.Context, error) {
+	uid, err := principal.UserId(ctx)
+	if err != nil {
+		return ctx, nil
+	}
+
+	s := dao.Personal(uid)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("workspace_id"); len(v) > 0 && v[0] != "" {
+		id, err := strconv.Atoi(v[0])
+		if err != nil || id <= 0 {
+			return ctx, ErrInvalidWorkspace
+		}
+		if err := c.check(ctx, uid, id); err != nil {
+			return ctx, err
+		}
+		s.WorkspaceId = id
+	}
+
+	return context.WithValue(ctx, scopeKey{}, s), nil
+}
+
+func (c *MembershipChecker) check(ctx context.Context, uid, workspaceId int) error {
+	key := membership{userId: uid, workspaceId: workspaceId}
+	now := time.Now()
+	c.mu.Lock()
+	expires, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && now.Before(expires) {
+		return nil
+	}
+
+	resp, err := c.users.CheckMembership(ctx, &user.CheckMembershipRequest{
+		UserId:      int32(uid),
+		WorkspaceId: int32(workspaceId),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetRole() == "" {
+		c.mu.Lock()
+		delete(c.cache, key)
+		c.mu.Unlock()
+		return ErrNotMember
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxMemberships {
+		clear(c.cache)
+	}
+	c.cache[key] = now.Add(membershipTTL)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// scopeOf 读取拦截器写入的查询范围
+func scopeOf(ctx context.Context) (dao.Scope, error) {
+	s, ok := ctx.Value(scopeKey{}).(dao.Scope)
+	if !ok {
+		return dao.Scope{}, principal.ErrNoUser
+	}
+
+	return s, nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+)
+
+// defaultStatsRange 未指定开始时间时统计最近 30 天
+const defaultStatsRange = 30 * 24 * time.Hour
+
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+var ErrInvalidInterval = errors.New("invalid stats interval")
+
+// StatBucket 一个统计区间, Start 为区间在用户时区中开始的时间
+type StatBucket struct {
+	Start     int64
+	Created   int64
+	Completed int64
+	Deleted   int64
+}
+
+type Stats struct {
+	Buckets   []StatBucket
+	Created   int64
+	Completed int64
+	Deleted   int64
+	// AvgCompletion 范围内完成的任务从创建到完成的平均秒数
+	AvgCompletion int64
+	CurrentStreak int64
+	LongestStreak int64
+}
+
+type StatService struct {
+	repo *repository.StatRepo
+}
+
+func NewStatService(repo *repository.StatRepo) *StatService {
+	return &StatService{repo: repo}
+}
+
+// GetStats 统计 [start, end) 内的任务数据, 天与周按 timezone 划分, 周从周一开始, 默认 UTC.
+// start 所在的天或周整体计入统计
+func (s *StatService) GetStats(ctx context.Context, start, end int64, interval, timezone string) (*Stats, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if end == 0 {
+		end = now.Unix()
+	}
+	if start == 0 {
+		start = end - int64(defaultStatsRange/time.Second)
+	}
+	if end <= start || time.Duration(end-start)*time.Second > maxReportRange {
+		return nil, ErrInvalidTimeRange
+	}
+	switch interval {
+	case "":
+		interval = IntervalDay
+	case IntervalDay, IntervalWeek:
+	default:
+		return nil, ErrInvalidInterval
+	}
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, ErrInvalidTimezone
+		}
+		loc = l
+	}
+
+	slots, err := s.repo.FindInRange(ctx, uId, bucketStart(start, interval, loc).Unix(), end)
+	if err != nil {
+		return nil, err
+	}
+	res := &Stats{Buckets: []StatBucket{}}
+	var seconds int64
+	for _, st := range slots {
+		b := bucketStart(st.Slot, interval, loc).Unix()
+		if n := len(res.Buckets); n == 0 || res.Buckets[n-1].Start != b {
+			res.Buckets = append(res.Buckets, StatBucket{Start: b})
+		}
+		cur := &res.Buckets[len(res.Buckets)-1]
+		cur.Created += st.Created
+		cur.Completed += st.Completed
+		cur.Deleted += st.Deleted
+
+		res.Created += st.Created
+		res.Completed += st.Completed
+		res.Deleted += st.Deleted
+		seconds += st.CompleteSeconds
+	}
+	if res.Completed > 0 {
+		res.AvgCompletion = seconds / res.Completed
+	}
+
+	completed, err := s.repo.CompletedSlots(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	res.CurrentStreak, res.LongestStreak = streaks(completed, now, loc)
+
+	return res, nil
+}
+
+// bucketStart 返回 at 所在的天或周在 loc 中开始的时间
+func bucketStart(at int64, interval string, loc *time.Location) time.Time {
+	day := startOfDay(time.Unix(at, 0).In(loc))
+	if interval == IntervalWeek {
+		// 周一为 0
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+
+	return day
+}
+
+// streaks 按 loc 中的自然日计算连续有完成任务的天数, slots 按时间排序.
+// 今天还没有完成任务时, 截止到昨天的连续天数仍然算作当前连续
+func streaks(slots []int64, now time.Time, loc *time.Location) (current, longest int64) {
+	var last time.Time
+	var run int64
+	for _, slot := range slots {
+		day := startOfDay(time.Unix(slot, 0).In(loc))
+		switch {
+		case day.Equal(last):
+			continue
+		case !last.IsZero() && day.Equal(last.AddDate(0, 0, 1)):
+			run++
+		default:
+			run = 1
+		}
+		last = day
+		longest = max(longest, run)
+	}
+
+	today := startOfDay(now.In(loc))
+	if !last.IsZero() && !last.Before(today.AddDate(0, 0, -1)) {
+		current = run
+	}
+
+	return current, longest
+}
+
+// startOfDay 返回 t 所在时区中当天的零点, 夏令时切换的日子也按日历日计算
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
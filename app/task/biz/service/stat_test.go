@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		interval string
+		loc      *time.Location
+		want     time.Time
+	}{
+		{"utc day", time.Date(2026, 10, 14, 23, 59, 0, 0, time.UTC), IntervalDay, time.UTC,
+			time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)},
+		// UTC 的 10 月 14 日 16:30 在上海已是 15 日
+		{"ahead of utc", time.Date(2026, 10, 14, 16, 30, 0, 0, time.UTC), IntervalDay, shanghai,
+			time.Date(2026, 10, 15, 0, 0, 0, 0, shanghai)},
+		{"behind utc", time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC), IntervalDay, newYork,
+			time.Date(2026, 10, 14, 0, 0, 0, 0, newYork)},
+		{"half hour offset", time.Date(2026, 10, 14, 18, 45, 0, 0, time.UTC), IntervalDay, kolkata,
+			time.Date(2026, 10, 15, 0, 0, 0, 0, kolkata)},
+		// 2026-03-08 纽约夏令时开始, 当天只有 23 小时
+		{"dst start", time.Date(2026, 3, 8, 23, 30, 0, 0, newYork), IntervalDay, newYork,
+			time.Date(2026, 3, 8, 0, 0, 0, 0, newYork)},
+		{"dst end", time.Date(2026, 11, 1, 23, 30, 0, 0, newYork), IntervalDay, newYork,
+			time.Date(2026, 11, 1, 0, 0, 0, 0, newYork)},
+		// 2026-10-18 是星期日
+		{"week from sunday", time.Date(2026, 10, 18, 12, 0, 0, 0, shanghai), IntervalWeek, shanghai,
+			time.Date(2026, 10, 12, 0, 0, 0, 0, shanghai)},
+		{"week from monday", time.Date(2026, 10, 19, 0, 0, 0, 0, shanghai), IntervalWeek, shanghai,
+			time.Date(2026, 10, 19, 0, 0, 0, 0, shanghai)},
+		// 周一零点在 UTC 中仍是周日
+		{"week differs from utc", time.Date(2026, 10, 18, 17, 0, 0, 0, time.UTC), IntervalWeek, shanghai,
+			time.Date(2026, 10, 19, 0, 0, 0, 0, shanghai)},
+		{"week across dst", time.Date(2026, 11, 4, 9, 0, 0, 0, newYork), IntervalWeek, newYork,
+			time.Date(2026, 11, 2, 0, 0, 0, 0, newYork)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucketStart(tt.at.Unix(), tt.interval, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("bucketStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, month time.Month, day, hour int) int64 {
+		return time.Date(2026, month, day, hour, 0, 0, 0, loc).Unix()
+	}
+
+	tests := []struct {
+		name    string
+		slots   []int64
+		now     time.Time
+		loc     *time.Location
+		current int64
+		longest int64
+	}{
+		{"none", nil, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), time.UTC, 0, 0},
+		{"today", []int64{at(time.UTC, 10, 17, 9), at(time.UTC, 10, 18, 9), at(time.UTC, 10, 19, 9)},
+			time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), time.UTC, 3, 3},
+		// 今天还没有完成任务
+		{"through yesterday", []int64{at(time.UTC, 10, 17, 9), at(time.UTC, 10, 18, 9)},
+			time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), time.UTC, 2, 2},
+		{"broken", []int64{at(time.UTC, 10, 10, 9), at(time.UTC, 10, 11, 9), at(time.UTC, 10, 12, 9), at(time.UTC, 10, 17, 9)},
+			time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), time.UTC, 0, 3},
+		{"same day counted once", []int64{at(time.UTC, 10, 18, 1), at(time.UTC, 10, 18, 5), at(time.UTC, 10, 18, 22)},
+			time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), time.UTC, 1, 1},
+		// 上海晚上 22 点与次日早上 7 点在 UTC 中是同一天, 在上海是连续两天
+		{"local days", []int64{at(shanghai, 10, 17, 22), at(shanghai, 10, 18, 7)},
+			time.Date(2026, 10, 18, 20, 0, 0, 0, shanghai), shanghai, 2, 2},
+		{"local days in utc", []int64{at(shanghai, 10, 17, 22), at(shanghai, 10, 18, 7)},
+			time.Date(2026, 10, 18, 20, 0, 0, 0, shanghai), time.UTC, 1, 1},
+		// 跨越夏令时结束的 25 小时的一天仍然连续
+		{"across dst", []int64{at(newYork, 10, 31, 23), at(newYork, 11, 1, 23), at(newYork, 11, 2, 0)},
+			time.Date(2026, 11, 2, 12, 0, 0, 0, newYork), newYork, 3, 3},
+		{"across year", []int64{at(time.UTC, 12, 31, 9), time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC).Unix()},
+			time.Date(2027, 1, 2, 9, 0, 0, 0, time.UTC), time.UTC, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := streaks(tt.slots, tt.now, tt.loc)
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("streaks = %d, %d, want %d, %d", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
@@ -3,69 +3,368 @@ package service
 import (
 	"context"
 	"errors"
-	"strconv"
-
-	"google.golang.org/grpc/metadata"
+	"strings"
+	"time"
 
 	"github.com/crazyfrankie/todolist/app/task/biz/repository"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
+	"github.com/crazyfrankie/todolist/app/task/pkg/quickadd"
+)
+
+var (
+	ErrProjectNotFound = errors.New("project not found")
+	ErrParentNotFound  = errors.New("parent task not found")
+	ErrInvalidPriority = errors.New("invalid priority")
+	ErrEmptyTitle      = errors.New("empty title")
+	ErrInvalidSnooze   = errors.New("snooze time must be in the future")
+	ErrInvalidAssignee = errors.New("assignee must be the owner of a personal task or a member of the workspace")
 )
 
 type TaskService struct {
-	repo *repository.TaskRepo
+	repo        *repository.TaskRepo
+	projectRepo *repository.ProjectRepo
+	filterRepo  *repository.FilterRepo
+	members     *MembershipChecker
+}
+
+func NewTaskService(repo *repository.TaskRepo, projectRepo *repository.ProjectRepo, filterRepo *repository.FilterRepo,
+	members *MembershipChecker) *TaskService {
+	return &TaskService{repo: repo, projectRepo: projectRepo, filterRepo: filterRepo, members: members}
+}
+
+func (s *TaskService) AddTask(ctx context.Context, t *dao.Task) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.UserId = scope.UserId
+	t.WorkspaceId = scope.WorkspaceId
+
+	t.Labels = normalizeLabels(t.Labels)
+	if t.Priority < quickadd.PriorityNone || t.Priority > quickadd.PriorityUrgent {
+		return ErrInvalidPriority
+	}
+
+	if t.ParentId != 0 {
+		parent, err := s.repo.FindById(ctx, scope, t.ParentId)
+		if err != nil {
+			return ErrParentNotFound
+		}
+		// 子任务默认与父任务在同一项目
+		if t.ProjectId == 0 {
+			t.ProjectId = parent.ProjectId
+		}
+	}
+	if t.ProjectId != 0 {
+		if _, err := s.projectRepo.FindById(ctx, scope, t.ProjectId); err != nil {
+			return ErrProjectNotFound
+		}
+	}
+
+	return s.repo.CreateTask(ctx, t)
+}
+
+// List 查询任务列表, 指定 filterId 时使用保存的筛选, 否则使用 expr, 两者都为空时返回全部可见任务.
+// 筛选中的日期按 timezone 解释
+func (s *TaskService) List(ctx context.Context, filterId int, expr, timezone string) ([]*dao.Task, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if filterId != 0 {
+		f, err := s.filterRepo.FindById(ctx, scope.UserId, filterId)
+		if err != nil {
+			return nil, ErrFilterNotFound
+		}
+		expr = f.Query
+	}
+	if strings.TrimSpace(expr) == "" {
+		return s.repo.FindVisible(ctx, scope, now.Unix())
+	}
+
+	n, err := filter.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, ErrInvalidTimezone
+		}
+		loc = l
+	}
+
+	return s.repo.FindByFilter(ctx, scope, n, now, loc)
+}
+
+// Archive 归档或取消归档任务, 归档后的任务不在任务列表中显示
+func (s *TaskService) Archive(ctx context.Context, id int, archived bool) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	var at int64
+	if archived {
+		at = time.Now().Unix()
+	}
+
+	return s.repo.Archive(ctx, scope, id, at)
+}
+
+// Snooze 延后任务到 until, 到期后任务在查询时自动重新出现, until 为 0 表示取消延后
+func (s *TaskService) Snooze(ctx context.Context, id int, until int64) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	if until != 0 && until <= time.Now().Unix() {
+		return ErrInvalidSnooze
+	}
+
+	return s.repo.Snooze(ctx, scope, id, until)
+}
+
+func (s *TaskService) ListArchived(ctx context.Context, keyword string) ([]*dao.Task, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindArchived(ctx, scope, strings.TrimSpace(keyword))
+}
+
+func (s *TaskService) ListSnoozed(ctx context.Context) ([]*dao.Task, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindSnoozed(ctx, scope, time.Now().Unix())
+}
+
+// Assign 指派任务, 个人任务只能指派给自己, 工作区任务只能指派给工作区成员. assigneeId 为 0 表示取消指派
+func (s *TaskService) Assign(ctx context.Context, id, assigneeId int) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	if assigneeId < 0 {
+		return ErrInvalidAssignee
+	}
+	if assigneeId != 0 {
+		if scope.WorkspaceId == 0 {
+			if assigneeId != scope.UserId {
+				return ErrInvalidAssignee
+			}
+		} else if err := s.members.check(ctx, assigneeId, scope.WorkspaceId); err != nil {
+			if errors.Is(err, ErrNotMember) {
+				return ErrInvalidAssignee
+			}
+			return err
+		}
+	}
+
+	return s.repo.Assign(ctx, scope, id, assigneeId)
 }
 
-func NewTaskService(repo *repository.TaskRepo) *TaskService {
-	return &TaskService{repo: repo}
+// MyAssignments 查询指派给调用方的未完成任务, 不限于请求的工作区.
+// 成员离开工作区后任务仍保留负责人, 这里按当前的成员身份排除这些任务
+func (s *TaskService) MyAssignments(ctx context.Context) ([]*dao.Task, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := s.repo.FindAssigned(ctx, scope.UserId, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.visibleTo(ctx, scope.UserId, tasks)
 }
 
-func (s *TaskService) AddTask(ctx context.Context, title, content string) error {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return errors.New("error param")
+// WorkspaceTasks 查询调用方在所在的工作区中创建或负责的全部任务, 用于导出账号数据
+func (s *TaskService) WorkspaceTasks(ctx context.Context) ([]*dao.Task, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
 	}
-	userId := md["user_id"][0]
-	uId, _ := strconv.Atoi(userId)
 
-	task := &dao.Task{
-		UserId:  uId,
-		Title:   title,
-		Content: content,
+	tasks, err := s.repo.FindContributed(ctx, scope.UserId)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repo.CreateTask(ctx, task)
+	return s.visibleTo(ctx, scope.UserId, tasks)
 }
 
-func (s *TaskService) List(ctx context.Context) ([]*dao.Task, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, errors.New("error param")
+// visibleTo 按当前的成员身份排除用户已经离开的工作区中的任务, 个人任务只保留用户自己的
+func (s *TaskService) visibleTo(ctx context.Context, uid int, tasks []*dao.Task) ([]*dao.Task, error) {
+	member := make(map[int]bool)
+	results := make([]*dao.Task, 0, len(tasks))
+	for _, t := range tasks {
+		if t.WorkspaceId == 0 {
+			if t.UserId == uid {
+				results = append(results, t)
+			}
+			continue
+		}
+		ok, checked := member[t.WorkspaceId]
+		if !checked {
+			err := s.members.check(ctx, uid, t.WorkspaceId)
+			if err != nil && !errors.Is(err, ErrNotMember) {
+				return nil, err
+			}
+			ok = err == nil
+			member[t.WorkspaceId] = ok
+		}
+		if ok {
+			results = append(results, t)
+		}
 	}
-	userId := md["user_id"][0]
-	uId, _ := strconv.Atoi(userId)
 
-	return s.repo.FindByUid(ctx, uId, 0)
+	return results, nil
 }
 
 func (s *TaskService) UpdateTask(ctx context.Context, t *dao.Task) error {
-	return s.repo.UpdateTask(ctx, t)
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateTask(ctx, scope, t); err != nil {
+		return err
+	}
+	if len(t.Labels) == 0 {
+		return nil
+	}
+	old, err := s.repo.FindById(ctx, scope, t.Id)
+	if err != nil {
+		return err
+	}
+
+	// 标签与创建任务时一样属于任务的创建者, 而不是编辑任务的成员
+	return s.repo.ReplaceLabels(ctx, old.UserId, t.Id, normalizeLabels(t.Labels))
+}
+
+func (s *TaskService) SetPriority(ctx context.Context, id, priority int) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	if priority < quickadd.PriorityNone || priority > quickadd.PriorityUrgent {
+		return ErrInvalidPriority
+	}
+	if _, err := s.repo.FindById(ctx, scope, id); err != nil {
+		return err
+	}
+
+	return s.repo.SetPriority(ctx, scope, id, priority)
+}
+
+// QuickAdd 解析快速添加的文本, preview 为 false 时按解析结果创建任务并返回任务 id
+func (s *TaskService) QuickAdd(ctx context.Context, text, timezone string, projectId int, preview bool) (quickadd.Result, int, error) {
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return quickadd.Result{}, 0, ErrInvalidTimezone
+		}
+		loc = l
+	}
+
+	res := quickadd.Parse(text, time.Now(), loc)
+	res.Title = truncate(res.Title, 128)
+	res.Labels = normalizeLabels(res.Labels)
+	if res.Title == "" {
+		return res, 0, ErrEmptyTitle
+	}
+	if preview {
+		return res, 0, nil
+	}
+
+	t := &dao.Task{
+		Title:     res.Title,
+		Rrule:     res.RRule,
+		ProjectId: projectId,
+		Labels:    res.Labels,
+		Priority:  res.Priority,
+	}
+	if !res.Due.IsZero() {
+		t.Due = res.Due.Unix()
+	}
+	if err := s.AddTask(ctx, t); err != nil {
+		return res, 0, err
+	}
+
+	return res, t.Id, nil
 }
 
 func (s *TaskService) DeleteTask(ctx context.Context, id int) error {
-	return s.repo.DeleteTask(ctx, id)
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteTask(ctx, scope, id)
 }
 
 func (s *TaskService) RecycleBin(ctx context.Context) ([]*dao.Task, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, errors.New("error param")
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
 	}
-	userId := md["user_id"][0]
-	uId, _ := strconv.Atoi(userId)
 
-	return s.repo.FindByUid(ctx, uId, 1)
+	return s.repo.FindByScope(ctx, scope, 1)
 }
 
 func (s *TaskService) RestoreTask(ctx context.Context, id int) error {
-	return s.repo.RestoreTask(ctx, id)
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RestoreTask(ctx, scope, id)
+}
+
+func (s *TaskService) CompleteTask(ctx context.Context, id int, completed bool) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	var at int64
+	if completed {
+		at = time.Now().Unix()
+	}
+
+	return s.repo.CompleteTask(ctx, scope, id, at)
+}
+
+// normalizeLabels 去掉标签两端的空白与 # 前缀, 并去重
+func normalizeLabels(labels []string) []string {
+	res := make([]string, 0, len(labels))
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		l = truncate(strings.TrimPrefix(strings.TrimSpace(l), "#"), 64)
+		if l == "" {
+			continue
+		}
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		res = append(res, l)
+	}
+
+	return res
 }
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrMissingVariable  = errors.New("missing template variable")
+)
+
+var placeholder = regexp.MustCompile(`{{\s*([A-Za-z0-9_]+)\s*}}`)
+
+type TemplateService struct {
+	repo        *repository.TemplateRepo
+	taskRepo    *repository.TaskRepo
+	projectRepo *repository.ProjectRepo
+}
+
+func NewTemplateService(repo *repository.TemplateRepo, taskRepo *repository.TaskRepo, projectRepo *repository.ProjectRepo) *TemplateService {
+	return &TemplateService{repo: repo, taskRepo: taskRepo, projectRepo: projectRepo}
+}
+
+func (s *TemplateService) AddTemplate(ctx context.Context, t *dao.TaskTemplate) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.UserId = uId
+	normalizeItems(t.Items)
+
+	return s.repo.CreateTemplate(ctx, t)
+}
+
+func (s *TemplateService) List(ctx context.Context) ([]*dao.TaskTemplate, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUid(ctx, uId)
+}
+
+func (s *TemplateService) DeleteTemplate(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteTemplate(ctx, uId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTemplateNotFound
+	}
+
+	return err
+}
+
+// Instantiate 按模板创建任务, 所有任务在同一个事务中创建, 返回创建的任务数.
+// 模板属于个人, 任务创建在调用方当前的范围中
+func (s *TemplateService) Instantiate(ctx context.Context, id int, base int64, projectId int, vars map[string]string) (int, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tpl, err := s.repo.FindById(ctx, scope.UserId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrTemplateNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if projectId != 0 {
+		if _, err := s.projectRepo.FindById(ctx, scope, projectId); err != nil {
+			return 0, ErrProjectNotFound
+		}
+	}
+
+	baseTime := time.Now()
+	if base != 0 {
+		baseTime = time.Unix(base, 0)
+	}
+	values := map[string]string{
+		"date": baseTime.Format(time.DateOnly),
+		"time": baseTime.Format("15:04"),
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+
+	b := &instantiator{scope: scope, projectId: projectId, base: baseTime.Unix(), values: values}
+	nodes := b.build(tpl.Items)
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	return s.taskRepo.CreateTree(ctx, nodes)
+}
+
+// instantiator 将模板条目转换为待创建的任务树, 并完成变量替换
+type instantiator struct {
+	scope     dao.Scope
+	projectId int
+	base      int64
+	values    map[string]string
+	err       error
+}
+
+func (b *instantiator) build(items []*dao.TemplateItem) []*dao.TaskNode {
+	nodes := make([]*dao.TaskNode, 0, len(items))
+	for _, item := range items {
+		t := &dao.Task{
+			UserId:      b.scope.UserId,
+			WorkspaceId: b.scope.WorkspaceId,
+			ProjectId:   b.projectId,
+			Title:       truncate(b.substitute(item.Title), 128),
+			Content:     b.substitute(item.Content),
+		}
+		if item.DueOffset != nil {
+			t.Due = b.base + *item.DueOffset
+		}
+		labels := make([]string, 0)
+		for _, l := range splitLabels(item.Labels) {
+			labels = append(labels, b.substitute(l))
+		}
+		t.Labels = normalizeLabels(labels)
+
+		nodes = append(nodes, &dao.TaskNode{
+			Task:     t,
+			Children: b.build(item.Subtasks),
+		})
+	}
+
+	return nodes
+}
+
+func (b *instantiator) substitute(s string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		key := placeholder.FindStringSubmatch(m)[1]
+		v, ok := b.values[key]
+		if !ok {
+			if b.err == nil {
+				b.err = fmt.Errorf("%w: %s", ErrMissingVariable, key)
+			}
+			return m
+		}
+		return v
+	})
+}
+
+func normalizeItems(items []*dao.TemplateItem) {
+	for _, item := range items {
+		item.Title = truncate(item.Title, 128)
+		item.Labels = joinLabels(splitLabels(item.Labels))
+		normalizeItems(item.Subtasks)
+	}
+}
+
+func joinLabels(labels []string) string {
+	return strings.Join(normalizeLabels(labels), ",")
+}
+
+func splitLabels(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+
+	return strings.Split(labels, ",")
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository"
+	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
+)
+
+const (
+	GroupByDay     = "day"
+	GroupByProject = "project"
+	GroupByLabel   = "label"
+
+	// maxReportRange 单次报表最多覆盖的时间范围
+	maxReportRange = 366 * 24 * time.Hour
+)
+
+var (
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrNoRunningTimer     = errors.New("no running timer")
+	ErrTimeEntryNotFound  = errors.New("time entry not found")
+	ErrInvalidTimeRange   = errors.New("invalid time range")
+	ErrInvalidReportGroup = errors.New("invalid report group")
+	ErrInvalidTimezone    = errors.New("invalid timezone")
+)
+
+// ReportRow 报表中的一行, Seconds 为该分组在时间范围内的耗时
+type ReportRow struct {
+	Key     string
+	Name    string
+	Seconds int64
+}
+
+type TimeService struct {
+	repo        *repository.TimeEntryRepo
+	taskRepo    *repository.TaskRepo
+	projectRepo *repository.ProjectRepo
+}
+
+func NewTimeService(repo *repository.TimeEntryRepo, taskRepo *repository.TaskRepo, projectRepo *repository.ProjectRepo) *TimeService {
+	return &TimeService{repo: repo, taskRepo: taskRepo, projectRepo: projectRepo}
+}
+
+// StartTimer 开始计时, 同一用户运行中的计时会被自动停止
+func (s *TimeService) StartTimer(ctx context.Context, taskId int, note string) (*dao.TimeEntry, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.taskRepo.FindById(ctx, scope, taskId); err != nil {
+		return nil, ErrTaskNotFound
+	}
+
+	e := &dao.TimeEntry{
+		UserId: scope.UserId,
+		TaskId: taskId,
+		Note:   truncate(note, 255),
+	}
+	if _, err := s.repo.StartTimer(ctx, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (s *TimeService) StopTimer(ctx context.Context) (*dao.TimeEntry, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := s.repo.StopTimer(ctx, uId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoRunningTimer
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Running 返回运行中的计时, 没有时返回 nil
+func (s *TimeService) Running(ctx context.Context) (*dao.TimeEntry, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := s.repo.FindRunning(ctx, uId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// AddEntry 手动补录一段计时
+func (s *TimeService) AddEntry(ctx context.Context, taskId int, start, end int64, note string) (*dao.TimeEntry, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if start <= 0 || end <= start {
+		return nil, ErrInvalidTimeRange
+	}
+	if _, err := s.taskRepo.FindById(ctx, scope, taskId); err != nil {
+		return nil, ErrTaskNotFound
+	}
+
+	e := &dao.TimeEntry{
+		UserId:  scope.UserId,
+		TaskId:  taskId,
+		StartAt: start,
+		EndAt:   end,
+		Note:    truncate(note, 255),
+	}
+	if err := s.repo.CreateEntry(ctx, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ListEntries 返回任务的全部计时及累计耗时, taskId 为 0 时返回用户的全部计时
+func (s *TimeService) ListEntries(ctx context.Context, taskId int) ([]*dao.TimeEntry, int64, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []*dao.TimeEntry
+	if taskId == 0 {
+		entries, err = s.repo.FindByUser(ctx, uId)
+	} else {
+		entries, err = s.repo.FindByTask(ctx, uId, taskId)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now().Unix()
+	var total int64
+	for _, e := range entries {
+		total += Duration(e, now)
+	}
+
+	return entries, total, nil
+}
+
+func (s *TimeService) DeleteEntry(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteEntry(ctx, uId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTimeEntryNotFound
+	}
+
+	return err
+}
+
+// Report 按天、项目或标签汇总 [start, end) 内的耗时, 跨越边界的计时只统计范围内的部分.
+// 按标签汇总时一段计时会计入其任务的每个标签, 总计不重复计算
+func (s *TimeService) Report(ctx context.Context, start, end int64, groupBy, timezone string) ([]ReportRow, int64, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if end <= start || time.Duration(end-start)*time.Second > maxReportRange {
+		return nil, 0, ErrInvalidTimeRange
+	}
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, 0, ErrInvalidTimezone
+		}
+		loc = l
+	}
+
+	entries, err := s.repo.FindInRange(ctx, uId, start, end)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now().Unix()
+	sums := make(map[string]int64)
+	names := make(map[string]string)
+	var total int64
+	add := func(key string, seconds int64) {
+		if seconds > 0 {
+			sums[key] += seconds
+		}
+	}
+
+	switch groupBy {
+	case GroupByDay:
+		for _, e := range entries {
+			from, to := clip(e, start, end, now)
+			total += to - from
+			for from < to {
+				day := time.Unix(from, 0).In(loc)
+				y, m, d := day.Date()
+				next := time.Date(y, m, d+1, 0, 0, 0, 0, loc).Unix()
+				add(day.Format(time.DateOnly), min(next, to)-from)
+				from = next
+			}
+		}
+	case GroupByProject, GroupByLabel:
+		// 计时记录属于用户自己, 其中的任务可能在个人范围或用户所在的任意工作区中
+		tasks, err := s.taskRepo.FindByIds(ctx, taskIds(entries))
+		if err != nil {
+			return nil, 0, err
+		}
+		byId := make(map[int]*dao.Task, len(tasks))
+		for _, t := range tasks {
+			byId[t.Id] = t
+		}
+
+		if groupBy == GroupByProject {
+			projects, err := s.projectRepo.FindByIds(ctx, projectIds(tasks))
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, p := range projects {
+				names[strconv.Itoa(p.Id)] = p.Name
+			}
+		}
+
+		for _, e := range entries {
+			from, to := clip(e, start, end, now)
+			total += to - from
+
+			t, ok := byId[e.TaskId]
+			if !ok {
+				t = &dao.Task{}
+			}
+			if groupBy == GroupByProject {
+				add(strconv.Itoa(t.ProjectId), to-from)
+				continue
+			}
+			if len(t.Labels) == 0 {
+				add("", to-from)
+			}
+			for _, l := range t.Labels {
+				add(l, to-from)
+			}
+		}
+	default:
+		return nil, 0, ErrInvalidReportGroup
+	}
+
+	rows := make([]ReportRow, 0, len(sums))
+	for k, v := range sums {
+		name := k
+		if groupBy == GroupByProject {
+			name = names[k]
+		}
+		rows = append(rows, ReportRow{Key: k, Name: name, Seconds: v})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if groupBy != GroupByDay && rows[i].Seconds != rows[j].Seconds {
+			return rows[i].Seconds > rows[j].Seconds
+		}
+		return rows[i].Key < rows[j].Key
+	})
+
+	return rows, total, nil
+}
+
+// Duration 返回计时的时长, 运行中的计时按 now 计算
+func Duration(e *dao.TimeEntry, now int64) int64 {
+	if e.EndAt == 0 {
+		return max(now-e.StartAt, 0)
+	}
+
+	return e.EndAt - e.StartAt
+}
+
+func clip(e *dao.TimeEntry, start, end, now int64) (int64, int64) {
+	to := e.EndAt
+	if to == 0 {
+		to = now
+	}
+	from := max(e.StartAt, start)
+	to = min(to, end)
+	if to < from {
+		to = from
+	}
+
+	return from, to
+}
+
+func taskIds(entries []*dao.TimeEntry) []int {
+	seen := make(map[int]struct{}, len(entries))
+	ids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		if _, ok := seen[e.TaskId]; ok {
+			continue
+		}
+		seen[e.TaskId] = struct{}{}
+		ids = append(ids, e.TaskId)
+	}
+
+	return ids
+}
+
+func projectIds(tasks []*dao.Task) []int {
+	seen := make(map[int]struct{}, len(tasks))
+	ids := make([]int, 0, len(tasks))
+	for _, t := range tasks {
+		if _, ok := seen[t.ProjectId]; ok || t.ProjectId == 0 {
+			continue
+		}
+		seen[t.ProjectId] = struct{}{}
+		ids = append(ids, t.ProjectId)
+	}
+
+	return ids
+}
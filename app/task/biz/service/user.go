@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/task/pkg/lru"
+)
+
+const (
+	// userCacheSize 缓存的用户数上限
+	userCacheSize = 10000
+	// userCacheTTL 修改昵称与头像后最长的生效延迟
+	userCacheTTL = 5 * time.Minute
+	// userBatchSize 用户服务一次批量查询的上限
+	userBatchSize = 500
+)
+
+// UserSummary 任务响应中展示的用户信息
+type UserSummary struct {
+	Id          int
+	Name        string
+	DisplayName string
+	Avatar      string
+}
+
+// UserDirectory 通过用户服务批量查询用户信息, 缓存在进程内, 一次请求中的全部用户只需要一次调用
+type UserDirectory struct {
+	users user.UserServiceClient
+	cache *lru.Cache[int, UserSummary]
+}
+
+func NewUserDirectory(users user.UserServiceClient) *UserDirectory {
+	return &UserDirectory{users: users, cache: lru.New[int, UserSummary](userCacheSize, userCacheTTL)}
+}
+
+// Lookup 查询一组用户, 不存在的用户同样缓存, 结果中 Id 为 0
+func (d *UserDirectory) Lookup(ctx context.Context, ids []int) (map[int]UserSummary, error) {
+	results := make(map[int]UserSummary, len(ids))
+	var missing []int32
+	for _, id := range ids {
+		if _, ok := results[id]; ok || id == 0 {
+			continue
+		}
+		u, ok := d.cache.Get(id)
+		if !ok {
+			missing = append(missing, int32(id))
+		}
+		results[id] = u
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	for batch := range slices.Chunk(missing, userBatchSize) {
+		resp, err := d.users.BatchGetUsers(ctx, &user.BatchGetUsersRequest{Ids: batch})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range resp.GetUsers() {
+			results[int(u.GetId())] = UserSummary{
+				Id:          int(u.GetId()),
+				Name:        u.GetName(),
+				DisplayName: u.GetDisplayName(),
+				Avatar:      u.GetAvatar(),
+			}
+		}
+	}
+	for _, id := range missing {
+		d.cache.Add(int(id), results[int(id)])
+	}
+
+	return results, nil
+}
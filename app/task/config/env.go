@@ -15,6 +15,8 @@ type EnvConfig struct {
 	MySQLHost     string
 	MySQLPort     string
 	MySQLDb       string
+	// InternalKey 签名服务间内部凭证的共享密钥, 网关与各服务需要配置同一个值
+	InternalKey string
 }
 
 var envConfig *EnvConfig
@@ -27,6 +29,7 @@ func LoadEnvConfig() error {
 		MySQLHost:     os.Getenv("MYSQL_HOST"),
 		MySQLPort:     os.Getenv("MYSQL_PORT"),
 		MySQLDb:       os.Getenv("MYSQL_DB"),
+		InternalKey:   os.Getenv("INTERNAL_AUTH_KEY"),
 	}
 	return nil
 }
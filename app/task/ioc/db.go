@@ -1,9 +1,11 @@
 package ioc
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
+	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
@@ -58,7 +60,19 @@ func (p *DBProvider) refreshConnection() {
 		panic(err)
 	}
 
-	db.AutoMigrate(&dao.Task{})
+	// 统计表首次创建时从已有任务重建
+	rebuild := !db.Migrator().HasTable(&dao.TaskStat{})
+	db.AutoMigrate(&dao.Task{}, &dao.CalendarToken{}, &dao.Project{}, &dao.TaskLabel{}, &dao.TaskTemplate{}, &dao.TemplateItem{},
+		&dao.TimeEntry{}, &dao.TaskStat{}, &dao.SavedFilter{})
+	if rebuild {
+		if err := dao.NewStatDao(db).Rebuild(context.Background()); err != nil {
+			// 重建失败不影响服务, 之后的写操作仍会继续累计统计
+			zap.L().Error("Failed to rebuild task stats", zap.Error(err))
+		} else if err := db.Migrator().DropTable("task_daily_stat"); err != nil {
+			// 之前按 UTC 天汇总的统计表, 已由 task_stat 取代
+			zap.L().Error("Failed to drop task_daily_stat", zap.Error(err))
+		}
+	}
 
 	p.mu.Lock()
 	oldDB := p.db
@@ -0,0 +1,57 @@
+package ioc
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/resolver"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/task/config"
+)
+
+// InitUserConn 通过 etcd 发现用户服务, WorkspaceService 与 UserService 共用连接
+func InitUserConn(cli *clientv3.Client, key *principal.Key) *grpc.ClientConn {
+	builder, err := resolver.NewBuilder(cli)
+	if err != nil {
+		panic(err)
+	}
+	conn, err := grpc.NewClient("etcd:///service/user",
+		grpc.WithResolvers(builder),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithChainUnaryInterceptor(principal.UnaryClientInterceptor(key, principal.IssuerTask, nil)),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return conn
+}
+
+// InitWorkspaceClient 用于确认调用方是工作区成员
+func InitWorkspaceClient(conn *grpc.ClientConn) user.WorkspaceServiceClient {
+	return user.NewWorkspaceServiceClient(conn)
+}
+
+// InitUserClient 用于查询任务创建者与负责人的展示信息
+func InitUserClient(conn *grpc.ClientConn) user.UserServiceClient {
+	return user.NewUserServiceClient(conn)
+}
+
+// InitPrincipalKey 没有内部凭证密钥时无法校验调用方, 拒绝启动
+func InitPrincipalKey() *principal.Key {
+	env := config.GetEnvConfig()
+	if env == nil || env.InternalKey == "" {
+		panic("INTERNAL_AUTH_KEY is not set")
+	}
+	key, err := principal.NewKey(env.InternalKey)
+	if err != nil {
+		panic("invalid INTERNAL_AUTH_KEY: " + err.Error())
+	}
+
+	return key
+}
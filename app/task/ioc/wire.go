@@ -3,12 +3,12 @@
 package ioc
 
 import (
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/task/biz/service"
 	"github.com/crazyfrankie/todolist/app/task/rpc"
 	"github.com/crazyfrankie/todolist/app/task/rpc/server"
-	"github.com/crazyfrankie/todolist/app/task/rpc_gen/task"
 	"github.com/google/wire"
 	"google.golang.org/grpc"
 )
@@ -16,9 +16,37 @@ import (
 func InitTask() *rpc.Server {
 	wire.Build(
 		InitDB,
+		InitPrincipalKey,
+		InitUserConn,
+		InitWorkspaceClient,
+		InitUserClient,
 		dao.NewTaskDao,
+		dao.NewCalendarDao,
+		dao.NewProjectDao,
+		dao.NewLabelDao,
+		dao.NewTemplateDao,
+		dao.NewTimeEntryDao,
+		dao.NewStatDao,
+		dao.NewFilterDao,
+		dao.NewAccountDao,
 		repository.NewTaskRepo,
+		repository.NewCalendarRepo,
+		repository.NewProjectRepo,
+		repository.NewTemplateRepo,
+		repository.NewTimeEntryRepo,
+		repository.NewStatRepo,
+		repository.NewFilterRepo,
+		repository.NewAccountRepo,
 		service.NewTaskService,
+		service.NewCalendarService,
+		service.NewProjectService,
+		service.NewTemplateService,
+		service.NewTimeService,
+		service.NewStatService,
+		service.NewFilterService,
+		service.NewAccountService,
+		service.NewMembershipChecker,
+		service.NewUserDirectory,
 		server.NewTaskServer,
 		InitRegistry,
 		registerService,
@@ -7,12 +7,12 @@
 package ioc
 
 import (
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/task/biz/service"
 	"github.com/crazyfrankie/todolist/app/task/rpc"
 	"github.com/crazyfrankie/todolist/app/task/rpc/server"
-	"github.com/crazyfrankie/todolist/app/task/rpc_gen/task"
 	"google.golang.org/grpc"
 )
 
@@ -22,11 +22,39 @@ func InitTask() *rpc.Server {
 	client := InitRegistry()
 	db := InitDB()
 	taskDao := dao.NewTaskDao(db)
-	taskRepo := repository.NewTaskRepo(taskDao)
-	taskService := service.NewTaskService(taskRepo)
-	taskServer := server.NewTaskServer(taskService)
+	labelDao := dao.NewLabelDao(db)
+	timeEntryDao := dao.NewTimeEntryDao(db)
+	taskRepo := repository.NewTaskRepo(taskDao, labelDao, timeEntryDao)
+	projectDao := dao.NewProjectDao(db)
+	projectRepo := repository.NewProjectRepo(projectDao)
+	filterDao := dao.NewFilterDao(db)
+	filterRepo := repository.NewFilterRepo(filterDao)
+	key := InitPrincipalKey()
+	clientConn := InitUserConn(client, key)
+	workspaceServiceClient := InitWorkspaceClient(clientConn)
+	membershipChecker := service.NewMembershipChecker(workspaceServiceClient)
+	taskService := service.NewTaskService(taskRepo, projectRepo, filterRepo, membershipChecker)
+	calendarDao := dao.NewCalendarDao(db)
+	calendarRepo := repository.NewCalendarRepo(calendarDao)
+	calendarService := service.NewCalendarService(calendarRepo, taskRepo, projectRepo)
+	projectService := service.NewProjectService(projectRepo)
+	templateDao := dao.NewTemplateDao(db)
+	templateRepo := repository.NewTemplateRepo(templateDao)
+	templateService := service.NewTemplateService(templateRepo, taskRepo, projectRepo)
+	timeEntryRepo := repository.NewTimeEntryRepo(timeEntryDao)
+	timeService := service.NewTimeService(timeEntryRepo, taskRepo, projectRepo)
+	statDao := dao.NewStatDao(db)
+	statRepo := repository.NewStatRepo(statDao)
+	statService := service.NewStatService(statRepo)
+	filterService := service.NewFilterService(filterRepo)
+	accountDao := dao.NewAccountDao(db)
+	accountRepo := repository.NewAccountRepo(accountDao)
+	accountService := service.NewAccountService(accountRepo)
+	userServiceClient := InitUserClient(clientConn)
+	userDirectory := service.NewUserDirectory(userServiceClient)
+	taskServer := server.NewTaskServer(taskService, calendarService, projectService, templateService, timeService, statService, filterService, accountService, userDirectory)
 	v := registerService(taskServer)
-	rpcServer := rpc.NewServer(client, v)
+	rpcServer := rpc.NewServer(client, v, membershipChecker, key)
 	return rpcServer
 }
 
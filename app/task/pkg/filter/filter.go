@@ -0,0 +1,399 @@
+// Package filter 实现任务筛选表达式的解析, 例如
+//
+//	priority>=high AND label:work AND due<7d
+//	(is:open OR is:snoozed) -label:someday "weekly report"
+//	assignee:me OR assignee:none
+//
+// 条件之间默认为 AND, 支持 OR、NOT (或前缀 -) 与括号, 不带字段的词按标题与内容搜索.
+// 解析结果只描述条件, 由调用方编译成查询
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FieldPriority = "priority"
+	FieldDue      = "due"
+	FieldCreated  = "created"
+	FieldUpdated  = "updated"
+	FieldLabel    = "label"
+	FieldProject  = "project"
+	FieldTitle    = "title"
+	FieldContent  = "content"
+	FieldIs       = "is"
+	FieldHas      = "has"
+	FieldAssignee = "assignee"
+
+	OpEq = "="
+	OpNe = "!="
+	OpLt = "<"
+	OpLe = "<="
+	OpGt = ">"
+	OpGe = ">="
+
+	// maxLength 表达式的最大长度, 避免生成过大的查询
+	maxLength = 1024
+	maxDepth  = 32
+)
+
+var priorities = map[string]int64{
+	"none": 0, "low": 1, "medium": 2, "med": 2, "high": 3, "urgent": 4,
+}
+
+// 各字段支持的取值
+var (
+	isValues  = []string{"open", "completed", "archived", "snoozed", "recurring", "subtask"}
+	hasValues = []string{"due", "label", "rrule", "project", "content", "assignee"}
+)
+
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Msg, e.Pos+1)
+}
+
+type Node interface {
+	node()
+}
+
+type And struct {
+	Left, Right Node
+}
+
+type Or struct {
+	Left, Right Node
+}
+
+type Not struct {
+	X Node
+}
+
+// Text 不带字段的搜索词
+type Text struct {
+	Value string
+}
+
+// Cond 一个字段条件, 根据字段不同只有一个取值字段有意义
+type Cond struct {
+	Field string
+	Op    string
+	// Str 用于 label、project 名称、title、content、is、has 与 assignee 的 me 和 none
+	Str string
+	// Int 用于 priority、project id 与 assignee id
+	Int int64
+	// Time 用于 due、created 与 updated
+	Time *TimeValue
+}
+
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+func (Text) node() {}
+func (Cond) node() {}
+
+// TimeValue 时间条件的取值: 相对当前的偏移, 某一天, 或 none 表示没有设置
+type TimeValue struct {
+	None   bool
+	Offset time.Duration
+	// Days 相对今天的天数, Date 不为空时使用具体日期
+	Days     int
+	Date     string
+	WholeDay bool
+}
+
+// Range 把取值解析为 [from, to) 区间, 相对偏移解析为一个时间点
+func (v *TimeValue) Range(now time.Time, loc *time.Location) (int64, int64) {
+	if !v.WholeDay {
+		at := now.Add(v.Offset).Unix()
+		return at, at + 1
+	}
+
+	now = now.In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, v.Days)
+	if v.Date != "" {
+		day, _ = time.ParseInLocation(time.DateOnly, v.Date, loc)
+	}
+
+	return day.Unix(), day.AddDate(0, 0, 1).Unix()
+}
+
+// Mentions 判断表达式中是否出现了 field:value 条件
+func Mentions(n Node, field, value string) bool {
+	switch n := n.(type) {
+	case *And:
+		return Mentions(n.Left, field, value) || Mentions(n.Right, field, value)
+	case *Or:
+		return Mentions(n.Left, field, value) || Mentions(n.Right, field, value)
+	case *Not:
+		return Mentions(n.X, field, value)
+	case *Cond:
+		return n.Field == field && n.Str == value
+	}
+
+	return false
+}
+
+// Parse 解析筛选表达式
+func Parse(s string) (Node, error) {
+	if len(s) > maxLength {
+		return nil, &SyntaxError{Pos: maxLength, Msg: "expression too long"}
+	}
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty expression"}
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+
+	return n, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) or(depth int) (Node, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and(depth int) (Node, error) {
+	left, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokNot, tokLParen, tokWord, tokString:
+			// 相邻的条件之间默认为 AND
+		default:
+			return left, nil
+		}
+		right, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) unary(depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, &SyntaxError{Pos: p.peek().pos, Msg: "expression nested too deeply"}
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		x, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	case tokLParen:
+		n, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if r := p.next(); r.kind != tokRParen {
+			return nil, &SyntaxError{Pos: r.pos, Msg: "missing )"}
+		}
+		return n, nil
+	case tokString:
+		return &Text{Value: t.text}, nil
+	case tokWord:
+		if p.peek().kind != tokOp {
+			return &Text{Value: t.text}, nil
+		}
+		op := p.next()
+		v := p.next()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, &SyntaxError{Pos: v.pos, Msg: "missing value after " + op.text}
+		}
+		return newCond(t, op, v)
+	case tokEOF:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected end of expression"}
+	default:
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+}
+
+func newCond(field, op, value token) (Node, error) {
+	c := &Cond{Field: strings.ToLower(field.text), Op: op.text}
+	if c.Op == ":" {
+		c.Op = OpEq
+	}
+	v := value.text
+	lower := strings.ToLower(v)
+	invalid := func(msg string) error {
+		return &SyntaxError{Pos: value.pos, Msg: msg}
+	}
+	equalityOnly := func() error {
+		if c.Op != OpEq && c.Op != OpNe {
+			return &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("%s only supports : = and !=", c.Field)}
+		}
+		return nil
+	}
+
+	switch c.Field {
+	case FieldPriority:
+		n, ok := priorities[lower]
+		if !ok {
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || i < 0 || i > 4 {
+				return nil, invalid(fmt.Sprintf("invalid priority %q", v))
+			}
+			n = i
+		}
+		c.Int = n
+	case FieldDue, FieldCreated, FieldUpdated:
+		t, err := parseTime(lower)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+		if t.None {
+			if err := equalityOnly(); err != nil {
+				return nil, err
+			}
+		}
+		c.Time = t
+	case FieldLabel, FieldTitle, FieldContent:
+		if err := equalityOnly(); err != nil {
+			return nil, err
+		}
+		// label:none 表示没有标签
+		c.Str = strings.TrimPrefix(v, "#")
+	case FieldProject:
+		if err := equalityOnly(); err != nil {
+			return nil, err
+		}
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.Int = id
+		} else {
+			c.Str = v
+		}
+	case FieldAssignee:
+		if err := equalityOnly(); err != nil {
+			return nil, err
+		}
+		// assignee:me 为调用方, assignee:none 为未指派, 否则为用户 id
+		switch lower {
+		case "me", "none":
+			c.Str = lower
+		default:
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, invalid(fmt.Sprintf("invalid assignee %q, expected me, none or a user id", v))
+			}
+			c.Int = id
+		}
+	case FieldIs, FieldHas:
+		if err := equalityOnly(); err != nil {
+			return nil, err
+		}
+		values := isValues
+		if c.Field == FieldHas {
+			values = hasValues
+		}
+		if lower == "labels" {
+			lower = "label"
+		}
+		if !contains(values, lower) {
+			return nil, invalid(fmt.Sprintf("invalid value %q for %s, expected one of %s", v, c.Field, strings.Join(values, ", ")))
+		}
+		c.Str = lower
+	default:
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("unknown field %q", field.text)}
+	}
+
+	return c, nil
+}
+
+// parseTime 解析时间取值: none, now, today, tomorrow, yesterday, 2026-01-02, 或 7d / -2w / 3h 这样的相对偏移
+func parseTime(v string) (*TimeValue, error) {
+	switch v {
+	case "none":
+		return &TimeValue{None: true}, nil
+	case "now":
+		return &TimeValue{}, nil
+	case "today":
+		return &TimeValue{WholeDay: true}, nil
+	case "tomorrow":
+		return &TimeValue{WholeDay: true, Days: 1}, nil
+	case "yesterday":
+		return &TimeValue{WholeDay: true, Days: -1}, nil
+	}
+
+	if _, err := time.Parse(time.DateOnly, v); err == nil {
+		return &TimeValue{WholeDay: true, Date: v}, nil
+	}
+
+	if len(v) >= 2 {
+		n, err := strconv.Atoi(strings.TrimPrefix(v[:len(v)-1], "+"))
+		if err == nil && n > -100000 && n < 100000 {
+			switch v[len(v)-1] {
+			case 'h':
+				return &TimeValue{Offset: time.Duration(n) * time.Hour}, nil
+			case 'd':
+				return &TimeValue{Offset: time.Duration(n) * 24 * time.Hour}, nil
+			case 'w':
+				return &TimeValue{Offset: time.Duration(n) * 7 * 24 * time.Hour}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("invalid time %q", v)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// show 把语法树输出为前缀形式, 便于比较结合顺序
+func show(n Node) string {
+	switch n := n.(type) {
+	case *And:
+		return "(and " + show(n.Left) + " " + show(n.Right) + ")"
+	case *Or:
+		return "(or " + show(n.Left) + " " + show(n.Right) + ")"
+	case *Not:
+		return "(not " + show(n.X) + ")"
+	case *Text:
+		return fmt.Sprintf("%q", n.Value)
+	case *Cond:
+		v := n.Str
+		switch {
+		case n.Time != nil:
+			v = fmt.Sprintf("%+v", *n.Time)
+		case n.Str == "":
+			v = fmt.Sprint(n.Int)
+		}
+		return n.Field + n.Op + v
+	}
+
+	return "?"
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// 优先级: NOT > AND > OR, 同级从左结合
+		{"a b", `(and "a" "b")`},
+		{"a AND b AND c", `(and (and "a" "b") "c")`},
+		{"a OR b c", `(or "a" (and "b" "c"))`},
+		{"a b OR c", `(or (and "a" "b") "c")`},
+		{"a || b && c", `(or "a" (and "b" "c"))`},
+		{"a or b or c", `(or (or "a" "b") "c")`},
+		{"NOT a b", `(and (not "a") "b")`},
+		{"-a OR b", `(or (not "a") "b")`},
+		{"not not a", `(not (not "a"))`},
+		// 括号
+		{"(a OR b) c", `(and (or "a" "b") "c")`},
+		{"a (b OR c)", `(and "a" (or "b" "c"))`},
+		{"-(a b)", `(not (and "a" "b"))`},
+		{`-"draft" x`, `(and (not "draft") "x")`},
+		{"a - b", `(and (and "a" "-") "b")`},
+		{"((a))", `"a"`},
+		{"(is:open OR is:snoozed) -label:someday", `(and (or is=open is=snoozed) (not label=someday))`},
+		// 引号
+		{`"weekly report"`, `"weekly report"`},
+		{`"a OR b"`, `"a OR b"`},
+		{`"(x)" y`, `(and "(x)" "y")`},
+		{`title:"team sync"`, `title=team sync`},
+		{`label:"#home"`, `label=home`},
+		{`""`, `""`},
+		// 运算符之后的 - 与关键字属于取值
+		{"due>-2d", `due>{None:false Offset:-48h0m0s Days:0 Date: WholeDay:false}`},
+		{"label:or", `label=or`},
+		{"a-b", `"a-b"`},
+		// 字段与取值
+		{"priority>=high", `priority>=3`},
+		{"PRIORITY:Med", `priority=2`},
+		{"priority<2", `priority<2`},
+		{"project:12", `project=12`},
+		{"project:Work", `project=Work`},
+		{"assignee:ME", `assignee=me`},
+		{"assignee!=7", `assignee!=7`},
+		{"has:labels", `has=label`},
+		{"due:none", `due={None:true Offset:0s Days:0 Date: WholeDay:false}`},
+		{"due<=tomorrow", `due<={None:false Offset:0s Days:1 Date: WholeDay:true}`},
+		{"created=2026-10-14", `created={None:false Offset:0s Days:0 Date:2026-10-14 WholeDay:true}`},
+		{"updated>+3h", `updated>{None:false Offset:3h0m0s Days:0 Date: WholeDay:false}`},
+		{"due<1w", `due<{None:false Offset:168h0m0s Days:0 Date: WholeDay:false}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := show(n); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 0, "empty expression"},
+		{"   ", 0, "empty expression"},
+		{strings.Repeat("a", maxLength+1), maxLength, "too long"},
+		{strings.Repeat("(", maxDepth+2) + "a" + strings.Repeat(")", maxDepth+2), maxDepth + 1, "nested too deeply"},
+		// 语法
+		{"(a", 2, "missing )"},
+		{"a)", 1, `unexpected ")"`},
+		{"a OR", 4, "unexpected end"},
+		{"AND a", 0, `unexpected "AND"`},
+		{"a OR OR b", 5, `unexpected "OR"`},
+		{"()", 1, `unexpected ")"`},
+		{`"abc`, 0, "unterminated string"},
+		{"a & b", 2, "unexpected &"},
+		{"a!b", 1, "unexpected !"},
+		{"priority:", 9, "missing value"},
+		{"priority:>high", 9, "missing value after :"},
+		// 字段
+		{"color:red", 0, `unknown field "color"`},
+		{"-foo:bar", 1, `unknown field "foo"`},
+		// 取值
+		{"priority:highest", 9, `invalid priority "highest"`},
+		{"priority:5", 9, `invalid priority "5"`},
+		{"priority:-1", 9, `invalid priority "-1"`},
+		{"due<soon", 4, `invalid time "soon"`},
+		{"due:2026-13-01", 4, "invalid time"},
+		{"due<7m", 4, "invalid time"},
+		{"due<100000d", 4, "invalid time"},
+		{"is:done", 3, `invalid value "done" for is`},
+		{"has:priority", 4, `invalid value "priority" for has`},
+		{"assignee:bob", 9, "invalid assignee"},
+		{"assignee:0", 9, "invalid assignee"},
+		// 只支持相等比较的字段
+		{"label>work", 5, "label only supports"},
+		{"is<open", 2, "is only supports"},
+		{"assignee>=me", 8, "assignee only supports"},
+		{"due<none", 3, "due only supports"},
+	}
+
+	for _, tt := range tests {
+		name := tt.expr
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			n, err := Parse(tt.expr)
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("Parse = %s, %v, want syntax error", show(n), err)
+			}
+			if se.Pos != tt.pos || !strings.Contains(se.Msg, tt.msg) {
+				t.Errorf("error = %q at %d, want %q at %d", se.Msg, se.Pos, tt.msg, tt.pos)
+			}
+		})
+	}
+}
+
+func TestTimeValueRange(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UTC 10-14 20:00 在上海已是 10-15
+	now := time.Date(2026, 10, 14, 20, 0, 0, 0, time.UTC)
+	day := func(loc *time.Location, month time.Month, d int) int64 {
+		return time.Date(2026, month, d, 0, 0, 0, 0, loc).Unix()
+	}
+
+	tests := []struct {
+		name     string
+		v        TimeValue
+		now      time.Time
+		loc      *time.Location
+		from, to int64
+	}{
+		{"now", TimeValue{}, now, shanghai, now.Unix(), now.Unix() + 1},
+		{"offset", TimeValue{Offset: -time.Hour}, now, shanghai, now.Unix() - 3600, now.Unix() - 3599},
+		{"today", TimeValue{WholeDay: true}, now, shanghai, day(shanghai, 10, 15), day(shanghai, 10, 16)},
+		{"today in utc", TimeValue{WholeDay: true}, now, time.UTC, day(time.UTC, 10, 14), day(time.UTC, 10, 15)},
+		{"yesterday", TimeValue{WholeDay: true, Days: -1}, now, shanghai, day(shanghai, 10, 14), day(shanghai, 10, 15)},
+		{"date", TimeValue{WholeDay: true, Date: "2026-12-31"}, now, shanghai, day(shanghai, 12, 31), time.Date(2027, 1, 1, 0, 0, 0, 0, shanghai).Unix()},
+		// 夏令时结束的一天有 25 小时
+		{"dst end", TimeValue{WholeDay: true, Date: "2026-11-01"}, now, newYork, day(newYork, 11, 1), day(newYork, 11, 1) + 25*3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := tt.v.Range(tt.now, tt.loc)
+			if from != tt.from || to != tt.to {
+				t.Errorf("Range = [%d, %d), want [%d, %d)", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	n, err := Parse("a OR -(is:completed label:x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Mentions(n, FieldIs, "completed") {
+		t.Error("is:completed not found")
+	}
+	if Mentions(n, FieldIs, "archived") || Mentions(n, FieldLabel, "a") {
+		t.Error("unexpected mention")
+	}
+}
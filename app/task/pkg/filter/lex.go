@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex 将表达式切分为记号, 运算符之后的 - 属于取值, 其它位置词、括号与引号前的 - 表示 NOT
+func lex(s string) ([]token, error) {
+	var tokens []token
+	prevOp := false
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case strings.HasPrefix(s[i:], "&&"):
+			tokens = append(tokens, token{kind: tokAnd, text: "&&", pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, token{kind: tokOr, text: "||", pos: i})
+			i += 2
+		case c == '&' || c == '|':
+			return nil, &SyntaxError{Pos: i, Msg: "unexpected " + string(c)}
+		case c == ':' || c == '=' || c == '<' || c == '>' || c == '!':
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' && c != ':' && c != '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &SyntaxError{Pos: i, Msg: "unexpected !"}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+			prevOp = true
+			continue
+		case c == '-' && !prevOp && i+1 < len(s) && (!isDelimiter(s[i+1]) || s[i+1] == '(' || s[i+1] == '"'):
+			tokens = append(tokens, token{kind: tokNot, text: "-", pos: i})
+			i++
+		default:
+			start := i
+			for i < len(s) && !isDelimiter(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			kind := tokWord
+			if !prevOp {
+				switch strings.ToUpper(word) {
+				case "AND":
+					kind = tokAnd
+				case "OR":
+					kind = tokOr
+				case "NOT":
+					kind = tokNot
+				}
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+		}
+		prevOp = false
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\n\r()\":=<>!&|", c) >= 0
+}
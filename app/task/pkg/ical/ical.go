@@ -0,0 +1,299 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ComponentTodo  = "VTODO"
+	ComponentEvent = "VEVENT"
+
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusCompleted   = "COMPLETED"
+
+	// lineLimit RFC 5545 要求每行不超过 75 个八位字节
+	lineLimit = 75
+
+	utcLayout      = "20060102T150405Z"
+	floatingLayout = "20060102T150405"
+	dateLayout     = "20060102"
+)
+
+var ErrMalformed = errors.New("ical: malformed calendar")
+
+// Todo 日历中的一个条目, 导出时按需渲染成 VTODO 或 VEVENT
+type Todo struct {
+	UID          string
+	Summary      string
+	Description  string
+	Status       string
+	RRule        string
+	Due          time.Time
+	Completed    time.Time
+	Created      time.Time
+	LastModified time.Time
+}
+
+type Calendar struct {
+	ProdID string
+	Name   string
+	Todos  []Todo
+}
+
+// Encode 将日历写为 text/calendar 格式, component 决定条目的组件类型
+func Encode(w io.Writer, cal *Calendar, component string) error {
+	if component != ComponentEvent {
+		component = ComponentTodo
+	}
+
+	bw := bufio.NewWriter(w)
+	write := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	write("BEGIN", "VCALENDAR")
+	write("VERSION", "2.0")
+	write("PRODID", cal.ProdID)
+	write("CALSCALE", "GREGORIAN")
+	if cal.Name != "" {
+		write("X-WR-CALNAME", escapeText(cal.Name))
+	}
+
+	stamp := time.Now().UTC().Format(utcLayout)
+	for _, t := range cal.Todos {
+		// VEVENT 必须有开始时间, 没有截止时间的任务无法渲染成事件
+		if component == ComponentEvent && t.Due.IsZero() {
+			continue
+		}
+
+		write("BEGIN", component)
+		write("UID", t.UID)
+		write("DTSTAMP", stamp)
+		if !t.Created.IsZero() {
+			write("CREATED", t.Created.UTC().Format(utcLayout))
+		}
+		if !t.LastModified.IsZero() {
+			write("LAST-MODIFIED", t.LastModified.UTC().Format(utcLayout))
+		}
+		write("SUMMARY", escapeText(t.Summary))
+		if t.Description != "" {
+			write("DESCRIPTION", escapeText(t.Description))
+		}
+		if !t.Due.IsZero() {
+			due := t.Due.UTC().Format(utcLayout)
+			if component == ComponentEvent {
+				write("DTSTART", due)
+				write("DTEND", due)
+			} else {
+				write("DUE", due)
+			}
+		}
+		if t.RRule != "" {
+			write("RRULE", t.RRule)
+		}
+		if component == ComponentTodo {
+			status := t.Status
+			if status == "" {
+				status = StatusNeedsAction
+			}
+			write("STATUS", status)
+			if !t.Completed.IsZero() {
+				write("COMPLETED", t.Completed.UTC().Format(utcLayout))
+			}
+		}
+		write("END", component)
+	}
+	write("END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+// Decode 解析 text/calendar 内容, VTODO 与 VEVENT 都会被当作任务读出
+func Decode(r io.Reader) ([]Todo, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		todos   []Todo
+		current *Todo
+		depth   int
+	)
+	for _, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			return nil, ErrMalformed
+		}
+
+		switch name {
+		case "BEGIN":
+			if value == ComponentTodo || value == ComponentEvent {
+				if current != nil {
+					return nil, ErrMalformed
+				}
+				current = &Todo{}
+				continue
+			}
+			if current != nil {
+				// 跳过 VALARM 等嵌套组件
+				depth++
+			}
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if value != ComponentTodo && value != ComponentEvent {
+				return nil, ErrMalformed
+			}
+			todos = append(todos, *current)
+			current = nil
+			continue
+		}
+
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = unescapeText(value)
+		case "DESCRIPTION":
+			current.Description = unescapeText(value)
+		case "STATUS":
+			current.Status = strings.ToUpper(value)
+		case "RRULE":
+			current.RRule = value
+		case "DUE", "DTEND":
+			if current.Due, err = parseTime(value, params); err != nil {
+				return nil, err
+			}
+		case "DTSTART":
+			// 只有 DTSTART 的事件以开始时间作为截止时间
+			if current.Due.IsZero() {
+				if current.Due, err = parseTime(value, params); err != nil {
+					return nil, err
+				}
+			}
+		case "COMPLETED":
+			current.Completed, _ = parseTime(value, params)
+		case "CREATED":
+			current.Created, _ = parseTime(value, params)
+		case "LAST-MODIFIED":
+			current.LastModified, _ = parseTime(value, params)
+		}
+	}
+
+	if current != nil {
+		return nil, ErrMalformed
+	}
+
+	return todos, nil
+}
+
+func writeLine(w *bufio.Writer, line string) {
+	limit := lineLimit
+	for len(line) > limit {
+		cut := limit
+		// 不能在 UTF-8 字符中间折行
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// 续行开头的空格也计入长度
+		limit = lineLimit - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// splitLine 将内容行拆分成属性名、参数与值
+func splitLine(line string) (string, map[string]string, string, bool) {
+	idx := strings.IndexByte(line, ':')
+	if idx <= 0 {
+		return "", nil, "", false
+	}
+
+	head, value := line[:idx], line[idx+1:]
+	parts := strings.Split(head, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+func parseTime(value string, params map[string]string) (time.Time, error) {
+	layout, loc := floatingLayout, time.Local
+	switch {
+	case params["VALUE"] == "DATE" || len(value) == len(dateLayout):
+		layout = dateLayout
+	case strings.HasSuffix(value, "Z"):
+		layout, loc = utcLayout, time.UTC
+	case params["TZID"] != "":
+		l, err := time.LoadLocation(params["TZID"])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: unknown TZID %q", ErrMalformed, params["TZID"])
+		}
+		loc = l
+	}
+
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid time %q", ErrMalformed, value)
+	}
+
+	return t, nil
+}
+
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
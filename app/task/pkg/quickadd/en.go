@@ -0,0 +1,283 @@
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	enWeekdays    = `monday|tuesday|wednesday|thursday|friday|saturday|sunday`
+	enWeekdayAbbr = `mon|tues|tue|wed|thurs|thur|thu|fri|sat|sun`
+	enMonths      = `january|february|march|april|may|june|july|august|september|october|november|december|` +
+		`jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec`
+	enNumbers = `\d+|a|an|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve`
+	enUnits   = `minute|min|hour|hr|day|week|month|year`
+	ordinal   = `(?:st|nd|rd|th)`
+)
+
+var enWeekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var enNumberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+var enFreq = map[string]string{
+	"day": "DAILY", "daily": "DAILY",
+	"week": "WEEKLY", "weekly": "WEEKLY",
+	"month": "MONTHLY", "monthly": "MONTHLY",
+	"year": "YEARLY", "yearly": "YEARLY", "annually": "YEARLY",
+}
+
+var (
+	enWeekdayList = regexp.MustCompile(`(?i)` + enWeekdays + `|` + enWeekdayAbbr)
+	enUnitAlias   = map[string]string{"min": "minute", "hr": "hour"}
+	// enWeekdayAbbrTitle 首字母大写或全部大写的星期缩写
+	enWeekdayAbbrTitle = titleAlternatives(enWeekdayAbbr)
+)
+
+var recurrenceRules = []rule{
+	{
+		re: regexp.MustCompile(`(?i)\bevery\s+(week\s*day|weekend)s?\b`),
+		apply: func(p *parser, m []string) bool {
+			r := &recurrence{freq: "WEEKLY"}
+			if strings.EqualFold(m[1], "weekend") {
+				r.byDay = []time.Weekday{time.Saturday, time.Sunday}
+			} else {
+				r.byDay = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+			}
+			return p.setRecurrence(r)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\bevery\s+((?:` + enWeekdays + `|` + enWeekdayAbbr + `)(?:\s*(?:,|and|&)\s*(?:` + enWeekdays + `|` + enWeekdayAbbr + `))*)\b`),
+		apply: func(p *parser, m []string) bool {
+			r := &recurrence{freq: "WEEKLY"}
+			for _, name := range enWeekdayList.FindAllString(m[1], -1) {
+				r.addDay(enWeekdayNames[strings.ToLower(name)])
+			}
+			return p.setRecurrence(r)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\bevery\s+(other\s+|\d+\s+)?(day|week|month|year)s?` +
+			`(?:\s+on\s+the\s+(\d{1,2})` + ordinal + `?|\s+on\s+((?:` + enWeekdays + `|` + enWeekdayAbbr + `)` +
+			`(?:\s*(?:,|and|&)\s*(?:` + enWeekdays + `|` + enWeekdayAbbr + `))*))?\b`),
+		apply: func(p *parser, m []string) bool {
+			r := &recurrence{freq: enFreq[strings.ToLower(m[2])], interval: 1}
+			switch n := strings.ToLower(strings.TrimSpace(m[1])); n {
+			case "":
+			case "other":
+				r.interval = 2
+			default:
+				r.interval, _ = strconv.Atoi(n)
+			}
+			if m[3] != "" {
+				day, _ := strconv.Atoi(m[3])
+				if r.freq != "MONTHLY" || day < 1 || day > 31 {
+					return false
+				}
+				r.byMonthDay = day
+			}
+			// every 2 weeks on tuesday 在重复规则中指定星期, 不作为截止日期
+			if m[4] != "" {
+				if r.freq != "WEEKLY" {
+					return false
+				}
+				for _, name := range enWeekdayList.FindAllString(m[4], -1) {
+					r.addDay(enWeekdayNames[strings.ToLower(name)])
+				}
+			}
+			return p.setRecurrence(r)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\bevery\s+(\d{1,2})` + ordinal + `\b`),
+		apply: func(p *parser, m []string) bool {
+			day, _ := strconv.Atoi(m[1])
+			if day < 1 || day > 31 {
+				return false
+			}
+			return p.setRecurrence(&recurrence{freq: "MONTHLY", byMonthDay: day})
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(daily|weekly|monthly|yearly|annually)\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setRecurrence(&recurrence{freq: enFreq[strings.ToLower(m[1])]})
+		},
+	},
+}
+
+var dateRules = []rule{
+	{
+		re: regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setMonthDay(atoi(m[1]), atoi(m[2]), atoi(m[3]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(?:on\s+)?(` + enMonths + `)\.?\s+(\d{1,2})` + ordinal + `?(?:,?\s+(\d{4}))?\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setMonthDay(atoi(m[3]), monthOf(m[1]), atoi(m[2]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(?:on\s+)?(?:the\s+)?(\d{1,2})` + ordinal + `?\s+(?:of\s+)?(` + enMonths + `)\b(?:,?\s+(\d{4})\b)?`),
+		apply: func(p *parser, m []string) bool {
+			return p.setMonthDay(atoi(m[3]), monthOf(m[2]), atoi(m[1]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`\b(?:on\s+)?(\d{1,2})/(\d{1,2})(?:/(\d{4}))?\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setMonthDay(atoi(m[3]), atoi(m[1]), atoi(m[2]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(?:on\s+)?the\s+(\d{1,2})` + ordinal + `\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setDayOfMonth(atoi(m[1]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(day\s+after\s+tomorrow|today|tonight|tomorrow|tmrw|tmr)\b`),
+		apply: func(p *parser, m []string) bool {
+			offset := 0
+			switch strings.ToLower(strings.Join(strings.Fields(m[1]), " ")) {
+			case "day after tomorrow":
+				offset = 2
+			case "tomorrow", "tmrw", "tmr":
+				offset = 1
+			case "tonight":
+				p.evening = true
+			}
+			return p.setDate(p.today().AddDate(0, 0, offset))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(?:(next|this|on)\s+)?(` + enWeekdays + `)\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setDate(p.upcoming(enWeekdayNames[strings.ToLower(m[2])], strings.EqualFold(m[1], "next")))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\b(next|this|on)\s+(` + enWeekdayAbbr + `)\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setDate(p.upcoming(enWeekdayNames[strings.ToLower(m[2])], strings.EqualFold(m[1], "next")))
+		},
+	},
+	{
+		// 单独出现的缩写容易与普通单词混淆 (sun, sat, wed), 只识别不在开头且首字母大写的写法, 例如 "Email Mon at noon"
+		re: regexp.MustCompile(`\s(` + enWeekdayAbbrTitle + `)\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setDate(p.upcoming(enWeekdayNames[strings.ToLower(m[1])], false))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\bnext\s+(week|month|year)\b`),
+		apply: func(p *parser, m []string) bool {
+			today := p.today()
+			switch strings.ToLower(m[1]) {
+			case "week":
+				return p.setDate(p.weekOf(time.Monday, 1))
+			case "month":
+				return p.setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, p.loc))
+			default:
+				return p.setDate(time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, p.loc))
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)\bin\s+(` + enNumbers + `)\s+(` + enUnits + `)s?\b`),
+		apply: func(p *parser, m []string) bool {
+			n, ok := enNumberWords[strings.ToLower(m[1])]
+			if !ok {
+				n = atoi(m[1])
+			}
+			unit := strings.ToLower(m[2])
+			if alias, ok := enUnitAlias[unit]; ok {
+				unit = alias
+			}
+			return p.relative(n, unit)
+		},
+	},
+}
+
+var timeRules = []rule{
+	{
+		re: regexp.MustCompile(`(?i)(?:\bat\s+|@\s*)?\b(\d{1,2})(?::([0-5]\d))?\s*(a\.m\.|p\.m\.|am\b|pm\b)`),
+		apply: func(p *parser, m []string) bool {
+			hour, minute := atoi(m[1]), atoi(m[2])
+			if hour < 1 || hour > 12 {
+				return false
+			}
+			hour %= 12
+			if strings.HasPrefix(strings.ToLower(m[3]), "p") {
+				hour += 12
+			}
+			return p.setTime(hour, minute)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)(?:\bat\s+|@\s*)?\b([01]?\d|2[0-3]):([0-5]\d)\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setTime(atoi(m[1]), atoi(m[2]))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)(?:\bat\s+)?\b(noon|midday|midnight)\b`),
+		apply: func(p *parser, m []string) bool {
+			if strings.EqualFold(m[1], "midnight") {
+				return p.setTime(23, 59)
+			}
+			return p.setTime(12, 0)
+		},
+	},
+	{
+		// 只有 at 后面跟的数字才当作整点
+		re: regexp.MustCompile(`(?i)(?:\bat\s+|@\s*)(\d{1,2})\b`),
+		apply: func(p *parser, m []string) bool {
+			return p.setTime(atoi(m[1]), 0)
+		},
+	},
+}
+
+// titleAlternatives 把以 | 分隔的小写单词转换为只匹配首字母大写与全部大写写法的正则
+func titleAlternatives(words string) string {
+	var alts []string
+	for _, w := range strings.Split(words, "|") {
+		alts = append(alts, strings.ToUpper(w[:1])+w[1:], strings.ToUpper(w))
+	}
+
+	return strings.Join(alts, "|")
+}
+
+func monthOf(name string) int {
+	name = strings.ToLower(name)
+	if name == "sept" {
+		name = "sep"
+	}
+	for i, m := range []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"} {
+		if strings.HasPrefix(name, m) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
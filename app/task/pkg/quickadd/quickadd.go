@@ -0,0 +1,391 @@
+package quickadd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 优先级取值与 Task.priority 一致
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+// Result 解析结果, Due 为零值表示没有截止时间, AllDay 表示只指定了日期
+type Result struct {
+	Title    string
+	Due      time.Time
+	AllDay   bool
+	RRule    string
+	Labels   []string
+	Priority int
+}
+
+// rule 一条解析规则, apply 返回 false 时匹配的文本保留在标题中
+type rule struct {
+	re    *regexp.Regexp
+	apply func(p *parser, m []string) bool
+}
+
+// recurrence 解析出的重复规则, 用于计算第一次出现的日期并生成 RRULE
+type recurrence struct {
+	freq       string
+	interval   int
+	byDay      []time.Weekday
+	byMonthDay int
+}
+
+type parser struct {
+	now time.Time
+	loc *time.Location
+
+	date    time.Time
+	hasDate bool
+
+	hour, minute int
+	hasTime      bool
+	// evening 今晚 / tonight 等没有给出具体时间时使用默认时间
+	evening bool
+
+	rec      *recurrence
+	labels   []string
+	priority int
+}
+
+// Parse 解析一条快速添加的文本, 日期与时间按 loc 解释, now 为解析时的当前时间
+func Parse(text string, now time.Time, loc *time.Location) Result {
+	if loc == nil {
+		loc = time.UTC
+	}
+	p := &parser{now: now.In(loc), loc: loc}
+
+	for _, group := range [][]rule{markerRules, recurrenceRules, zhRecurrenceRules, zhDateRules, dateRules, zhTimeRules, timeRules} {
+		for _, r := range group {
+			text = p.run(text, r)
+		}
+	}
+
+	return p.result(cleanTitle(text))
+}
+
+// run 执行一条规则并把被采用的匹配从文本中移除
+func (p *parser) run(text string, r rule) string {
+	indexes := r.re.FindAllStringSubmatchIndex(text, -1)
+	if indexes == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, idx := range indexes {
+		m := make([]string, len(idx)/2)
+		for i := range m {
+			if idx[2*i] >= 0 {
+				m[i] = text[idx[2*i]:idx[2*i+1]]
+			}
+		}
+		if !r.apply(p, m) {
+			continue
+		}
+		b.WriteString(text[last:idx[0]])
+		b.WriteString(" ")
+		last = idx[1]
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+func (p *parser) today() time.Time {
+	y, m, d := p.now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, p.loc)
+}
+
+func (p *parser) setDate(t time.Time) bool {
+	if p.hasDate {
+		return false
+	}
+	y, m, d := t.Date()
+	p.date = time.Date(y, m, d, 0, 0, 0, 0, p.loc)
+	p.hasDate = true
+	return true
+}
+
+func (p *parser) setTime(hour, minute int) bool {
+	if p.hasTime || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return false
+	}
+	p.hour, p.minute = hour, minute
+	p.hasTime = true
+	return true
+}
+
+func (p *parser) setRecurrence(r *recurrence) bool {
+	if p.rec != nil {
+		return false
+	}
+	if r.interval < 1 {
+		r.interval = 1
+	}
+	p.rec = r
+	return true
+}
+
+// setMonthDay 设置某月某日, 没有年份且日期已过时顺延到下一年
+func (p *parser) setMonthDay(year, month, day int) bool {
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return false
+	}
+	explicit := year != 0
+	if !explicit {
+		year = p.now.Year()
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, p.loc)
+	if t.Day() != day {
+		return false
+	}
+	if !explicit && t.Before(p.today()) {
+		t = t.AddDate(1, 0, 0)
+	}
+
+	return p.setDate(t)
+}
+
+// setDayOfMonth 设置本月的某一天, 已过时顺延到下个月
+func (p *parser) setDayOfMonth(day int) bool {
+	if day < 1 || day > 31 {
+		return false
+	}
+	today := p.today()
+	for i := 0; i < 12; i++ {
+		first := time.Date(today.Year(), today.Month()+time.Month(i), 1, 0, 0, 0, 0, p.loc)
+		t := first.AddDate(0, 0, day-1)
+		if t.Month() == first.Month() && !t.Before(today) {
+			return p.setDate(t)
+		}
+	}
+
+	return false
+}
+
+// upcoming 返回今天或之后最近的 wd, strict 为 true 时不包括今天
+func (p *parser) upcoming(wd time.Weekday, strict bool) time.Time {
+	today := p.today()
+	diff := (int(wd) - int(today.Weekday()) + 7) % 7
+	if diff == 0 && strict {
+		diff = 7
+	}
+
+	return today.AddDate(0, 0, diff)
+}
+
+// weekOf 返回 weeks 周之后那一周 (周一开始) 的 wd
+func (p *parser) weekOf(wd time.Weekday, weeks int) time.Time {
+	today := p.today()
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	return monday.AddDate(0, 0, 7*weeks+(int(wd)+6)%7)
+}
+
+// relative 处理 "in 2 days" / "3天后" 一类相对时间
+func (p *parser) relative(n int, unit string) bool {
+	if n <= 0 || p.hasDate {
+		return false
+	}
+	switch unit {
+	case "minute", "hour":
+		if p.hasTime {
+			return false
+		}
+		d := time.Duration(n) * time.Minute
+		if unit == "hour" {
+			d = time.Duration(n) * time.Hour
+		}
+		t := p.now.Add(d)
+		p.setDate(t)
+		return p.setTime(t.Hour(), t.Minute())
+	case "day":
+		return p.setDate(p.today().AddDate(0, 0, n))
+	case "week":
+		return p.setDate(p.today().AddDate(0, 0, 7*n))
+	case "month":
+		return p.setDate(addMonths(p.today(), n))
+	case "year":
+		return p.setDate(addMonths(p.today(), 12*n))
+	}
+
+	return false
+}
+
+// addMonths 与 AddDate 不同, 目标月份没有对应的日期时取月末而不是顺延到下个月, 例如 1 月 31 日加一个月为 2 月 28 日
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+func (p *parser) result(title string) Result {
+	res := Result{
+		Title:    title,
+		Labels:   p.labels,
+		Priority: p.priority,
+	}
+	if p.rec != nil {
+		res.RRule = p.rec.String()
+	}
+
+	if !p.hasTime && p.evening {
+		p.hour, p.minute, p.hasTime = 20, 0, true
+	}
+
+	date, hasDate := p.date, p.hasDate
+	if p.rec != nil {
+		switch {
+		case !hasDate:
+			date, hasDate = p.firstOccurrence(p.today()), true
+		case !p.rec.matches(date):
+			// 给出的日期不符合重复规则时从该日期起顺延到第一次出现, 例如 every month on the 1st ... tomorrow
+			date = p.firstOccurrence(date)
+		}
+	}
+	switch {
+	case p.hasTime:
+		if !hasDate {
+			date = p.today()
+		}
+		due := time.Date(date.Year(), date.Month(), date.Day(), p.hour, p.minute, 0, 0, p.loc)
+		// 只给出时间且已经过去时指向明天
+		if !p.hasDate && p.rec == nil && due.Before(p.now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		res.Due = due
+	case hasDate:
+		res.Due = date
+		res.AllDay = true
+	}
+
+	return res
+}
+
+// firstOccurrence 计算重复规则从 from 起第一次出现的日期, 当天的时间已过时从第二天开始
+func (p *parser) firstOccurrence(from time.Time) time.Time {
+	day := from
+	if p.hasTime {
+		at := time.Date(day.Year(), day.Month(), day.Day(), p.hour, p.minute, 0, 0, p.loc)
+		if at.Before(p.now) {
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+	for i := 0; i < 366; i++ {
+		if p.rec.matches(day) {
+			return day
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return day
+}
+
+func (r *recurrence) matches(day time.Time) bool {
+	if len(r.byDay) > 0 {
+		for _, wd := range r.byDay {
+			if day.Weekday() == wd {
+				return true
+			}
+		}
+		return false
+	}
+	if r.byMonthDay > 0 {
+		return day.Day() == r.byMonthDay
+	}
+
+	return true
+}
+
+var rruleDays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (r *recurrence) String() string {
+	s := "FREQ=" + r.freq
+	if r.interval > 1 {
+		s += ";INTERVAL=" + strconv.Itoa(r.interval)
+	}
+	if len(r.byDay) > 0 {
+		days := append([]time.Weekday(nil), r.byDay...)
+		// 按周一开始的顺序输出
+		sort.Slice(days, func(i, j int) bool { return (days[i]+6)%7 < (days[j]+6)%7 })
+		names := make([]string, 0, len(days))
+		for _, wd := range days {
+			names = append(names, rruleDays[wd])
+		}
+		s += ";BYDAY=" + strings.Join(names, ",")
+	}
+	if r.byMonthDay > 0 {
+		s += fmt.Sprintf(";BYMONTHDAY=%d", r.byMonthDay)
+	}
+
+	return s
+}
+
+// addDay 把星期加入重复规则, 忽略重复的星期
+func (r *recurrence) addDay(wd time.Weekday) {
+	for _, d := range r.byDay {
+		if d == wd {
+			return
+		}
+	}
+	r.byDay = append(r.byDay, wd)
+}
+
+var markerRules = []rule{
+	{
+		re: regexp.MustCompile(`[#＃]([\p{L}\p{N}_\-/]+)`),
+		apply: func(p *parser, m []string) bool {
+			p.labels = append(p.labels, m[1])
+			return true
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)[!！](urgent|high|medium|med|low|紧急|高|中|低|[1-4])`),
+		apply: func(p *parser, m []string) bool {
+			if p.priority != PriorityNone {
+				return false
+			}
+			switch strings.ToLower(m[1]) {
+			case "urgent", "紧急", "1":
+				p.priority = PriorityUrgent
+			case "high", "高", "2":
+				p.priority = PriorityHigh
+			case "medium", "med", "中", "3":
+				p.priority = PriorityMedium
+			default:
+				p.priority = PriorityLow
+			}
+			return true
+		},
+	},
+}
+
+var (
+	spaces     = regexp.MustCompile(`\s+`)
+	connectors = regexp.MustCompile(`(?i)(^|\s)(on|at|by|due|in|from|every)$`)
+)
+
+// cleanTitle 合并空白并去掉被移除的日期表达式遗留的介词与标点
+func cleanTitle(s string) string {
+	s = strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+	for {
+		trimmed := strings.TrimSpace(connectors.ReplaceAllString(s, ""))
+		trimmed = strings.TrimRight(trimmed, " ,，、;；")
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
@@ -0,0 +1,187 @@
+package quickadd
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type parseTest struct {
+	text string
+	want Result
+}
+
+func TestParse(t *testing.T) {
+	shanghai := mustLoad(t, "Asia/Shanghai")
+	newYork := mustLoad(t, "America/New_York")
+	losAngeles := mustLoad(t, "America/Los_Angeles")
+	kolkata := mustLoad(t, "Asia/Kolkata")
+
+	// 2026-10-14 是星期三
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, shanghai)
+	}
+	in := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	groups := []struct {
+		name  string
+		now   time.Time
+		tests []parseTest
+	}{
+		{"en", at(10, 14, 10, 0), []parseTest{
+			{"Buy milk tomorrow 9am #home !high", Result{Title: "Buy milk", Due: at(10, 15, 9, 0), Labels: []string{"home"}, Priority: PriorityHigh}},
+			{"Email Mon at noon", Result{Title: "Email", Due: at(10, 19, 12, 0)}},
+			{"Call mom on Fri", Result{Title: "Call mom", Due: at(10, 16, 0, 0), AllDay: true}},
+			{"Submit report next wed", Result{Title: "Submit report", Due: at(10, 21, 0, 0), AllDay: true}},
+			{"Sun cream", Result{Title: "Sun cream"}},
+			{"Wash the sun hat", Result{Title: "Wash the sun hat"}},
+			{"Party on Dec 25th at 8pm", Result{Title: "Party", Due: at(12, 25, 20, 0)}},
+			{"Renew passport in 3 days", Result{Title: "Renew passport", Due: at(10, 17, 0, 0), AllDay: true}},
+			{"Meeting at 9", Result{Title: "Meeting", Due: at(10, 15, 9, 0)}},
+			{"Standup every weekday at 9:30", Result{Title: "Standup", Due: at(10, 15, 9, 30), RRule: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"}},
+			{"every 2 weeks on tuesday review", Result{Title: "review", Due: at(10, 20, 0, 0), AllDay: true, RRule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU"}},
+			{"Gym every mon and thu 7pm", Result{Title: "Gym", Due: at(10, 15, 19, 0), RRule: "FREQ=WEEKLY;BYDAY=MO,TH"}},
+			{"Pay rent every month on the 1st tomorrow 9am", Result{Title: "Pay rent", Due: at(11, 1, 9, 0), RRule: "FREQ=MONTHLY;BYMONTHDAY=1"}},
+			{"Water plants daily", Result{Title: "Water plants", Due: at(10, 14, 0, 0), AllDay: true, RRule: "FREQ=DAILY"}},
+		}},
+		{"zh", at(10, 14, 10, 0), []parseTest{
+			{"明天下午3点开会", Result{Title: "开会", Due: at(10, 15, 15, 0)}},
+			{"下周一交报告 #工作 !紧急", Result{Title: "交报告", Due: at(10, 19, 0, 0), AllDay: true, Labels: []string{"工作"}, Priority: PriorityUrgent}},
+			{"今晚看电影", Result{Title: "看电影", Due: at(10, 14, 20, 0)}},
+			{"3天后提醒我续费", Result{Title: "提醒我续费", Due: at(10, 17, 0, 0), AllDay: true}},
+			{"10月20日上午9点半体检", Result{Title: "体检", Due: at(10, 20, 9, 30)}},
+			{"有一点累", Result{Title: "有一点累"}},
+			{"每周二四健身 晚上7点", Result{Title: "健身", Due: at(10, 15, 19, 0), RRule: "FREQ=WEEKLY;BYDAY=TU,TH"}},
+			{"每月15号交房租", Result{Title: "交房租", Due: at(10, 15, 0, 0), AllDay: true, RRule: "FREQ=MONTHLY;BYMONTHDAY=15"}},
+			{"每月1号交房租 明天上午9点", Result{Title: "交房租", Due: at(11, 1, 9, 0), RRule: "FREQ=MONTHLY;BYMONTHDAY=1"}},
+			{"每隔一天浇花", Result{Title: "浇花", Due: at(10, 14, 0, 0), AllDay: true, RRule: "FREQ=DAILY;INTERVAL=2"}},
+		}},
+		// 2026-10-19 是星期一, next 不包括今天, 不带前缀时包括今天
+		{"asked on monday", at(10, 19, 10, 0), []parseTest{
+			{"Review next monday", Result{Title: "Review", Due: at(10, 26, 0, 0), AllDay: true}},
+			{"Review monday", Result{Title: "Review", Due: at(10, 19, 0, 0), AllDay: true}},
+			{"Review this mon", Result{Title: "Review", Due: at(10, 19, 0, 0), AllDay: true}},
+			{"Review next week", Result{Title: "Review", Due: at(10, 26, 0, 0), AllDay: true}},
+			{"下周一复盘", Result{Title: "复盘", Due: at(10, 26, 0, 0), AllDay: true}},
+			{"周一复盘", Result{Title: "复盘", Due: at(10, 19, 0, 0), AllDay: true}},
+			// 今天的时间已过时从下一次开始
+			{"Sync every monday 9am", Result{Title: "Sync", Due: at(10, 26, 9, 0), RRule: "FREQ=WEEKLY;BYDAY=MO"}},
+		}},
+		{"end of month", in(shanghai, 2026, 1, 31, 10, 0), []parseTest{
+			{"Pay rent tomorrow", Result{Title: "Pay rent", Due: in(shanghai, 2026, 2, 1, 0, 0), AllDay: true}},
+			// 下个月没有对应的日期时取月末
+			{"Renew in 1 month", Result{Title: "Renew", Due: in(shanghai, 2026, 2, 28, 0, 0), AllDay: true}},
+			{"1个月后续费", Result{Title: "续费", Due: in(shanghai, 2026, 2, 28, 0, 0), AllDay: true}},
+			{"Plan next month", Result{Title: "Plan", Due: in(shanghai, 2026, 2, 1, 0, 0), AllDay: true}},
+			// 二月没有 30 号, 顺延到三月
+			{"每月30号对账", Result{Title: "对账", Due: in(shanghai, 2026, 3, 30, 0, 0), AllDay: true, RRule: "FREQ=MONTHLY;BYMONTHDAY=30"}},
+			{"Invoice every month on the 31st", Result{Title: "Invoice", Due: in(shanghai, 2026, 1, 31, 0, 0), AllDay: true, RRule: "FREQ=MONTHLY;BYMONTHDAY=31"}},
+		}},
+		{"leap year", in(shanghai, 2028, 2, 28, 10, 0), []parseTest{
+			{"Backup tomorrow", Result{Title: "Backup", Due: in(shanghai, 2028, 2, 29, 0, 0), AllDay: true}},
+			{"Renew in 1 year", Result{Title: "Renew", Due: in(shanghai, 2029, 2, 28, 0, 0), AllDay: true}},
+		}},
+		{"end of year", in(shanghai, 2026, 12, 31, 22, 0), []parseTest{
+			{"Party tomorrow 8pm", Result{Title: "Party", Due: in(shanghai, 2027, 1, 1, 20, 0)}},
+			// 已过的日期指向明年
+			{"Gift on Dec 25th", Result{Title: "Gift", Due: in(shanghai, 2027, 12, 25, 0, 0), AllDay: true}},
+			{"1月5日开会", Result{Title: "开会", Due: in(shanghai, 2027, 1, 5, 0, 0), AllDay: true}},
+			{"Plan next year", Result{Title: "Plan", Due: in(shanghai, 2027, 1, 1, 0, 0), AllDay: true}},
+			{"明年规划", Result{Title: "规划", Due: in(shanghai, 2027, 1, 1, 0, 0), AllDay: true}},
+			// 2026-12-31 是星期四
+			{"Retro next friday", Result{Title: "Retro", Due: in(shanghai, 2027, 1, 1, 0, 0), AllDay: true}},
+			{"Review next week", Result{Title: "Review", Due: in(shanghai, 2027, 1, 4, 0, 0), AllDay: true}},
+			{"Call in 2 hours", Result{Title: "Call", Due: in(shanghai, 2027, 1, 1, 0, 0)}},
+			{"Meeting at 9", Result{Title: "Meeting", Due: in(shanghai, 2027, 1, 1, 9, 0)}},
+		}},
+		// 2026-03-08 02:00 纽约进入夏令时
+		{"dst start", in(newYork, 2026, 3, 7, 10, 0), []parseTest{
+			{"Brunch tomorrow 11am", Result{Title: "Brunch", Due: in(newYork, 2026, 3, 8, 11, 0)}},
+			{"Run in 2 days", Result{Title: "Run", Due: in(newYork, 2026, 3, 9, 0, 0), AllDay: true}},
+			{"Standup every day at 9am", Result{Title: "Standup", Due: in(newYork, 2026, 3, 8, 9, 0), RRule: "FREQ=DAILY"}},
+		}},
+		{"across dst gap", in(newYork, 2026, 3, 8, 1, 30), []parseTest{
+			// 01:30 EST 之后一小时是 03:30 EDT
+			{"Check oven in 1 hour", Result{Title: "Check oven", Due: in(newYork, 2026, 3, 8, 3, 30)}},
+			{"Lunch at noon", Result{Title: "Lunch", Due: in(newYork, 2026, 3, 8, 12, 0)}},
+		}},
+		// 2026-11-01 02:00 纽约结束夏令时, 当天有 25 小时
+		{"dst end", in(newYork, 2026, 10, 31, 12, 0), []parseTest{
+			{"Standup tomorrow at 9", Result{Title: "Standup", Due: in(newYork, 2026, 11, 1, 9, 0)}},
+			{"Run in 3 days", Result{Title: "Run", Due: in(newYork, 2026, 11, 3, 0, 0), AllDay: true}},
+			{"Pay bills on Dec 1st", Result{Title: "Pay bills", Due: in(newYork, 2026, 12, 1, 0, 0), AllDay: true}},
+		}},
+		// 洛杉矶 10-14 23:30 在 UTC 中已是 10-15, 日期按用户时区计算
+		{"behind utc", in(losAngeles, 2026, 10, 14, 23, 30), []parseTest{
+			{"Water plants today", Result{Title: "Water plants", Due: in(losAngeles, 2026, 10, 14, 0, 0), AllDay: true}},
+			{"Call mom tomorrow 9am", Result{Title: "Call mom", Due: in(losAngeles, 2026, 10, 15, 9, 0)}},
+			{"Submit report friday", Result{Title: "Submit report", Due: in(losAngeles, 2026, 10, 16, 0, 0), AllDay: true}},
+		}},
+		{"half hour offset", in(kolkata, 2026, 10, 14, 23, 45), []parseTest{
+			{"Pay rent tomorrow 9am", Result{Title: "Pay rent", Due: in(kolkata, 2026, 10, 15, 9, 0)}},
+			{"Meeting at 11pm", Result{Title: "Meeting", Due: in(kolkata, 2026, 10, 15, 23, 0)}},
+		}},
+		{"utc", in(time.UTC, 2026, 10, 14, 10, 0), []parseTest{
+			{"Deploy tomorrow 6pm", Result{Title: "Deploy", Due: in(time.UTC, 2026, 10, 15, 18, 0)}},
+			{"明天下午3点开会", Result{Title: "开会", Due: in(time.UTC, 2026, 10, 15, 15, 0)}},
+		}},
+	}
+
+	for _, g := range groups {
+		for _, tt := range g.tests {
+			t.Run(g.name+"/"+tt.text, func(t *testing.T) {
+				got := Parse(tt.text, g.now, g.now.Location())
+				if got.Title != tt.want.Title {
+					t.Errorf("Title = %q, want %q", got.Title, tt.want.Title)
+				}
+				if !got.Due.Equal(tt.want.Due) {
+					t.Errorf("Due = %v, want %v", got.Due, tt.want.Due)
+				}
+				if got.AllDay != tt.want.AllDay {
+					t.Errorf("AllDay = %v, want %v", got.AllDay, tt.want.AllDay)
+				}
+				if got.RRule != tt.want.RRule {
+					t.Errorf("RRule = %q, want %q", got.RRule, tt.want.RRule)
+				}
+				if !slices.Equal(got.Labels, tt.want.Labels) {
+					t.Errorf("Labels = %v, want %v", got.Labels, tt.want.Labels)
+				}
+				if got.Priority != tt.want.Priority {
+					t.Errorf("Priority = %d, want %d", got.Priority, tt.want.Priority)
+				}
+			})
+		}
+	}
+}
+
+// TestParseNowInOtherZone now 与 loc 不同时按 loc 解释
+func TestParseNowInOtherZone(t *testing.T) {
+	shanghai := mustLoad(t, "Asia/Shanghai")
+	// UTC 10-14 20:00 在上海已是 10-15 04:00
+	now := time.Date(2026, 10, 14, 20, 0, 0, 0, time.UTC)
+
+	got := Parse("Call tomorrow 9am", now, shanghai)
+	if want := time.Date(2026, 10, 16, 9, 0, 0, 0, shanghai); !got.Due.Equal(want) {
+		t.Errorf("Due = %v, want %v", got.Due, want)
+	}
+	if got.Due.Location() != shanghai {
+		t.Errorf("Due location = %v, want %v", got.Due.Location(), shanghai)
+	}
+
+	// loc 为 nil 时使用 UTC
+	got = Parse("Call tomorrow 9am", now, nil)
+	if want := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC); !got.Due.Equal(want) {
+		t.Errorf("nil loc: Due = %v, want %v", got.Due, want)
+	}
+}
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
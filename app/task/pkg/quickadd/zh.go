@@ -0,0 +1,262 @@
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	zhNumber  = `[0-9零〇一二两三四五六七八九十]+`
+	zhWeekday = `[一二三四五六日天1-7]`
+	zhWeek    = `(?:周|星期|礼拜)`
+)
+
+var zhDigits = map[rune]int{
+	'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+var zhWeekdays = map[string]time.Weekday{
+	"一": time.Monday, "二": time.Tuesday, "三": time.Wednesday, "四": time.Thursday,
+	"五": time.Friday, "六": time.Saturday, "日": time.Sunday, "天": time.Sunday,
+	"1": time.Monday, "2": time.Tuesday, "3": time.Wednesday, "4": time.Thursday,
+	"5": time.Friday, "6": time.Saturday, "7": time.Sunday,
+}
+
+var zhUnits = map[string]string{
+	"分钟": "minute", "小时": "hour", "钟头": "hour",
+	"天": "day", "日": "day",
+	"周": "week", "星期": "week", "礼拜": "week",
+	"月": "month", "年": "year",
+}
+
+var zhWeekdayList = regexp.MustCompile(zhWeekday)
+
+var zhRecurrenceRules = []rule{
+	{
+		re: regexp.MustCompile(`每个?工作日`),
+		apply: func(p *parser, m []string) bool {
+			return p.setRecurrence(&recurrence{
+				freq:  "WEEKLY",
+				byDay: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+			})
+		},
+	},
+	{
+		re: regexp.MustCompile(`每个?` + zhWeek + `(` + zhWeekday + `(?:[、,，和及]?` + zhWeekday + `)*)`),
+		apply: func(p *parser, m []string) bool {
+			r := &recurrence{freq: "WEEKLY"}
+			for _, d := range zhWeekdayList.FindAllString(m[1], -1) {
+				r.addDay(zhWeekdays[d])
+			}
+			return p.setRecurrence(r)
+		},
+	},
+	{
+		re: regexp.MustCompile(`每个?月\s*(` + zhNumber + `)\s*[日号]`),
+		apply: func(p *parser, m []string) bool {
+			day, ok := zhNumberOf(m[1])
+			if !ok || day < 1 || day > 31 {
+				return false
+			}
+			return p.setRecurrence(&recurrence{freq: "MONTHLY", byMonthDay: day})
+		},
+	},
+	{
+		re: regexp.MustCompile(`每(隔)?\s*(` + zhNumber + `)?\s*个?(天|日|周|星期|礼拜|月|年)`),
+		apply: func(p *parser, m []string) bool {
+			n := 1
+			if m[2] != "" {
+				var ok bool
+				if n, ok = zhNumberOf(m[2]); !ok || n < 1 {
+					return false
+				}
+			}
+			// "每隔一天" 指隔一天重复一次, 即间隔两天
+			if m[1] != "" {
+				n++
+			}
+			freq := map[string]string{"day": "DAILY", "week": "WEEKLY", "month": "MONTHLY", "year": "YEARLY"}[zhUnits[m[3]]]
+			return p.setRecurrence(&recurrence{freq: freq, interval: n})
+		},
+	},
+}
+
+var zhDateRules = []rule{
+	{
+		re: regexp.MustCompile(`(?:(\d{4})\s*年\s*)?(` + zhNumber + `)\s*月\s*(` + zhNumber + `)\s*[日号]`),
+		apply: func(p *parser, m []string) bool {
+			month, ok1 := zhNumberOf(m[2])
+			day, ok2 := zhNumberOf(m[3])
+			if !ok1 || !ok2 {
+				return false
+			}
+			return p.setMonthDay(atoi(m[1]), month, day)
+		},
+	},
+	{
+		re: regexp.MustCompile(`大后天|后天|明天|明日|今天|今日|今晚|明晚`),
+		apply: func(p *parser, m []string) bool {
+			offset := 0
+			switch m[0] {
+			case "大后天":
+				offset = 3
+			case "后天":
+				offset = 2
+			case "明天", "明日":
+				offset = 1
+			case "明晚":
+				offset = 1
+				p.evening = true
+			case "今晚":
+				p.evening = true
+			}
+			return p.setDate(p.today().AddDate(0, 0, offset))
+		},
+	},
+	{
+		re: regexp.MustCompile(`(下下个?|下个?|这个?|本)?` + zhWeek + `(` + zhWeekday + `)`),
+		apply: func(p *parser, m []string) bool {
+			wd := zhWeekdays[m[2]]
+			switch {
+			case strings.HasPrefix(m[1], "下下"):
+				return p.setDate(p.weekOf(wd, 2))
+			case strings.HasPrefix(m[1], "下"):
+				return p.setDate(p.weekOf(wd, 1))
+			default:
+				return p.setDate(p.upcoming(wd, false))
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`下个?(周|星期|礼拜|月)|明年`),
+		apply: func(p *parser, m []string) bool {
+			today := p.today()
+			switch m[1] {
+			case "":
+				return p.setDate(time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, p.loc))
+			case "月":
+				return p.setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, p.loc))
+			default:
+				return p.setDate(p.weekOf(time.Monday, 1))
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`(` + zhNumber + `|半)\s*个?(分钟|小时|钟头|天|周|星期|礼拜|月|年)\s*(?:后|以后|之后)`),
+		apply: func(p *parser, m []string) bool {
+			unit := zhUnits[m[2]]
+			if m[1] == "半" {
+				if unit != "hour" {
+					return false
+				}
+				return p.relative(30, "minute")
+			}
+			n, ok := zhNumberOf(m[1])
+			if !ok {
+				return false
+			}
+			return p.relative(n, unit)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(` + zhNumber + `)\s*[日号]`),
+		apply: func(p *parser, m []string) bool {
+			day, ok := zhNumberOf(m[1])
+			if !ok {
+				return false
+			}
+			return p.setDayOfMonth(day)
+		},
+	},
+}
+
+var zhTimeRules = []rule{
+	{
+		re: regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里)?\s*(` + zhNumber + `)\s*[点點时時](?:\s*(半|一刻|三刻|(` + zhNumber + `)\s*分?))?`),
+		apply: func(p *parser, m []string) bool {
+			hour, ok := zhNumberOf(m[2])
+			// "有一点" 之类的说法不是时间
+			if !ok || (m[1] == "" && m[2] == "一" && m[3] == "") {
+				return false
+			}
+			minute := 0
+			switch m[3] {
+			case "":
+			case "半":
+				minute = 30
+			case "一刻":
+				minute = 15
+			case "三刻":
+				minute = 45
+			default:
+				if minute, ok = zhNumberOf(m[4]); !ok {
+					return false
+				}
+			}
+			return p.setZhTime(m[1], hour, minute)
+		},
+	},
+	{
+		re: regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里)\s*([01]?\d|2[0-3])[:：]([0-5]\d)`),
+		apply: func(p *parser, m []string) bool {
+			return p.setZhTime(m[1], atoi(m[2]), atoi(m[3]))
+		},
+	},
+}
+
+// setZhTime 按上午、下午等时段换算成 24 小时制
+func (p *parser) setZhTime(period string, hour, minute int) bool {
+	switch period {
+	case "下午", "傍晚", "晚上", "夜里":
+		if hour < 12 {
+			hour += 12
+		}
+	case "中午":
+		if hour < 11 {
+			hour += 12
+		}
+	case "凌晨", "早上", "早晨", "上午":
+		if hour == 12 {
+			hour = 0
+		}
+	default:
+		if p.evening && hour < 12 {
+			hour += 12
+		}
+	}
+	// 晚上12点即午夜
+	if hour == 24 {
+		hour, minute = 23, 59
+	}
+
+	return p.setTime(hour, minute)
+}
+
+// zhNumberOf 解析阿拉伯数字或一百以内的中文数字
+func zhNumberOf(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+
+	total, cur := 0, 0
+	for _, r := range s {
+		if r == '十' {
+			if cur == 0 {
+				cur = 1
+			}
+			total += cur * 10
+			cur = 0
+			continue
+		}
+		d, ok := zhDigits[r]
+		if !ok {
+			return 0, false
+		}
+		cur = d
+	}
+
+	return total + cur, s != ""
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -19,8 +20,12 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/crazyfrankie/framework-plugin/grpcx/interceptor/circuitbreaker"
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/task/biz/service"
 	"github.com/crazyfrankie/todolist/app/task/config"
 	"github.com/crazyfrankie/todolist/app/task/pkg/registry"
 )
@@ -34,8 +39,9 @@ type Server struct {
 	listener net.Listener
 }
 
-func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar)) *Server {
-	srv := grpc.NewServer(grpcServerOption()...)
+func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar), members *service.MembershipChecker,
+	key *principal.Key) *Server {
+	srv := grpc.NewServer(grpcServerOption(members, key)...)
 	registrar(srv)
 
 	rpcServer := &Server{
@@ -53,7 +59,7 @@ func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar)) *
 	return rpcServer
 }
 
-func grpcServerOption() []grpc.ServerOption {
+func grpcServerOption(members *service.MembershipChecker, key *principal.Key) []grpc.ServerOption {
 	logger, err := zap.NewProduction()
 	if err != nil {
 		panic(err)
@@ -77,12 +83,30 @@ func grpcServerOption() []grpc.ServerOption {
 		grpc.ChainUnaryInterceptor(
 			logging.UnaryServerInterceptor(initInterceptor(logger), logging.WithFieldsFromContext(logTraceID)),
 			circuitbreaker.NewInterceptorBuilder().Build(),
+			principal.UnaryServerInterceptor(key),
+			scopeInterceptor(members),
 		),
 	}
 
 	return srcOpts
 }
 
+// scopeInterceptor 确认调用方可以访问请求的工作区, 并把查询范围写入 ctx 供各方法使用
+func scopeInterceptor(members *service.MembershipChecker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := members.Authorize(ctx)
+		switch {
+		case errors.Is(err, service.ErrNotMember):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, service.ErrInvalidWorkspace):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case err != nil:
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
 func (s *Server) OnConfigChange(c *config.Config, changeType config.ConfigChangeType) {
 	if changeType == config.ServerChange && c.Server.Addr != s.Addr {
 		if err := s.register.Unregister(); err != nil {
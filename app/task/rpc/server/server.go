@@ -2,22 +2,42 @@ package server
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/httpbody"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
 
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
 	"github.com/crazyfrankie/todolist/app/task/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/task/biz/service"
-	"github.com/crazyfrankie/todolist/app/task/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/task/pkg/filter"
+	"github.com/crazyfrankie/todolist/app/task/pkg/ical"
 )
 
 type TaskServer struct {
-	svc *service.TaskService
+	svc     *service.TaskService
+	cal     *service.CalendarService
+	project *service.ProjectService
+	tpl     *service.TemplateService
+	timer   *service.TimeService
+	stat    *service.StatService
+	filter  *service.FilterService
+	account *service.AccountService
+	users   *service.UserDirectory
 	task.UnimplementedTaskServiceServer
 }
 
-func NewTaskServer(svc *service.TaskService) *TaskServer {
-	return &TaskServer{svc: svc}
+func NewTaskServer(svc *service.TaskService, cal *service.CalendarService, project *service.ProjectService,
+	tpl *service.TemplateService, timer *service.TimeService, stat *service.StatService, filter *service.FilterService,
+	account *service.AccountService, users *service.UserDirectory) *TaskServer {
+	return &TaskServer{svc: svc, cal: cal, project: project, tpl: tpl, timer: timer, stat: stat, filter: filter,
+		account: account, users: users}
 }
 
 func (t *TaskServer) RegisterServer(s *grpc.Server) {
@@ -25,33 +45,107 @@ func (t *TaskServer) RegisterServer(s *grpc.Server) {
 }
 
 func (t *TaskServer) AddTask(ctx context.Context, request *task.AddTaskRequest) (*task.AddTaskResponse, error) {
-	err := t.svc.AddTask(ctx, request.GetTitle(), request.GetContent())
+	err := t.svc.AddTask(ctx, &dao.Task{
+		Title:     request.GetTitle(),
+		Content:   request.GetContent(),
+		Due:       request.GetDue(),
+		Rrule:     request.GetRrule(),
+		ProjectId: int(request.GetProjectId()),
+		ParentId:  int(request.GetParentId()),
+		Labels:    request.GetLabels(),
+		Priority:  int(request.GetPriority()),
+	})
 	if err != nil {
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	return &task.AddTaskResponse{}, nil
 }
 
 func (t *TaskServer) ListTasks(ctx context.Context, request *task.ListTasksRequest) (*task.ListTasksResponse, error) {
-	tasks, err := t.svc.List(ctx)
+	tasks, err := t.svc.List(ctx, int(request.GetFilterId()), request.GetFilter(), request.GetTimezone())
+	if err != nil {
+		return nil, filterError(err)
+	}
+
+	results := t.toTasks(ctx, tasks)
+
+	return &task.ListTasksResponse{
+		Tasks: results,
+	}, nil
+}
+
+func (t *TaskServer) ArchiveTask(ctx context.Context, req *task.ArchiveTaskRequest) (*task.ArchiveTaskResponse, error) {
+	err := t.svc.Archive(ctx, int(req.GetId()), req.GetArchived())
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &task.ArchiveTaskResponse{}, nil
+}
+
+func (t *TaskServer) SnoozeTask(ctx context.Context, req *task.SnoozeTaskRequest) (*task.SnoozeTaskResponse, error) {
+	err := t.svc.Snooze(ctx, int(req.GetId()), req.GetUntil())
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &task.SnoozeTaskResponse{}, nil
+}
+
+func (t *TaskServer) ListArchivedTasks(ctx context.Context, req *task.ListArchivedTasksRequest) (*task.ListArchivedTasksResponse, error) {
+	tasks, err := t.svc.ListArchived(ctx, req.GetKeyword())
 	if err != nil {
 		return nil, err
 	}
 
-	results := make([]*task.Task, 0, len(tasks))
-	for _, t := range tasks {
-		utime := time.Unix(t.Utime, 0).Format(time.DateTime)
-		results = append(results, &task.Task{
-			Id:      int32(t.Id),
-			Title:   t.Title,
-			Content: t.Content,
-			Utime:   utime,
-			Status:  int32(t.Status),
-		})
+	results := t.toTasks(ctx, tasks)
+
+	return &task.ListArchivedTasksResponse{
+		Tasks: results,
+	}, nil
+}
+
+func (t *TaskServer) ListSnoozedTasks(ctx context.Context, req *task.ListSnoozedTasksRequest) (*task.ListSnoozedTasksResponse, error) {
+	tasks, err := t.svc.ListSnoozed(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return &task.ListTasksResponse{
+	results := t.toTasks(ctx, tasks)
+
+	return &task.ListSnoozedTasksResponse{
+		Tasks: results,
+	}, nil
+}
+
+func (t *TaskServer) AssignTask(ctx context.Context, req *task.AssignTaskRequest) (*task.AssignTaskResponse, error) {
+	err := t.svc.Assign(ctx, int(req.GetId()), int(req.GetAssigneeId()))
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &task.AssignTaskResponse{}, nil
+}
+
+func (t *TaskServer) UnassignTask(ctx context.Context, req *task.UnassignTaskRequest) (*task.UnassignTaskResponse, error) {
+	err := t.svc.Assign(ctx, int(req.GetId()), 0)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &task.UnassignTaskResponse{}, nil
+}
+
+func (t *TaskServer) MyAssignments(ctx context.Context, req *task.MyAssignmentsRequest) (*task.MyAssignmentsResponse, error) {
+	tasks, err := t.svc.MyAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := t.toTasks(ctx, tasks)
+
+	return &task.MyAssignmentsResponse{
 		Tasks: results,
 	}, nil
 }
@@ -61,9 +155,17 @@ func (t *TaskServer) UpdateTask(ctx context.Context, request *task.UpdateTaskReq
 		Id:      int(request.GetId()),
 		Title:   request.GetTitle(),
 		Content: request.GetContent(),
+		Due:     request.GetDue(),
+		Rrule:   request.GetRrule(),
+		Labels:  request.GetLabels(),
 	})
 	if err != nil {
-		return nil, err
+		return nil, taskError(err)
+	}
+	if request.Priority != nil {
+		if err := t.svc.SetPriority(ctx, int(request.GetId()), int(request.GetPriority())); err != nil {
+			return nil, taskError(err)
+		}
 	}
 
 	return &task.UpdateTaskResponse{}, nil
@@ -72,7 +174,7 @@ func (t *TaskServer) UpdateTask(ctx context.Context, request *task.UpdateTaskReq
 func (t *TaskServer) DeleteTask(ctx context.Context, req *task.DeleteTaskRequest) (*task.DeleteTaskResponse, error) {
 	err := t.svc.DeleteTask(ctx, int(req.GetId()))
 	if err != nil {
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	return &task.DeleteTaskResponse{}, nil
@@ -84,17 +186,7 @@ func (t *TaskServer) RecycleBin(ctx context.Context, req *task.RecycleBinRequest
 		return nil, err
 	}
 
-	results := make([]*task.Task, 0, len(tasks))
-	for _, t := range tasks {
-		utime := time.Unix(t.Utime, 0).Format(time.DateTime)
-		results = append(results, &task.Task{
-			Id:      int32(t.Id),
-			Title:   t.Title,
-			Content: t.Content,
-			Utime:   utime,
-			Status:  int32(t.Status),
-		})
-	}
+	results := t.toTasks(ctx, tasks)
 
 	return &task.RecycleBinResponse{
 		Tasks: results,
@@ -104,8 +196,626 @@ func (t *TaskServer) RecycleBin(ctx context.Context, req *task.RecycleBinRequest
 func (t *TaskServer) RestoreTask(ctx context.Context, req *task.RestoreTaskRequest) (*task.RestoreTaskResponse, error) {
 	err := t.svc.RestoreTask(ctx, int(req.GetId()))
 	if err != nil {
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	return &task.RestoreTaskResponse{}, nil
 }
+
+func (t *TaskServer) CreateCalendarToken(ctx context.Context, req *task.CreateCalendarTokenRequest) (*task.CreateCalendarTokenResponse, error) {
+	token, err := t.cal.CreateToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &task.CreateCalendarTokenResponse{
+		Token: token,
+	}, nil
+}
+
+func (t *TaskServer) RevokeCalendarToken(ctx context.Context, req *task.RevokeCalendarTokenRequest) (*task.RevokeCalendarTokenResponse, error) {
+	err := t.cal.RevokeToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &task.RevokeCalendarTokenResponse{}, nil
+}
+
+func (t *TaskServer) CalendarFeed(ctx context.Context, req *task.CalendarFeedRequest) (*httpbody.HttpBody, error) {
+	data, err := t.cal.Feed(ctx, req.GetToken(), req.GetType())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCalendarToken) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, err
+	}
+
+	return &httpbody.HttpBody{
+		ContentType: "text/calendar; charset=utf-8",
+		Data:        data,
+	}, nil
+}
+
+func (t *TaskServer) ImportCalendar(ctx context.Context, req *task.ImportCalendarRequest) (*task.ImportCalendarResponse, error) {
+	count, err := t.cal.Import(ctx, req.GetData())
+	if err != nil {
+		if errors.Is(err, ical.ErrMalformed) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, err
+	}
+
+	return &task.ImportCalendarResponse{
+		Count: int32(count),
+	}, nil
+}
+
+func (t *TaskServer) CompleteTask(ctx context.Context, req *task.CompleteTaskRequest) (*task.CompleteTaskResponse, error) {
+	err := t.svc.CompleteTask(ctx, int(req.GetId()), req.GetCompleted())
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &task.CompleteTaskResponse{}, nil
+}
+
+func (t *TaskServer) AddProject(ctx context.Context, req *task.AddProjectRequest) (*task.AddProjectResponse, error) {
+	p, err := t.project.AddProject(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &task.AddProjectResponse{
+		Project: &task.Project{
+			Id:          int32(p.Id),
+			Name:        p.Name,
+			WorkspaceId: int32(p.WorkspaceId),
+		},
+	}, nil
+}
+
+func (t *TaskServer) ListProjects(ctx context.Context, req *task.ListProjectsRequest) (*task.ListProjectsResponse, error) {
+	projects, err := t.project.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.Project, 0, len(projects))
+	for _, p := range projects {
+		results = append(results, &task.Project{
+			Id:          int32(p.Id),
+			Name:        p.Name,
+			WorkspaceId: int32(p.WorkspaceId),
+		})
+	}
+
+	return &task.ListProjectsResponse{
+		Projects: results,
+	}, nil
+}
+
+func (t *TaskServer) ListCalendarCollections(ctx context.Context, req *task.ListCalendarCollectionsRequest) (*task.ListCalendarCollectionsResponse, error) {
+	projectIds := make([]int, 0, len(req.GetProjectIds()))
+	for _, id := range req.GetProjectIds() {
+		projectIds = append(projectIds, int(id))
+	}
+	cols, err := t.cal.ListCollections(ctx, projectIds)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.CalendarCollection, 0, len(cols))
+	for _, c := range cols {
+		results = append(results, &task.CalendarCollection{
+			ProjectId: int32(c.ProjectId),
+			Name:      c.Name,
+			Ctag:      c.CTag,
+		})
+	}
+
+	return &task.ListCalendarCollectionsResponse{
+		Collections: results,
+	}, nil
+}
+
+func (t *TaskServer) ListCalendarObjects(ctx context.Context, req *task.ListCalendarObjectsRequest) (*task.ListCalendarObjectsResponse, error) {
+	objects, err := t.cal.ListObjects(ctx, int(req.GetProjectId()), req.GetNames(), req.GetWithData())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.CalendarObject, 0, len(objects))
+	for _, o := range objects {
+		results = append(results, &task.CalendarObject{
+			Name:    o.Name,
+			Version: o.Version,
+			Data:    o.Data,
+		})
+	}
+
+	return &task.ListCalendarObjectsResponse{
+		Objects: results,
+	}, nil
+}
+
+func (t *TaskServer) PutCalendarObject(ctx context.Context, req *task.PutCalendarObjectRequest) (*task.PutCalendarObjectResponse, error) {
+	version, created, err := t.cal.PutObject(ctx, int(req.GetProjectId()), req.GetName(), req.GetData(), req.GetIfMatch(), req.GetIfNoneMatch(), req.GetIfExists())
+	if err != nil {
+		return nil, calendarError(err)
+	}
+
+	return &task.PutCalendarObjectResponse{
+		Version: version,
+		Created: created,
+	}, nil
+}
+
+func (t *TaskServer) DeleteCalendarObject(ctx context.Context, req *task.DeleteCalendarObjectRequest) (*task.DeleteCalendarObjectResponse, error) {
+	err := t.cal.DeleteObject(ctx, int(req.GetProjectId()), req.GetName(), req.GetIfMatch(), req.GetIfExists())
+	if err != nil {
+		return nil, calendarError(err)
+	}
+
+	return &task.DeleteCalendarObjectResponse{}, nil
+}
+
+func calendarError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrObjectNotFound), errors.Is(err, service.ErrProjectNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrPreconditionFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ical.ErrMalformed):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+func (t *TaskServer) AddTemplate(ctx context.Context, req *task.AddTemplateRequest) (*task.AddTemplateResponse, error) {
+	tpl := &dao.TaskTemplate{
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Items:       fromTemplateItems(req.GetItems()),
+	}
+	err := t.tpl.AddTemplate(ctx, tpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &task.AddTemplateResponse{
+		Template: toTemplate(tpl),
+	}, nil
+}
+
+func (t *TaskServer) ListTemplates(ctx context.Context, req *task.ListTemplatesRequest) (*task.ListTemplatesResponse, error) {
+	templates, err := t.tpl.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.TaskTemplate, 0, len(templates))
+	for _, tpl := range templates {
+		results = append(results, toTemplate(tpl))
+	}
+
+	return &task.ListTemplatesResponse{
+		Templates: results,
+	}, nil
+}
+
+func (t *TaskServer) DeleteTemplate(ctx context.Context, req *task.DeleteTemplateRequest) (*task.DeleteTemplateResponse, error) {
+	err := t.tpl.DeleteTemplate(ctx, int(req.GetId()))
+	if err != nil {
+		if errors.Is(err, service.ErrTemplateNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	return &task.DeleteTemplateResponse{}, nil
+}
+
+func (t *TaskServer) CreateFromTemplate(ctx context.Context, req *task.CreateFromTemplateRequest) (*task.CreateFromTemplateResponse, error) {
+	count, err := t.tpl.Instantiate(ctx, int(req.GetTemplateId()), req.GetBase(), int(req.GetProjectId()), req.GetVariables())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTemplateNotFound), errors.Is(err, service.ErrProjectNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, service.ErrMissingVariable):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, err
+	}
+
+	return &task.CreateFromTemplateResponse{
+		Count: int32(count),
+	}, nil
+}
+
+func fromTemplateItems(items []*task.TemplateItem) []*dao.TemplateItem {
+	results := make([]*dao.TemplateItem, 0, len(items))
+	for _, item := range items {
+		i := &dao.TemplateItem{
+			Title:    item.GetTitle(),
+			Content:  item.GetContent(),
+			Labels:   strings.Join(item.GetLabels(), ","),
+			Subtasks: fromTemplateItems(item.GetSubtasks()),
+		}
+		if item.DueOffset != nil {
+			offset := item.GetDueOffset()
+			i.DueOffset = &offset
+		}
+		results = append(results, i)
+	}
+
+	return results
+}
+
+func toTemplate(tpl *dao.TaskTemplate) *task.TaskTemplate {
+	return &task.TaskTemplate{
+		Id:          int32(tpl.Id),
+		Name:        tpl.Name,
+		Description: tpl.Description,
+		Items:       toTemplateItems(tpl.Items),
+	}
+}
+
+func toTemplateItems(items []*dao.TemplateItem) []*task.TemplateItem {
+	results := make([]*task.TemplateItem, 0, len(items))
+	for _, item := range items {
+		var labels []string
+		if item.Labels != "" {
+			labels = strings.Split(item.Labels, ",")
+		}
+		results = append(results, &task.TemplateItem{
+			Id:        int32(item.Id),
+			Title:     item.Title,
+			Content:   item.Content,
+			DueOffset: item.DueOffset,
+			Labels:    labels,
+			Subtasks:  toTemplateItems(item.Subtasks),
+		})
+	}
+
+	return results
+}
+
+func (t *TaskServer) StartTimer(ctx context.Context, req *task.StartTimerRequest) (*task.StartTimerResponse, error) {
+	e, err := t.timer.StartTimer(ctx, int(req.GetTaskId()), req.GetNote())
+	if err != nil {
+		return nil, timeError(err)
+	}
+
+	return &task.StartTimerResponse{
+		Entry: toTimeEntry(e),
+	}, nil
+}
+
+func (t *TaskServer) StopTimer(ctx context.Context, req *task.StopTimerRequest) (*task.StopTimerResponse, error) {
+	e, err := t.timer.StopTimer(ctx)
+	if err != nil {
+		return nil, timeError(err)
+	}
+
+	return &task.StopTimerResponse{
+		Entry: toTimeEntry(e),
+	}, nil
+}
+
+func (t *TaskServer) GetRunningTimer(ctx context.Context, req *task.GetRunningTimerRequest) (*task.GetRunningTimerResponse, error) {
+	e, err := t.timer.Running(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &task.GetRunningTimerResponse{}
+	if e != nil {
+		resp.Entry = toTimeEntry(e)
+	}
+
+	return resp, nil
+}
+
+func (t *TaskServer) AddTimeEntry(ctx context.Context, req *task.AddTimeEntryRequest) (*task.AddTimeEntryResponse, error) {
+	e, err := t.timer.AddEntry(ctx, int(req.GetTaskId()), req.GetStart(), req.GetEnd(), req.GetNote())
+	if err != nil {
+		return nil, timeError(err)
+	}
+
+	return &task.AddTimeEntryResponse{
+		Entry: toTimeEntry(e),
+	}, nil
+}
+
+func (t *TaskServer) ListTimeEntries(ctx context.Context, req *task.ListTimeEntriesRequest) (*task.ListTimeEntriesResponse, error) {
+	entries, total, err := t.timer.ListEntries(ctx, int(req.GetTaskId()))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.TimeEntry, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, toTimeEntry(e))
+	}
+
+	return &task.ListTimeEntriesResponse{
+		Entries: results,
+		Total:   total,
+	}, nil
+}
+
+func (t *TaskServer) DeleteTimeEntry(ctx context.Context, req *task.DeleteTimeEntryRequest) (*task.DeleteTimeEntryResponse, error) {
+	err := t.timer.DeleteEntry(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, timeError(err)
+	}
+
+	return &task.DeleteTimeEntryResponse{}, nil
+}
+
+func (t *TaskServer) TimeReport(ctx context.Context, req *task.TimeReportRequest) (*task.TimeReportResponse, error) {
+	rows, total, err := t.timer.Report(ctx, req.GetStart(), req.GetEnd(), req.GetGroupBy(), req.GetTimezone())
+	if err != nil {
+		return nil, timeError(err)
+	}
+
+	results := make([]*task.TimeReportRow, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, &task.TimeReportRow{
+			Key:     r.Key,
+			Name:    r.Name,
+			Seconds: r.Seconds,
+		})
+	}
+
+	return &task.TimeReportResponse{
+		Rows:  results,
+		Total: total,
+	}, nil
+}
+
+func (t *TaskServer) GetStats(ctx context.Context, req *task.GetStatsRequest) (*task.GetStatsResponse, error) {
+	stats, err := t.stat.GetStats(ctx, req.GetStart(), req.GetEnd(), req.GetInterval(), req.GetTimezone())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimeRange) || errors.Is(err, service.ErrInvalidInterval) ||
+			errors.Is(err, service.ErrInvalidTimezone) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, err
+	}
+
+	buckets := make([]*task.StatBucket, 0, len(stats.Buckets))
+	for _, b := range stats.Buckets {
+		buckets = append(buckets, &task.StatBucket{
+			Start:     b.Start,
+			Created:   b.Created,
+			Completed: b.Completed,
+			Deleted:   b.Deleted,
+		})
+	}
+
+	return &task.GetStatsResponse{
+		Buckets:              buckets,
+		Created:              stats.Created,
+		Completed:            stats.Completed,
+		Deleted:              stats.Deleted,
+		AvgCompletionSeconds: stats.AvgCompletion,
+		CurrentStreak:        stats.CurrentStreak,
+		LongestStreak:        stats.LongestStreak,
+	}, nil
+}
+
+func (t *TaskServer) QuickAddTask(ctx context.Context, req *task.QuickAddTaskRequest) (*task.QuickAddTaskResponse, error) {
+	res, id, err := t.svc.QuickAdd(ctx, req.GetText(), req.GetTimezone(), int(req.GetProjectId()), req.GetPreview())
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	parsed := &task.ParsedTask{
+		Title:    res.Title,
+		AllDay:   res.AllDay,
+		Rrule:    res.RRule,
+		Labels:   res.Labels,
+		Priority: int32(res.Priority),
+	}
+	if !res.Due.IsZero() {
+		parsed.Due = res.Due.Unix()
+	}
+
+	return &task.QuickAddTaskResponse{
+		Parsed: parsed,
+		Id:     int32(id),
+	}, nil
+}
+
+func (t *TaskServer) ExportWorkspaceTasks(ctx context.Context, req *task.ExportWorkspaceTasksRequest) (*task.ExportWorkspaceTasksResponse, error) {
+	tasks, err := t.svc.WorkspaceTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &task.ExportWorkspaceTasksResponse{
+		Tasks: t.toTasks(ctx, tasks),
+	}, nil
+}
+
+func (t *TaskServer) AddFilter(ctx context.Context, req *task.AddFilterRequest) (*task.AddFilterResponse, error) {
+	f := &dao.SavedFilter{Name: req.GetName(), Query: req.GetQuery()}
+	if err := t.filter.AddFilter(ctx, f); err != nil {
+		return nil, filterError(err)
+	}
+
+	return &task.AddFilterResponse{Filter: toSavedFilter(f)}, nil
+}
+
+func (t *TaskServer) ListFilters(ctx context.Context, req *task.ListFiltersRequest) (*task.ListFiltersResponse, error) {
+	filters, err := t.filter.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*task.SavedFilter, 0, len(filters))
+	for _, f := range filters {
+		results = append(results, toSavedFilter(f))
+	}
+
+	return &task.ListFiltersResponse{Filters: results}, nil
+}
+
+func (t *TaskServer) UpdateFilter(ctx context.Context, req *task.UpdateFilterRequest) (*task.UpdateFilterResponse, error) {
+	f := &dao.SavedFilter{Id: int(req.GetId()), Name: req.GetName(), Query: req.GetQuery()}
+	if err := t.filter.UpdateFilter(ctx, f); err != nil {
+		return nil, filterError(err)
+	}
+
+	return &task.UpdateFilterResponse{Filter: toSavedFilter(f)}, nil
+}
+
+func (t *TaskServer) DeleteFilter(ctx context.Context, req *task.DeleteFilterRequest) (*task.DeleteFilterResponse, error) {
+	if err := t.filter.DeleteFilter(ctx, int(req.GetId())); err != nil {
+		return nil, filterError(err)
+	}
+
+	return &task.DeleteFilterResponse{}, nil
+}
+
+func toSavedFilter(f *dao.SavedFilter) *task.SavedFilter {
+	return &task.SavedFilter{
+		Id:    int32(f.Id),
+		Name:  f.Name,
+		Query: f.Query,
+	}
+}
+
+func filterError(err error) error {
+	var syntax *filter.SyntaxError
+	switch {
+	case errors.Is(err, service.ErrFilterNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &syntax), errors.Is(err, service.ErrEmptyName), errors.Is(err, service.ErrInvalidTimezone):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// toTasks 转换任务列表, 并填充创建者与负责人的展示信息.
+// 用户服务不可用时只记录日志, 返回不带用户信息的任务
+func (t *TaskServer) toTasks(ctx context.Context, tasks []*dao.Task) []*task.Task {
+	ids := make([]int, 0, len(tasks)*2)
+	for _, t := range tasks {
+		ids = append(ids, t.UserId, t.AssigneeId)
+	}
+	users, err := t.users.Lookup(ctx, ids)
+	if err != nil {
+		zap.L().Warn("Failed to look up task users", zap.Error(err))
+	}
+
+	results := make([]*task.Task, 0, len(tasks))
+	for _, t := range tasks {
+		res := toTask(t)
+		res.Owner = toUserSummary(users[t.UserId])
+		res.Assignee = toUserSummary(users[t.AssigneeId])
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// toUserSummary 未知的用户返回 nil
+func toUserSummary(u service.UserSummary) *task.UserSummary {
+	if u.Id == 0 {
+		return nil
+	}
+
+	return &task.UserSummary{
+		Id:          int32(u.Id),
+		Name:        u.Name,
+		DisplayName: u.DisplayName,
+		Avatar:      u.Avatar,
+	}
+}
+
+func toTask(t *dao.Task) *task.Task {
+	return &task.Task{
+		Id:          int32(t.Id),
+		Title:       t.Title,
+		Content:     t.Content,
+		Utime:       time.Unix(t.Utime, 0).Format(time.DateTime),
+		Status:      int32(t.Status),
+		Due:         t.Due,
+		Rrule:       t.Rrule,
+		ProjectId:   int32(t.ProjectId),
+		Version:     t.Version,
+		Completed:   t.Completed,
+		ParentId:    int32(t.ParentId),
+		Labels:      t.Labels,
+		TimeSpent:   t.TimeSpent,
+		Priority:    int32(t.Priority),
+		Archived:    t.Archived,
+		SnoozeUntil: t.SnoozeUntil,
+		WorkspaceId: int32(t.WorkspaceId),
+		AssigneeId:  int32(t.AssigneeId),
+	}
+}
+
+func taskError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrProjectNotFound), errors.Is(err, service.ErrParentNotFound),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidPriority), errors.Is(err, service.ErrEmptyTitle),
+		errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidSnooze),
+		errors.Is(err, service.ErrInvalidAssignee):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+func toTimeEntry(e *dao.TimeEntry) *task.TimeEntry {
+	return &task.TimeEntry{
+		Id:       int32(e.Id),
+		TaskId:   int32(e.TaskId),
+		Start:    e.StartAt,
+		End:      e.EndAt,
+		Duration: service.Duration(e, time.Now().Unix()),
+		Note:     e.Note,
+	}
+}
+
+func timeError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrTimeEntryNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrNoRunningTimer), errors.Is(err, dao.ErrTimerRunning):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrInvalidTimeRange), errors.Is(err, service.ErrInvalidReportGroup),
+		errors.Is(err, service.ErrInvalidTimezone):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+func (t *TaskServer) PurgeUserData(ctx context.Context, request *task.PurgeUserDataRequest) (*task.PurgeUserDataResponse, error) {
+	workspaceIds := make([]int, 0, len(request.GetWorkspaceIds()))
+	for _, id := range request.GetWorkspaceIds() {
+		workspaceIds = append(workspaceIds, int(id))
+	}
+
+	n, err := t.account.Purge(ctx, int(request.GetUserId()), workspaceIds)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUser) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, service.ErrNotFromUsers) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, err
+	}
+
+	return &task.PurgeUserDataResponse{TasksDeleted: n}, nil
+}
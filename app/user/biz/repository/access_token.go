@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type AccessTokenRepo struct {
+	dao *dao.AccessTokenDao
+}
+
+func NewAccessTokenRepo(d *dao.AccessTokenDao) *AccessTokenRepo {
+	return &AccessTokenRepo{dao: d}
+}
+
+func (r *AccessTokenRepo) Create(ctx context.Context, t *dao.AccessToken) error {
+	return r.dao.Create(ctx, t)
+}
+
+func (r *AccessTokenRepo) FindByUid(ctx context.Context, uid int) ([]*dao.AccessToken, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *AccessTokenRepo) FindByHash(ctx context.Context, hash string) (dao.AccessToken, error) {
+	return r.dao.FindByHash(ctx, hash)
+}
+
+func (r *AccessTokenRepo) Touch(ctx context.Context, id int, at int64) error {
+	return r.dao.Touch(ctx, id, at)
+}
+
+func (r *AccessTokenRepo) Delete(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
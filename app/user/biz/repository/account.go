@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type AccountRepo struct {
+	dao *dao.AccountDao
+}
+
+func NewAccountRepo(d *dao.AccountDao) *AccountRepo {
+	return &AccountRepo{dao: d}
+}
+
+func (r *AccountRepo) Delete(ctx context.Context, uid int) error {
+	return r.dao.Delete(ctx, uid)
+}
+
+func (r *AccountRepo) FindDue(ctx context.Context, now int64, limit int) ([]*dao.AccountDeletion, error) {
+	return r.dao.FindDue(ctx, now, limit)
+}
+
+func (r *AccountRepo) Claim(ctx context.Context, id int, from, until int64) (bool, error) {
+	return r.dao.Claim(ctx, id, from, until)
+}
+
+func (r *AccountRepo) Retry(ctx context.Context, id int, next int64, lastError string) error {
+	return r.dao.Retry(ctx, id, next, lastError)
+}
+
+func (r *AccountRepo) Finish(ctx context.Context, id int, at int64) error {
+	return r.dao.Finish(ctx, id, at)
+}
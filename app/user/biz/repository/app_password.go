@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type AppPasswordRepo struct {
+	dao *dao.AppPasswordDao
+}
+
+func NewAppPasswordRepo(d *dao.AppPasswordDao) *AppPasswordRepo {
+	return &AppPasswordRepo{dao: d}
+}
+
+func (r *AppPasswordRepo) Create(ctx context.Context, p *dao.AppPassword) error {
+	return r.dao.Create(ctx, p)
+}
+
+func (r *AppPasswordRepo) FindByUid(ctx context.Context, uid int) ([]*dao.AppPassword, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *AppPasswordRepo) FindByHash(ctx context.Context, uid int, hash string) (dao.AppPassword, error) {
+	return r.dao.FindByHash(ctx, uid, hash)
+}
+
+func (r *AppPasswordRepo) Touch(ctx context.Context, id int) error {
+	return r.dao.Touch(ctx, id)
+}
+
+func (r *AppPasswordRepo) Delete(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
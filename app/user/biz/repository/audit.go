@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type AuditRepo struct {
+	dao *dao.AuditDao
+}
+
+func NewAuditRepo(d *dao.AuditDao) *AuditRepo {
+	return &AuditRepo{dao: d}
+}
+
+func (r *AuditRepo) Create(ctx context.Context, l *dao.AuditLog) error {
+	return r.dao.Create(ctx, l)
+}
+
+func (r *AuditRepo) Find(ctx context.Context, q dao.AuditQuery) ([]*dao.AuditLog, int64, error) {
+	return r.dao.Find(ctx, q)
+}
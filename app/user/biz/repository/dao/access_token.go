@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessToken 个人访问令牌, 供脚本等客户端通过 Authorization: Bearer 调用 API
+type AccessToken struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"index"`
+	Name      string `gorm:"type:varchar(128)"`
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	// Scopes 以空格分隔的权限范围
+	Scopes    string `gorm:"type:varchar(255)"`
+	ExpiresAt int64
+	LastUsed  int64
+	Ctime     int64
+}
+
+type AccessTokenDao struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenDao(db *gorm.DB) *AccessTokenDao {
+	return &AccessTokenDao{db: db}
+}
+
+func (d *AccessTokenDao) Create(ctx context.Context, t *AccessToken) error {
+	t.Ctime = time.Now().Unix()
+
+	return d.db.WithContext(ctx).Create(t).Error
+}
+
+func (d *AccessTokenDao) FindByUid(ctx context.Context, uid int) ([]*AccessToken, error) {
+	var ts []*AccessToken
+	err := d.db.WithContext(ctx).Model(&AccessToken{}).Where("user_id = ?", uid).Order("id").Find(&ts).Error
+	if err != nil {
+		return []*AccessToken{}, err
+	}
+
+	return ts, nil
+}
+
+func (d *AccessTokenDao) FindByHash(ctx context.Context, hash string) (AccessToken, error) {
+	var t AccessToken
+	err := d.db.WithContext(ctx).Model(&AccessToken{}).Where("token_hash = ?", hash).First(&t).Error
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	return t, nil
+}
+
+func (d *AccessTokenDao) Touch(ctx context.Context, id int, at int64) error {
+	return d.db.WithContext(ctx).Model(&AccessToken{}).Where("id = ?", id).UpdateColumn("last_used", at).Error
+}
+
+// Delete 吊销令牌, 令牌不属于该用户时返回 gorm.ErrRecordNotFound
+func (d *AccessTokenDao) Delete(ctx context.Context, uid, id int) error {
+	res := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, uid).Delete(&AccessToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
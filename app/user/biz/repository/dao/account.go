@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountDeletion 注销账号后需要在其他服务中清除数据的任务, 与删除账号在同一个事务中写入,
+// 由后台任务重试直到其他服务确认删除. 只保留用户 id 与随账号删除的工作区
+type AccountDeletion struct {
+	Id     int `gorm:"primaryKey,autoIncrement"`
+	UserId int `gorm:"uniqueIndex"`
+	// WorkspaceIds 用户拥有的工作区, 以空格分隔, 其中的任务与项目由任务服务一并清除
+	WorkspaceIds string `gorm:"type:text"`
+	// Attempts 调用失败的次数, 用于计算下次重试的时间
+	Attempts    int
+	NextAttempt int64  `gorm:"index"`
+	LastError   string `gorm:"type:varchar(512)"`
+	// Done 其他服务确认删除的时间, 为 0 表示未完成
+	Done  int64
+	Ctime int64
+}
+
+type AccountDao struct {
+	db *gorm.DB
+}
+
+func NewAccountDao(db *gorm.DB) *AccountDao {
+	return &AccountDao{db: db}
+}
+
+// Delete 删除用户与用户服务中属于该用户的全部数据, 包括用户拥有的工作区, 并记录需要其他服务清除数据的任务.
+// 用户记录删除后已签发的访问令牌在网关下一次检查时失效
+func (d *AccountDao) Delete(ctx context.Context, uid int) error {
+	now := time.Now().Unix()
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&AppPassword{}, &AccessToken{}, &RefreshToken{}, &RevokedToken{}, &Session{},
+			&PasswordReset{}, &TwoFactor{}, &RecoveryCode{}, &LoginChallenge{}, &UserIdentity{}} {
+			if err := tx.Where("user_id = ?", uid).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		workspaceIds, err := deleteWorkspaces(tx, uid)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", uid).Delete(&User{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&AccountDeletion{
+			UserId:       uid,
+			WorkspaceIds: joinIds(workspaceIds),
+			NextAttempt:  now,
+			Ctime:        now,
+		}).Error
+	})
+}
+
+func joinIds(ids []int) string {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, strconv.Itoa(id))
+	}
+
+	return strings.Join(s, " ")
+}
+
+// FindDue 返回需要执行的清除任务
+func (d *AccountDao) FindDue(ctx context.Context, now int64, limit int) ([]*AccountDeletion, error) {
+	var ds []*AccountDeletion
+	err := d.db.WithContext(ctx).Model(&AccountDeletion{}).Where("done = 0 AND next_attempt <= ?", now).
+		Order("next_attempt").Limit(limit).Find(&ds).Error
+	if err != nil {
+		return []*AccountDeletion{}, err
+	}
+
+	return ds, nil
+}
+
+// Claim 把任务的下次执行时间推迟到 until, 多个实例同时执行时只有一个能成功
+func (d *AccountDao) Claim(ctx context.Context, id int, from, until int64) (bool, error) {
+	res := d.db.WithContext(ctx).Model(&AccountDeletion{}).Where("id = ? AND done = 0 AND next_attempt = ?", id, from).
+		UpdateColumn("next_attempt", until)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+func (d *AccountDao) Retry(ctx context.Context, id int, next int64, lastError string) error {
+	return d.db.WithContext(ctx).Model(&AccountDeletion{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"next_attempt": next,
+			"last_error":   lastError,
+		}).Error
+}
+
+func (d *AccountDao) Finish(ctx context.Context, id int, at int64) error {
+	return d.db.WithContext(ctx).Model(&AccountDeletion{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"done":       at,
+			"last_error": "",
+		}).Error
+}
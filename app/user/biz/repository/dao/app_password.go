@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AppPassword 应用专用密码, 供 CalDAV 等无法走登录流程的客户端使用
+type AppPassword struct {
+	Id           int    `gorm:"primaryKey,autoIncrement"`
+	UserId       int    `gorm:"index"`
+	Name         string `gorm:"type:varchar(128)"`
+	PasswordHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	LastUsed     int64
+	Ctime        int64
+	Utime        int64
+}
+
+type AppPasswordDao struct {
+	db *gorm.DB
+}
+
+func NewAppPasswordDao(db *gorm.DB) *AppPasswordDao {
+	return &AppPasswordDao{db: db}
+}
+
+func (d *AppPasswordDao) Create(ctx context.Context, p *AppPassword) error {
+	now := time.Now().Unix()
+	p.Ctime = now
+	p.Utime = now
+
+	return d.db.WithContext(ctx).Create(p).Error
+}
+
+func (d *AppPasswordDao) FindByUid(ctx context.Context, uid int) ([]*AppPassword, error) {
+	var ps []*AppPassword
+	err := d.db.WithContext(ctx).Model(&AppPassword{}).Where("user_id = ?", uid).Order("id").Find(&ps).Error
+	if err != nil {
+		return []*AppPassword{}, err
+	}
+
+	return ps, nil
+}
+
+func (d *AppPasswordDao) FindByHash(ctx context.Context, uid int, hash string) (AppPassword, error) {
+	var p AppPassword
+	err := d.db.WithContext(ctx).Model(&AppPassword{}).Where("user_id = ? AND password_hash = ?", uid, hash).First(&p).Error
+	if err != nil {
+		return AppPassword{}, err
+	}
+
+	return p, nil
+}
+
+func (d *AppPasswordDao) Touch(ctx context.Context, id int) error {
+	return d.db.WithContext(ctx).Model(&AppPassword{}).Where("id = ?", id).UpdateColumn("last_used", time.Now().Unix()).Error
+}
+
+func (d *AppPasswordDao) Delete(ctx context.Context, uid, id int) error {
+	return d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, uid).Delete(&AppPassword{}).Error
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLog 管理员操作记录, 只追加不修改. 目标账号注销后保留记录
+type AuditLog struct {
+	Id      int `gorm:"primaryKey,autoIncrement"`
+	ActorId int `gorm:"index"`
+	// Action 取值见 service 包中的 Audit 常量
+	Action   string `gorm:"type:varchar(32)"`
+	TargetId int    `gorm:"index"`
+	// Detail 操作的参数或原因, 如模拟登录的原因、修改后的角色
+	Detail    string `gorm:"type:varchar(512)"`
+	Ip        string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:varchar(512)"`
+	Ctime     int64  `gorm:"index"`
+}
+
+// AuditQuery 查询操作记录的条件, 为 0 的条件不生效
+type AuditQuery struct {
+	ActorId  int
+	TargetId int
+	Offset   int
+	Limit    int
+}
+
+type AuditDao struct {
+	db *gorm.DB
+}
+
+func NewAuditDao(db *gorm.DB) *AuditDao {
+	return &AuditDao{db: db}
+}
+
+func (d *AuditDao) Create(ctx context.Context, l *AuditLog) error {
+	l.Ctime = time.Now().Unix()
+
+	return d.db.WithContext(ctx).Create(l).Error
+}
+
+// Find 按时间倒序返回一页记录与符合条件的总数
+func (d *AuditDao) Find(ctx context.Context, q AuditQuery) ([]*AuditLog, int64, error) {
+	db := d.db.WithContext(ctx).Model(&AuditLog{})
+	if q.ActorId != 0 {
+		db = db.Where("actor_id = ?", q.ActorId)
+	}
+	if q.TargetId != 0 {
+		db = db.Where("target_id = ?", q.TargetId)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return []*AuditLog{}, 0, err
+	}
+	var ls []*AuditLog
+	if err := db.Order("id DESC").Offset(q.Offset).Limit(q.Limit).Find(&ls).Error; err != nil {
+		return []*AuditLog{}, 0, err
+	}
+
+	return ls, total, nil
+}
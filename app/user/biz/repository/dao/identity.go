@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var ErrDuplicateIdentity = errors.New("duplicate identity")
+
+// UserIdentity 外部 OIDC 身份与本地账号的关联, 同一个身份只能关联一个账号
+type UserIdentity struct {
+	Id       int    `gorm:"primaryKey,autoIncrement"`
+	UserId   int    `gorm:"index"`
+	Provider string `gorm:"type:varchar(64);uniqueIndex:provider_subject"`
+	// Subject 身份提供方的 sub, 在同一个提供方内唯一且不会改变
+	Subject string `gorm:"type:varchar(255);uniqueIndex:provider_subject"`
+	// Email 关联时身份提供方返回的邮箱, 只用于展示
+	Email     string `gorm:"type:varchar(255)"`
+	LastLogin int64
+	Ctime     int64
+}
+
+type IdentityDao struct {
+	db *gorm.DB
+}
+
+func NewIdentityDao(db *gorm.DB) *IdentityDao {
+	return &IdentityDao{db: db}
+}
+
+func (d *IdentityDao) Create(ctx context.Context, i *UserIdentity) error {
+	now := time.Now().Unix()
+	i.Ctime = now
+	i.LastLogin = now
+
+	return duplicateIdentity(d.db.WithContext(ctx).Create(i).Error)
+}
+
+// CreateWithUser 通过外部身份注册, 账号与身份在同一个事务中创建
+func (d *IdentityDao) CreateWithUser(ctx context.Context, u *User, i *UserIdentity) error {
+	now := time.Now().Unix()
+	u.Ctime, u.Utime = now, now
+	i.Ctime, i.LastLogin = now, now
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return duplicateEmail(err)
+		}
+		i.UserId = u.Id
+		return duplicateIdentity(tx.Create(i).Error)
+	})
+
+	return err
+}
+
+// FindBySubject 没有关联时返回零值
+func (d *IdentityDao) FindBySubject(ctx context.Context, provider, subject string) (UserIdentity, error) {
+	var i UserIdentity
+	err := d.db.WithContext(ctx).Model(&UserIdentity{}).Where("provider = ? AND subject = ?", provider, subject).Find(&i).Error
+	if err != nil {
+		return UserIdentity{}, err
+	}
+
+	return i, nil
+}
+
+func (d *IdentityDao) FindByUid(ctx context.Context, uid int) ([]*UserIdentity, error) {
+	var identities []*UserIdentity
+	err := d.db.WithContext(ctx).Model(&UserIdentity{}).Where("user_id = ?", uid).Order("id").Find(&identities).Error
+	if err != nil {
+		return []*UserIdentity{}, err
+	}
+
+	return identities, nil
+}
+
+func (d *IdentityDao) Touch(ctx context.Context, id int, at int64) error {
+	return d.db.WithContext(ctx).Model(&UserIdentity{}).Where("id = ?", id).UpdateColumn("last_login", at).Error
+}
+
+// Delete 解除关联, 身份不属于该用户时返回 gorm.ErrRecordNotFound
+func (d *IdentityDao) Delete(ctx context.Context, uid, id int) error {
+	res := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, uid).Delete(&UserIdentity{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// duplicateIdentity 并发关联同一个身份时由唯一索引兜底
+func duplicateIdentity(err error) error {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1062 {
+		return ErrDuplicateIdentity
+	}
+	return err
+}
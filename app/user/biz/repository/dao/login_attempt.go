@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttempt 登录失败计数, Subject 为账号或来源 IP
+type LoginAttempt struct {
+	Id          int    `gorm:"primaryKey,autoIncrement"`
+	Subject     string `gorm:"uniqueIndex;type:varchar(191)"`
+	Failures    int
+	LastFailure int64 `gorm:"index"`
+}
+
+type LoginAttemptDao struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptDao(db *gorm.DB) *LoginAttemptDao {
+	return &LoginAttemptDao{db: db}
+}
+
+// Find 没有记录时返回零值
+func (d *LoginAttemptDao) Find(ctx context.Context, subject string) (LoginAttempt, error) {
+	var a LoginAttempt
+	err := d.db.WithContext(ctx).Model(&LoginAttempt{}).Where("subject = ?", subject).Find(&a).Error
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	return a, nil
+}
+
+// Fail 原子地增加失败次数, 上次失败早于 since 时重新计数. 同时顺带清理早于 since 的记录
+func (d *LoginAttemptDao) Fail(ctx context.Context, subject string, now, since int64) (LoginAttempt, error) {
+	db := d.db.WithContext(ctx)
+	if err := db.Where("last_failure < ?", since).Delete(&LoginAttempt{}).Error; err != nil {
+		return LoginAttempt{}, err
+	}
+
+	// failures 必须在 last_failure 之前赋值, 以便读取到更新前的 last_failure
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "failures"}, Value: gorm.Expr("IF(last_failure < ?, 1, failures + 1)", since)},
+			{Column: clause.Column{Name: "last_failure"}, Value: now},
+		},
+	}).Create(&LoginAttempt{Subject: subject, Failures: 1, LastFailure: now}).Error
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	return d.Find(ctx, subject)
+}
+
+func (d *LoginAttemptDao) Delete(ctx context.Context, subject string) error {
+	return d.db.WithContext(ctx).Where("subject = ?", subject).Delete(&LoginAttempt{}).Error
+}
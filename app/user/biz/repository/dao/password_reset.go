@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordReset 重置密码令牌, 只保存哈希, 使用一次后失效
+type PasswordReset struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	ExpiresAt int64
+	// Used 使用时间, 为 0 表示未使用
+	Used  int64
+	Ctime int64
+}
+
+type PasswordResetDao struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetDao(db *gorm.DB) *PasswordResetDao {
+	return &PasswordResetDao{db: db}
+}
+
+func (d *PasswordResetDao) Create(ctx context.Context, r *PasswordReset) error {
+	r.Ctime = time.Now().Unix()
+
+	return d.db.WithContext(ctx).Create(r).Error
+}
+
+// Consume 使用令牌, 令牌不存在、已过期或已使用时返回 gorm.ErrRecordNotFound.
+// 成功后同一用户其他未使用的令牌一并作废
+func (d *PasswordResetDao) Consume(ctx context.Context, hash string, now int64) (PasswordReset, error) {
+	var r PasswordReset
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PasswordReset{}).Where("token_hash = ? AND used = 0 AND expires_at > ?", hash, now).First(&r).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&PasswordReset{}).Where("user_id = ? AND used = 0", r.UserId).UpdateColumn("used", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		// 并发的请求已经使用了该令牌
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+
+	return r, err
+}
@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken 刷新令牌, 只保存哈希. 每次刷新都会轮换出同一 Family 下的新令牌,
+// 已轮换的令牌再次出现说明被盗用, 此时整个 Family 都会被吊销
+type RefreshToken struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"index"`
+	Family    string `gorm:"index;type:varchar(64)"`
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	UserAgent string
+	ExpiresAt int64
+	// Rotated 轮换时间, 为 0 表示仍是该 Family 当前有效的令牌
+	Rotated int64
+	// Revoked 吊销时间, 为 0 表示未吊销
+	Revoked int64
+	Ctime   int64
+}
+
+type RefreshTokenDao struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenDao(db *gorm.DB) *RefreshTokenDao {
+	return &RefreshTokenDao{db: db}
+}
+
+func (d *RefreshTokenDao) Create(ctx context.Context, t *RefreshToken) error {
+	t.Ctime = time.Now().Unix()
+
+	return d.db.WithContext(ctx).Create(t).Error
+}
+
+func (d *RefreshTokenDao) FindByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	var t RefreshToken
+	err := d.db.WithContext(ctx).Model(&RefreshToken{}).Where("token_hash = ?", hash).First(&t).Error
+
+	return t, err
+}
+
+// Rotate 把 old 标记为已轮换并创建 next, 条件更新保证同一个令牌只能轮换一次,
+// 返回 false 表示令牌已被并发的请求使用过
+func (d *RefreshTokenDao) Rotate(ctx context.Context, old RefreshToken, next *RefreshToken) (bool, error) {
+	rotated := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		res := tx.Model(&RefreshToken{}).Where("id = ? AND rotated = 0 AND revoked = 0", old.Id).
+			UpdateColumn("rotated", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		next.Ctime = now
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		rotated = true
+		return nil
+	})
+
+	return rotated, err
+}
+
+// RevokeFamily 吊销同一 Family 下的全部令牌
+func (d *RefreshTokenDao) RevokeFamily(ctx context.Context, family string) error {
+	return d.db.WithContext(ctx).Model(&RefreshToken{}).Where("family = ? AND revoked = 0", family).
+		UpdateColumn("revoked", time.Now().Unix()).Error
+}
+
+// RevokeByUid 吊销用户的全部刷新令牌, except 不为空时保留该 Family
+func (d *RefreshTokenDao) RevokeByUid(ctx context.Context, uid int, except string) error {
+	return d.db.WithContext(ctx).Model(&RefreshToken{}).Where("user_id = ? AND revoked = 0 AND family <> ?", uid, except).
+		UpdateColumn("revoked", time.Now().Unix()).Error
+}
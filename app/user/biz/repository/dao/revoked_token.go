@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevokedToken 退出登录后尚未过期的访问令牌, 过期后即可清理
+type RevokedToken struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	Jti       string `gorm:"uniqueIndex;type:varchar(64)"`
+	UserId    int
+	ExpiresAt int64 `gorm:"index"`
+}
+
+type RevokedTokenDao struct {
+	db *gorm.DB
+}
+
+func NewRevokedTokenDao(db *gorm.DB) *RevokedTokenDao {
+	return &RevokedTokenDao{db: db}
+}
+
+// Create 记录吊销的令牌, 同时顺带清理已经过期的记录
+func (d *RevokedTokenDao) Create(ctx context.Context, t *RevokedToken) error {
+	db := d.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", time.Now().Unix()).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(t).Error
+}
+
+func (d *RevokedTokenDao) Exists(ctx context.Context, jti string) (bool, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&RevokedToken{}).Where("jti = ?", jti).Count(&n).Error
+
+	return n > 0, err
+}
@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session 一次登录会话, Sid 与刷新令牌的 Family 相同, 会话内轮换的令牌共用一条记录
+type Session struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"index"`
+	Sid       string `gorm:"uniqueIndex;type:varchar(64)"`
+	Device    string `gorm:"type:varchar(128)"`
+	UserAgent string
+	Ip        string `gorm:"type:varchar(64)"`
+	LastSeen  int64
+	ExpiresAt int64
+	// Revoked 退出或被移除的时间, 为 0 表示仍然有效
+	Revoked int64
+	Ctime   int64
+}
+
+type SessionDao struct {
+	db *gorm.DB
+}
+
+func NewSessionDao(db *gorm.DB) *SessionDao {
+	return &SessionDao{db: db}
+}
+
+func (d *SessionDao) Create(ctx context.Context, s *Session) error {
+	now := time.Now().Unix()
+	s.Ctime = now
+	s.LastSeen = now
+
+	return d.db.WithContext(ctx).Create(s).Error
+}
+
+// FindActive 查询用户未退出且未过期的会话, 最近使用的在前
+func (d *SessionDao) FindActive(ctx context.Context, uid int, now int64) ([]*Session, error) {
+	var sessions []*Session
+	err := d.db.WithContext(ctx).Model(&Session{}).
+		Where("user_id = ? AND revoked = 0 AND expires_at > ?", uid, now).
+		Order("last_seen DESC").Find(&sessions).Error
+	if err != nil {
+		return []*Session{}, err
+	}
+
+	return sessions, nil
+}
+
+func (d *SessionDao) FindById(ctx context.Context, uid, id int) (Session, error) {
+	var s Session
+	err := d.db.WithContext(ctx).Model(&Session{}).Where("id = ? AND user_id = ?", id, uid).First(&s).Error
+
+	return s, err
+}
+
+func (d *SessionDao) FindBySid(ctx context.Context, sid string) (Session, error) {
+	var s Session
+	err := d.db.WithContext(ctx).Model(&Session{}).Where("sid = ?", sid).First(&s).Error
+
+	return s, err
+}
+
+func (d *SessionDao) RevokeBySid(ctx context.Context, sid string) error {
+	return d.db.WithContext(ctx).Model(&Session{}).Where("sid = ? AND revoked = 0", sid).
+		UpdateColumn("revoked", time.Now().Unix()).Error
+}
+
+// RevokeByUid 结束用户的全部会话, except 不为空时保留该会话
+func (d *SessionDao) RevokeByUid(ctx context.Context, uid int, except string) error {
+	return d.db.WithContext(ctx).Model(&Session{}).Where("user_id = ? AND revoked = 0 AND sid <> ?", uid, except).
+		UpdateColumn("revoked", time.Now().Unix()).Error
+}
+
+// Touch 更新会话的最近使用时间与 IP, 只会把时间往后推
+func (d *SessionDao) Touch(ctx context.Context, uid int, sid, ip string, at int64) error {
+	updates := map[string]any{"last_seen": at}
+	if ip != "" {
+		updates["ip"] = ip
+	}
+
+	return d.db.WithContext(ctx).Model(&Session{}).
+		Where("user_id = ? AND sid = ? AND last_seen < ?", uid, sid, at).
+		UpdateColumns(updates).Error
+}
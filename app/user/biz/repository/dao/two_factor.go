@@ -0,0 +1,182 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TwoFactor 用户的 TOTP 配置, 密钥加密后保存
+type TwoFactor struct {
+	Id     int    `gorm:"primaryKey,autoIncrement"`
+	UserId int    `gorm:"uniqueIndex"`
+	Secret string `gorm:"type:varchar(255)"`
+	// Enabled 开启时间, 为 0 表示已绑定但还没有通过验证
+	Enabled int64
+	// LastCounter 最近一次通过验证的时间步, 同一个验证码不能重复使用
+	LastCounter int64
+	Ctime       int64
+	Utime       int64
+}
+
+// RecoveryCode 恢复码, 只保存哈希, 每个只能使用一次
+type RecoveryCode struct {
+	Id       int    `gorm:"primaryKey,autoIncrement"`
+	UserId   int    `gorm:"index"`
+	CodeHash string `gorm:"type:varchar(64)"`
+	// Used 使用时间, 为 0 表示未使用
+	Used int64
+}
+
+// LoginChallenge 密码验证通过后等待输入验证码的登录请求, 只保存哈希
+type LoginChallenge struct {
+	Id        int    `gorm:"primaryKey,autoIncrement"`
+	UserId    int    `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;type:varchar(64)"`
+	ExpiresAt int64
+	Attempts  int
+	Ctime     int64
+}
+
+type TwoFactorDao struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorDao(db *gorm.DB) *TwoFactorDao {
+	return &TwoFactorDao{db: db}
+}
+
+// FindByUid 没有绑定时返回零值
+func (d *TwoFactorDao) FindByUid(ctx context.Context, uid int) (TwoFactor, error) {
+	var t TwoFactor
+	err := d.db.WithContext(ctx).Model(&TwoFactor{}).Where("user_id = ?", uid).Find(&t).Error
+	if err != nil {
+		return TwoFactor{}, err
+	}
+
+	return t, nil
+}
+
+// Enroll 绑定新的密钥, 覆盖之前没有通过验证的密钥, 已开启时不做修改
+func (d *TwoFactorDao) Enroll(ctx context.Context, uid int, secret string) error {
+	now := time.Now().Unix()
+	res := d.db.WithContext(ctx).Model(&TwoFactor{}).Where("user_id = ? AND enabled = 0", uid).
+		Updates(map[string]any{
+			"secret":       secret,
+			"last_counter": 0,
+			"utime":        now,
+		})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&TwoFactor{
+		UserId: uid,
+		Secret: secret,
+		Ctime:  now,
+		Utime:  now,
+	}).Error
+}
+
+// Enable 开启两步验证并替换全部恢复码
+func (d *TwoFactorDao) Enable(ctx context.Context, uid int, counter int64, codes []RecoveryCode) (bool, error) {
+	var ok bool
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		res := tx.Model(&TwoFactor{}).Where("user_id = ? AND enabled = 0", uid).
+			Updates(map[string]any{
+				"enabled":      now,
+				"last_counter": counter,
+				"utime":        now,
+			})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		ok = true
+		return replaceCodes(tx, uid, codes)
+	})
+
+	return ok, err
+}
+
+// ReplaceRecoveryCodes 重新生成恢复码, 之前的恢复码全部失效
+func (d *TwoFactorDao) ReplaceRecoveryCodes(ctx context.Context, uid int, codes []RecoveryCode) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceCodes(tx, uid, codes)
+	})
+}
+
+// AdvanceCounter 记录通过验证的时间步, 时间步不大于上一次时返回 false
+func (d *TwoFactorDao) AdvanceCounter(ctx context.Context, uid int, counter int64) (bool, error) {
+	res := d.db.WithContext(ctx).Model(&TwoFactor{}).Where("user_id = ? AND last_counter < ?", uid, counter).
+		UpdateColumn("last_counter", counter)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// UseRecoveryCode 使用恢复码, 恢复码不存在或已使用时返回 false
+func (d *TwoFactorDao) UseRecoveryCode(ctx context.Context, uid int, hash string) (bool, error) {
+	res := d.db.WithContext(ctx).Model(&RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used = 0", uid, hash).
+		UpdateColumn("used", time.Now().Unix())
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// Delete 关闭两步验证, 删除密钥与恢复码
+func (d *TwoFactorDao) Delete(ctx context.Context, uid int) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", uid).Delete(&TwoFactor{}).Error
+	})
+}
+
+func (d *TwoFactorDao) CreateChallenge(ctx context.Context, c *LoginChallenge) error {
+	c.Ctime = time.Now().Unix()
+
+	// 顺便清理过期的登录请求
+	d.db.WithContext(ctx).Where("expires_at <= ?", c.Ctime).Delete(&LoginChallenge{})
+
+	return d.db.WithContext(ctx).Create(c).Error
+}
+
+// FindChallenge 查找没有过期且尝试次数未超过 maxAttempts 的登录请求, 找不到时返回 gorm.ErrRecordNotFound
+func (d *TwoFactorDao) FindChallenge(ctx context.Context, hash string, now int64, maxAttempts int) (LoginChallenge, error) {
+	var c LoginChallenge
+	err := d.db.WithContext(ctx).Model(&LoginChallenge{}).
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", hash, now, maxAttempts).First(&c).Error
+	if err != nil {
+		return LoginChallenge{}, err
+	}
+
+	return c, nil
+}
+
+func (d *TwoFactorDao) IncrAttempts(ctx context.Context, id int) error {
+	return d.db.WithContext(ctx).Model(&LoginChallenge{}).Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// ConsumeChallenge 删除登录请求, 已被并发的请求使用时返回 false
+func (d *TwoFactorDao) ConsumeChallenge(ctx context.Context, id int) (bool, error) {
+	res := d.db.WithContext(ctx).Where("id = ?", id).Delete(&LoginChallenge{})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+func replaceCodes(tx *gorm.DB, uid int, codes []RecoveryCode) error {
+	if err := tx.Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	for i := range codes {
+		codes[i].UserId = uid
+	}
+
+	return tx.Create(&codes).Error
+}
@@ -2,17 +2,64 @@ package dao
 
 import (
 	"context"
-	"gorm.io/gorm"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
 )
 
+var ErrDuplicateEmail = errors.New("duplicate email")
+
 type User struct {
 	Id       int    `gorm:"primaryKey,autoIncrement"`
 	Name     string `gorm:"unique;type:varchar(255)"`
 	Password string `gorm:";type:varchar(255)"`
-	Ctime    int64
-	Utime    int64
+	// Email 登录与接收通知邮件的地址, 没有设置时为 NULL 以免违反唯一约束
+	Email *string `gorm:"uniqueIndex;type:varchar(255)"`
+	// EmailVerified 邮箱验证时间, 为 0 表示未验证, 修改邮箱后需要重新验证
+	EmailVerified int64
+	// TokenGeneration 签发访问令牌时写入, 增加后之前签发的令牌全部失效
+	TokenGeneration int64
+	// Role 取值见 service 包中的 Role 常量, 写入访问令牌. 第一个管理员需要直接修改数据库
+	Role string `gorm:"type:varchar(16);default:user"`
+	// Disabled 管理员停用账号的时间, 为 0 表示正常
+	Disabled int64
+	// ResetRequired 管理员要求重置密码的时间, 设置新密码后清除
+	ResetRequired int64
+	// 以下为个人资料, 为空时客户端使用默认值
+	DisplayName string `gorm:"type:varchar(64)"`
+	Avatar      string `gorm:"type:varchar(512)"`
+	// Timezone IANA 时区名称, 如 Asia/Shanghai
+	Timezone string `gorm:"type:varchar(64)"`
+	// Locale BCP 47 语言标签, 如 zh-CN
+	Locale string `gorm:"type:varchar(16)"`
+	// WeekStart 每周的第一天, 0 为周日
+	WeekStart int
+	Ctime     int64
+	Utime     int64
+}
+
+// Profile 修改个人资料时需要更新的字段, nil 表示不修改
+type Profile struct {
+	DisplayName *string
+	Avatar      *string
+	Timezone    *string
+	Locale      *string
+	WeekStart   *int
+}
+
+// UserQuery 管理员查询用户的条件, 为空的条件不生效
+type UserQuery struct {
+	// Keyword 匹配用户名、邮箱或显示名称
+	Keyword  string
+	Role     string
+	Disabled *bool
+	Offset   int
+	Limit    int
 }
+
 type UserDao struct {
 	db *gorm.DB
 }
@@ -26,7 +73,7 @@ func (d *UserDao) Create(ctx context.Context, u *User) error {
 	u.Ctime = now
 	u.Utime = now
 
-	return d.db.WithContext(ctx).Create(u).Error
+	return duplicateEmail(d.db.WithContext(ctx).Create(u).Error)
 }
 
 func (d *UserDao) FindByName(ctx context.Context, name string) (User, error) {
@@ -39,6 +86,144 @@ func (d *UserDao) FindByName(ctx context.Context, name string) (User, error) {
 	return u, nil
 }
 
+func (d *UserDao) FindByEmail(ctx context.Context, email string) (User, error) {
+	var u User
+	err := d.db.WithContext(ctx).Model(&User{}).Where("email = ?", email).Find(&u).Error
+	if err != nil {
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+// UpdateEmail 修改邮箱并清除验证状态
+func (d *UserDao) UpdateEmail(ctx context.Context, id int, email string) error {
+	err := d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"email":          email,
+			"email_verified": 0,
+			"utime":          time.Now().Unix(),
+		}).Error
+
+	return duplicateEmail(err)
+}
+
+// MarkEmailVerified 验证邮箱, 只有邮箱仍是链接签发时的地址才会生效
+func (d *UserDao) MarkEmailVerified(ctx context.Context, id int, email string, at int64) (bool, error) {
+	res := d.db.WithContext(ctx).Model(&User{}).Where("id = ? AND email = ?", id, email).
+		Updates(map[string]any{
+			"email_verified": at,
+			"utime":          at,
+		})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// UpdatePassword 修改密码并清除重置密码的要求
+func (d *UserDao) UpdatePassword(ctx context.Context, id int, password string) error {
+	return d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"password":       password,
+			"reset_required": 0,
+			"utime":          time.Now().Unix(),
+		}).Error
+}
+
+func (d *UserDao) UpdateRole(ctx context.Context, id int, role string) error {
+	return d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"role":  role,
+			"utime": time.Now().Unix(),
+		}).Error
+}
+
+// UpdateDisabled at 为 0 时恢复账号
+func (d *UserDao) UpdateDisabled(ctx context.Context, id int, at int64) error {
+	return d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"disabled": at,
+			"utime":    time.Now().Unix(),
+		}).Error
+}
+
+func (d *UserDao) RequireReset(ctx context.Context, id int, at int64) error {
+	return d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"reset_required": at,
+			"utime":          at,
+		}).Error
+}
+
+// Search 按 id 排序返回一页用户与符合条件的总数
+func (d *UserDao) Search(ctx context.Context, q UserQuery) ([]User, int64, error) {
+	db := d.db.WithContext(ctx).Model(&User{})
+	if q.Keyword != "" {
+		like := "%" + escapeLike(q.Keyword) + "%"
+		db = db.Where("name LIKE ? OR email LIKE ? OR display_name LIKE ?", like, like, like)
+	}
+	if q.Role != "" {
+		db = db.Where("role = ?", q.Role)
+	}
+	if q.Disabled != nil {
+		if *q.Disabled {
+			db = db.Where("disabled <> 0")
+		} else {
+			db = db.Where("disabled = 0")
+		}
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return []User{}, 0, err
+	}
+	var us []User
+	if err := db.Order("id").Offset(q.Offset).Limit(q.Limit).Find(&us).Error; err != nil {
+		return []User{}, 0, err
+	}
+
+	return us, total, nil
+}
+
+// UpdateProfile 只更新 p 中不为 nil 的字段
+func (d *UserDao) UpdateProfile(ctx context.Context, id int, p Profile) error {
+	fields := map[string]any{"utime": time.Now().Unix()}
+	if p.DisplayName != nil {
+		fields["display_name"] = *p.DisplayName
+	}
+	if p.Avatar != nil {
+		fields["avatar"] = *p.Avatar
+	}
+	if p.Timezone != nil {
+		fields["timezone"] = *p.Timezone
+	}
+	if p.Locale != nil {
+		fields["locale"] = *p.Locale
+	}
+	if p.WeekStart != nil {
+		fields["week_start"] = *p.WeekStart
+	}
+
+	return d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// BumpGeneration 增加令牌代数并返回新值
+func (d *UserDao) BumpGeneration(ctx context.Context, id int) (int64, error) {
+	var u User
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", id).
+			Updates(map[string]any{
+				"token_generation": gorm.Expr("token_generation + 1"),
+				"utime":            time.Now().Unix(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", id).First(&u).Error
+	})
+
+	return u.TokenGeneration, err
+}
+
 func (d *UserDao) FindById(ctx context.Context, id int) (User, error) {
 	var u User
 	err := d.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Find(&u).Error
@@ -48,3 +233,33 @@ func (d *UserDao) FindById(ctx context.Context, id int) (User, error) {
 
 	return u, nil
 }
+
+// FindByIds 批量查询用户的公开信息, 只读取展示需要的列
+func (d *UserDao) FindByIds(ctx context.Context, ids []int) ([]User, error) {
+	var users []User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := d.db.WithContext(ctx).Model(&User{}).Select("id", "name", "display_name", "avatar").
+		Where("id IN ?", ids).Find(&users).Error
+	if err != nil {
+		return []User{}, err
+	}
+
+	return users, nil
+}
+
+// duplicateEmail 并发注册或修改为同一邮箱时由唯一索引兜底
+func duplicateEmail(err error) error {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1062 && strings.Contains(me.Message, "email") {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
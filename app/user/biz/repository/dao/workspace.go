@@ -0,0 +1,322 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyMember = errors.New("already a member of the workspace")
+	ErrInviteUsed    = errors.New("invite not found or already used")
+)
+
+// 邀请的状态
+const (
+	InvitePending  = "pending"
+	InviteAccepted = "accepted"
+	InviteDeclined = "declined"
+	InviteRevoked  = "revoked"
+)
+
+type Workspace struct {
+	Id      int    `gorm:"primaryKey,autoIncrement"`
+	Name    string `gorm:"type:varchar(64)"`
+	OwnerId int    `gorm:"index"`
+	Ctime   int64
+	Utime   int64
+}
+
+// WorkspaceMember 工作区成员, 所有者同样是成员
+type WorkspaceMember struct {
+	Id          int `gorm:"primaryKey,autoIncrement"`
+	WorkspaceId int `gorm:"uniqueIndex:workspace_user"`
+	UserId      int `gorm:"uniqueIndex:workspace_user;index"`
+	// Role 取值见 service 包中的 Member 常量
+	Role  string `gorm:"type:varchar(16)"`
+	Ctime int64
+}
+
+// WorkspaceInvite 工作区邀请, 只保存令牌的哈希, 接受或拒绝后失效
+type WorkspaceInvite struct {
+	Id          int    `gorm:"primaryKey,autoIncrement"`
+	WorkspaceId int    `gorm:"index"`
+	TokenHash   string `gorm:"uniqueIndex;type:varchar(64)"`
+	// Email 不为空时只有该邮箱的用户可以接受
+	Email     string `gorm:"type:varchar(255)"`
+	Role      string `gorm:"type:varchar(16)"`
+	InviterId int
+	Status    string `gorm:"type:varchar(16);default:pending"`
+	// UserId 接受或拒绝邀请的用户
+	UserId    int
+	ExpiresAt int64
+	Ctime     int64
+	Utime     int64
+}
+
+// MemberInfo 成员与对应的用户信息
+type MemberInfo struct {
+	WorkspaceMember
+	Name        string
+	DisplayName string
+	Avatar      string
+}
+
+// Membership 用户所在的工作区与用户在其中的角色
+type Membership struct {
+	Workspace
+	Role        string
+	MemberCount int
+}
+
+type WorkspaceDao struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceDao(db *gorm.DB) *WorkspaceDao {
+	return &WorkspaceDao{db: db}
+}
+
+// Create 创建工作区, 并把创建者加入为所有者
+func (d *WorkspaceDao) Create(ctx context.Context, w *Workspace, ownerRole string) error {
+	now := time.Now().Unix()
+	w.Ctime = now
+	w.Utime = now
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		return tx.Create(&WorkspaceMember{
+			WorkspaceId: w.Id,
+			UserId:      w.OwnerId,
+			Role:        ownerRole,
+			Ctime:       now,
+		}).Error
+	})
+}
+
+// FindByMember 查询用户所在的全部工作区
+func (d *WorkspaceDao) FindByMember(ctx context.Context, uid int) ([]Membership, error) {
+	var ms []Membership
+	err := d.db.WithContext(ctx).Table("workspace").
+		Select("workspace.*, workspace_member.role, "+
+			"(SELECT COUNT(*) FROM workspace_member m WHERE m.workspace_id = workspace.id) AS member_count").
+		Joins("JOIN workspace_member ON workspace_member.workspace_id = workspace.id").
+		Where("workspace_member.user_id = ?", uid).Order("workspace.id").Scan(&ms).Error
+	if err != nil {
+		return []Membership{}, err
+	}
+
+	return ms, nil
+}
+
+func (d *WorkspaceDao) FindById(ctx context.Context, id int) (Workspace, error) {
+	var w Workspace
+	err := d.db.WithContext(ctx).Model(&Workspace{}).Where("id = ?", id).First(&w).Error
+	if err != nil {
+		return Workspace{}, err
+	}
+
+	return w, nil
+}
+
+func (d *WorkspaceDao) Rename(ctx context.Context, id int, name string) error {
+	return d.db.WithContext(ctx).Model(&Workspace{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"name":  name,
+			"utime": time.Now().Unix(),
+		}).Error
+}
+
+// FindMember 用户不是成员时返回 gorm.ErrRecordNotFound
+func (d *WorkspaceDao) FindMember(ctx context.Context, workspaceId, uid int) (WorkspaceMember, error) {
+	var m WorkspaceMember
+	err := d.db.WithContext(ctx).Model(&WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceId, uid).First(&m).Error
+	if err != nil {
+		return WorkspaceMember{}, err
+	}
+
+	return m, nil
+}
+
+// FindMembers 按加入时间返回全部成员
+func (d *WorkspaceDao) FindMembers(ctx context.Context, workspaceId int) ([]MemberInfo, error) {
+	var ms []MemberInfo
+	err := d.db.WithContext(ctx).Table("workspace_member").
+		Select("workspace_member.*, user.name, user.display_name, user.avatar").
+		Joins("JOIN user ON user.id = workspace_member.user_id").
+		Where("workspace_member.workspace_id = ?", workspaceId).Order("workspace_member.id").Scan(&ms).Error
+	if err != nil {
+		return []MemberInfo{}, err
+	}
+
+	return ms, nil
+}
+
+func (d *WorkspaceDao) UpdateMemberRole(ctx context.Context, workspaceId, uid int, role string) error {
+	return d.db.WithContext(ctx).Model(&WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceId, uid).UpdateColumn("role", role).Error
+}
+
+// TransferOwner 转让工作区, 原所有者成为 prevRole
+func (d *WorkspaceDao) TransferOwner(ctx context.Context, workspaceId, from, to int, ownerRole, prevRole string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Workspace{}).Where("id = ? AND owner_id = ?", workspaceId, from).
+			Updates(map[string]any{
+				"owner_id": to,
+				"utime":    time.Now().Unix(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Model(&WorkspaceMember{}).Where("workspace_id = ? AND user_id = ?", workspaceId, from).
+			UpdateColumn("role", prevRole).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&WorkspaceMember{}).Where("workspace_id = ? AND user_id = ?", workspaceId, to).
+			UpdateColumn("role", ownerRole).Error
+	})
+}
+
+func (d *WorkspaceDao) RemoveMember(ctx context.Context, workspaceId, uid int) error {
+	return d.db.WithContext(ctx).Where("workspace_id = ? AND user_id = ?", workspaceId, uid).
+		Delete(&WorkspaceMember{}).Error
+}
+
+func (d *WorkspaceDao) CreateInvite(ctx context.Context, i *WorkspaceInvite) error {
+	now := time.Now().Unix()
+	i.Status = InvitePending
+	i.Ctime = now
+	i.Utime = now
+
+	return d.db.WithContext(ctx).Create(i).Error
+}
+
+// FindInvites 查询工作区未过期且未处理的邀请
+func (d *WorkspaceDao) FindInvites(ctx context.Context, workspaceId int, now int64) ([]*WorkspaceInvite, error) {
+	var is []*WorkspaceInvite
+	err := d.db.WithContext(ctx).Model(&WorkspaceInvite{}).
+		Where("workspace_id = ? AND status = ? AND expires_at > ?", workspaceId, InvitePending, now).
+		Order("id DESC").Find(&is).Error
+	if err != nil {
+		return []*WorkspaceInvite{}, err
+	}
+
+	return is, nil
+}
+
+// FindInvite 按令牌哈希查询未过期且未处理的邀请, 不存在时返回 ErrInviteUsed
+func (d *WorkspaceDao) FindInvite(ctx context.Context, hash string, now int64) (WorkspaceInvite, error) {
+	var i WorkspaceInvite
+	err := d.db.WithContext(ctx).Model(&WorkspaceInvite{}).
+		Where("token_hash = ? AND status = ? AND expires_at > ?", hash, InvitePending, now).First(&i).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return WorkspaceInvite{}, ErrInviteUsed
+	}
+	if err != nil {
+		return WorkspaceInvite{}, err
+	}
+
+	return i, nil
+}
+
+// RevokeInvite 撤销未处理的邀请, 不存在时返回 ErrInviteUsed
+func (d *WorkspaceDao) RevokeInvite(ctx context.Context, workspaceId, id int) error {
+	res := d.db.WithContext(ctx).Model(&WorkspaceInvite{}).
+		Where("id = ? AND workspace_id = ? AND status = ?", id, workspaceId, InvitePending).
+		Updates(map[string]any{
+			"status": InviteRevoked,
+			"utime":  time.Now().Unix(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInviteUsed
+	}
+
+	return nil
+}
+
+// AcceptInvite 在一个事务中使用邀请并加入工作区. 并发的请求只有一个能使用同一个邀请
+func (d *WorkspaceDao) AcceptInvite(ctx context.Context, i WorkspaceInvite, uid int) error {
+	now := time.Now().Unix()
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := useInvite(tx, i.Id, uid, InviteAccepted, now); err != nil {
+			return err
+		}
+		err := tx.Create(&WorkspaceMember{
+			WorkspaceId: i.WorkspaceId,
+			UserId:      uid,
+			Role:        i.Role,
+			Ctime:       now,
+		}).Error
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			return ErrAlreadyMember
+		}
+		return err
+	})
+}
+
+func (d *WorkspaceDao) DeclineInvite(ctx context.Context, id, uid int) error {
+	return useInvite(d.db.WithContext(ctx), id, uid, InviteDeclined, time.Now().Unix())
+}
+
+func useInvite(tx *gorm.DB, id, uid int, status string, now int64) error {
+	res := tx.Model(&WorkspaceInvite{}).Where("id = ? AND status = ? AND expires_at > ?", id, InvitePending, now).
+		Updates(map[string]any{
+			"status":  status,
+			"user_id": uid,
+			"utime":   now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInviteUsed
+	}
+
+	return nil
+}
+
+// HasOtherMembers 用户是否拥有还有其他成员的工作区, 这样的工作区需要先转让才能注销账号
+func (d *WorkspaceDao) HasOtherMembers(ctx context.Context, ownerId int) (bool, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&WorkspaceMember{}).
+		Where("workspace_id IN (?) AND user_id <> ?",
+			d.db.Model(&Workspace{}).Select("id").Where("owner_id = ?", ownerId), ownerId).
+		Count(&n).Error
+
+	return n > 0, err
+}
+
+// deleteWorkspaces 注销账号时删除用户的成员身份与用户拥有的工作区, 返回删除的工作区 id
+func deleteWorkspaces(tx *gorm.DB, uid int) ([]int, error) {
+	var owned []int
+	if err := tx.Model(&Workspace{}).Where("owner_id = ?", uid).Pluck("id", &owned).Error; err != nil {
+		return nil, err
+	}
+	if len(owned) > 0 {
+		for _, model := range []any{&WorkspaceMember{}, &WorkspaceInvite{}} {
+			if err := tx.Where("workspace_id IN ?", owned).Delete(model).Error; err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Where("id IN ?", owned).Delete(&Workspace{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return owned, tx.Where("user_id = ?", uid).Delete(&WorkspaceMember{}).Error
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type IdentityRepo struct {
+	dao *dao.IdentityDao
+}
+
+func NewIdentityRepo(d *dao.IdentityDao) *IdentityRepo {
+	return &IdentityRepo{dao: d}
+}
+
+func (r *IdentityRepo) Create(ctx context.Context, i *dao.UserIdentity) error {
+	return r.dao.Create(ctx, i)
+}
+
+func (r *IdentityRepo) CreateWithUser(ctx context.Context, u *dao.User, i *dao.UserIdentity) error {
+	return r.dao.CreateWithUser(ctx, u, i)
+}
+
+func (r *IdentityRepo) FindBySubject(ctx context.Context, provider, subject string) (dao.UserIdentity, error) {
+	return r.dao.FindBySubject(ctx, provider, subject)
+}
+
+func (r *IdentityRepo) FindByUid(ctx context.Context, uid int) ([]*dao.UserIdentity, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *IdentityRepo) Touch(ctx context.Context, id int, at int64) error {
+	return r.dao.Touch(ctx, id, at)
+}
+
+func (r *IdentityRepo) Delete(ctx context.Context, uid, id int) error {
+	return r.dao.Delete(ctx, uid, id)
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+// Attempt 登录失败记录
+type Attempt struct {
+	Failures int
+	// Last 最近一次失败的时间
+	Last int64
+}
+
+// AttemptStore 保存登录失败次数, 多实例部署时需要使用共享的存储
+type AttemptStore interface {
+	// Get 没有记录时返回零值
+	Get(ctx context.Context, key string) (Attempt, error)
+	// Fail 记录一次失败并返回更新后的记录, 上次失败早于 since 时重新计数
+	Fail(ctx context.Context, key string, now, since int64) (Attempt, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// LoginAttemptRepo 基于 MySQL 的 AttemptStore
+type LoginAttemptRepo struct {
+	dao *dao.LoginAttemptDao
+}
+
+func NewLoginAttemptRepo(d *dao.LoginAttemptDao) *LoginAttemptRepo {
+	return &LoginAttemptRepo{dao: d}
+}
+
+func (r *LoginAttemptRepo) Get(ctx context.Context, key string) (Attempt, error) {
+	a, err := r.dao.Find(ctx, key)
+	if err != nil {
+		return Attempt{}, err
+	}
+
+	return Attempt{Failures: a.Failures, Last: a.LastFailure}, nil
+}
+
+func (r *LoginAttemptRepo) Fail(ctx context.Context, key string, now, since int64) (Attempt, error) {
+	a, err := r.dao.Fail(ctx, key, now, since)
+	if err != nil {
+		return Attempt{}, err
+	}
+
+	return Attempt{Failures: a.Failures, Last: a.LastFailure}, nil
+}
+
+func (r *LoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	return r.dao.Delete(ctx, key)
+}
+
+// MemoryAttemptStore 进程内的 AttemptStore, 只适合单实例部署
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+	// pruned 上次清理过期记录的时间
+	pruned int64
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]Attempt)}
+}
+
+func (s *MemoryAttemptStore) Get(ctx context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attempts[key], nil
+}
+
+func (s *MemoryAttemptStore) Fail(ctx context.Context, key string, now, since int64) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 每分钟最多清理一次过期的记录, 避免每次失败都遍历全部记录
+	if now-s.pruned >= 60 {
+		for k, a := range s.attempts {
+			if a.Last < since {
+				delete(s.attempts, k)
+			}
+		}
+		s.pruned = now
+	}
+
+	a := s.attempts[key]
+	if a.Last < since {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.Last = now
+	s.attempts[key] = a
+
+	return a, nil
+}
+
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type PasswordResetRepo struct {
+	dao *dao.PasswordResetDao
+}
+
+func NewPasswordResetRepo(d *dao.PasswordResetDao) *PasswordResetRepo {
+	return &PasswordResetRepo{dao: d}
+}
+
+func (r *PasswordResetRepo) Create(ctx context.Context, p *dao.PasswordReset) error {
+	return r.dao.Create(ctx, p)
+}
+
+func (r *PasswordResetRepo) Consume(ctx context.Context, hash string, now int64) (dao.PasswordReset, error) {
+	return r.dao.Consume(ctx, hash, now)
+}
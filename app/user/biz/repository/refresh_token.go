@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type RefreshTokenRepo struct {
+	dao *dao.RefreshTokenDao
+}
+
+func NewRefreshTokenRepo(d *dao.RefreshTokenDao) *RefreshTokenRepo {
+	return &RefreshTokenRepo{dao: d}
+}
+
+func (r *RefreshTokenRepo) Create(ctx context.Context, t *dao.RefreshToken) error {
+	return r.dao.Create(ctx, t)
+}
+
+func (r *RefreshTokenRepo) FindByHash(ctx context.Context, hash string) (dao.RefreshToken, error) {
+	return r.dao.FindByHash(ctx, hash)
+}
+
+func (r *RefreshTokenRepo) Rotate(ctx context.Context, old dao.RefreshToken, next *dao.RefreshToken) (bool, error) {
+	return r.dao.Rotate(ctx, old, next)
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, family string) error {
+	return r.dao.RevokeFamily(ctx, family)
+}
+
+func (r *RefreshTokenRepo) RevokeByUid(ctx context.Context, uid int, except string) error {
+	return r.dao.RevokeByUid(ctx, uid, except)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type RevokedTokenRepo struct {
+	dao *dao.RevokedTokenDao
+}
+
+func NewRevokedTokenRepo(d *dao.RevokedTokenDao) *RevokedTokenRepo {
+	return &RevokedTokenRepo{dao: d}
+}
+
+func (r *RevokedTokenRepo) Create(ctx context.Context, t *dao.RevokedToken) error {
+	return r.dao.Create(ctx, t)
+}
+
+func (r *RevokedTokenRepo) Exists(ctx context.Context, jti string) (bool, error) {
+	return r.dao.Exists(ctx, jti)
+}
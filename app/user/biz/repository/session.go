@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type SessionRepo struct {
+	dao *dao.SessionDao
+}
+
+func NewSessionRepo(d *dao.SessionDao) *SessionRepo {
+	return &SessionRepo{dao: d}
+}
+
+func (r *SessionRepo) Create(ctx context.Context, s *dao.Session) error {
+	return r.dao.Create(ctx, s)
+}
+
+func (r *SessionRepo) FindActive(ctx context.Context, uid int, now int64) ([]*dao.Session, error) {
+	return r.dao.FindActive(ctx, uid, now)
+}
+
+func (r *SessionRepo) FindById(ctx context.Context, uid, id int) (dao.Session, error) {
+	return r.dao.FindById(ctx, uid, id)
+}
+
+func (r *SessionRepo) FindBySid(ctx context.Context, sid string) (dao.Session, error) {
+	return r.dao.FindBySid(ctx, sid)
+}
+
+func (r *SessionRepo) RevokeBySid(ctx context.Context, sid string) error {
+	return r.dao.RevokeBySid(ctx, sid)
+}
+
+func (r *SessionRepo) RevokeByUid(ctx context.Context, uid int, except string) error {
+	return r.dao.RevokeByUid(ctx, uid, except)
+}
+
+func (r *SessionRepo) Touch(ctx context.Context, uid int, sid, ip string, at int64) error {
+	return r.dao.Touch(ctx, uid, sid, ip, at)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type TwoFactorRepo struct {
+	dao *dao.TwoFactorDao
+}
+
+func NewTwoFactorRepo(d *dao.TwoFactorDao) *TwoFactorRepo {
+	return &TwoFactorRepo{dao: d}
+}
+
+func (r *TwoFactorRepo) FindByUid(ctx context.Context, uid int) (dao.TwoFactor, error) {
+	return r.dao.FindByUid(ctx, uid)
+}
+
+func (r *TwoFactorRepo) Enroll(ctx context.Context, uid int, secret string) error {
+	return r.dao.Enroll(ctx, uid, secret)
+}
+
+func (r *TwoFactorRepo) Enable(ctx context.Context, uid int, counter int64, codes []dao.RecoveryCode) (bool, error) {
+	return r.dao.Enable(ctx, uid, counter, codes)
+}
+
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, uid int, codes []dao.RecoveryCode) error {
+	return r.dao.ReplaceRecoveryCodes(ctx, uid, codes)
+}
+
+func (r *TwoFactorRepo) AdvanceCounter(ctx context.Context, uid int, counter int64) (bool, error) {
+	return r.dao.AdvanceCounter(ctx, uid, counter)
+}
+
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, uid int, hash string) (bool, error) {
+	return r.dao.UseRecoveryCode(ctx, uid, hash)
+}
+
+func (r *TwoFactorRepo) Delete(ctx context.Context, uid int) error {
+	return r.dao.Delete(ctx, uid)
+}
+
+func (r *TwoFactorRepo) CreateChallenge(ctx context.Context, c *dao.LoginChallenge) error {
+	return r.dao.CreateChallenge(ctx, c)
+}
+
+func (r *TwoFactorRepo) FindChallenge(ctx context.Context, hash string, now int64, maxAttempts int) (dao.LoginChallenge, error) {
+	return r.dao.FindChallenge(ctx, hash, now, maxAttempts)
+}
+
+func (r *TwoFactorRepo) IncrAttempts(ctx context.Context, id int) error {
+	return r.dao.IncrAttempts(ctx, id)
+}
+
+func (r *TwoFactorRepo) ConsumeChallenge(ctx context.Context, id int) (bool, error) {
+	return r.dao.ConsumeChallenge(ctx, id)
+}
@@ -24,3 +24,47 @@ func (r *UserRepo) FindByName(ctx context.Context, name string) (dao.User, error
 func (r *UserRepo) FindById(ctx context.Context, id int) (dao.User, error) {
 	return r.dao.FindById(ctx, id)
 }
+
+func (r *UserRepo) FindByIds(ctx context.Context, ids []int) ([]dao.User, error) {
+	return r.dao.FindByIds(ctx, ids)
+}
+
+func (r *UserRepo) UpdateRole(ctx context.Context, id int, role string) error {
+	return r.dao.UpdateRole(ctx, id, role)
+}
+
+func (r *UserRepo) UpdateDisabled(ctx context.Context, id int, at int64) error {
+	return r.dao.UpdateDisabled(ctx, id, at)
+}
+
+func (r *UserRepo) RequireReset(ctx context.Context, id int, at int64) error {
+	return r.dao.RequireReset(ctx, id, at)
+}
+
+func (r *UserRepo) Search(ctx context.Context, q dao.UserQuery) ([]dao.User, int64, error) {
+	return r.dao.Search(ctx, q)
+}
+
+func (r *UserRepo) UpdateProfile(ctx context.Context, id int, p dao.Profile) error {
+	return r.dao.UpdateProfile(ctx, id, p)
+}
+
+func (r *UserRepo) BumpGeneration(ctx context.Context, id int) (int64, error) {
+	return r.dao.BumpGeneration(ctx, id)
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	return r.dao.UpdatePassword(ctx, id, password)
+}
+
+func (r *UserRepo) FindByEmail(ctx context.Context, email string) (dao.User, error) {
+	return r.dao.FindByEmail(ctx, email)
+}
+
+func (r *UserRepo) UpdateEmail(ctx context.Context, id int, email string) error {
+	return r.dao.UpdateEmail(ctx, id, email)
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, id int, email string, at int64) (bool, error) {
+	return r.dao.MarkEmailVerified(ctx, id, email, at)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+type WorkspaceRepo struct {
+	dao *dao.WorkspaceDao
+}
+
+func NewWorkspaceRepo(d *dao.WorkspaceDao) *WorkspaceRepo {
+	return &WorkspaceRepo{dao: d}
+}
+
+func (r *WorkspaceRepo) Create(ctx context.Context, w *dao.Workspace, ownerRole string) error {
+	return r.dao.Create(ctx, w, ownerRole)
+}
+
+func (r *WorkspaceRepo) FindByMember(ctx context.Context, uid int) ([]dao.Membership, error) {
+	return r.dao.FindByMember(ctx, uid)
+}
+
+func (r *WorkspaceRepo) FindById(ctx context.Context, id int) (dao.Workspace, error) {
+	return r.dao.FindById(ctx, id)
+}
+
+func (r *WorkspaceRepo) Rename(ctx context.Context, id int, name string) error {
+	return r.dao.Rename(ctx, id, name)
+}
+
+func (r *WorkspaceRepo) FindMember(ctx context.Context, workspaceId, uid int) (dao.WorkspaceMember, error) {
+	return r.dao.FindMember(ctx, workspaceId, uid)
+}
+
+func (r *WorkspaceRepo) FindMembers(ctx context.Context, workspaceId int) ([]dao.MemberInfo, error) {
+	return r.dao.FindMembers(ctx, workspaceId)
+}
+
+func (r *WorkspaceRepo) UpdateMemberRole(ctx context.Context, workspaceId, uid int, role string) error {
+	return r.dao.UpdateMemberRole(ctx, workspaceId, uid, role)
+}
+
+func (r *WorkspaceRepo) TransferOwner(ctx context.Context, workspaceId, from, to int, ownerRole, prevRole string) error {
+	return r.dao.TransferOwner(ctx, workspaceId, from, to, ownerRole, prevRole)
+}
+
+func (r *WorkspaceRepo) RemoveMember(ctx context.Context, workspaceId, uid int) error {
+	return r.dao.RemoveMember(ctx, workspaceId, uid)
+}
+
+func (r *WorkspaceRepo) CreateInvite(ctx context.Context, i *dao.WorkspaceInvite) error {
+	return r.dao.CreateInvite(ctx, i)
+}
+
+func (r *WorkspaceRepo) FindInvites(ctx context.Context, workspaceId int, now int64) ([]*dao.WorkspaceInvite, error) {
+	return r.dao.FindInvites(ctx, workspaceId, now)
+}
+
+func (r *WorkspaceRepo) FindInvite(ctx context.Context, hash string, now int64) (dao.WorkspaceInvite, error) {
+	return r.dao.FindInvite(ctx, hash, now)
+}
+
+func (r *WorkspaceRepo) RevokeInvite(ctx context.Context, workspaceId, id int) error {
+	return r.dao.RevokeInvite(ctx, workspaceId, id)
+}
+
+func (r *WorkspaceRepo) AcceptInvite(ctx context.Context, i dao.WorkspaceInvite, uid int) error {
+	return r.dao.AcceptInvite(ctx, i, uid)
+}
+
+func (r *WorkspaceRepo) DeclineInvite(ctx context.Context, id, uid int) error {
+	return r.dao.DeclineInvite(ctx, id, uid)
+}
+
+func (r *WorkspaceRepo) HasOtherMembers(ctx context.Context, ownerId int) (bool, error) {
+	return r.dao.HasOtherMembers(ctx, ownerId)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+// AccessTokenPrefix 便于网关区分个人访问令牌与 JWT, 也便于密钥扫描工具识别
+const AccessTokenPrefix = "tdl_pat_"
+
+const (
+	defaultAccessTokenDays = 90
+	maxAccessTokenDays     = 365
+	// accessTokenTouch last_used 的更新间隔, 避免每次请求都写库
+	accessTokenTouch = time.Minute
+)
+
+// AccessTokenScopes 个人访问令牌可以申请的权限范围, tasks:write 不包含 tasks:read
+var AccessTokenScopes = []string{"tasks:read", "tasks:write", "user:read"}
+
+var (
+	ErrTokenNameRequired   = errors.New("token name is required")
+	ErrInvalidScope        = errors.New("invalid token scope")
+	ErrInvalidExpiry       = errors.New("token expiry must be between 1 and 365 days")
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+type AccessTokenService struct {
+	repo     *repository.AccessTokenRepo
+	userRepo *repository.UserRepo
+}
+
+func NewAccessTokenService(repo *repository.AccessTokenRepo, userRepo *repository.UserRepo) *AccessTokenService {
+	return &AccessTokenService{repo: repo, userRepo: userRepo}
+}
+
+// Create 生成新的个人访问令牌, 明文只在这里返回一次. expiresInDays 为 0 时使用默认有效期
+func (s *AccessTokenService) Create(ctx context.Context, name string, scopes []string, expiresInDays int) (*dao.AccessToken, string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrTokenNameRequired
+	}
+	scopes, err = normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if expiresInDays == 0 {
+		expiresInDays = defaultAccessTokenDays
+	}
+	if expiresInDays < 0 || expiresInDays > maxAccessTokenDays {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return nil, "", err
+	}
+	if restricted(u, CapAccessTokens) {
+		return nil, "", ErrEmailNotVerified
+	}
+
+	random, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := AccessTokenPrefix + random
+
+	t := &dao.AccessToken{
+		UserId:    uId,
+		Name:      truncate(name, 128),
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: time.Now().AddDate(0, 0, expiresInDays).Unix(),
+	}
+	if err := s.repo.Create(ctx, t); err != nil {
+		return nil, "", err
+	}
+
+	return t, token, nil
+}
+
+func (s *AccessTokenService) List(ctx context.Context) ([]*dao.AccessToken, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUid(ctx, uId)
+}
+
+func (s *AccessTokenService) Revoke(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Delete(ctx, uId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccessTokenNotFound
+	}
+
+	return err
+}
+
+// Verify 校验令牌, 令牌不存在或已过期时 ok 为 false
+func (s *AccessTokenService) Verify(ctx context.Context, token string) (dao.AccessToken, bool, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return dao.AccessToken{}, false, nil
+	}
+	t, err := s.repo.FindByHash(ctx, hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.AccessToken{}, false, nil
+	}
+	if err != nil {
+		return dao.AccessToken{}, false, err
+	}
+
+	now := time.Now()
+	if t.ExpiresAt <= now.Unix() {
+		return dao.AccessToken{}, false, nil
+	}
+	u, err := s.userRepo.FindById(ctx, t.UserId)
+	if err != nil {
+		return dao.AccessToken{}, false, err
+	}
+	if u.Disabled != 0 {
+		return dao.AccessToken{}, false, nil
+	}
+	if now.Unix()-t.LastUsed >= int64(accessTokenTouch/time.Second) {
+		if err := s.repo.Touch(ctx, t.Id, now.Unix()); err != nil {
+			zap.L().Error("Failed to update access token last used", zap.Error(err))
+		}
+	}
+
+	return t, true, nil
+}
+
+// normalizeScopes 校验并去重权限范围, 至少需要一个
+func normalizeScopes(scopes []string) ([]string, error) {
+	res := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(AccessTokenScopes, scope) {
+			return nil, ErrInvalidScope
+		}
+		if !slices.Contains(res, scope) {
+			res = append(res, scope)
+		}
+	}
+	if len(res) == 0 {
+		return nil, ErrInvalidScope
+	}
+	slices.Sort(res)
+
+	return res, nil
+}
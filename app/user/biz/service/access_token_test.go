@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   []string
+		err    error
+	}{
+		{[]string{"tasks:read"}, []string{"tasks:read"}, nil},
+		{[]string{"user:read", " tasks:write ", "tasks:read"}, []string{"tasks:read", "tasks:write", "user:read"}, nil},
+		{[]string{"tasks:read", "tasks:read"}, []string{"tasks:read"}, nil},
+		{nil, nil, ErrInvalidScope},
+		{[]string{""}, nil, ErrInvalidScope},
+		{[]string{"tasks:*"}, nil, ErrInvalidScope},
+		{[]string{"TASKS:READ"}, nil, ErrInvalidScope},
+		{[]string{"tasks:read", "admin"}, nil, ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeScopes(tt.scopes)
+		if !errors.Is(err, tt.err) || !slices.Equal(got, tt.want) {
+			t.Errorf("normalizeScopes(%q) = %q, %v, want %q, %v", tt.scopes, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	a := hashToken(AccessTokenPrefix + "abc")
+	if len(a) != 64 {
+		t.Errorf("hash length = %d, want 64", len(a))
+	}
+	if a != hashToken(AccessTokenPrefix+"abc") {
+		t.Error("hash is not deterministic")
+	}
+	if a == hashToken(AccessTokenPrefix+"abd") {
+		t.Error("different tokens share a hash")
+	}
+}
+
+// TestVerifyAccessTokenPrefix 没有前缀的令牌不查库
+func TestVerifyAccessTokenPrefix(t *testing.T) {
+	s := &AccessTokenService{}
+	for _, token := range []string{"", "abc", "eyJhbGciOi.x.y", "tdl_pa_abc"} {
+		_, ok, err := s.Verify(context.Background(), token)
+		if ok || err != nil {
+			t.Errorf("Verify(%q) = %v, %v, want false, nil", token, ok, err)
+		}
+	}
+}
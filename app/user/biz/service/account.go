@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+const (
+	maxDisplayName = 64
+	maxAvatarURL   = 512
+	// purgeInterval 检查待清除数据的账号的周期, 注销时会立即触发一次
+	purgeInterval = 30 * time.Second
+	purgeBatch    = 20
+	// purgeLease 执行中的任务在这段时间内不会被其他实例重复执行
+	purgeLease   = 5 * time.Minute
+	purgeTimeout = 10 * time.Second
+	purgeBackoff = 30 * time.Second
+	maxPurgeWait = time.Hour
+)
+
+var (
+	ErrInvalidProfile  = errors.New("invalid profile")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+var localeTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+type AccountService struct {
+	repo      *repository.AccountRepo
+	userRepo  *repository.UserRepo
+	twoFactor *TwoFactorService
+	workspace *WorkspaceService
+	tasks     task.TaskServiceClient
+	// wake 注销后通知后台任务立即清除数据
+	wake chan struct{}
+}
+
+func NewAccountService(repo *repository.AccountRepo, userRepo *repository.UserRepo, twoFactor *TwoFactorService,
+	workspace *WorkspaceService, tasks task.TaskServiceClient) *AccountService {
+	return &AccountService{repo: repo, userRepo: userRepo, twoFactor: twoFactor, workspace: workspace, tasks: tasks,
+		wake: make(chan struct{}, 1)}
+}
+
+// UpdateProfile 校验并修改个人资料, 返回修改后的用户
+func (s *AccountService) UpdateProfile(ctx context.Context, p dao.Profile) (dao.User, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.User{}, err
+	}
+
+	update, err := normalizeProfile(p)
+	if err != nil {
+		return dao.User{}, err
+	}
+	if err := s.userRepo.UpdateProfile(ctx, uId, update); err != nil {
+		return dao.User{}, err
+	}
+
+	return s.userRepo.FindById(ctx, uId)
+}
+
+// Delete 注销账号. 需要提供密码, 开启了两步验证时还需要验证码或恢复码.
+// 拥有其他成员的工作区时需要先转让. 用户服务中的数据与令牌立即删除, 其他服务中的数据由后台任务清除
+func (s *AccountService) Delete(ctx context.Context, password, code string) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if u.Id == 0 {
+		return ErrAccountNotFound
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	enabled, err := s.twoFactor.Enabled(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err := s.twoFactor.check(ctx, uId, code); err != nil {
+			return err
+		}
+	}
+	if err := s.workspace.CheckDeletable(ctx, uId); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, uId); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run 定期清除已注销账号在其他服务中的数据, 失败时按指数退避重试, 直到 ctx 结束
+func (s *AccountService) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *AccountService) purge(ctx context.Context) {
+	now := time.Now()
+	ds, err := s.repo.FindDue(ctx, now.Unix(), purgeBatch)
+	if err != nil {
+		zap.L().Error("Failed to find pending account deletions", zap.Error(err))
+		return
+	}
+
+	for _, d := range ds {
+		ok, err := s.repo.Claim(ctx, d.Id, d.NextAttempt, now.Add(purgeLease).Unix())
+		if err != nil || !ok {
+			continue
+		}
+
+		// 任务服务按用户 id 与工作区 id 删除数据, 重复调用是安全的
+		callCtx, cancel := context.WithTimeout(ctx, purgeTimeout)
+		resp, err := s.tasks.PurgeUserData(callCtx, &task.PurgeUserDataRequest{
+			UserId:       int32(d.UserId),
+			WorkspaceIds: splitIds(d.WorkspaceIds),
+		})
+		cancel()
+		if err != nil {
+			next := time.Now().Add(purgeDelay(d.Attempts)).Unix()
+			zap.L().Warn("Failed to purge task data", zap.Int("uid", d.UserId), zap.Int("attempts", d.Attempts+1), zap.Error(err))
+			if err := s.repo.Retry(ctx, d.Id, next, truncate(err.Error(), 512)); err != nil {
+				zap.L().Error("Failed to reschedule account deletion", zap.Int("uid", d.UserId), zap.Error(err))
+			}
+			continue
+		}
+
+		if err := s.repo.Finish(ctx, d.Id, time.Now().Unix()); err != nil {
+			zap.L().Error("Failed to finish account deletion", zap.Int("uid", d.UserId), zap.Error(err))
+			continue
+		}
+		zap.L().Info("Account data purged", zap.Int("uid", d.UserId), zap.Int64("tasks", resp.GetTasksDeleted()))
+	}
+}
+
+// splitIds 解析以空格分隔的 id
+func splitIds(s string) []int32 {
+	fields := strings.Fields(s)
+	ids := make([]int32, 0, len(fields))
+	for _, f := range fields {
+		if id, err := strconv.Atoi(f); err == nil {
+			ids = append(ids, int32(id))
+		}
+	}
+
+	return ids
+}
+
+// purgeDelay 第 attempts 次失败后等待的时间
+func purgeDelay(attempts int) time.Duration {
+	delay := purgeBackoff
+	for i := 0; i < attempts && delay < maxPurgeWait; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxPurgeWait)
+}
+
+func normalizeProfile(p dao.Profile) (dao.Profile, error) {
+	res := dao.Profile{WeekStart: p.WeekStart}
+	if p.DisplayName != nil {
+		name := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayName || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			return dao.Profile{}, fmt.Errorf("%w: display_name", ErrInvalidProfile)
+		}
+		res.DisplayName = &name
+	}
+	if p.Avatar != nil {
+		avatar := strings.TrimSpace(*p.Avatar)
+		if avatar != "" {
+			u, err := url.Parse(avatar)
+			if err != nil || len(avatar) > maxAvatarURL || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return dao.Profile{}, fmt.Errorf("%w: avatar", ErrInvalidProfile)
+			}
+		}
+		res.Avatar = &avatar
+	}
+	if p.Timezone != nil {
+		tz := strings.TrimSpace(*p.Timezone)
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+				return dao.Profile{}, fmt.Errorf("%w: timezone", ErrInvalidProfile)
+			}
+		}
+		res.Timezone = &tz
+	}
+	if p.Locale != nil {
+		locale := strings.TrimSpace(*p.Locale)
+		if locale != "" && (len(locale) > 16 || !localeTag.MatchString(locale)) {
+			return dao.Profile{}, fmt.Errorf("%w: locale", ErrInvalidProfile)
+		}
+		res.Locale = &locale
+	}
+	if p.WeekStart != nil && (*p.WeekStart < 0 || *p.WeekStart > 6) {
+		return dao.Profile{}, fmt.Errorf("%w: week_start", ErrInvalidProfile)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+// 账号角色, 写入访问令牌的 role 声明
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// 管理员操作记录的 Action
+const (
+	AuditDisable     = "disable"
+	AuditEnable      = "enable"
+	AuditForceReset  = "force_password_reset"
+	AuditSetRole     = "set_role"
+	AuditImpersonate = "impersonate"
+)
+
+const (
+	adminServicePrefix = "/user.AdminService/"
+	userServicePrefix  = "/user.UserService/"
+	defaultPageSize    = 20
+	maxPageSize        = 100
+	maxReason          = 256
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrReasonRequired   = errors.New("a reason is required")
+	ErrSelfAction       = errors.New("cannot perform this action on your own account")
+)
+
+// adminMethods AdminService 各方法允许的角色, 未列出的方法全部拒绝
+var adminMethods = map[string][]string{
+	"ListUsers":          {RoleAdmin, RoleSupport},
+	"GetUser":            {RoleAdmin, RoleSupport},
+	"ForcePasswordReset": {RoleAdmin, RoleSupport},
+	"DisableUser":        {RoleAdmin},
+	"EnableUser":         {RoleAdmin},
+	"SetUserRole":        {RoleAdmin},
+	"Impersonate":        {RoleAdmin},
+	"ListAuditLogs":      {RoleAdmin},
+}
+
+// impersonationDenied 模拟登录时不能调用的 UserService 方法: 修改登录凭证、签发长期凭证与修改或删除账号,
+// 模拟登录只用于查看与排查问题, 不能借此接管账号
+var impersonationDenied = map[string]bool{
+	"LogoutAllSessions":       true,
+	"RevokeSession":           true,
+	"ChangePassword":          true,
+	"UpdateEmail":             true,
+	"EnrollTwoFactor":         true,
+	"VerifyTwoFactor":         true,
+	"DisableTwoFactor":        true,
+	"RegenerateRecoveryCodes": true,
+	"UnlinkIdentity":          true,
+	"CreateAccessToken":       true,
+	"RevokeAccessToken":       true,
+	"UpdateProfile":           true,
+	"DeleteAccount":           true,
+	"CreateAppPassword":       true,
+	"DeleteAppPassword":       true,
+}
+
+type AdminService struct {
+	userRepo  *repository.UserRepo
+	auditRepo *repository.AuditRepo
+	token     *TokenService
+	pwd       *PasswordService
+}
+
+func NewAdminService(userRepo *repository.UserRepo, auditRepo *repository.AuditRepo, token *TokenService,
+	pwd *PasswordService) *AdminService {
+	return &AdminService{userRepo: userRepo, auditRepo: auditRepo, token: token, pwd: pwd}
+}
+
+// Authorize 由 gRPC 拦截器在每次调用前执行. 模拟登录的令牌不能调用 AdminService 与 impersonationDenied 中的方法;
+// AdminService 按数据库中的当前角色校验, 不信任令牌中的 role 声明, 停用的账号不能调用. 其他方法直接放行
+func (s *AdminService) Authorize(ctx context.Context, method string) error {
+	p, _ := principal.FromContext(ctx)
+	if name, ok := strings.CutPrefix(method, userServicePrefix); ok {
+		if p.ImpersonatorId != 0 && impersonationDenied[name] {
+			zap.L().Warn("Impersonated call denied", zap.Int("user_id", p.UserId),
+				zap.Int("impersonator_id", p.ImpersonatorId), zap.String("method", name))
+			return ErrPermissionDenied
+		}
+		return nil
+	}
+	name, ok := strings.CutPrefix(method, adminServicePrefix)
+	if !ok {
+		return nil
+	}
+	if p.ImpersonatorId != 0 || p.UserId == 0 {
+		return ErrPermissionDenied
+	}
+	uid := p.UserId
+
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if u.Id == 0 || u.Disabled != 0 || !slices.Contains(adminMethods[name], RoleOf(u)) {
+		zap.L().Warn("Admin call denied", zap.Int("user_id", uid), zap.String("method", name))
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// ListUsers 分页查询用户, Limit 为 0 时每页 20 个
+func (s *AdminService) ListUsers(ctx context.Context, q dao.UserQuery) ([]dao.User, int64, error) {
+	if q.Role != "" && !validRole(q.Role) {
+		return nil, 0, ErrInvalidRole
+	}
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	q.Offset = max(q.Offset, 0)
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	q.Limit = min(q.Limit, maxPageSize)
+
+	return s.userRepo.Search(ctx, q)
+}
+
+func (s *AdminService) GetUser(ctx context.Context, uid int) (dao.User, error) {
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return dao.User{}, err
+	}
+	if u.Id == 0 {
+		return dao.User{}, ErrUserNotFound
+	}
+
+	return u, nil
+}
+
+// SetDisabled 停用或恢复账号. 停用时结束全部会话, 已签发的令牌在网关下一次检查时失效
+func (s *AdminService) SetDisabled(ctx context.Context, uid int, disabled bool, reason string) error {
+	actor, target, err := s.target(ctx, uid)
+	if err != nil {
+		return err
+	}
+	reason, err = normalizeReason(reason, false)
+	if err != nil {
+		return err
+	}
+
+	if !disabled {
+		if err := s.userRepo.UpdateDisabled(ctx, uid, 0); err != nil {
+			return err
+		}
+		s.audit(ctx, actor, AuditEnable, target.Id, reason)
+		return nil
+	}
+
+	if err := s.userRepo.UpdateDisabled(ctx, uid, time.Now().Unix()); err != nil {
+		return err
+	}
+	if err := s.token.RevokeAll(ctx, uid); err != nil {
+		return err
+	}
+	s.audit(ctx, actor, AuditDisable, target.Id, reason)
+
+	return nil
+}
+
+// ForcePasswordReset 要求用户重置密码, 用户没有邮箱时返回 ErrNoEmail, 但仍然要求重置
+func (s *AdminService) ForcePasswordReset(ctx context.Context, uid int) error {
+	actor, target, err := s.target(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	err = s.pwd.ForceReset(ctx, target.Id)
+	if err == nil || errors.Is(err, ErrNoEmail) {
+		s.audit(ctx, actor, AuditForceReset, target.Id, "")
+	}
+
+	return err
+}
+
+// SetRole 修改角色, 不能修改自己的角色, 避免最后一个管理员误操作后无人可以管理
+func (s *AdminService) SetRole(ctx context.Context, uid int, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+	actor, target, err := s.target(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if RoleOf(target) == role {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, uid, role); err != nil {
+		return err
+	}
+	s.audit(ctx, actor, AuditSetRole, target.Id, fmt.Sprintf("%s -> %s", RoleOf(target), role))
+
+	return nil
+}
+
+// Impersonate 签发以该用户身份访问的访问令牌, 必须填写原因. 不能模拟管理员或客服账号
+func (s *AdminService) Impersonate(ctx context.Context, uid int, reason string) (string, error) {
+	actor, target, err := s.target(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if RoleOf(target) != RoleUser {
+		return "", ErrPermissionDenied
+	}
+	reason, err = normalizeReason(reason, true)
+	if err != nil {
+		return "", err
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := s.token.Impersonate(ctx, actor.Id, target.Id, userAgentOf(md))
+	if err != nil {
+		return "", err
+	}
+	s.audit(ctx, actor, AuditImpersonate, target.Id, reason)
+
+	return token, nil
+}
+
+// ListAuditLogs 分页查询操作记录, Limit 为 0 时每页 20 条
+func (s *AdminService) ListAuditLogs(ctx context.Context, q dao.AuditQuery) ([]*dao.AuditLog, int64, error) {
+	q.Offset = max(q.Offset, 0)
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	q.Limit = min(q.Limit, maxPageSize)
+
+	return s.auditRepo.Find(ctx, q)
+}
+
+// target 读取操作者与目标用户. 不能操作自己, 只有管理员可以操作管理员与客服账号
+func (s *AdminService) target(ctx context.Context, uid int) (dao.User, dao.User, error) {
+	actorId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.User{}, dao.User{}, err
+	}
+
+	actor, err := s.userRepo.FindById(ctx, actorId)
+	if err != nil {
+		return dao.User{}, dao.User{}, err
+	}
+	target, err := s.GetUser(ctx, uid)
+	if err != nil {
+		return dao.User{}, dao.User{}, err
+	}
+	if actor.Id == target.Id {
+		return dao.User{}, dao.User{}, ErrSelfAction
+	}
+	if RoleOf(target) != RoleUser && RoleOf(actor) != RoleAdmin {
+		return dao.User{}, dao.User{}, ErrPermissionDenied
+	}
+
+	return actor, target, nil
+}
+
+// audit 记录失败不影响已经完成的操作, 只记录日志
+func (s *AdminService) audit(ctx context.Context, actor dao.User, action string, target int, detail string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	l := &dao.AuditLog{
+		ActorId:   actor.Id,
+		Action:    action,
+		TargetId:  target,
+		Detail:    detail,
+		Ip:        clientIP(md),
+		UserAgent: truncate(userAgentOf(md), 512),
+	}
+	if err := s.auditRepo.Create(ctx, l); err != nil {
+		zap.L().Error("Failed to write audit log", zap.Int("actor", actor.Id), zap.String("action", action),
+			zap.Int("target", target), zap.Error(err))
+	}
+}
+
+func normalizeReason(reason string, required bool) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if required && reason == "" {
+		return "", ErrReasonRequired
+	}
+
+	return truncate(reason, maxReason), nil
+}
+
+func validRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleSupport
+}
+
+// RoleOf 添加角色之前创建的账号 role 为空, 视为普通用户
+func RoleOf(u dao.User) string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
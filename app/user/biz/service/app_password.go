@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+var ErrInvalidAppPassword = errors.New("invalid app password")
+
+type AppPasswordService struct {
+	repo     *repository.AppPasswordRepo
+	userRepo *repository.UserRepo
+}
+
+func NewAppPasswordService(repo *repository.AppPasswordRepo, userRepo *repository.UserRepo) *AppPasswordService {
+	return &AppPasswordService{repo: repo, userRepo: userRepo}
+}
+
+// Create 生成新的应用专用密码, 明文只在这里返回一次
+func (s *AppPasswordService) Create(ctx context.Context, name string) (*dao.AppPassword, string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return nil, "", err
+	}
+	if restricted(u, CapAppPasswords) {
+		return nil, "", ErrEmailNotVerified
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	password := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))
+
+	p := &dao.AppPassword{
+		UserId:       uId,
+		Name:         name,
+		PasswordHash: hashAppPassword(password),
+	}
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, "", err
+	}
+
+	return p, password, nil
+}
+
+func (s *AppPasswordService) List(ctx context.Context) ([]*dao.AppPassword, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUid(ctx, uId)
+}
+
+func (s *AppPasswordService) Delete(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, uId, id)
+}
+
+// Verify 校验用户名与应用专用密码, 成功时返回用户 id
+func (s *AppPasswordService) Verify(ctx context.Context, name, password string) (int, error) {
+	u, err := s.userRepo.FindByName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if u.Id == 0 || u.Disabled != 0 {
+		return 0, ErrInvalidAppPassword
+	}
+
+	p, err := s.repo.FindByHash(ctx, u.Id, hashAppPassword(password))
+	if err != nil {
+		return 0, ErrInvalidAppPassword
+	}
+
+	if err := s.repo.Touch(ctx, p.Id); err != nil {
+		zap.L().Error("Failed to update app password last used", zap.Error(err))
+	}
+
+	return u.Id, nil
+}
+
+// hashAppPassword 应用专用密码是高熵随机串, 使用 sha256 即可, 避免每次请求都做 bcrypt
+func hashAppPassword(password string) string {
+	// 客户端展示时可能带有分隔符或大写
+	password = strings.ToLower(strings.ReplaceAll(password, "-", ""))
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
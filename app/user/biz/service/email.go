@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/mailer"
+)
+
+// 邮箱未验证时可以限制的功能, 通过配置 email.restrict 开启
+const (
+	CapAppPasswords  = "app_passwords"
+	CapAccessTokens  = "access_tokens"
+	CapPasswordReset = "password_reset"
+	// CapWorkspaceInvites 通过邮件发送工作区邀请
+	CapWorkspaceInvites = "workspace_invites"
+)
+
+const verifyTokenTTL = time.Hour * 24
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailTaken         = errors.New("email address is already in use")
+	ErrNoEmail            = errors.New("no email address set")
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification link")
+	ErrEmailNotVerified   = errors.New("email address is not verified")
+)
+
+// VerifyKey 签名邮箱验证链接的密钥, 不与其他用途共用
+type VerifyKey []byte
+
+type EmailService struct {
+	userRepo  *repository.UserRepo
+	twoFactor *TwoFactorService
+	mailer    mailer.Mailer
+	key       VerifyKey
+}
+
+func NewEmailService(userRepo *repository.UserRepo, twoFactor *TwoFactorService, m mailer.Mailer, key VerifyKey) *EmailService {
+	return &EmailService{userRepo: userRepo, twoFactor: twoFactor, mailer: m, key: key}
+}
+
+// UpdateEmail 修改邮箱, 新邮箱需要重新验证. 邮箱可以用于重置密码, 修改前需要当前密码,
+// 开启了两步验证时还需要验证码或恢复码
+func (s *EmailService) UpdateEmail(ctx context.Context, email, password, code string) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	enabled, err := s.twoFactor.Enabled(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err := s.twoFactor.check(ctx, uId, code); err != nil {
+			return err
+		}
+	}
+
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return ErrInvalidEmail
+	}
+	other, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if other.Id == uId {
+		return nil
+	}
+	if other.Id != 0 {
+		return ErrEmailTaken
+	}
+
+	if err := s.userRepo.UpdateEmail(ctx, uId, email); err != nil {
+		if errors.Is(err, dao.ErrDuplicateEmail) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	return s.sendVerification(ctx, uId, email)
+}
+
+// SendVerification 重新发送验证邮件
+func (s *EmailService) SendVerification(ctx context.Context) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if u.Email == nil {
+		return ErrNoEmail
+	}
+	if u.EmailVerified != 0 {
+		return nil
+	}
+
+	return s.sendVerification(ctx, uId, *u.Email)
+}
+
+// Verify 校验邮件中的链接并把邮箱标记为已验证, 链接签发后修改过邮箱时失效
+func (s *EmailService) Verify(ctx context.Context, token string) error {
+	uid, email, err := parseVerifyToken(s.key, token, time.Now())
+	if err != nil {
+		return err
+	}
+	ok, err := s.userRepo.MarkEmailVerified(ctx, uid, email, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidVerifyToken
+	}
+
+	return nil
+}
+
+func (s *EmailService) sendVerification(ctx context.Context, uid int, email string) error {
+	token := signVerifyToken(s.key, uid, email, time.Now().Add(verifyTokenTTL))
+	link := config.GetConf().Email.VerifyURL + "?token=" + url.QueryEscape(token)
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your todolist email address",
+		Body: fmt.Sprintf("Open the link below to verify your email address. It expires in %d hours.\n\n%s\n\n"+
+			"If you did not sign up for todolist, you can ignore this email.\n", int(verifyTokenTTL.Hours()), link),
+	})
+	if err != nil {
+		zap.L().Error("Failed to send verification email", zap.Int("user_id", uid), zap.Error(err))
+	}
+
+	return err
+}
+
+// Restrictions 返回账号因邮箱未验证而不能使用的功能
+func Restrictions(u dao.User) []string {
+	if u.EmailVerified != 0 {
+		return nil
+	}
+	return config.GetConf().Email.Restrict
+}
+
+// restricted 判断账号是否因邮箱未验证而不能使用 capability
+func restricted(u dao.User, capability string) bool {
+	if u.EmailVerified != 0 {
+		return false
+	}
+	return slices.Contains(config.GetConf().Email.Restrict, capability)
+}
+
+// normalizeEmail 校验并统一邮箱格式, 空字符串表示不设置邮箱
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 255 {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// 验证链接的令牌: base64url(uid:过期时间:邮箱) + "." + base64url(HMAC)
+func signVerifyToken(key VerifyKey, uid int, email string, expire time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", uid, expire.Unix(), email)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(verifyMAC(key, payload))
+}
+
+func parseVerifyToken(key VerifyKey, token string, now time.Time) (int, string, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidVerifyToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, verifyMAC(key, payload)) {
+		return 0, "", ErrInvalidVerifyToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, "", ErrInvalidVerifyToken
+	}
+
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return 0, "", ErrInvalidVerifyToken
+	}
+	uid, err1 := strconv.Atoi(parts[0])
+	expire, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || expire <= now.Unix() {
+		return 0, "", ErrInvalidVerifyToken
+	}
+
+	return uid, parts[2], nil
+}
+
+func verifyMAC(key VerifyKey, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+var (
+	// ErrIdentityConflict 身份提供方的邮箱已被一个未验证邮箱的账号使用, 需要登录该账号后手动关联
+	ErrIdentityConflict = errors.New("an account with this email already exists, sign in and link the provider from settings")
+	ErrIdentityLinked   = errors.New("this identity is already linked to another account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastSignInMethod 解除关联后账号没有其他登录方式
+	ErrLastSignInMethod = errors.New("cannot unlink the only sign-in method, set an email address first")
+	ErrInvalidIdentity  = errors.New("invalid identity")
+)
+
+var nameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// ExternalIdentity 网关校验 ID Token 后得到的身份
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified 身份提供方是否确认过该邮箱
+	EmailVerified bool
+	// Name 用于生成新账号的用户名
+	Name string
+}
+
+type IdentityService struct {
+	repo      *repository.IdentityRepo
+	userRepo  *repository.UserRepo
+	token     *TokenService
+	twoFactor *TwoFactorService
+}
+
+func NewIdentityService(repo *repository.IdentityRepo, userRepo *repository.UserRepo, token *TokenService,
+	twoFactor *TwoFactorService) *IdentityService {
+	return &IdentityService{repo: repo, userRepo: userRepo, token: token, twoFactor: twoFactor}
+}
+
+// Login 使用外部身份登录. 身份已关联时登录对应账号; linkUid 不为 0 时把身份关联到该账号, 不签发令牌;
+// 否则身份提供方确认过的邮箱属于一个已验证邮箱的账号时自动关联, 都不满足时注册新账号.
+// 账号开启了两步验证时与密码登录一样返回登录请求令牌
+func (s *IdentityService) Login(ctx context.Context, id ExternalIdentity, linkUid int) (Tokens, string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Tokens{}, "", errors.New("error param")
+	}
+	userAgent := userAgentOf(md)
+	if id.Provider == "" || id.Subject == "" {
+		return Tokens{}, "", ErrInvalidIdentity
+	}
+	email, err := normalizeEmail(id.Email)
+	if err != nil {
+		// 邮箱格式不被接受时当作没有邮箱
+		email = ""
+	}
+
+	ident, err := s.repo.FindBySubject(ctx, id.Provider, id.Subject)
+	if err != nil {
+		return Tokens{}, "", err
+	}
+
+	var uid int
+	switch {
+	case ident.Id != 0:
+		if linkUid != 0 && ident.UserId != linkUid {
+			return Tokens{}, "", ErrIdentityLinked
+		}
+		uid = ident.UserId
+		if err := s.repo.Touch(ctx, ident.Id, time.Now().Unix()); err != nil {
+			return Tokens{}, "", err
+		}
+	case linkUid != 0:
+		uid = linkUid
+		if err := s.link(ctx, uid, id, email); err != nil {
+			return Tokens{}, "", err
+		}
+	default:
+		uid, err = s.signUp(ctx, id, email)
+		if err != nil {
+			return Tokens{}, "", err
+		}
+	}
+
+	// 关联时用户已经登录, 不需要新的令牌
+	if linkUid != 0 {
+		return Tokens{}, "", nil
+	}
+
+	// 与密码登录一样检查账号状态, 管理员要求重置密码后不能通过外部身份绕过
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return Tokens{}, "", err
+	}
+	if u.Disabled != 0 {
+		return Tokens{}, "", ErrAccountDisabled
+	}
+	if u.ResetRequired != 0 {
+		return Tokens{}, "", ErrPasswordResetRequired
+	}
+
+	enabled, err := s.twoFactor.Enabled(ctx, uid)
+	if err != nil {
+		return Tokens{}, "", err
+	}
+	if enabled {
+		challenge, err := s.twoFactor.Challenge(ctx, uid)
+		return Tokens{}, challenge, err
+	}
+
+	tokens, err := s.token.Issue(ctx, uid, userAgent, clientIP(md))
+	return tokens, "", err
+}
+
+func (s *IdentityService) List(ctx context.Context) ([]*dao.UserIdentity, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUid(ctx, uId)
+}
+
+// Unlink 解除关联. 账号没有邮箱时无法通过重置密码找回, 因此至少保留一个身份
+func (s *IdentityService) Unlink(ctx context.Context, id int) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return err
+	}
+	identities, err := s.repo.FindByUid(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if u.Email == nil && len(identities) <= 1 {
+		return ErrLastSignInMethod
+	}
+
+	err = s.repo.Delete(ctx, uId, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrIdentityNotFound
+	}
+
+	return err
+}
+
+func (s *IdentityService) link(ctx context.Context, uid int, id ExternalIdentity, email string) error {
+	err := s.repo.Create(ctx, &dao.UserIdentity{
+		UserId:   uid,
+		Provider: id.Provider,
+		Subject:  id.Subject,
+		Email:    email,
+	})
+	if errors.Is(err, dao.ErrDuplicateIdentity) {
+		return ErrIdentityLinked
+	}
+
+	return err
+}
+
+// signUp 身份没有关联时, 按邮箱自动关联已有账号或注册新账号
+func (s *IdentityService) signUp(ctx context.Context, id ExternalIdentity, email string) (int, error) {
+	if email != "" && id.EmailVerified {
+		u, err := s.userRepo.FindByEmail(ctx, email)
+		if err != nil {
+			return 0, err
+		}
+		if u.Id != 0 {
+			// 未验证的邮箱可能被他人抢注, 不能据此关联
+			if u.EmailVerified == 0 {
+				return 0, ErrIdentityConflict
+			}
+			return u.Id, s.link(ctx, u.Id, id, email)
+		}
+	}
+
+	name, err := s.availableName(ctx, id, email)
+	if err != nil {
+		return 0, err
+	}
+	// 通过外部身份注册的账号没有可用的密码, 需要时可以通过邮箱重置
+	random, err := randomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	u := &dao.User{Name: name, Password: string(hash)}
+	if email != "" && id.EmailVerified {
+		u.Email = &email
+		u.EmailVerified = time.Now().Unix()
+	}
+	err = s.repo.CreateWithUser(ctx, u, &dao.UserIdentity{
+		Provider: id.Provider,
+		Subject:  id.Subject,
+		Email:    email,
+	})
+	switch {
+	case errors.Is(err, dao.ErrDuplicateEmail):
+		return 0, ErrIdentityConflict
+	case errors.Is(err, dao.ErrDuplicateIdentity):
+		// 并发的回调已经注册了账号
+		return 0, ErrIdentityLinked
+	case err != nil:
+		return 0, err
+	}
+
+	return u.Id, nil
+}
+
+// availableName 根据身份提供方返回的名称生成一个没有被使用的用户名
+func (s *IdentityService) availableName(ctx context.Context, id ExternalIdentity, email string) (string, error) {
+	base := id.Name
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = strings.Trim(nameChars.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if base == "" {
+		base = "user"
+	}
+	base = truncate(base, 32)
+
+	name := base
+	for i := 0; i < 5; i++ {
+		u, err := s.userRepo.FindByName(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if u.Id == 0 {
+			return name, nil
+		}
+		suffix, err := randomToken(3)
+		if err != nil {
+			return "", err
+		}
+		name = base + "-" + strings.ToLower(suffix)
+	}
+
+	return "", errors.New("failed to generate a user name")
+}
@@ -1,26 +1,53 @@
 package service
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 
-	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/keyring"
 )
 
-func GenerateToken(uid int, userAgent string) (string, error) {
-	claims := &jwt.MapClaims{
-		"user_id":    uid,
-		"expire_at":  time.Now().Add(time.Hour * 24).Unix(),
-		"issuer":     "github.com/crazyfrankie",
-		"issue_at":   time.Now().Unix(),
-		"user_agent": userAgent,
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.GetConf().JWT.SecretKey))
+const (
+	// AccessTokenTTL 访问令牌有效期较短, 过期后使用刷新令牌换取新的令牌
+	AccessTokenTTL  = time.Minute * 15
+	RefreshTokenTTL = time.Hour * 24 * 30
+)
+
+// AccessClaims 访问令牌中的用户信息. Session 为所属的登录会话 (刷新令牌的 Family),
+// Generation 为用户当前的令牌代数, 退出全部会话时代数增加
+type AccessClaims struct {
+	UserId     int
+	Role       string
+	UserAgent  string
+	Session    string
+	Generation int64
+	// Actor 不为 0 时表示管理员正在模拟该用户, 写入 act 声明
+	Actor int
+}
+
+// GenerateToken 使用 key 签发访问令牌, jti 用于单独吊销该令牌
+func GenerateToken(key keyring.Key, c AccessClaims) (string, error) {
+	jti, err := randomToken(16)
 	if err != nil {
 		return "", err
 	}
-
-	return tokenString, nil
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id":    c.UserId,
+		"role":       c.Role,
+		"exp":        now.Add(AccessTokenTTL).Unix(),
+		"iss":        "github.com/crazyfrankie",
+		"iat":        now.Unix(),
+		"jti":        jti,
+		"sid":        c.Session,
+		"gen":        c.Generation,
+		"user_agent": c.UserAgent,
+	}
+	if c.Actor != 0 {
+		// RFC 8693 4.1
+		claims["act"] = map[string]any{"sub": strconv.Itoa(c.Actor)}
+	}
+	return key.Sign(&claims)
 }
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+)
+
+var (
+	// ErrInvalidCredentials 用户不存在与密码错误返回同样的错误, 避免泄露账号是否存在
+	ErrInvalidCredentials = errors.New("invalid name or password")
+	ErrTooManyAttempts    = errors.New("too many failed login attempts, try again later")
+)
+
+// RetryError 登录被限制时返回, After 为需要等待的时间
+type RetryError struct {
+	After time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// LoginGuard 按账号与来源 IP 记录登录失败次数, 超过免费次数后按指数退避要求等待, 达到阈值后临时锁定
+type LoginGuard struct {
+	store repository.AttemptStore
+	// conf 与 now 在测试中替换
+	conf func() config.Login
+	now  func() time.Time
+}
+
+func NewLoginGuard(store repository.AttemptStore) *LoginGuard {
+	return &LoginGuard{
+		store: store,
+		conf:  func() config.Login { return config.GetConf().Login },
+		now:   time.Now,
+	}
+}
+
+type guardKey struct {
+	key   string
+	limit config.LoginLimit
+}
+
+// Check 账号或来源 IP 处于等待或锁定状态时返回 RetryError
+func (g *LoginGuard) Check(ctx context.Context, account, ip string) error {
+	conf := g.conf()
+	now := g.now().Unix()
+
+	var wait int64
+	for _, k := range guardKeys(conf, account, ip) {
+		a, err := g.store.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if w := blockedUntil(conf, k.limit, a) - now; w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return &RetryError{After: time.Duration(wait) * time.Second}
+	}
+
+	return nil
+}
+
+// Fail 记录一次登录失败
+func (g *LoginGuard) Fail(ctx context.Context, account, ip string) error {
+	conf := g.conf()
+	now := g.now()
+	since := now.Add(-conf.Window).Unix()
+
+	for _, k := range guardKeys(conf, account, ip) {
+		if _, err := g.store.Fail(ctx, k.key, now.Unix(), since); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset 登录成功后清除账号的失败次数, 来源 IP 的计数不清除,
+// 否则攻击者可以穿插登录自己的账号来绕过限制
+func (g *LoginGuard) Reset(ctx context.Context, account string) error {
+	return g.store.Reset(ctx, account)
+}
+
+// loginSubject 存在的账号按 id 计数, 使用用户名和邮箱登录共享同一个计数;
+// 不存在的账号按输入的名称计数, 与存在的账号表现一致
+func loginSubject(u dao.User, login string) string {
+	if u.Id != 0 {
+		return "account:" + strconv.Itoa(u.Id)
+	}
+
+	return "login:" + strings.ToLower(strings.TrimSpace(login))
+}
+
+// guardKeys 按账号与来源 IP 计数. ip 由网关根据连接地址确定, 只有配置了可信代理时才采用转发头部
+func guardKeys(conf config.Login, account, ip string) []guardKey {
+	keys := []guardKey{{key: account, limit: conf.Account}}
+	// 直接调用 gRPC 接口时没有来源 IP
+	if ip != "" {
+		keys = append(keys, guardKey{key: "ip:" + ip, limit: conf.IP})
+	}
+
+	return keys
+}
+
+// blockedUntil 返回在此之前不允许再次尝试的时间
+func blockedUntil(conf config.Login, limit config.LoginLimit, a repository.Attempt) int64 {
+	if limit.Lock > 0 && a.Failures >= limit.Lock {
+		return a.Last + int64(conf.Lockout/time.Second)
+	}
+	if a.Failures <= limit.Free || conf.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := conf.BaseDelay
+	for i := limit.Free + 1; i < a.Failures && delay < conf.MaxDelay; i++ {
+		delay *= 2
+	}
+	if conf.MaxDelay > 0 && delay > conf.MaxDelay {
+		delay = conf.MaxDelay
+	}
+
+	return a.Last + int64(delay/time.Second)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+)
+
+var testLoginConf = config.Login{
+	Window:    time.Hour,
+	BaseDelay: time.Second,
+	MaxDelay:  8 * time.Second,
+	Lockout:   15 * time.Minute,
+	Account:   config.LoginLimit{Free: 3, Lock: 10},
+	IP:        config.LoginLimit{Free: 5, Lock: 20},
+}
+
+// testClock 手动推进的时钟
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestGuard() (*LoginGuard, *testClock) {
+	clock := &testClock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+	return &LoginGuard{
+		store: repository.NewMemoryAttemptStore(),
+		conf:  func() config.Login { return testLoginConf },
+		now:   clock.now,
+	}, clock
+}
+
+func retryAfter(t *testing.T, err error) time.Duration {
+	t.Helper()
+	if err == nil {
+		return 0
+	}
+	var retry *RetryError
+	if !errors.As(err, &retry) {
+		t.Fatalf("err = %v, want RetryError", err)
+	}
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("RetryError does not unwrap to ErrTooManyAttempts")
+	}
+	return retry.After
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		// 等待时间不超过 MaxDelay
+		{9, 8 * time.Second},
+		// 达到 Lock 后锁定
+		{10, 15 * time.Minute},
+		{12, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		g, _ := newTestGuard()
+		ctx := context.Background()
+		for i := 0; i < tt.failures; i++ {
+			if err := g.Fail(ctx, "account:1", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := retryAfter(t, g.Check(ctx, "account:1", "")); got != tt.want {
+			t.Errorf("after %d failures: wait = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		failures int
+		advance  time.Duration
+		// fail 推进时钟后再失败一次
+		fail bool
+		want time.Duration
+	}{
+		{name: "backoff elapsed", failures: 5, advance: 2 * time.Second, want: 0},
+		{name: "backoff partly elapsed", failures: 5, advance: time.Second, want: time.Second},
+		{name: "lockout partly elapsed", failures: 10, advance: 10 * time.Minute, want: 5 * time.Minute},
+		{name: "lockout elapsed", failures: 10, advance: 15 * time.Minute, want: 0},
+		// 窗口内没有失败时重新计数, 再失败一次仍在免费次数内
+		{name: "window restarts count", failures: 9, advance: time.Hour + time.Second, fail: true, want: 0},
+		{name: "within window keeps count", failures: 9, advance: 30 * time.Minute, fail: true, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, clock := newTestGuard()
+			for i := 0; i < tt.failures; i++ {
+				if err := g.Fail(ctx, "account:1", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			clock.advance(tt.advance)
+			if tt.fail {
+				if err := g.Fail(ctx, "account:1", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := retryAfter(t, g.Check(ctx, "account:1", "")); got != tt.want {
+				t.Errorf("wait = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginGuardKeys(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ip shared across accounts", func(t *testing.T) {
+		g, _ := newTestGuard()
+		// 每个账号都在免费次数内, 但来源 IP 超过了
+		for i := 0; i < 6; i++ {
+			account := loginSubject(dao.User{}, "user"+string(rune('a'+i)))
+			if err := g.Fail(ctx, account, "10.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := retryAfter(t, g.Check(ctx, "login:other", "10.0.0.1")); got != time.Second {
+			t.Errorf("same ip: wait = %v, want 1s", got)
+		}
+		if got := retryAfter(t, g.Check(ctx, "login:other", "10.0.0.2")); got != 0 {
+			t.Errorf("other ip: wait = %v, want 0", got)
+		}
+	})
+
+	t.Run("reset keeps ip count", func(t *testing.T) {
+		g, _ := newTestGuard()
+		for i := 0; i < 6; i++ {
+			if err := g.Fail(ctx, "account:1", "10.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := g.Reset(ctx, "account:1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := retryAfter(t, g.Check(ctx, "account:1", "")); got != 0 {
+			t.Errorf("account after reset: wait = %v, want 0", got)
+		}
+		if got := retryAfter(t, g.Check(ctx, "account:1", "10.0.0.1")); got != time.Second {
+			t.Errorf("ip after reset: wait = %v, want 1s", got)
+		}
+	})
+
+	t.Run("longest wait wins", func(t *testing.T) {
+		g, _ := newTestGuard()
+		for i := 0; i < 10; i++ {
+			if err := g.Fail(ctx, "account:1", "10.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := retryAfter(t, g.Check(ctx, "account:2", "10.0.0.1")); got != 8*time.Second {
+			t.Errorf("ip only: wait = %v, want 8s", got)
+		}
+		if got := retryAfter(t, g.Check(ctx, "account:1", "10.0.0.1")); got != 15*time.Minute {
+			t.Errorf("account and ip: wait = %v, want 15m", got)
+		}
+	})
+}
+
+func TestLoginSubject(t *testing.T) {
+	tests := []struct {
+		user  dao.User
+		login string
+		want  string
+	}{
+		// 用户名与邮箱登录同一个账号共享计数
+		{dao.User{Id: 7}, "alice", "account:7"},
+		{dao.User{Id: 7}, "alice@example.com", "account:7"},
+		// 不存在的账号按输入计数, 忽略大小写与首尾空白
+		{dao.User{}, "Bob", "login:bob"},
+		{dao.User{}, "  bob ", "login:bob"},
+		{dao.User{}, "BOB@Example.com", "login:bob@example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := loginSubject(tt.user, tt.login); got != tt.want {
+			t.Errorf("loginSubject(%d, %q) = %q, want %q", tt.user.Id, tt.login, got, tt.want)
+		}
+	}
+}
+
+// TestLoginGuardUniform 不存在的账号与密码错误的账号经过同样的限制
+func TestLoginGuardUniform(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newTestGuard()
+
+	existing := loginSubject(dao.User{Id: 1}, "alice")
+	missing := loginSubject(dao.User{}, "nobody")
+	for i := 0; i < 5; i++ {
+		if err := g.Fail(ctx, existing, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Fail(ctx, missing, ""); err != nil {
+			t.Fatal(err)
+		}
+		a := retryAfter(t, g.Check(ctx, existing, ""))
+		b := retryAfter(t, g.Check(ctx, missing, ""))
+		if a != b {
+			t.Fatalf("after %d failures: existing waits %v, missing waits %v", i+1, a, b)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/mailer"
+)
+
+const resetTokenTTL = time.Minute * 30
+
+var (
+	ErrWrongPassword     = errors.New("current password is incorrect")
+	ErrInvalidPassword   = errors.New("password must be 8 to 72 bytes")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	// ErrPasswordResetRequired 管理员要求重置密码后, 需要通过重置密码邮件设置新密码才能登录
+	ErrPasswordResetRequired = errors.New("password reset required")
+)
+
+type PasswordService struct {
+	userRepo  *repository.UserRepo
+	resetRepo *repository.PasswordResetRepo
+	token     *TokenService
+	mailer    mailer.Mailer
+}
+
+func NewPasswordService(userRepo *repository.UserRepo, resetRepo *repository.PasswordResetRepo, token *TokenService, m mailer.Mailer) *PasswordService {
+	return &PasswordService{userRepo: userRepo, resetRepo: resetRepo, token: token, mailer: m}
+}
+
+// ChangePassword 校验当前密码后修改密码, 并结束当前会话以外的全部会话
+func (s *PasswordService) ChangePassword(ctx context.Context, current, password string) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(current)) != nil {
+		return ErrWrongPassword
+	}
+	if err := s.setPassword(ctx, uId, password); err != nil {
+		return err
+	}
+
+	return s.token.RevokeOthers(ctx, uId, currentSession(ctx))
+}
+
+// ForceReset 管理员要求用户重置密码: 旧密码不能再登录, 结束全部会话并发送重置密码邮件.
+// 用户没有邮箱时返回 ErrNoEmail, 此时仍然要求重置, 由用户联系管理员
+func (s *PasswordService) ForceReset(ctx context.Context, uid int) error {
+	if err := s.userRepo.RequireReset(ctx, uid, time.Now().Unix()); err != nil {
+		return err
+	}
+	if err := s.token.RevokeAll(ctx, uid); err != nil {
+		return err
+	}
+
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if u.Email == nil {
+		return ErrNoEmail
+	}
+
+	return s.sendReset(ctx, u)
+}
+
+// RequestReset 向用户的邮箱发送重置密码链接, name 可以是用户名或邮箱.
+// 用户不存在、没有邮箱或邮箱未验证而受限时同样返回成功, 避免泄露账号是否存在
+func (s *PasswordService) RequestReset(ctx context.Context, name string) error {
+	u, err := findByLogin(ctx, s.userRepo, name)
+	if err != nil {
+		return err
+	}
+	if u.Id == 0 || u.Email == nil || restricted(u, CapPasswordReset) {
+		return nil
+	}
+
+	return s.sendReset(ctx, u)
+}
+
+func (s *PasswordService) sendReset(ctx context.Context, u dao.User) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.Create(ctx, &dao.PasswordReset{
+		UserId:    u.Id,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(resetTokenTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := config.GetConf().Mail.ResetURL + "?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      *u.Email,
+		Subject: "Reset your todolist password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to choose a new password. It expires in %d minutes and can be used once.\n\n%s\n\n"+
+			"If you did not request a password reset, you can ignore this email.\n", u.Name, int(resetTokenTTL.Minutes()), link),
+	})
+	if err != nil {
+		zap.L().Error("Failed to send password reset email", zap.Int("user_id", u.Id), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmReset 使用重置令牌设置新密码, 成功后结束用户的全部会话
+func (s *PasswordService) ConfirmReset(ctx context.Context, token, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	r, err := s.resetRepo.Consume(ctx, hashToken(token), time.Now().Unix())
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := s.setPassword(ctx, r.UserId, password); err != nil {
+		return err
+	}
+
+	return s.token.RevokeAll(ctx, r.UserId)
+}
+
+func (s *PasswordService) setPassword(ctx context.Context, uid int, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.UpdatePassword(ctx, uid, string(hash))
+}
+
+// validatePassword bcrypt 只使用前 72 个字节, 超出部分会被静默忽略
+func validatePassword(password string) error {
+	if len(password) < 8 || len(password) > 72 {
+		return ErrInvalidPassword
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionSeen 网关汇总的一次会话活动
+type SessionSeen struct {
+	UserId  int
+	Session string
+	Ip      string
+	SeenAt  int64
+}
+
+type SessionService struct {
+	repo  *repository.SessionRepo
+	token *TokenService
+}
+
+func NewSessionService(repo *repository.SessionRepo, token *TokenService) *SessionService {
+	return &SessionService{repo: repo, token: token}
+}
+
+// List 返回用户当前登录的会话, 以及发起请求的会话 id
+func (s *SessionService) List(ctx context.Context) ([]*dao.Session, string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, err := s.repo.FindActive(ctx, uId, time.Now().Unix())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessions, currentSession(ctx), nil
+}
+
+// Revoke 移除一个会话, 返回被移除的是否是当前会话
+func (s *SessionService) Revoke(ctx context.Context, id int) (bool, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	sess, err := s.repo.FindById(ctx, uId, id)
+	if err != nil || sess.Revoked != 0 {
+		return false, ErrSessionNotFound
+	}
+	if err := s.token.RevokeSession(ctx, sess.Sid); err != nil {
+		return false, err
+	}
+
+	return sess.Sid == currentSession(ctx), nil
+}
+
+// Touch 记录网关批量上报的会话活动, 单条失败不影响其他记录
+func (s *SessionService) Touch(ctx context.Context, seen []SessionSeen) {
+	for _, e := range seen {
+		if err := s.repo.Touch(ctx, e.UserId, e.Session, e.Ip, e.SeenAt); err != nil {
+			zap.L().Error("Failed to update session last seen", zap.String("session", e.Session), zap.Error(err))
+		}
+	}
+}
+
+func currentSession(ctx context.Context) string {
+	p, _ := principal.FromContext(ctx)
+	return p.SessionId
+}
+
+func userAgentOf(md metadata.MD) string {
+	if v := md.Get("user_agent"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func clientIP(md metadata.MD) string {
+	if v := md.Get("client_ip"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// deviceName 从 User-Agent 中粗略识别浏览器与系统, 用于会话列表展示
+func deviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	pick := func(candidates [][2]string) string {
+		for _, c := range candidates {
+			if strings.Contains(ua, c[0]) {
+				return c[1]
+			}
+		}
+		return ""
+	}
+
+	// 顺序有意义: Edge 与 Chrome 的 UA 都包含 safari, iPhone 的 UA 包含 mac os
+	browser := pick([][2]string{
+		{"edg/", "Edge"}, {"opr/", "Opera"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"},
+		{"safari/", "Safari"}, {"curl/", "curl"}, {"okhttp", "Android app"}, {"cfnetwork", "iOS app"},
+	})
+	system := pick([][2]string{
+		{"iphone", "iPhone"}, {"ipad", "iPad"}, {"android", "Android"}, {"windows", "Windows"},
+		{"mac os", "macOS"}, {"cros", "ChromeOS"}, {"linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case userAgent == "":
+		return "Unknown device"
+	default:
+		return truncate(userAgent, 128)
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/pkg/keyring"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrAccountDisabled     = errors.New("account is disabled")
+)
+
+// Tokens 登录或刷新后下发的一对令牌
+type Tokens struct {
+	Access  string
+	Refresh string
+}
+
+type TokenService struct {
+	repo        *repository.RefreshTokenRepo
+	revokedRepo *repository.RevokedTokenRepo
+	userRepo    *repository.UserRepo
+	sessionRepo *repository.SessionRepo
+	keys        *keyring.Keyring
+}
+
+func NewTokenService(repo *repository.RefreshTokenRepo, revokedRepo *repository.RevokedTokenRepo, userRepo *repository.UserRepo,
+	sessionRepo *repository.SessionRepo, keys *keyring.Keyring) *TokenService {
+	return &TokenService{repo: repo, revokedRepo: revokedRepo, userRepo: userRepo, sessionRepo: sessionRepo, keys: keys}
+}
+
+// Issue 登录时创建会话, 签发访问令牌与新 Family 的刷新令牌. 账号被停用时返回 ErrAccountDisabled
+func (s *TokenService) Issue(ctx context.Context, uid int, userAgent, ip string) (Tokens, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+	// 先签发访问令牌, 停用的账号不会留下会话记录
+	access, err := s.accessToken(ctx, uid, userAgent, family)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refresh, t, err := newRefreshToken(uid, family, userAgent)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if err := s.repo.Create(ctx, t); err != nil {
+		return Tokens{}, err
+	}
+	err = s.sessionRepo.Create(ctx, &dao.Session{
+		UserId:    uid,
+		Sid:       family,
+		Device:    deviceName(userAgent),
+		UserAgent: userAgent,
+		Ip:        ip,
+		ExpiresAt: t.ExpiresAt,
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{Access: access, Refresh: refresh}, nil
+}
+
+// Refresh 用刷新令牌换取新的一对令牌, 旧的刷新令牌随即失效.
+// 已经轮换过的令牌再次使用时吊销整个 Family, 迫使持有者重新登录
+func (s *TokenService) Refresh(ctx context.Context, refresh, userAgent string) (Tokens, error) {
+	if refresh == "" {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	old, err := s.repo.FindByHash(ctx, hashToken(refresh))
+	if err != nil {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if old.Revoked != 0 || old.ExpiresAt <= time.Now().Unix() || old.UserAgent != userAgent {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if old.Rotated != 0 {
+		return Tokens{}, s.revoke(ctx, old)
+	}
+
+	next, t, err := newRefreshToken(old.UserId, old.Family, userAgent)
+	if err != nil {
+		return Tokens{}, err
+	}
+	// 刷新不延长 Family 的最长有效期
+	t.ExpiresAt = old.ExpiresAt
+	ok, err := s.repo.Rotate(ctx, old, t)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if !ok {
+		return Tokens{}, s.revoke(ctx, old)
+	}
+
+	access, err := s.accessToken(ctx, old.UserId, userAgent, old.Family)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{Access: access, Refresh: next}, nil
+}
+
+// Revoke 退出当前会话: 吊销访问令牌 jti 与会话的刷新令牌
+func (s *TokenService) Revoke(ctx context.Context, uid int, jti, session string) error {
+	if jti != "" {
+		err := s.revokedRepo.Create(ctx, &dao.RevokedToken{
+			Jti:       jti,
+			UserId:    uid,
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if session == "" {
+		return nil
+	}
+
+	return s.RevokeSession(ctx, session)
+}
+
+// RevokeSession 结束会话并吊销会话的刷新令牌, 会话的访问令牌在网关下一次检查时失效
+func (s *TokenService) RevokeSession(ctx context.Context, session string) error {
+	if err := s.sessionRepo.RevokeBySid(ctx, session); err != nil {
+		return err
+	}
+
+	return s.repo.RevokeFamily(ctx, session)
+}
+
+// RevokeAll 退出全部会话: 增加令牌代数使已签发的访问令牌失效, 并吊销全部刷新令牌
+func (s *TokenService) RevokeAll(ctx context.Context, uid int) error {
+	if _, err := s.userRepo.BumpGeneration(ctx, uid); err != nil {
+		return err
+	}
+	return s.RevokeOthers(ctx, uid, "")
+}
+
+// RevokeOthers 结束 session 以外的全部会话, session 为空时结束全部会话
+func (s *TokenService) RevokeOthers(ctx context.Context, uid int, session string) error {
+	if err := s.sessionRepo.RevokeByUid(ctx, uid, session); err != nil {
+		return err
+	}
+
+	return s.repo.RevokeByUid(ctx, uid, session)
+}
+
+// Check 判断访问令牌及其会话是否已被吊销, 签名与有效期由网关校验
+func (s *TokenService) Check(ctx context.Context, uid int, jti, session string, generation int64) (bool, error) {
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	if u.Id == 0 || u.Disabled != 0 || generation < u.TokenGeneration {
+		return false, nil
+	}
+	revoked, err := s.revokedRepo.Exists(ctx, jti)
+	if err != nil || revoked {
+		return false, err
+	}
+	if session == "" {
+		return true, nil
+	}
+
+	sess, err := s.sessionRepo.FindBySid(ctx, session)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// 会话管理上线前签发的令牌没有会话记录
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+
+	return sess.UserId == uid && sess.Revoked == 0, nil
+}
+
+func (s *TokenService) accessToken(ctx context.Context, uid int, userAgent, session string) (string, error) {
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if u.Disabled != 0 {
+		return "", ErrAccountDisabled
+	}
+
+	return GenerateToken(s.keys.Active(), AccessClaims{
+		UserId:     uid,
+		Role:       RoleOf(u),
+		UserAgent:  userAgent,
+		Session:    session,
+		Generation: u.TokenGeneration,
+	})
+}
+
+// Impersonate 为管理员签发模拟 uid 登录的访问令牌, 令牌不属于任何会话, 也没有刷新令牌
+func (s *TokenService) Impersonate(ctx context.Context, actor, uid int, userAgent string) (string, error) {
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if u.Disabled != 0 {
+		return "", ErrAccountDisabled
+	}
+
+	return GenerateToken(s.keys.Active(), AccessClaims{
+		UserId:     uid,
+		Role:       RoleOf(u),
+		UserAgent:  userAgent,
+		Generation: u.TokenGeneration,
+		Actor:      actor,
+	})
+}
+
+// JWKS 校验访问令牌所需的公钥
+func (s *TokenService) JWKS() []keyring.JWK {
+	return s.keys.JWKS()
+}
+
+func (s *TokenService) revoke(ctx context.Context, t dao.RefreshToken) error {
+	zap.L().Warn("Refresh token reused, revoking family", zap.Int("user_id", t.UserId), zap.String("family", t.Family))
+	if err := s.RevokeSession(ctx, t.Family); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+func newRefreshToken(uid int, family, userAgent string) (string, *dao.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &dao.RefreshToken{
+		UserId:    uid,
+		Family:    family,
+		TokenHash: hashToken(token),
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL).Unix(),
+	}, nil
+}
+
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 刷新令牌是高熵随机串, 使用 sha256 即可
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
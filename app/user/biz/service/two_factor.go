@@ -0,0 +1,399 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/secret"
+)
+
+const (
+	totpPeriod = 30
+	// totpSkew 允许前后各一个时间步的时钟误差
+	totpSkew          = 1
+	defaultTOTPIssuer = "todolist"
+	qrCodeSize        = 256
+	// recoveryCodeBytes 每个恢复码 40 位随机数, 编码后为 8 个字符
+	recoveryCodeBytes = 5
+	recoveryCodeCount = 10
+	challengeTTL      = time.Minute * 5
+	// challengeAttempts 同一个登录请求最多提交验证码的次数
+	challengeAttempts = 5
+)
+
+var (
+	ErrTwoFactorUnavailable = errors.New("two-factor authentication is not configured")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidTOTPCode      = errors.New("invalid verification code")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Enrollment 绑定时返回给客户端的密钥, 用于在认证器中添加账号
+type Enrollment struct {
+	URI   string
+	QRPNG []byte
+}
+
+// twoFactorStore 两步验证使用的存储, 由 repository.TwoFactorRepo 实现
+type twoFactorStore interface {
+	FindByUid(ctx context.Context, uid int) (dao.TwoFactor, error)
+	Enroll(ctx context.Context, uid int, secret string) error
+	Enable(ctx context.Context, uid int, counter int64, codes []dao.RecoveryCode) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, uid int, codes []dao.RecoveryCode) error
+	AdvanceCounter(ctx context.Context, uid int, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uid int, hash string) (bool, error)
+	Delete(ctx context.Context, uid int) error
+	CreateChallenge(ctx context.Context, c *dao.LoginChallenge) error
+	FindChallenge(ctx context.Context, hash string, now int64, maxAttempts int) (dao.LoginChallenge, error)
+	IncrAttempts(ctx context.Context, id int) error
+	ConsumeChallenge(ctx context.Context, id int) (bool, error)
+}
+
+type TwoFactorService struct {
+	repo     twoFactorStore
+	userRepo *repository.UserRepo
+	token    *TokenService
+	// guard 验证码错误与密码错误计入同一个账号与来源 IP 的失败次数
+	guard *LoginGuard
+	// box 为 nil 时没有配置加密密钥, 不能开启两步验证
+	box *secret.Box
+}
+
+func NewTwoFactorService(repo *repository.TwoFactorRepo, userRepo *repository.UserRepo, token *TokenService,
+	guard *LoginGuard, box *secret.Box) *TwoFactorService {
+	return &TwoFactorService{repo: repo, userRepo: userRepo, token: token, guard: guard, box: box}
+}
+
+// Enroll 生成新的 TOTP 密钥, 通过 Verify 验证后才会开启
+func (s *TwoFactorService) Enroll(ctx context.Context) (Enrollment, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	if s.box == nil {
+		return Enrollment{}, ErrTwoFactorUnavailable
+	}
+	t, err := s.repo.FindByUid(ctx, uId)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if t.Enabled > 0 {
+		return Enrollment{}, ErrTwoFactorEnabled
+	}
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	issuer := config.GetConf().TOTP.Issuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: u.Name,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return Enrollment{}, err
+	}
+	sealed, err := s.box.Seal(key.Secret())
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if err := s.repo.Enroll(ctx, uId, sealed); err != nil {
+		return Enrollment{}, err
+	}
+
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Enrollment{}, err
+	}
+
+	return Enrollment{URI: key.URL(), QRPNG: buf.Bytes()}, nil
+}
+
+// Verify 校验认证器生成的验证码并开启两步验证, 返回只展示一次的恢复码
+func (s *TwoFactorService) Verify(ctx context.Context, code string) ([]string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.repo.FindByUid(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled > 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+	if t.Id == 0 {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	counter, err := s.match(t, code)
+	if err != nil {
+		return nil, err
+	}
+	codes, rows, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.repo.Enable(ctx, uId, counter, rows)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return codes, nil
+}
+
+// Disable 关闭两步验证, 需要提供验证码或恢复码
+func (s *TwoFactorService) Disable(ctx context.Context, code string) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.check(ctx, uId, code); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, uId)
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码, 之前的恢复码全部失效
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.check(ctx, uId, code); err != nil {
+		return nil, err
+	}
+	codes, rows, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, s.repo.ReplaceRecoveryCodes(ctx, uId, rows)
+}
+
+// Enabled 登录时判断是否需要第二步验证
+func (s *TwoFactorService) Enabled(ctx context.Context, uid int) (bool, error) {
+	t, err := s.repo.FindByUid(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+
+	return t.Enabled > 0, nil
+}
+
+// Challenge 密码验证通过后创建登录请求, 返回的令牌只能用来提交验证码, 不能访问其他接口
+func (s *TwoFactorService) Challenge(ctx context.Context, uid int) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateChallenge(ctx, &dao.LoginChallenge{
+		UserId:    uid,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(challengeTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Login 登录的第二步, 验证码或恢复码正确后签发令牌
+func (s *TwoFactorService) Login(ctx context.Context, challenge, code string) (Tokens, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Tokens{}, errors.New("error param")
+	}
+	userAgent := userAgentOf(md)
+
+	uid, err := s.pass(ctx, challenge, code)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return s.token.Issue(ctx, uid, userAgent, clientIP(md))
+}
+
+// pass 校验登录请求与验证码并消费登录请求, 返回登录的用户 id.
+// 两步都通过后才清除账号的失败次数, 否则知道密码的人可以反复创建登录请求来穷举验证码
+func (s *TwoFactorService) pass(ctx context.Context, challenge, code string) (int, error) {
+	c, err := s.repo.FindChallenge(ctx, hashToken(challenge), time.Now().Unix(), challengeAttempts)
+	if err != nil {
+		return 0, ErrInvalidChallenge
+	}
+	if err := s.check(ctx, c.UserId, code); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			if err := s.repo.IncrAttempts(ctx, c.Id); err != nil {
+				return 0, err
+			}
+		}
+		return 0, err
+	}
+	ok, err := s.repo.ConsumeChallenge(ctx, c.Id)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidChallenge
+	}
+
+	account := loginSubject(dao.User{Id: c.UserId}, "")
+	if err := s.guard.Reset(ctx, account); err != nil {
+		zap.L().Error("Failed to reset login failures", zap.String("account", account), zap.Error(err))
+	}
+
+	return c.UserId, nil
+}
+
+// check 校验已开启两步验证的用户提交的验证码或恢复码.
+// 账号或来源 IP 处于等待或锁定状态时不校验, 验证码错误计入失败次数
+func (s *TwoFactorService) check(ctx context.Context, uid int, code string) error {
+	account := loginSubject(dao.User{Id: uid}, "")
+	var ip string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ip = clientIP(md)
+	}
+	if err := s.guard.Check(ctx, account, ip); err != nil {
+		return err
+	}
+
+	err := s.verify(ctx, uid, code)
+	if errors.Is(err, ErrInvalidTOTPCode) {
+		if err := s.guard.Fail(ctx, account, ip); err != nil {
+			zap.L().Error("Failed to record login failure", zap.String("account", account), zap.Error(err))
+		}
+	}
+
+	return err
+}
+
+// verify 依次尝试验证码与恢复码
+func (s *TwoFactorService) verify(ctx context.Context, uid int, code string) error {
+	t, err := s.repo.FindByUid(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if t.Enabled == 0 {
+		return ErrTwoFactorNotEnabled
+	}
+
+	counter, err := s.match(t, code)
+	if err == nil {
+		ok, err := s.repo.AdvanceCounter(ctx, uid, counter)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+	if !errors.Is(err, ErrInvalidTOTPCode) {
+		return err
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, uid, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+// match 在允许的时钟误差内查找与验证码匹配且没有使用过的时间步
+func (s *TwoFactorService) match(t dao.TwoFactor, code string) (int64, error) {
+	if s.box == nil {
+		return 0, ErrTwoFactorUnavailable
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return 0, ErrInvalidTOTPCode
+	}
+	key, err := s.box.Open(t.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		counter := now + int64(i)
+		if counter <= t.LastCounter {
+			continue
+		}
+		expected, err := hotp.GenerateCodeCustom(key, uint64(counter), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, nil
+		}
+	}
+
+	return 0, ErrInvalidTOTPCode
+}
+
+// newRecoveryCodes 返回展示给用户的恢复码与需要保存的哈希
+func newRecoveryCodes() ([]string, []dao.RecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]dao.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		rows = append(rows, dao.RecoveryCode{CodeHash: hashToken(code)})
+	}
+
+	return codes, rows, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/secret"
+)
+
+// memoryTwoFactorStore 内存中的 twoFactorStore, 语义与 dao.TwoFactorDao 一致
+type memoryTwoFactorStore struct {
+	mu         sync.Mutex
+	factors    map[int]dao.TwoFactor
+	codes      map[int][]dao.RecoveryCode
+	challenges map[int]dao.LoginChallenge
+	nextId     int
+}
+
+func newMemoryTwoFactorStore() *memoryTwoFactorStore {
+	return &memoryTwoFactorStore{
+		factors:    make(map[int]dao.TwoFactor),
+		codes:      make(map[int][]dao.RecoveryCode),
+		challenges: make(map[int]dao.LoginChallenge),
+	}
+}
+
+func (m *memoryTwoFactorStore) FindByUid(ctx context.Context, uid int) (dao.TwoFactor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.factors[uid], nil
+}
+
+func (m *memoryTwoFactorStore) Enroll(ctx context.Context, uid int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.factors[uid].Enabled > 0 {
+		return nil
+	}
+	m.factors[uid] = dao.TwoFactor{Id: uid, UserId: uid, Secret: secret}
+	return nil
+}
+
+func (m *memoryTwoFactorStore) Enable(ctx context.Context, uid int, counter int64, codes []dao.RecoveryCode) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.factors[uid]
+	if !ok || t.Enabled > 0 {
+		return false, nil
+	}
+	t.Enabled = time.Now().Unix()
+	t.LastCounter = counter
+	m.factors[uid] = t
+	m.codes[uid] = codes
+	return true, nil
+}
+
+func (m *memoryTwoFactorStore) ReplaceRecoveryCodes(ctx context.Context, uid int, codes []dao.RecoveryCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[uid] = codes
+	return nil
+}
+
+func (m *memoryTwoFactorStore) AdvanceCounter(ctx context.Context, uid int, counter int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.factors[uid]
+	if t.LastCounter >= counter {
+		return false, nil
+	}
+	t.LastCounter = counter
+	m.factors[uid] = t
+	return true, nil
+}
+
+func (m *memoryTwoFactorStore) UseRecoveryCode(ctx context.Context, uid int, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.codes[uid] {
+		if c.CodeHash == hash && c.Used == 0 {
+			m.codes[uid][i].Used = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryTwoFactorStore) Delete(ctx context.Context, uid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.factors, uid)
+	delete(m.codes, uid)
+	return nil
+}
+
+func (m *memoryTwoFactorStore) CreateChallenge(ctx context.Context, c *dao.LoginChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	c.Id = m.nextId
+	m.challenges[c.Id] = *c
+	return nil
+}
+
+func (m *memoryTwoFactorStore) FindChallenge(ctx context.Context, hash string, now int64, maxAttempts int) (dao.LoginChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.challenges {
+		if c.TokenHash == hash && c.ExpiresAt > now && c.Attempts < maxAttempts {
+			return c, nil
+		}
+	}
+	return dao.LoginChallenge{}, gorm.ErrRecordNotFound
+}
+
+func (m *memoryTwoFactorStore) IncrAttempts(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.challenges[id]
+	c.Attempts++
+	m.challenges[id] = c
+	return nil
+}
+
+func (m *memoryTwoFactorStore) ConsumeChallenge(ctx context.Context, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.challenges[id]; !ok {
+		return false, nil
+	}
+	delete(m.challenges, id)
+	return true, nil
+}
+
+type twoFactorFixture struct {
+	svc      *TwoFactorService
+	store    *memoryTwoFactorStore
+	clock    *testClock
+	secret   string
+	recovery []string
+}
+
+// newTwoFactorFixture 用户 1 已开启两步验证
+func newTwoFactorFixture(t *testing.T) *twoFactorFixture {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	box, err := secret.NewBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otpKey, err := totp.Generate(totp.GenerateOpts{Issuer: "test", AccountName: "alice", Period: totpPeriod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal(otpKey.Secret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, rows, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newMemoryTwoFactorStore()
+	ctx := context.Background()
+	if err := store.Enroll(ctx, 1, sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Enable(ctx, 1, 0, rows); err != nil {
+		t.Fatal(err)
+	}
+	guard, clock := newTestGuard()
+
+	return &twoFactorFixture{
+		svc:      &TwoFactorService{repo: store, guard: guard, box: box},
+		store:    store,
+		clock:    clock,
+		secret:   otpKey.Secret(),
+		recovery: codes,
+	}
+}
+
+func (f *twoFactorFixture) code(t *testing.T) string {
+	t.Helper()
+	code, err := totp.GenerateCode(f.secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// wrongCode 返回一个与允许误差内任何时间步都不匹配的验证码
+func (f *twoFactorFixture) wrongCode(t *testing.T) string {
+	t.Helper()
+	valid := make(map[string]bool)
+	for i := -totpSkew - 1; i <= totpSkew+1; i++ {
+		code, err := totp.GenerateCode(f.secret, time.Now().Add(time.Duration(i*totpPeriod)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid[code] = true
+	}
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if !valid[code] {
+			return code
+		}
+	}
+	t.Fatal("no wrong code available")
+	return ""
+}
+
+func TestTwoFactorCheck(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// codes 依次提交的验证码, 由 fixture 生成
+		codes func(t *testing.T, f *twoFactorFixture) []string
+		want  []error
+	}{
+		{
+			name:  "totp code",
+			codes: func(t *testing.T, f *twoFactorFixture) []string { return []string{f.code(t)} },
+			want:  []error{nil},
+		},
+		{
+			name:  "totp code with spaces",
+			codes: func(t *testing.T, f *twoFactorFixture) []string { return []string{" " + f.code(t) + " "} },
+			want:  []error{nil},
+		},
+		{
+			name: "totp code replayed",
+			codes: func(t *testing.T, f *twoFactorFixture) []string {
+				c := f.code(t)
+				return []string{c, c}
+			},
+			want: []error{nil, ErrInvalidTOTPCode},
+		},
+		{
+			name:  "wrong code",
+			codes: func(t *testing.T, f *twoFactorFixture) []string { return []string{f.wrongCode(t)} },
+			want:  []error{ErrInvalidTOTPCode},
+		},
+		{
+			name:  "malformed code",
+			codes: func(t *testing.T, f *twoFactorFixture) []string { return []string{"12345", "abcdefg", ""} },
+			want:  []error{ErrInvalidTOTPCode, ErrInvalidTOTPCode, ErrInvalidTOTPCode},
+		},
+		{
+			name: "recovery code used once",
+			codes: func(t *testing.T, f *twoFactorFixture) []string {
+				return []string{f.recovery[0], f.recovery[0], f.recovery[1]}
+			},
+			want: []error{nil, ErrInvalidTOTPCode, nil},
+		},
+		{
+			name: "recovery code normalized",
+			codes: func(t *testing.T, f *twoFactorFixture) []string {
+				return []string{" " + strings.ToUpper(f.recovery[2]) + " ", strings.ReplaceAll(f.recovery[3], "-", "")}
+			},
+			want: []error{nil, nil},
+		},
+		{
+			name:  "unknown recovery code",
+			codes: func(t *testing.T, f *twoFactorFixture) []string { return []string{"aaaa-aaaa"} },
+			want:  []error{ErrInvalidTOTPCode},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTwoFactorFixture(t)
+			for i, code := range tt.codes(t, f) {
+				if err := f.svc.check(ctx, 1, code); !errors.Is(err, tt.want[i]) {
+					t.Errorf("code %d: err = %v, want %v", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("not enabled", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		if err := f.svc.check(ctx, 2, "000000"); !errors.Is(err, ErrTwoFactorNotEnabled) {
+			t.Errorf("err = %v, want ErrTwoFactorNotEnabled", err)
+		}
+	})
+
+	t.Run("no encryption key", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		f.svc.box = nil
+		if err := f.svc.check(ctx, 1, "000000"); !errors.Is(err, ErrTwoFactorUnavailable) {
+			t.Errorf("err = %v, want ErrTwoFactorUnavailable", err)
+		}
+	})
+}
+
+// TestTwoFactorCheckGuarded 验证码错误计入账号的失败次数, 被限制时正确的验证码也不再校验
+func TestTwoFactorCheckGuarded(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("client_ip", "10.0.0.1"))
+	f := newTwoFactorFixture(t)
+
+	for i := 0; i < testLoginConf.Account.Free; i++ {
+		if err := f.svc.check(ctx, 1, f.wrongCode(t)); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidTOTPCode", i, err)
+		}
+	}
+	if err := f.svc.check(ctx, 1, f.wrongCode(t)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("err = %v, want ErrInvalidTOTPCode", err)
+	}
+	if err := f.svc.check(ctx, 1, f.code(t)); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("blocked: err = %v, want ErrTooManyAttempts", err)
+	}
+	// 来源 IP 同样被计数
+	if got := retryAfter(t, f.svc.guard.Check(ctx, "account:2", "10.0.0.1")); got != 0 {
+		t.Errorf("ip below limit: wait = %v, want 0", got)
+	}
+
+	f.clock.advance(time.Second)
+	if err := f.svc.check(ctx, 1, f.code(t)); err != nil {
+		t.Fatalf("after backoff: err = %v", err)
+	}
+}
+
+// TestTwoFactorLoginChallenge 知道密码的人反复创建登录请求也不能绕过失败次数限制
+func TestTwoFactorLoginChallenge(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("client_ip", "10.0.0.1"))
+
+	t.Run("challenge attempts", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		// 每次失败后等待退避时间, 只验证登录请求自身的次数限制
+		f.svc.guard.conf = func() config.Login { return config.Login{Window: time.Hour} }
+		challenge, err := f.svc.Challenge(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < challengeAttempts; i++ {
+			if _, err := f.svc.pass(ctx, challenge, f.wrongCode(t)); !errors.Is(err, ErrInvalidTOTPCode) {
+				t.Fatalf("attempt %d: err = %v, want ErrInvalidTOTPCode", i, err)
+			}
+		}
+		if _, err := f.svc.pass(ctx, challenge, f.code(t)); !errors.Is(err, ErrInvalidChallenge) {
+			t.Fatalf("exhausted challenge: err = %v, want ErrInvalidChallenge", err)
+		}
+	})
+
+	t.Run("new challenges share the account limit", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		var blocked bool
+		for i := 0; i < testLoginConf.Account.Lock; i++ {
+			challenge, err := f.svc.Challenge(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.svc.pass(ctx, challenge, f.wrongCode(t))
+			if errors.Is(err, ErrTooManyAttempts) {
+				blocked = true
+				break
+			}
+			if !errors.Is(err, ErrInvalidTOTPCode) {
+				t.Fatalf("attempt %d: err = %v", i, err)
+			}
+		}
+		if !blocked {
+			t.Fatal("fresh challenges were never rate limited")
+		}
+
+		challenge, err := f.svc.Challenge(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.svc.pass(ctx, challenge, f.code(t)); !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("correct code while blocked: err = %v, want ErrTooManyAttempts", err)
+		}
+	})
+
+	t.Run("success resets account", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		for i := 0; i < testLoginConf.Account.Free; i++ {
+			if err := f.svc.guard.Fail(ctx, "account:1", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		challenge, err := f.svc.Challenge(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, err := f.svc.pass(ctx, challenge, f.code(t))
+		if err != nil || uid != 1 {
+			t.Fatalf("pass = %d, %v, want 1, nil", uid, err)
+		}
+		a, err := f.svc.guard.store.Get(ctx, "account:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Failures != 0 {
+			t.Errorf("failures after login = %d, want 0", a.Failures)
+		}
+		// 登录请求只能使用一次
+		if _, err := f.svc.pass(ctx, challenge, f.recovery[0]); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("reused challenge: err = %v, want ErrInvalidChallenge", err)
+		}
+	})
+
+	t.Run("unknown challenge", func(t *testing.T) {
+		f := newTwoFactorFixture(t)
+		if _, err := f.svc.pass(ctx, "nope", f.code(t)); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("err = %v, want ErrInvalidChallenge", err)
+		}
+	})
+}
@@ -3,87 +3,213 @@ package service
 import (
 	"context"
 	"errors"
-	"strconv"
+	"strings"
 
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/pkg/keyring"
 )
 
+const (
+	// dummyPasswordHash 不对应任何账号的密码哈希, 与真实哈希使用相同的 cost
+	dummyPasswordHash = "$2a$10$6MOk3chfuoQo377Ijn353unmMQCX8/vuR6sjglPMbi78XuDnSv2kC"
+	// maxBatchUsers 一次批量查询的用户数上限
+	maxBatchUsers = 500
+)
+
+var ErrTooManyUsers = errors.New("too many user ids")
+
 type UserService struct {
-	repo *repository.UserRepo
+	repo      *repository.UserRepo
+	token     *TokenService
+	email     *EmailService
+	twoFactor *TwoFactorService
+	guard     *LoginGuard
 }
 
-func NewUserService(r *repository.UserRepo) *UserService {
-	return &UserService{repo: r}
+func NewUserService(r *repository.UserRepo, token *TokenService, email *EmailService, twoFactor *TwoFactorService,
+	guard *LoginGuard) *UserService {
+	return &UserService{repo: r, token: token, email: email, twoFactor: twoFactor, guard: guard}
 }
 
-func (s *UserService) Register(ctx context.Context, name, password string) (string, error) {
+func (s *UserService) Register(ctx context.Context, name, password, email string) (Tokens, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return "", errors.New("error param")
+		return Tokens{}, errors.New("error param")
+	}
+	userAgent := userAgentOf(md)
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return Tokens{}, err
 	}
-	userAgent := md["user_agent"][0]
 
 	ps, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", err
+		return Tokens{}, err
 	}
 
 	u := &dao.User{
 		Name:     name,
 		Password: string(ps),
 	}
+	if email != "" {
+		u.Email = &email
+	}
 
 	err = s.repo.CreateUser(ctx, u)
 	if err != nil {
-		return "", err
+		if errors.Is(err, dao.ErrDuplicateEmail) {
+			return Tokens{}, ErrEmailTaken
+		}
+		return Tokens{}, err
 	}
-
-	var token string
-	token, err = GenerateToken(u.Id, userAgent)
-	if err != nil {
-		return "", err
+	if email != "" {
+		// 验证邮件发送失败不影响注册, 用户可以稍后重新发送
+		_ = s.email.sendVerification(ctx, u.Id, email)
 	}
 
-	return token, nil
+	return s.token.Issue(ctx, u.Id, userAgent, clientIP(md))
 }
 
-func (s *UserService) Login(ctx context.Context, name, password string) (string, error) {
+// Login 校验用户名与密码, 开启了两步验证时不签发令牌, 而是返回提交验证码所需的登录请求令牌.
+// 账号或来源 IP 失败次数过多时返回 RetryError, 用户不存在与密码错误都返回 ErrInvalidCredentials
+func (s *UserService) Login(ctx context.Context, name, password string) (Tokens, string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return "", errors.New("error param")
+		return Tokens{}, "", errors.New("error param")
 	}
-	userAgent := md["user_agent"][0]
+	userAgent := userAgentOf(md)
+	ip := clientIP(md)
 
-	u, err := s.repo.FindByName(ctx, name)
+	u, err := findByLogin(ctx, s.repo, name)
 	if err != nil {
-		return "", err
+		return Tokens{}, "", err
+	}
+	account := loginSubject(u, name)
+	if err := s.guard.Check(ctx, account, ip); err != nil {
+		return Tokens{}, "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	if err != nil {
-		return "", err
+	hash := u.Password
+	if u.Id == 0 {
+		// 用户不存在时同样计算一次哈希, 避免通过响应时间判断账号是否存在
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil || u.Id == 0 {
+		if err := s.guard.Fail(ctx, account, ip); err != nil {
+			zap.L().Error("Failed to record login failure", zap.String("account", account), zap.Error(err))
+		}
+		return Tokens{}, "", ErrInvalidCredentials
+	}
+	// 密码正确后才提示账号状态, 避免泄露账号是否存在
+	if u.Disabled != 0 {
+		return Tokens{}, "", ErrAccountDisabled
+	}
+	if u.ResetRequired != 0 {
+		return Tokens{}, "", ErrPasswordResetRequired
 	}
 
-	var token string
-	token, err = GenerateToken(u.Id, userAgent)
+	enabled, err := s.twoFactor.Enabled(ctx, u.Id)
 	if err != nil {
-		return "", err
+		return Tokens{}, "", err
+	}
+	// 开启两步验证时失败次数在验证码通过后才清除
+	if enabled {
+		challenge, err := s.twoFactor.Challenge(ctx, u.Id)
+		return Tokens{}, challenge, err
+	}
+	if err := s.guard.Reset(ctx, account); err != nil {
+		zap.L().Error("Failed to reset login failures", zap.String("account", account), zap.Error(err))
 	}
 
-	return token, nil
+	tokens, err := s.token.Issue(ctx, u.Id, userAgent, ip)
+	return tokens, "", err
 }
 
-func (s *UserService) GetUserInfo(ctx context.Context) (dao.User, error) {
+// RefreshToken 轮换刷新令牌, refresh 为空时使用网关从 Cookie 中转发的令牌
+func (s *UserService) RefreshToken(ctx context.Context, refresh string) (Tokens, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return dao.User{}, errors.New("error param")
+		return Tokens{}, errors.New("error param")
+	}
+	userAgent := userAgentOf(md)
+	if refresh == "" {
+		if v := md.Get("refresh_token"); len(v) > 0 {
+			refresh = v[0]
+		}
+	}
+
+	return s.token.Refresh(ctx, refresh, userAgent)
+}
+
+// Logout 退出当前会话, 令牌 id 与会话 id 由网关从访问令牌中解析后签入内部凭证
+func (s *UserService) Logout(ctx context.Context) error {
+	p, _ := principal.FromContext(ctx)
+	if p.UserId == 0 {
+		return principal.ErrNoUser
+	}
+
+	return s.token.Revoke(ctx, p.UserId, p.TokenId, p.SessionId)
+}
+
+func (s *UserService) LogoutAllSessions(ctx context.Context) error {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.token.RevokeAll(ctx, uId)
+}
+
+// JWKS 供网关获取校验访问令牌的公钥
+func (s *UserService) JWKS() []keyring.JWK {
+	return s.token.JWKS()
+}
+
+// CheckToken 供网关确认访问令牌没有被吊销
+func (s *UserService) CheckToken(ctx context.Context, uid int, jti, session string, generation int64) (bool, error) {
+	return s.token.Check(ctx, uid, jti, session, generation)
+}
+
+func (s *UserService) GetUserInfo(ctx context.Context) (dao.User, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.User{}, err
 	}
-	userId := md["user_id"][0]
-	uId, _ := strconv.Atoi(userId)
 
 	return s.repo.FindById(ctx, uId)
 }
+
+// BatchGet 批量查询用户的展示信息, 供其他服务填充响应中的用户名与头像
+func (s *UserService) BatchGet(ctx context.Context, ids []int) ([]dao.User, error) {
+	seen := make(map[int]struct{}, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || id <= 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+	if len(unique) > maxBatchUsers {
+		return nil, ErrTooManyUsers
+	}
+
+	return s.repo.FindByIds(ctx, unique)
+}
+
+// findByLogin 按用户名查找用户, 找不到且看起来是邮箱时按邮箱查找
+func findByLogin(ctx context.Context, repo *repository.UserRepo, login string) (dao.User, error) {
+	u, err := repo.FindByName(ctx, login)
+	if err != nil || u.Id != 0 || !strings.Contains(login, "@") {
+		return u, err
+	}
+
+	return repo.FindByEmail(ctx, strings.ToLower(strings.TrimSpace(login)))
+}
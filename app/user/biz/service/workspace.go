@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/mailer"
+)
+
+// 工作区成员的角色. 所有者与管理员可以邀请与移除成员, 只有所有者可以任免管理员与转让工作区
+const (
+	MemberOwner  = "owner"
+	MemberAdmin  = "admin"
+	MemberMember = "member"
+)
+
+const (
+	inviteTTL        = 7 * 24 * time.Hour
+	maxWorkspaceName = 64
+)
+
+var (
+	ErrWorkspaceNotFound   = errors.New("workspace not found")
+	ErrInvalidWorkspace    = errors.New("workspace name must be 1 to 64 characters")
+	ErrInvalidMemberRole   = errors.New("invalid member role")
+	ErrNotWorkspaceAdmin   = errors.New("only workspace owners and admins can do this")
+	ErrNotWorkspaceOwner   = errors.New("only the workspace owner can do this")
+	ErrMemberNotFound      = errors.New("member not found")
+	ErrOwnerCannotLeave    = errors.New("the workspace owner cannot leave, transfer the workspace first")
+	ErrInvalidInvite       = errors.New("invalid or expired invite")
+	ErrInviteEmail         = errors.New("this invite was sent to a different email address")
+	ErrAlreadyMember       = errors.New("already a member of the workspace")
+	ErrOwnsSharedWorkspace = errors.New("transfer workspaces that have other members before deleting the account")
+)
+
+type WorkspaceService struct {
+	repo     *repository.WorkspaceRepo
+	userRepo *repository.UserRepo
+	mailer   mailer.Mailer
+}
+
+func NewWorkspaceService(repo *repository.WorkspaceRepo, userRepo *repository.UserRepo, m mailer.Mailer) *WorkspaceService {
+	return &WorkspaceService{repo: repo, userRepo: userRepo, mailer: m}
+}
+
+// Create 创建工作区, 创建者成为所有者
+func (s *WorkspaceService) Create(ctx context.Context, name string) (dao.Membership, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.Membership{}, err
+	}
+
+	name, err = normalizeWorkspaceName(name)
+	if err != nil {
+		return dao.Membership{}, err
+	}
+	w := &dao.Workspace{Name: name, OwnerId: uId}
+	if err := s.repo.Create(ctx, w, MemberOwner); err != nil {
+		return dao.Membership{}, err
+	}
+
+	return dao.Membership{Workspace: *w, Role: MemberOwner, MemberCount: 1}, nil
+}
+
+func (s *WorkspaceService) List(ctx context.Context) ([]dao.Membership, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByMember(ctx, uId)
+}
+
+// Get 返回工作区与全部成员, 只有成员可以查看
+func (s *WorkspaceService) Get(ctx context.Context, id int) (dao.Membership, []dao.MemberInfo, error) {
+	w, self, err := s.member(ctx, id)
+	if err != nil {
+		return dao.Membership{}, nil, err
+	}
+	members, err := s.repo.FindMembers(ctx, id)
+	if err != nil {
+		return dao.Membership{}, nil, err
+	}
+
+	return dao.Membership{Workspace: w, Role: self.Role, MemberCount: len(members)}, members, nil
+}
+
+func (s *WorkspaceService) Rename(ctx context.Context, id int, name string) error {
+	_, self, err := s.member(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !canManage(self.Role) {
+		return ErrNotWorkspaceAdmin
+	}
+	name, err = normalizeWorkspaceName(name)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Rename(ctx, id, name)
+}
+
+// SetRole 修改成员的角色, role 为 owner 时转让工作区, 原所有者成为管理员
+func (s *WorkspaceService) SetRole(ctx context.Context, id, uid int, role string) error {
+	if role != MemberOwner && role != MemberAdmin && role != MemberMember {
+		return ErrInvalidMemberRole
+	}
+	_, self, err := s.member(ctx, id)
+	if err != nil {
+		return err
+	}
+	if self.Role != MemberOwner {
+		return ErrNotWorkspaceOwner
+	}
+	target, err := s.findMember(ctx, id, uid)
+	if err != nil {
+		return err
+	}
+	if target.UserId == self.UserId || target.Role == role {
+		return nil
+	}
+
+	if role == MemberOwner {
+		return s.repo.TransferOwner(ctx, id, self.UserId, target.UserId, MemberOwner, MemberAdmin)
+	}
+	return s.repo.UpdateMemberRole(ctx, id, uid, role)
+}
+
+// RemoveMember 移除成员, uid 为调用方自己时表示退出工作区. 管理员不能移除其他管理员与所有者
+func (s *WorkspaceService) RemoveMember(ctx context.Context, id, uid int) error {
+	_, self, err := s.member(ctx, id)
+	if err != nil {
+		return err
+	}
+	if uid == self.UserId {
+		if self.Role == MemberOwner {
+			return ErrOwnerCannotLeave
+		}
+		return s.repo.RemoveMember(ctx, id, uid)
+	}
+
+	if !canManage(self.Role) {
+		return ErrNotWorkspaceAdmin
+	}
+	target, err := s.findMember(ctx, id, uid)
+	if err != nil {
+		return err
+	}
+	if target.Role == MemberOwner || (target.Role == MemberAdmin && self.Role != MemberOwner) {
+		return ErrNotWorkspaceOwner
+	}
+
+	return s.repo.RemoveMember(ctx, id, uid)
+}
+
+// CreateInvite 创建邀请并返回令牌. email 不为空时发送邀请邮件, 邮件发送失败不影响邀请, 令牌同样返回给调用方
+func (s *WorkspaceService) CreateInvite(ctx context.Context, id int, email, role string) (*dao.WorkspaceInvite, string, error) {
+	if role == "" {
+		role = MemberMember
+	}
+	if role != MemberAdmin && role != MemberMember {
+		return nil, "", ErrInvalidMemberRole
+	}
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, "", err
+	}
+	w, self, err := s.member(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !canManage(self.Role) || (role == MemberAdmin && self.Role != MemberOwner) {
+		return nil, "", ErrNotWorkspaceAdmin
+	}
+	inviter, err := s.userRepo.FindById(ctx, self.UserId)
+	if err != nil {
+		return nil, "", err
+	}
+	if email != "" && restricted(inviter, CapWorkspaceInvites) {
+		return nil, "", ErrEmailNotVerified
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	i := &dao.WorkspaceInvite{
+		WorkspaceId: id,
+		TokenHash:   hashToken(token),
+		Email:       email,
+		Role:        role,
+		InviterId:   self.UserId,
+		ExpiresAt:   time.Now().Add(inviteTTL).Unix(),
+	}
+	if err := s.repo.CreateInvite(ctx, i); err != nil {
+		return nil, "", err
+	}
+	if email != "" {
+		s.sendInvite(ctx, w, inviter, email, token)
+	}
+
+	return i, token, nil
+}
+
+func (s *WorkspaceService) sendInvite(ctx context.Context, w dao.Workspace, inviter dao.User, email, token string) {
+	name := inviter.DisplayName
+	if name == "" {
+		name = inviter.Name
+	}
+	link := config.GetConf().Mail.InviteURL + "?token=" + url.QueryEscape(token)
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: fmt.Sprintf("%s invited you to %s on todolist", name, w.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join the workspace \"%s\". Open the link below to accept or decline. "+
+			"It expires in %d days and can be used once.\n\n%s\n", name, w.Name, int(inviteTTL.Hours()/24), link),
+	})
+	if err != nil {
+		zap.L().Error("Failed to send workspace invite email", zap.Int("workspace_id", w.Id), zap.Error(err))
+	}
+}
+
+// ListInvites 返回未处理的邀请, 只有所有者与管理员可以查看
+func (s *WorkspaceService) ListInvites(ctx context.Context, id int) (dao.Workspace, []*dao.WorkspaceInvite, error) {
+	w, self, err := s.member(ctx, id)
+	if err != nil {
+		return dao.Workspace{}, nil, err
+	}
+	if !canManage(self.Role) {
+		return dao.Workspace{}, nil, ErrNotWorkspaceAdmin
+	}
+	is, err := s.repo.FindInvites(ctx, id, time.Now().Unix())
+
+	return w, is, err
+}
+
+func (s *WorkspaceService) RevokeInvite(ctx context.Context, id, inviteId int) error {
+	_, self, err := s.member(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !canManage(self.Role) {
+		return ErrNotWorkspaceAdmin
+	}
+	if err := s.repo.RevokeInvite(ctx, id, inviteId); err != nil {
+		if errors.Is(err, dao.ErrInviteUsed) {
+			return ErrInvalidInvite
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Accept 接受邀请并加入工作区, 邀请指定了邮箱时调用方的邮箱需要一致且已验证
+func (s *WorkspaceService) Accept(ctx context.Context, token string) (dao.Membership, error) {
+	u, i, err := s.invite(ctx, token)
+	if err != nil {
+		return dao.Membership{}, err
+	}
+	if i.Email != "" && (u.Email == nil || *u.Email != i.Email || u.EmailVerified == 0) {
+		return dao.Membership{}, ErrInviteEmail
+	}
+
+	err = s.repo.AcceptInvite(ctx, i, u.Id)
+	switch {
+	case errors.Is(err, dao.ErrAlreadyMember):
+		return dao.Membership{}, ErrAlreadyMember
+	case errors.Is(err, dao.ErrInviteUsed):
+		return dao.Membership{}, ErrInvalidInvite
+	case err != nil:
+		return dao.Membership{}, err
+	}
+
+	w, err := s.repo.FindById(ctx, i.WorkspaceId)
+	if err != nil {
+		return dao.Membership{}, err
+	}
+	members, err := s.repo.FindMembers(ctx, i.WorkspaceId)
+	if err != nil {
+		return dao.Membership{}, err
+	}
+
+	return dao.Membership{Workspace: w, Role: i.Role, MemberCount: len(members)}, nil
+}
+
+// Decline 拒绝邀请, 拒绝后令牌失效
+func (s *WorkspaceService) Decline(ctx context.Context, token string) error {
+	u, i, err := s.invite(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeclineInvite(ctx, i.Id, u.Id); err != nil {
+		if errors.Is(err, dao.ErrInviteUsed) {
+			return ErrInvalidInvite
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Role 返回用户在工作区中的角色, 不是成员时返回空字符串. 供其他服务确认成员身份
+func (s *WorkspaceService) Role(ctx context.Context, id, uid int) (string, error) {
+	m, err := s.repo.FindMember(ctx, id, uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return m.Role, nil
+}
+
+// CheckDeletable 注销账号前确认用户没有还有其他成员的工作区
+func (s *WorkspaceService) CheckDeletable(ctx context.Context, uid int) error {
+	shared, err := s.repo.HasOtherMembers(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return ErrOwnsSharedWorkspace
+	}
+
+	return nil
+}
+
+// member 读取工作区与调用方的成员身份, 不是成员时与工作区不存在一样返回 ErrWorkspaceNotFound
+func (s *WorkspaceService) member(ctx context.Context, id int) (dao.Workspace, dao.WorkspaceMember, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.Workspace{}, dao.WorkspaceMember{}, err
+	}
+
+	m, err := s.repo.FindMember(ctx, id, uId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.Workspace{}, dao.WorkspaceMember{}, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return dao.Workspace{}, dao.WorkspaceMember{}, err
+	}
+	w, err := s.repo.FindById(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.Workspace{}, dao.WorkspaceMember{}, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return dao.Workspace{}, dao.WorkspaceMember{}, err
+	}
+
+	return w, m, nil
+}
+
+func (s *WorkspaceService) findMember(ctx context.Context, id, uid int) (dao.WorkspaceMember, error) {
+	m, err := s.repo.FindMember(ctx, id, uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.WorkspaceMember{}, ErrMemberNotFound
+	}
+
+	return m, err
+}
+
+// invite 读取调用方与令牌对应的未处理邀请
+func (s *WorkspaceService) invite(ctx context.Context, token string) (dao.User, dao.WorkspaceInvite, error) {
+	uId, err := principal.UserId(ctx)
+	if err != nil {
+		return dao.User{}, dao.WorkspaceInvite{}, err
+	}
+
+	i, err := s.repo.FindInvite(ctx, hashToken(strings.TrimSpace(token)), time.Now().Unix())
+	if errors.Is(err, dao.ErrInviteUsed) {
+		return dao.User{}, dao.WorkspaceInvite{}, ErrInvalidInvite
+	}
+	if err != nil {
+		return dao.User{}, dao.WorkspaceInvite{}, err
+	}
+	u, err := s.userRepo.FindById(ctx, uId)
+	if err != nil {
+		return dao.User{}, dao.WorkspaceInvite{}, err
+	}
+
+	return u, i, nil
+}
+
+func canManage(role string) bool {
+	return role == MemberOwner || role == MemberAdmin
+}
+
+func normalizeWorkspaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceName {
+		return "", ErrInvalidWorkspace
+	}
+
+	return name, nil
+}
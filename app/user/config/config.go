@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -21,6 +23,7 @@ type ConfigChangeType int
 const (
 	ServerChange ConfigChangeType = iota
 	DBChange
+	JWTChange
 )
 
 type Observer interface {
@@ -40,6 +43,10 @@ type Config struct {
 	MySQL     MySQL  `yaml:"mysql"`
 	JWT       JWT    `yaml:"jwt"`
 	ETCD      ETCD   `yaml:"etcd"`
+	Mail      Mail   `yaml:"mail"`
+	Email     Email  `yaml:"email"`
+	TOTP      TOTP   `yaml:"totp"`
+	Login     Login  `yaml:"login"`
 	observers []Observer
 	mu        sync.RWMutex
 }
@@ -56,8 +63,66 @@ type ETCD struct {
 	Addr string `yaml:"addr"`
 }
 
+// Mail 邮件发送配置, Addr 为空时不发送邮件, 只保存在内存中. SMTP 密码通过环境变量 SMTP_PASSWORD 提供
+type Mail struct {
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	// ResetURL 重置密码页面的地址, 邮件中的链接为 ResetURL?token=...
+	ResetURL string `yaml:"resetURL"`
+	// InviteURL 接受工作区邀请页面的地址, 邮件中的链接为 InviteURL?token=...
+	InviteURL string `yaml:"inviteURL"`
+}
+
+// Email 邮箱验证配置
+type Email struct {
+	// VerifyURL 验证邮箱页面的地址, 邮件中的链接为 VerifyURL?token=...
+	VerifyURL string `yaml:"verifyURL"`
+	// Restrict 邮箱未验证的账号不能使用的功能, 取值见 service 包中的 Cap 常量
+	Restrict []string `yaml:"restrict"`
+}
+
+// TOTP 两步验证配置, 加密密钥通过环境变量 TOTP_ENCRYPTION_KEY (base64 编码的 32 字节) 提供,
+// 没有配置密钥时不能开启两步验证
+type TOTP struct {
+	Issuer string `yaml:"issuer"`
+}
+
+// Login 登录失败限制, 按账号与来源 IP 分别计数
+type Login struct {
+	// Store 失败记录的存储, 可选 mysql 与 memory, memory 只适合单实例部署
+	Store string `yaml:"store"`
+	// Window 超过该时间没有失败时重新计数
+	Window time.Duration `yaml:"window"`
+	// BaseDelay 失败次数超过 Free 后需要等待的时间, 之后每失败一次翻倍, 最长为 MaxDelay
+	BaseDelay time.Duration `yaml:"baseDelay"`
+	MaxDelay  time.Duration `yaml:"maxDelay"`
+	// Lockout 失败次数达到 Lock 后锁定的时长
+	Lockout time.Duration `yaml:"lockout"`
+	Account LoginLimit    `yaml:"account"`
+	IP      LoginLimit    `yaml:"ip"`
+}
+
+type LoginLimit struct {
+	// Free 不需要等待的失败次数
+	Free int `yaml:"free"`
+	// Lock 达到该失败次数后锁定, 为 0 时不锁定
+	Lock int `yaml:"lock"`
+}
+
+// JWT 访问令牌签名配置. 轮换密钥时先在 Keys 中加入新密钥, 再把 Active 改为新密钥,
+// 旧密钥至少保留一个访问令牌有效期, 以便之前签发的令牌仍能通过校验. 修改后无需重启即生效
 type JWT struct {
-	SecretKey string `yaml:"secretKey"`
+	// Keys 签名密钥, 没有配置时启动时生成临时密钥, 只适合单实例部署
+	Keys []SigningKey `yaml:"keys"`
+	// Active 签发新令牌使用的密钥 kid, 为空时使用 Keys 中的第一个
+	Active string `yaml:"active"`
+}
+
+// SigningKey File 为 PEM 编码的 RSA (至少 2048 位) 或 Ed25519 私钥
+type SigningKey struct {
+	Kid  string `yaml:"kid"`
+	File string `yaml:"file"`
 }
 
 func GetConf() *Config {
@@ -104,6 +169,11 @@ func initConf() {
 				observer.OnConfigChange(conf, ServerChange)
 			}
 		}
+		if !reflect.DeepEqual(oldConf.JWT, conf.JWT) {
+			for _, observer := range conf.observers {
+				observer.OnConfigChange(conf, JWTChange)
+			}
+		}
 	})
 
 	viper.WatchConfig()
@@ -15,6 +15,12 @@ type EnvConfig struct {
 	MySQLHost     string
 	MySQLPort     string
 	MySQLDb       string
+	SMTPPassword  string
+	TOTPKey       string
+	// InternalKey 签名服务间内部凭证的共享密钥, 网关与各服务需要配置同一个值
+	InternalKey string
+	// VerifyKey 签名邮箱验证链接的密钥
+	VerifyKey string
 }
 
 var envConfig *EnvConfig
@@ -27,6 +33,10 @@ func LoadEnvConfig() error {
 		MySQLHost:     os.Getenv("MYSQL_HOST"),
 		MySQLPort:     os.Getenv("MYSQL_PORT"),
 		MySQLDb:       os.Getenv("MYSQL_DB"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+		TOTPKey:       os.Getenv("TOTP_ENCRYPTION_KEY"),
+		InternalKey:   os.Getenv("INTERNAL_AUTH_KEY"),
+		VerifyKey:     os.Getenv("EMAIL_VERIFY_KEY"),
 	}
 	return nil
 }
@@ -58,7 +58,13 @@ func (p *DBProvider) refreshConnection() {
 		panic(err)
 	}
 
-	db.AutoMigrate(&dao.User{})
+	// 没有邮箱的账号保存为 NULL, 空字符串会违反唯一索引
+	if db.Migrator().HasColumn(&dao.User{}, "email") {
+		db.Exec("UPDATE user SET email = NULL WHERE email = ''")
+	}
+	db.AutoMigrate(&dao.User{}, &dao.AppPassword{}, &dao.RefreshToken{}, &dao.RevokedToken{}, &dao.Session{}, &dao.PasswordReset{},
+		&dao.TwoFactor{}, &dao.RecoveryCode{}, &dao.LoginChallenge{}, &dao.LoginAttempt{}, &dao.UserIdentity{}, &dao.AccessToken{},
+		&dao.AccountDeletion{}, &dao.AuditLog{}, &dao.Workspace{}, &dao.WorkspaceMember{}, &dao.WorkspaceInvite{})
 
 	p.mu.Lock()
 	oldDB := p.db
@@ -0,0 +1,91 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/keyring"
+)
+
+// keyringObserver 配置中的签名密钥变化时重新加载, 加载失败时继续使用当前的密钥
+type keyringObserver struct {
+	ring *keyring.Keyring
+}
+
+func (o *keyringObserver) OnConfigChange(c *config.Config, changeType config.ConfigChangeType) {
+	if changeType != config.JWTChange {
+		return
+	}
+
+	active, keys, err := loadKeys(c.JWT)
+	if err != nil {
+		zap.L().Error("Failed to reload JWT signing keys, keeping the current keys", zap.Error(err))
+		return
+	}
+	o.ring.Replace(active, keys)
+	zap.L().Info("JWT signing keys reloaded", zap.String("active", active.Kid), zap.Int("keys", len(keys)))
+}
+
+func InitKeyring() *keyring.Keyring {
+	conf := config.GetConf()
+
+	var ring *keyring.Keyring
+	if len(conf.JWT.Keys) == 0 {
+		zap.L().Warn("No JWT signing keys configured, using an ephemeral key")
+		key, err := keyring.Generate("ephemeral-" + strconv.FormatInt(time.Now().Unix(), 10))
+		if err != nil {
+			panic(err)
+		}
+		ring = keyring.New(key, nil)
+	} else {
+		active, keys, err := loadKeys(conf.JWT)
+		if err != nil {
+			panic(err)
+		}
+		ring = keyring.New(active, keys)
+	}
+	conf.AddObserver(&keyringObserver{ring: ring})
+
+	return ring
+}
+
+func loadKeys(conf config.JWT) (keyring.Key, []keyring.Key, error) {
+	if len(conf.Keys) == 0 {
+		return keyring.Key{}, nil, errors.New("no JWT signing keys configured")
+	}
+
+	keys := make([]keyring.Key, 0, len(conf.Keys))
+	seen := make(map[string]struct{}, len(conf.Keys))
+	for _, k := range conf.Keys {
+		if _, ok := seen[k.Kid]; ok || k.Kid == "" {
+			return keyring.Key{}, nil, fmt.Errorf("signing key kid %q is empty or duplicated", k.Kid)
+		}
+		seen[k.Kid] = struct{}{}
+		data, err := os.ReadFile(k.File)
+		if err != nil {
+			return keyring.Key{}, nil, err
+		}
+		key, err := keyring.ParsePEM(k.Kid, data)
+		if err != nil {
+			return keyring.Key{}, nil, fmt.Errorf("signing key %s: %w", k.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if conf.Active == "" {
+		return keys[0], keys, nil
+	}
+	for _, k := range keys {
+		if k.Kid == conf.Active {
+			return k, keys, nil
+		}
+	}
+
+	return keyring.Key{}, nil, fmt.Errorf("active signing key %s is not configured", conf.Active)
+}
@@ -0,0 +1,17 @@
+package ioc
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/config"
+)
+
+func InitAttemptStore(db *gorm.DB) repository.AttemptStore {
+	if config.GetConf().Login.Store == "memory" {
+		return repository.NewMemoryAttemptStore()
+	}
+
+	return repository.NewLoginAttemptRepo(dao.NewLoginAttemptDao(db))
+}
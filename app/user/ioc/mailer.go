@@ -0,0 +1,23 @@
+package ioc
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/mailer"
+)
+
+func InitMailer() mailer.Mailer {
+	conf := config.GetConf().Mail
+	if conf.Addr == "" {
+		zap.L().Warn("SMTP is not configured, emails are kept in memory")
+		return mailer.NewMemoryMailer()
+	}
+
+	var password string
+	if env := config.GetEnvConfig(); env != nil {
+		password = env.SMTPPassword
+	}
+
+	return mailer.NewSMTPMailer(conf.Addr, conf.From, conf.Username, password)
+}
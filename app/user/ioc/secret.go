@@ -0,0 +1,61 @@
+package ioc
+
+import (
+	"encoding/base64"
+
+	"go.uber.org/zap"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/service"
+	"github.com/crazyfrankie/todolist/app/user/config"
+	"github.com/crazyfrankie/todolist/app/user/pkg/secret"
+)
+
+// InitSecretBox 没有配置密钥时返回 nil, 两步验证不可用
+func InitSecretBox() *secret.Box {
+	env := config.GetEnvConfig()
+	if env == nil || env.TOTPKey == "" {
+		zap.L().Warn("TOTP_ENCRYPTION_KEY is not set, two-factor authentication is disabled")
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(env.TOTPKey)
+	if err != nil {
+		panic("invalid TOTP_ENCRYPTION_KEY: " + err.Error())
+	}
+	box, err := secret.NewBox(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return box
+}
+
+// InitPrincipalKey 没有内部凭证密钥时无法校验调用方, 拒绝启动
+func InitPrincipalKey() *principal.Key {
+	env := config.GetEnvConfig()
+	if env == nil || env.InternalKey == "" {
+		panic("INTERNAL_AUTH_KEY is not set")
+	}
+	key, err := principal.NewKey(env.InternalKey)
+	if err != nil {
+		panic("invalid INTERNAL_AUTH_KEY: " + err.Error())
+	}
+
+	return key
+}
+
+// minVerifyKeySize 邮箱验证链接签名密钥的最小长度
+const minVerifyKeySize = 32
+
+// InitVerifyKey 验证链接关系到 OIDC 登录按已验证邮箱关联账号, 没有密钥时拒绝启动
+func InitVerifyKey() service.VerifyKey {
+	env := config.GetEnvConfig()
+	if env == nil || env.VerifyKey == "" {
+		panic("EMAIL_VERIFY_KEY is not set")
+	}
+	if len(env.VerifyKey) < minVerifyKeySize {
+		panic("EMAIL_VERIFY_KEY must be at least 32 bytes")
+	}
+
+	return service.VerifyKey(env.VerifyKey)
+}
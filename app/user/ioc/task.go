@@ -0,0 +1,45 @@
+package ioc
+
+import (
+	"context"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/resolver"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/task"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository"
+	"github.com/crazyfrankie/todolist/app/user/biz/service"
+)
+
+// InitTaskClient 通过 etcd 发现任务服务, 注销账号时用于清除用户的任务数据
+func InitTaskClient(cli *clientv3.Client, key *principal.Key) task.TaskServiceClient {
+	builder, err := resolver.NewBuilder(cli)
+	if err != nil {
+		panic(err)
+	}
+	conn, err := grpc.NewClient("etcd:///service/task",
+		grpc.WithResolvers(builder),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithChainUnaryInterceptor(principal.UnaryClientInterceptor(key, principal.IssuerUser, nil)),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return task.NewTaskServiceClient(conn)
+}
+
+// InitAccountService 同时启动清除已注销账号数据的后台任务
+func InitAccountService(repo *repository.AccountRepo, userRepo *repository.UserRepo, twoFactor *service.TwoFactorService,
+	workspace *service.WorkspaceService, tasks task.TaskServiceClient) *service.AccountService {
+	s := service.NewAccountService(repo, userRepo, twoFactor, workspace, tasks)
+	go s.Run(context.Background())
+
+	return s
+}
@@ -3,12 +3,12 @@
 package ioc
 
 import (
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/user/biz/service"
 	"github.com/crazyfrankie/todolist/app/user/rpc"
 	"github.com/crazyfrankie/todolist/app/user/rpc/server"
-	"github.com/crazyfrankie/todolist/app/user/rpc_gen/user"
 	"github.com/google/wire"
 	"google.golang.org/grpc"
 )
@@ -16,10 +16,53 @@ import (
 func InitUser() *rpc.Server {
 	wire.Build(
 		InitDB,
+		InitMailer,
+		InitSecretBox,
+		InitPrincipalKey,
+		InitVerifyKey,
+		InitAttemptStore,
+		InitKeyring,
+		InitTaskClient,
+		InitAccountService,
 		dao.NewUserDao,
+		dao.NewAppPasswordDao,
+		dao.NewRefreshTokenDao,
+		dao.NewRevokedTokenDao,
+		dao.NewSessionDao,
+		dao.NewPasswordResetDao,
+		dao.NewTwoFactorDao,
+		dao.NewIdentityDao,
+		dao.NewAccessTokenDao,
+		dao.NewAccountDao,
+		dao.NewAuditDao,
+		dao.NewWorkspaceDao,
 		repository.NewUserRepo,
+		repository.NewAppPasswordRepo,
+		repository.NewRefreshTokenRepo,
+		repository.NewRevokedTokenRepo,
+		repository.NewSessionRepo,
+		repository.NewPasswordResetRepo,
+		repository.NewTwoFactorRepo,
+		repository.NewIdentityRepo,
+		repository.NewAccessTokenRepo,
+		repository.NewAccountRepo,
+		repository.NewAuditRepo,
+		repository.NewWorkspaceRepo,
 		service.NewUserService,
+		service.NewAppPasswordService,
+		service.NewTokenService,
+		service.NewSessionService,
+		service.NewPasswordService,
+		service.NewEmailService,
+		service.NewTwoFactorService,
+		service.NewLoginGuard,
+		service.NewIdentityService,
+		service.NewAccessTokenService,
+		service.NewAdminService,
+		service.NewWorkspaceService,
 		server.NewUserServer,
+		server.NewAdminServer,
+		server.NewWorkspaceServer,
 		InitRegistry,
 		registerService,
 		rpc.NewServer,
@@ -27,8 +70,10 @@ func InitUser() *rpc.Server {
 	return new(rpc.Server)
 }
 
-func registerService(u *server.UserServer) func(grpc.ServiceRegistrar) {
+func registerService(u *server.UserServer, a *server.AdminServer, w *server.WorkspaceServer) func(grpc.ServiceRegistrar) {
 	return func(s grpc.ServiceRegistrar) {
 		user.RegisterUserServiceServer(s, u)
+		user.RegisterAdminServiceServer(s, a)
+		user.RegisterWorkspaceServiceServer(s, w)
 	}
 }
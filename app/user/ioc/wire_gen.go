@@ -7,12 +7,12 @@
 package ioc
 
 import (
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository"
 	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/user/biz/service"
 	"github.com/crazyfrankie/todolist/app/user/rpc"
 	"github.com/crazyfrankie/todolist/app/user/rpc/server"
-	"github.com/crazyfrankie/todolist/app/user/rpc_gen/user"
 	"google.golang.org/grpc"
 )
 
@@ -23,17 +23,62 @@ func InitUser() *rpc.Server {
 	db := InitDB()
 	userDao := dao.NewUserDao(db)
 	userRepo := repository.NewUserRepo(userDao)
-	userService := service.NewUserService(userRepo)
-	userServer := server.NewUserServer(userService)
-	v := registerService(userServer)
-	rpcServer := rpc.NewServer(client, v)
+	refreshTokenDao := dao.NewRefreshTokenDao(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepo(refreshTokenDao)
+	revokedTokenDao := dao.NewRevokedTokenDao(db)
+	revokedTokenRepo := repository.NewRevokedTokenRepo(revokedTokenDao)
+	sessionDao := dao.NewSessionDao(db)
+	sessionRepo := repository.NewSessionRepo(sessionDao)
+	keyring := InitKeyring()
+	tokenService := service.NewTokenService(refreshTokenRepo, revokedTokenRepo, userRepo, sessionRepo, keyring)
+	mailer := InitMailer()
+	twoFactorDao := dao.NewTwoFactorDao(db)
+	twoFactorRepo := repository.NewTwoFactorRepo(twoFactorDao)
+	box := InitSecretBox()
+	attemptStore := InitAttemptStore(db)
+	loginGuard := service.NewLoginGuard(attemptStore)
+	twoFactorService := service.NewTwoFactorService(twoFactorRepo, userRepo, tokenService, loginGuard, box)
+	verifyKey := InitVerifyKey()
+	emailService := service.NewEmailService(userRepo, twoFactorService, mailer, verifyKey)
+	userService := service.NewUserService(userRepo, tokenService, emailService, twoFactorService, loginGuard)
+	appPasswordDao := dao.NewAppPasswordDao(db)
+	appPasswordRepo := repository.NewAppPasswordRepo(appPasswordDao)
+	appPasswordService := service.NewAppPasswordService(appPasswordRepo, userRepo)
+	sessionService := service.NewSessionService(sessionRepo, tokenService)
+	passwordResetDao := dao.NewPasswordResetDao(db)
+	passwordResetRepo := repository.NewPasswordResetRepo(passwordResetDao)
+	passwordService := service.NewPasswordService(userRepo, passwordResetRepo, tokenService, mailer)
+	identityDao := dao.NewIdentityDao(db)
+	identityRepo := repository.NewIdentityRepo(identityDao)
+	identityService := service.NewIdentityService(identityRepo, userRepo, tokenService, twoFactorService)
+	accessTokenDao := dao.NewAccessTokenDao(db)
+	accessTokenRepo := repository.NewAccessTokenRepo(accessTokenDao)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, userRepo)
+	accountDao := dao.NewAccountDao(db)
+	accountRepo := repository.NewAccountRepo(accountDao)
+	workspaceDao := dao.NewWorkspaceDao(db)
+	workspaceRepo := repository.NewWorkspaceRepo(workspaceDao)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo, mailer)
+	key := InitPrincipalKey()
+	taskServiceClient := InitTaskClient(client, key)
+	accountService := InitAccountService(accountRepo, userRepo, twoFactorService, workspaceService, taskServiceClient)
+	userServer := server.NewUserServer(userService, appPasswordService, sessionService, passwordService, emailService, twoFactorService, identityService, accessTokenService, accountService)
+	auditDao := dao.NewAuditDao(db)
+	auditRepo := repository.NewAuditRepo(auditDao)
+	adminService := service.NewAdminService(userRepo, auditRepo, tokenService, passwordService)
+	adminServer := server.NewAdminServer(adminService)
+	workspaceServer := server.NewWorkspaceServer(workspaceService)
+	v := registerService(userServer, adminServer, workspaceServer)
+	rpcServer := rpc.NewServer(client, v, adminService, key)
 	return rpcServer
 }
 
 // wire.go:
 
-func registerService(u *server.UserServer) func(grpc.ServiceRegistrar) {
+func registerService(u *server.UserServer, a *server.AdminServer, w *server.WorkspaceServer) func(grpc.ServiceRegistrar) {
 	return func(s grpc.ServiceRegistrar) {
 		user.RegisterUserServiceServer(s, u)
+		user.RegisterAdminServiceServer(s, a)
+		user.RegisterWorkspaceServiceServer(s, w)
 	}
 }
@@ -0,0 +1,163 @@
+// Package keyring 管理签发访问令牌的非对称密钥, 支持 RSA (RS256) 与 Ed25519 (EdDSA)
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key 一个签名密钥, Kid 写入令牌头部, 校验方据此在 JWKS 中查找公钥
+type Key struct {
+	Kid    string
+	Alg    string
+	signer crypto.Signer
+}
+
+// JWK 公钥的 JSON Web Key 表示 (RFC 7517)
+type JWK struct {
+	Kty string
+	Kid string
+	Alg string
+	Use string
+	// Crv X 为 Ed25519 公钥, N E 为 RSA 公钥
+	Crv string
+	X   string
+	N   string
+	E   string
+}
+
+// ParsePEM 解析 PEM 编码的私钥, 支持 PKCS#8 与 PKCS#1 格式
+func ParsePEM(kid string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("keyring: no PEM data found")
+	}
+
+	var (
+		priv any
+		err  error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("keyring: unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch k := priv.(type) {
+	case ed25519.PrivateKey:
+		return Key{Kid: kid, Alg: AlgEdDSA, signer: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return Key{}, errors.New("keyring: RSA keys must be at least 2048 bits")
+		}
+		return Key{Kid: kid, Alg: AlgRS256, signer: k}, nil
+	default:
+		return Key{}, fmt.Errorf("keyring: unsupported key type %T", priv)
+	}
+}
+
+// Generate 生成 Ed25519 密钥
+func Generate(kid string) (Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{Kid: kid, Alg: AlgEdDSA, signer: priv}, nil
+}
+
+// Sign 使用密钥签发令牌, 头部带上 kid
+func (k Key) Sign(claims jwt.Claims) (string, error) {
+	var method jwt.SigningMethod = jwt.SigningMethodEdDSA
+	if k.Alg == AlgRS256 {
+		method = jwt.SigningMethodRS256
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = k.Kid
+	return token.SignedString(k.signer)
+}
+
+func (k Key) JWK() JWK {
+	jwk := JWK{Kid: k.Kid, Alg: k.Alg, Use: "sig"}
+	switch pub := k.signer.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+
+	return jwk
+}
+
+// Keyring 当前使用的密钥. 轮换密钥时先加入新密钥, 切换 Active 后保留旧密钥直到旧令牌全部过期
+type Keyring struct {
+	mu     sync.RWMutex
+	active Key
+	keys   []Key
+}
+
+func New(active Key, keys []Key) *Keyring {
+	r := &Keyring{}
+	r.Replace(active, keys)
+	return r
+}
+
+// Replace 替换全部密钥, keys 中没有 active 时自动加入
+func (r *Keyring) Replace(active Key, keys []Key) {
+	all := []Key{active}
+	for _, k := range keys {
+		if k.Kid != active.Kid {
+			all = append(all, k)
+		}
+	}
+
+	r.mu.Lock()
+	r.active, r.keys = active, all
+	r.mu.Unlock()
+}
+
+// Active 签发新令牌使用的密钥
+func (r *Keyring) Active() Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// JWKS 全部密钥的公钥, 签发中的密钥在最前
+func (r *Keyring) JWKS() []JWK {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]JWK, 0, len(r.keys))
+	for _, k := range r.keys {
+		res = append(res, k.JWK())
+	}
+	return res
+}
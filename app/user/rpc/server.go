@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -20,7 +21,11 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/crazyfrankie/todolist/app/common/pkg/principal"
+	"github.com/crazyfrankie/todolist/app/user/biz/service"
 	"github.com/crazyfrankie/todolist/app/user/config"
 	"github.com/crazyfrankie/todolist/app/user/pkg/registry"
 )
@@ -34,8 +39,9 @@ type Server struct {
 	listener net.Listener
 }
 
-func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar)) *Server {
-	srv := grpc.NewServer(grpcServerOption()...)
+func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar), admin *service.AdminService,
+	key *principal.Key) *Server {
+	srv := grpc.NewServer(grpcServerOption(admin, key)...)
 	registrar(srv)
 
 	rpcServer := &Server{
@@ -53,7 +59,7 @@ func NewServer(client *clientv3.Client, registrar func(grpc.ServiceRegistrar)) *
 	return rpcServer
 }
 
-func grpcServerOption() []grpc.ServerOption {
+func grpcServerOption(admin *service.AdminService, key *principal.Key) []grpc.ServerOption {
 	logger, err := zap.NewProduction()
 	if err != nil {
 		panic(err)
@@ -76,12 +82,27 @@ func grpcServerOption() []grpc.ServerOption {
 		grpc.ChainUnaryInterceptor(
 			logging.UnaryServerInterceptor(initInterceptor(logger), logging.WithFieldsFromContext(logTraceID)),
 			circuitbreaker.NewInterceptorBuilder().Build(),
+			principal.UnaryServerInterceptor(key),
+			roleInterceptor(admin),
 		),
 	}
 
 	return srvOpts
 }
 
+// roleInterceptor 按调用方在数据库中的角色校验管理接口并限制模拟登录可以调用的方法, 不依赖网关的检查
+func roleInterceptor(admin *service.AdminService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := admin.Authorize(ctx, info.FullMethod); err != nil {
+			if errors.Is(err, service.ErrPermissionDenied) {
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
 func (s *Server) OnConfigChange(c *config.Config, changeType config.ConfigChangeType) {
 	if changeType == config.ServerChange && c.Server.Addr != s.Addr {
 		if err := s.register.Unregister(); err != nil {
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/biz/service"
+)
+
+// AdminServer 调用方的角色由 rpc 包中的拦截器校验
+type AdminServer struct {
+	svc *service.AdminService
+	user.UnimplementedAdminServiceServer
+}
+
+func NewAdminServer(svc *service.AdminService) *AdminServer {
+	return &AdminServer{svc: svc}
+}
+
+func (s *AdminServer) RegisterServer(server *grpc.Server) {
+	user.RegisterAdminServiceServer(server, s)
+}
+
+func (s *AdminServer) ListUsers(ctx context.Context, request *user.ListUsersRequest) (*user.ListUsersResponse, error) {
+	q := dao.UserQuery{
+		Keyword: request.GetKeyword(),
+		Role:    request.GetRole(),
+		Offset:  int(request.GetOffset()),
+		Limit:   int(request.GetLimit()),
+	}
+	switch request.GetStatus() {
+	case "":
+	case "active", "disabled":
+		disabled := request.GetStatus() == "disabled"
+		q.Disabled = &disabled
+	default:
+		return nil, status.Error(codes.InvalidArgument, "invalid status")
+	}
+
+	us, total, err := s.svc.ListUsers(ctx, q)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	results := make([]*user.AdminUser, 0, len(us))
+	for _, u := range us {
+		results = append(results, toAdminUser(u))
+	}
+
+	return &user.ListUsersResponse{
+		Users: results,
+		Total: total,
+	}, nil
+}
+
+func (s *AdminServer) GetUser(ctx context.Context, request *user.GetUserRequest) (*user.GetUserResponse, error) {
+	u, err := s.svc.GetUser(ctx, int(request.GetId()))
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.GetUserResponse{
+		User: toAdminUser(u),
+	}, nil
+}
+
+func (s *AdminServer) DisableUser(ctx context.Context, request *user.DisableUserRequest) (*user.DisableUserResponse, error) {
+	if err := s.svc.SetDisabled(ctx, int(request.GetId()), true, request.GetReason()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.DisableUserResponse{}, nil
+}
+
+func (s *AdminServer) EnableUser(ctx context.Context, request *user.EnableUserRequest) (*user.EnableUserResponse, error) {
+	if err := s.svc.SetDisabled(ctx, int(request.GetId()), false, request.GetReason()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.EnableUserResponse{}, nil
+}
+
+func (s *AdminServer) ForcePasswordReset(ctx context.Context, request *user.ForcePasswordResetRequest) (*user.ForcePasswordResetResponse, error) {
+	err := s.svc.ForcePasswordReset(ctx, int(request.GetId()))
+	if errors.Is(err, service.ErrNoEmail) {
+		return &user.ForcePasswordResetResponse{}, nil
+	}
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.ForcePasswordResetResponse{
+		EmailSent: true,
+	}, nil
+}
+
+func (s *AdminServer) SetUserRole(ctx context.Context, request *user.SetUserRoleRequest) (*user.SetUserRoleResponse, error) {
+	if err := s.svc.SetRole(ctx, int(request.GetId()), request.GetRole()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.SetUserRoleResponse{}, nil
+}
+
+func (s *AdminServer) Impersonate(ctx context.Context, request *user.ImpersonateRequest) (*user.ImpersonateResponse, error) {
+	token, err := s.svc.Impersonate(ctx, int(request.GetId()), request.GetReason())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &user.ImpersonateResponse{
+		AccessToken: token,
+		ExpiresAt:   time.Now().Add(service.AccessTokenTTL).Format(time.DateTime),
+	}, nil
+}
+
+func (s *AdminServer) ListAuditLogs(ctx context.Context, request *user.ListAuditLogsRequest) (*user.ListAuditLogsResponse, error) {
+	ls, total, err := s.svc.ListAuditLogs(ctx, dao.AuditQuery{
+		ActorId:  int(request.GetActorId()),
+		TargetId: int(request.GetTargetId()),
+		Offset:   int(request.GetOffset()),
+		Limit:    int(request.GetLimit()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.AuditLog, 0, len(ls))
+	for _, l := range ls {
+		results = append(results, &user.AuditLog{
+			Id:        int32(l.Id),
+			ActorId:   int32(l.ActorId),
+			Action:    l.Action,
+			TargetId:  int32(l.TargetId),
+			Detail:    l.Detail,
+			Ip:        l.Ip,
+			UserAgent: l.UserAgent,
+			Ctime:     time.Unix(l.Ctime, 0).Format(time.DateTime),
+		})
+	}
+
+	return &user.ListAuditLogsResponse{
+		Logs:  results,
+		Total: total,
+	}, nil
+}
+
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrReasonRequired),
+		errors.Is(err, service.ErrSelfAction):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
+
+func toAdminUser(u dao.User) *user.AdminUser {
+	res := &user.AdminUser{
+		User:          toUser(u),
+		ResetRequired: u.ResetRequired != 0,
+		Ctime:         time.Unix(u.Ctime, 0).Format(time.DateTime),
+	}
+	if u.Disabled != 0 {
+		res.DisabledAt = time.Unix(u.Disabled, 0).Format(time.DateTime)
+	}
+
+	return res
+}
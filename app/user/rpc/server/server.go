@@ -2,21 +2,40 @@ package server
 
 import (
 	"context"
-	"google.golang.org/grpc/metadata"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
 	"github.com/crazyfrankie/todolist/app/user/biz/service"
-	"github.com/crazyfrankie/todolist/app/user/rpc_gen/user"
 )
 
 type UserServer struct {
-	svc *service.UserService
+	svc       *service.UserService
+	appPwd    *service.AppPasswordService
+	session   *service.SessionService
+	pwd       *service.PasswordService
+	email     *service.EmailService
+	twoFactor *service.TwoFactorService
+	identity  *service.IdentityService
+	pat       *service.AccessTokenService
+	account   *service.AccountService
 	user.UnimplementedUserServiceServer
 }
 
-func NewUserServer(svc *service.UserService) *UserServer {
-	return &UserServer{svc: svc}
+func NewUserServer(svc *service.UserService, appPwd *service.AppPasswordService, session *service.SessionService,
+	pwd *service.PasswordService, email *service.EmailService, twoFactor *service.TwoFactorService,
+	identity *service.IdentityService, pat *service.AccessTokenService, account *service.AccountService) *UserServer {
+	return &UserServer{svc: svc, appPwd: appPwd, session: session, pwd: pwd, email: email, twoFactor: twoFactor,
+		identity: identity, pat: pat, account: account}
 }
 
 func (s *UserServer) RegisterServer(server *grpc.Server) {
@@ -24,16 +43,15 @@ func (s *UserServer) RegisterServer(server *grpc.Server) {
 }
 
 func (s *UserServer) Register(ctx context.Context, request *user.RegisterRequest) (*user.RegisterResponse, error) {
-	token, err := s.svc.Register(ctx, request.GetName(), request.GetPassword())
+	tokens, err := s.svc.Register(ctx, request.GetName(), request.GetPassword(), request.GetEmail())
 	if err != nil {
 		return &user.RegisterResponse{
 			Code: 200,
 			Msg:  "ok",
-		}, err
+		}, emailError(err)
 	}
 
-	header := metadata.Pairs("Set-Auth-Token", token)
-	grpc.SendHeader(ctx, header)
+	sendTokens(ctx, tokens)
 
 	return &user.RegisterResponse{
 		Code: 200,
@@ -42,16 +60,23 @@ func (s *UserServer) Register(ctx context.Context, request *user.RegisterRequest
 }
 
 func (s *UserServer) Login(ctx context.Context, request *user.LoginRequest) (*user.LoginResponse, error) {
-	token, err := s.svc.Login(ctx, request.GetName(), request.GetPassword())
+	tokens, challenge, err := s.svc.Login(ctx, request.GetName(), request.GetPassword())
 	if err != nil {
 		return &user.LoginResponse{
 			Code: 500,
 			Msg:  "internal error",
-		}, err
+		}, loginError(ctx, err)
+	}
+	if challenge != "" {
+		return &user.LoginResponse{
+			Code:              200,
+			Msg:               "ok",
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		}, nil
 	}
 
-	header := metadata.Pairs("Set-Auth-Token", token)
-	grpc.SendHeader(ctx, header)
+	sendTokens(ctx, tokens)
 
 	return &user.LoginResponse{
 		Code: 200,
@@ -59,18 +84,621 @@ func (s *UserServer) Login(ctx context.Context, request *user.LoginRequest) (*us
 	}, nil
 }
 
+func (s *UserServer) RefreshToken(ctx context.Context, request *user.RefreshTokenRequest) (*user.RefreshTokenResponse, error) {
+	tokens, err := s.svc.RefreshToken(ctx, request.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) ||
+			errors.Is(err, service.ErrAccountDisabled) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, err
+	}
+
+	sendTokens(ctx, tokens)
+
+	return &user.RefreshTokenResponse{
+		Code: 200,
+		Msg:  "ok",
+	}, nil
+}
+
+func (s *UserServer) Logout(ctx context.Context, request *user.LogoutRequest) (*user.LogoutResponse, error) {
+	if err := s.svc.Logout(ctx); err != nil {
+		return nil, err
+	}
+
+	// 令牌为空时网关删除 Cookie
+	sendTokens(ctx, service.Tokens{})
+
+	return &user.LogoutResponse{}, nil
+}
+
+func (s *UserServer) LogoutAllSessions(ctx context.Context, request *user.LogoutAllSessionsRequest) (*user.LogoutAllSessionsResponse, error) {
+	if err := s.svc.LogoutAllSessions(ctx); err != nil {
+		return nil, err
+	}
+
+	sendTokens(ctx, service.Tokens{})
+
+	return &user.LogoutAllSessionsResponse{}, nil
+}
+
+func (s *UserServer) CheckToken(ctx context.Context, request *user.CheckTokenRequest) (*user.CheckTokenResponse, error) {
+	valid, err := s.svc.CheckToken(ctx, int(request.GetUserId()), request.GetTokenId(), request.GetSessionId(), request.GetGeneration())
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.CheckTokenResponse{
+		Valid: valid,
+	}, nil
+}
+
+func (s *UserServer) ListSessions(ctx context.Context, request *user.ListSessionsRequest) (*user.ListSessionsResponse, error) {
+	sessions, current, err := s.session.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.Session, 0, len(sessions))
+	for _, sess := range sessions {
+		results = append(results, &user.Session{
+			Id:        int32(sess.Id),
+			Device:    sess.Device,
+			UserAgent: sess.UserAgent,
+			Ip:        sess.Ip,
+			LastSeen:  time.Unix(sess.LastSeen, 0).Format(time.DateTime),
+			Ctime:     time.Unix(sess.Ctime, 0).Format(time.DateTime),
+			Current:   sess.Sid == current,
+		})
+	}
+
+	return &user.ListSessionsResponse{
+		Sessions: results,
+	}, nil
+}
+
+func (s *UserServer) RevokeSession(ctx context.Context, request *user.RevokeSessionRequest) (*user.RevokeSessionResponse, error) {
+	current, err := s.session.Revoke(ctx, int(request.GetId()))
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+	if current {
+		sendTokens(ctx, service.Tokens{})
+	}
+
+	return &user.RevokeSessionResponse{}, nil
+}
+
+func (s *UserServer) TouchSessions(ctx context.Context, request *user.TouchSessionsRequest) (*user.TouchSessionsResponse, error) {
+	seen := make([]service.SessionSeen, 0, len(request.GetSeen()))
+	for _, e := range request.GetSeen() {
+		seen = append(seen, service.SessionSeen{
+			UserId:  int(e.GetUserId()),
+			Session: e.GetSessionId(),
+			Ip:      e.GetIp(),
+			SeenAt:  e.GetSeenAt(),
+		})
+	}
+	s.session.Touch(ctx, seen)
+
+	return &user.TouchSessionsResponse{}, nil
+}
+
+func (s *UserServer) ChangePassword(ctx context.Context, request *user.ChangePasswordRequest) (*user.ChangePasswordResponse, error) {
+	err := s.pwd.ChangePassword(ctx, request.GetCurrentPassword(), request.GetNewPassword())
+	if err != nil {
+		return nil, passwordError(err)
+	}
+
+	return &user.ChangePasswordResponse{}, nil
+}
+
+func (s *UserServer) RequestPasswordReset(ctx context.Context, request *user.RequestPasswordResetRequest) (*user.RequestPasswordResetResponse, error) {
+	if err := s.pwd.RequestReset(ctx, request.GetName()); err != nil {
+		return nil, err
+	}
+
+	return &user.RequestPasswordResetResponse{}, nil
+}
+
+func (s *UserServer) ConfirmPasswordReset(ctx context.Context, request *user.ConfirmPasswordResetRequest) (*user.ConfirmPasswordResetResponse, error) {
+	err := s.pwd.ConfirmReset(ctx, request.GetToken(), request.GetNewPassword())
+	if err != nil {
+		return nil, passwordError(err)
+	}
+
+	// 重置后全部会话已结束, 同时清除发起请求的浏览器中的 Cookie
+	sendTokens(ctx, service.Tokens{})
+
+	return &user.ConfirmPasswordResetResponse{}, nil
+}
+
+func (s *UserServer) UpdateEmail(ctx context.Context, request *user.UpdateEmailRequest) (*user.UpdateEmailResponse, error) {
+	if err := s.email.UpdateEmail(ctx, request.GetEmail(), request.GetCurrentPassword(), request.GetCode()); err != nil {
+		return nil, emailError(err)
+	}
+
+	return &user.UpdateEmailResponse{}, nil
+}
+
+func (s *UserServer) SendVerificationEmail(ctx context.Context, request *user.SendVerificationEmailRequest) (*user.SendVerificationEmailResponse, error) {
+	if err := s.email.SendVerification(ctx); err != nil {
+		return nil, emailError(err)
+	}
+
+	return &user.SendVerificationEmailResponse{}, nil
+}
+
+func (s *UserServer) VerifyEmail(ctx context.Context, request *user.VerifyEmailRequest) (*user.VerifyEmailResponse, error) {
+	if err := s.email.Verify(ctx, request.GetToken()); err != nil {
+		return nil, emailError(err)
+	}
+
+	return &user.VerifyEmailResponse{}, nil
+}
+
+func (s *UserServer) LoginTwoFactor(ctx context.Context, request *user.LoginTwoFactorRequest) (*user.LoginTwoFactorResponse, error) {
+	tokens, err := s.twoFactor.Login(ctx, request.GetChallenge(), request.GetCode())
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			return nil, loginError(ctx, err)
+		}
+		return nil, twoFactorError(err)
+	}
+
+	sendTokens(ctx, tokens)
+
+	return &user.LoginTwoFactorResponse{
+		Code: 200,
+		Msg:  "ok",
+	}, nil
+}
+
+func (s *UserServer) EnrollTwoFactor(ctx context.Context, request *user.EnrollTwoFactorRequest) (*user.EnrollTwoFactorResponse, error) {
+	e, err := s.twoFactor.Enroll(ctx)
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return &user.EnrollTwoFactorResponse{
+		OtpauthUri: e.URI,
+		QrPng:      e.QRPNG,
+	}, nil
+}
+
+func (s *UserServer) VerifyTwoFactor(ctx context.Context, request *user.VerifyTwoFactorRequest) (*user.VerifyTwoFactorResponse, error) {
+	codes, err := s.twoFactor.Verify(ctx, request.GetCode())
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return &user.VerifyTwoFactorResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *UserServer) DisableTwoFactor(ctx context.Context, request *user.DisableTwoFactorRequest) (*user.DisableTwoFactorResponse, error) {
+	if err := s.twoFactor.Disable(ctx, request.GetCode()); err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return &user.DisableTwoFactorResponse{}, nil
+}
+
+func (s *UserServer) RegenerateRecoveryCodes(ctx context.Context, request *user.RegenerateRecoveryCodesRequest) (*user.RegenerateRecoveryCodesResponse, error) {
+	codes, err := s.twoFactor.RegenerateRecoveryCodes(ctx, request.GetCode())
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return &user.RegenerateRecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// loginError 被限制时通过 Retry-After 头告知客户端需要等待的秒数
+func loginError(ctx context.Context, err error) error {
+	var retry *service.RetryError
+	switch {
+	case errors.As(err, &retry):
+		grpc.SetHeader(ctx, metadata.Pairs("Retry-After", strconv.Itoa(int(math.Ceil(retry.After.Seconds())))))
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrPasswordResetRequired):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
+
+func twoFactorError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidTOTPCode), errors.Is(err, service.ErrInvalidChallenge):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrTwoFactorUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, service.ErrTooManyAttempts):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return err
+	}
+}
+
+func emailError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrInvalidVerifyToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrNoEmail):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrWrongPassword):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return twoFactorError(err)
+	}
+}
+
+func passwordError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrWrongPassword):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrInvalidPassword), errors.Is(err, service.ErrInvalidResetToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// sendTokens 通过响应头把令牌交给网关, 由网关写入 Cookie
+func sendTokens(ctx context.Context, tokens service.Tokens) {
+	header := metadata.Pairs("Set-Auth-Token", tokens.Access, "Set-Refresh-Token", tokens.Refresh)
+	grpc.SendHeader(ctx, header)
+}
+
+func (s *UserServer) OIDCLogin(ctx context.Context, request *user.OIDCLoginRequest) (*user.OIDCLoginResponse, error) {
+	tokens, challenge, err := s.identity.Login(ctx, service.ExternalIdentity{
+		Provider:      request.GetProvider(),
+		Subject:       request.GetSubject(),
+		Email:         request.GetEmail(),
+		EmailVerified: request.GetEmailVerified(),
+		Name:          request.GetName(),
+	}, int(request.GetLinkUserId()))
+	if err != nil {
+		return nil, identityError(err)
+	}
+
+	return &user.OIDCLoginResponse{
+		AccessToken:       tokens.Access,
+		RefreshToken:      tokens.Refresh,
+		TwoFactorRequired: challenge != "",
+		Challenge:         challenge,
+	}, nil
+}
+
+func (s *UserServer) ListIdentities(ctx context.Context, request *user.ListIdentitiesRequest) (*user.ListIdentitiesResponse, error) {
+	identities, err := s.identity.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*user.Identity, 0, len(identities))
+	for _, i := range identities {
+		res = append(res, &user.Identity{
+			Id:        int32(i.Id),
+			Provider:  i.Provider,
+			Email:     i.Email,
+			Ctime:     time.Unix(i.Ctime, 0).Format(time.DateTime),
+			LastLogin: time.Unix(i.LastLogin, 0).Format(time.DateTime),
+		})
+	}
+
+	return &user.ListIdentitiesResponse{Identities: res}, nil
+}
+
+func (s *UserServer) UnlinkIdentity(ctx context.Context, request *user.UnlinkIdentityRequest) (*user.UnlinkIdentityResponse, error) {
+	if err := s.identity.Unlink(ctx, int(request.GetId())); err != nil {
+		return nil, identityError(err)
+	}
+
+	return &user.UnlinkIdentityResponse{}, nil
+}
+
+func identityError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidIdentity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrIdentityConflict), errors.Is(err, service.ErrLastSignInMethod):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrIdentityLinked):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrIdentityNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	// FailedPrecondition 已用于邮箱冲突, 网关需要区分两者
+	case errors.Is(err, service.ErrPasswordResetRequired):
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return err
+	}
+}
+
+func (s *UserServer) GetJWKS(ctx context.Context, request *user.GetJWKSRequest) (*user.GetJWKSResponse, error) {
+	jwks := s.svc.JWKS()
+	keys := make([]*user.Jwk, 0, len(jwks))
+	for _, k := range jwks {
+		keys = append(keys, &user.Jwk{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Alg: k.Alg,
+			Use: k.Use,
+			Crv: k.Crv,
+			X:   k.X,
+			N:   k.N,
+			E:   k.E,
+		})
+	}
+
+	return &user.GetJWKSResponse{Keys: keys}, nil
+}
+
 func (s *UserServer) GetUserInfo(ctx context.Context, request *user.GetUserInfoRequest) (*user.GetUserInfoResponse, error) {
 	u, err := s.svc.GetUserInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	newUser := &user.User{
-		Id:   int32(u.Id),
-		Name: u.Name,
+	return &user.GetUserInfoResponse{
+		User: toUser(u),
+	}, nil
+}
+
+func (s *UserServer) BatchGetUsers(ctx context.Context, request *user.BatchGetUsersRequest) (*user.BatchGetUsersResponse, error) {
+	ids := make([]int, 0, len(request.GetIds()))
+	for _, id := range request.GetIds() {
+		ids = append(ids, int(id))
 	}
 
-	return &user.GetUserInfoResponse{
-		User: newUser,
+	users, err := s.svc.BatchGet(ctx, ids)
+	if errors.Is(err, service.ErrTooManyUsers) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.UserSummary, 0, len(users))
+	for _, u := range users {
+		results = append(results, &user.UserSummary{
+			Id:          int32(u.Id),
+			Name:        u.Name,
+			DisplayName: u.DisplayName,
+			Avatar:      u.Avatar,
+		})
+	}
+
+	return &user.BatchGetUsersResponse{
+		Users: results,
+	}, nil
+}
+
+func (s *UserServer) UpdateProfile(ctx context.Context, request *user.UpdateProfileRequest) (*user.UpdateProfileResponse, error) {
+	p := dao.Profile{
+		DisplayName: request.DisplayName,
+		Avatar:      request.Avatar,
+		Timezone:    request.Timezone,
+		Locale:      request.Locale,
+	}
+	if request.WeekStart != nil {
+		weekStart := int(request.GetWeekStart())
+		p.WeekStart = &weekStart
+	}
+
+	u, err := s.account.UpdateProfile(ctx, p)
+	if err != nil {
+		return nil, accountError(err)
+	}
+
+	return &user.UpdateProfileResponse{
+		User: toUser(u),
 	}, nil
 }
+
+func (s *UserServer) DeleteAccount(ctx context.Context, request *user.DeleteAccountRequest) (*user.DeleteAccountResponse, error) {
+	if err := s.account.Delete(ctx, request.GetPassword(), request.GetCode()); err != nil {
+		return nil, accountError(err)
+	}
+
+	sendTokens(ctx, service.Tokens{})
+
+	return &user.DeleteAccountResponse{}, nil
+}
+
+func accountError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidProfile):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrAccountNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrWrongPassword):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrOwnsSharedWorkspace):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return twoFactorError(err)
+	}
+}
+
+func toUser(u dao.User) *user.User {
+	res := &user.User{
+		Id:            int32(u.Id),
+		Name:          u.Name,
+		EmailVerified: u.EmailVerified != 0,
+		Restricted:    service.Restrictions(u),
+		DisplayName:   u.DisplayName,
+		Avatar:        u.Avatar,
+		Timezone:      u.Timezone,
+		Locale:        u.Locale,
+		WeekStart:     int32(u.WeekStart),
+		Role:          service.RoleOf(u),
+	}
+	if u.Email != nil {
+		res.Email = *u.Email
+	}
+
+	return res
+}
+
+func (s *UserServer) CreateAppPassword(ctx context.Context, request *user.CreateAppPasswordRequest) (*user.CreateAppPasswordResponse, error) {
+	p, password, err := s.appPwd.Create(ctx, request.GetName())
+	if err != nil {
+		return nil, emailError(err)
+	}
+
+	return &user.CreateAppPasswordResponse{
+		AppPassword: toAppPassword(p),
+		Password:    password,
+	}, nil
+}
+
+func (s *UserServer) ListAppPasswords(ctx context.Context, request *user.ListAppPasswordsRequest) (*user.ListAppPasswordsResponse, error) {
+	ps, err := s.appPwd.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.AppPassword, 0, len(ps))
+	for _, p := range ps {
+		results = append(results, toAppPassword(p))
+	}
+
+	return &user.ListAppPasswordsResponse{
+		AppPasswords: results,
+	}, nil
+}
+
+func (s *UserServer) DeleteAppPassword(ctx context.Context, request *user.DeleteAppPasswordRequest) (*user.DeleteAppPasswordResponse, error) {
+	err := s.appPwd.Delete(ctx, int(request.GetId()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.DeleteAppPasswordResponse{}, nil
+}
+
+func (s *UserServer) VerifyAppPassword(ctx context.Context, request *user.VerifyAppPasswordRequest) (*user.VerifyAppPasswordResponse, error) {
+	uid, err := s.appPwd.Verify(ctx, request.GetName(), request.GetPassword())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAppPassword) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, err
+	}
+
+	return &user.VerifyAppPasswordResponse{
+		UserId: int32(uid),
+	}, nil
+}
+
+func toAppPassword(p *dao.AppPassword) *user.AppPassword {
+	res := &user.AppPassword{
+		Id:    int32(p.Id),
+		Name:  p.Name,
+		Ctime: time.Unix(p.Ctime, 0).Format(time.DateTime),
+	}
+	if p.LastUsed != 0 {
+		res.LastUsed = time.Unix(p.LastUsed, 0).Format(time.DateTime)
+	}
+
+	return res
+}
+
+func (s *UserServer) CreateAccessToken(ctx context.Context, request *user.CreateAccessTokenRequest) (*user.CreateAccessTokenResponse, error) {
+	t, token, err := s.pat.Create(ctx, request.GetName(), request.GetScopes(), int(request.GetExpiresInDays()))
+	if err != nil {
+		return nil, accessTokenError(err)
+	}
+
+	return &user.CreateAccessTokenResponse{
+		AccessToken: toAccessToken(t),
+		Token:       token,
+	}, nil
+}
+
+func (s *UserServer) ListAccessTokens(ctx context.Context, request *user.ListAccessTokensRequest) (*user.ListAccessTokensResponse, error) {
+	ts, err := s.pat.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.AccessToken, 0, len(ts))
+	for _, t := range ts {
+		results = append(results, toAccessToken(t))
+	}
+
+	return &user.ListAccessTokensResponse{
+		AccessTokens: results,
+	}, nil
+}
+
+func (s *UserServer) RevokeAccessToken(ctx context.Context, request *user.RevokeAccessTokenRequest) (*user.RevokeAccessTokenResponse, error) {
+	if err := s.pat.Revoke(ctx, int(request.GetId())); err != nil {
+		return nil, accessTokenError(err)
+	}
+
+	return &user.RevokeAccessTokenResponse{}, nil
+}
+
+func (s *UserServer) VerifyAccessToken(ctx context.Context, request *user.VerifyAccessTokenRequest) (*user.VerifyAccessTokenResponse, error) {
+	t, ok, err := s.pat.Verify(ctx, request.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &user.VerifyAccessTokenResponse{}, nil
+	}
+
+	return &user.VerifyAccessTokenResponse{
+		Valid:     true,
+		UserId:    int32(t.UserId),
+		TokenId:   int32(t.Id),
+		Scopes:    strings.Fields(t.Scopes),
+		ExpiresAt: t.ExpiresAt,
+	}, nil
+}
+
+func accessTokenError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrTokenNameRequired), errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidExpiry):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrAccessTokenNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return emailError(err)
+	}
+}
+
+func toAccessToken(t *dao.AccessToken) *user.AccessToken {
+	res := &user.AccessToken{
+		Id:        int32(t.Id),
+		Name:      t.Name,
+		Scopes:    strings.Fields(t.Scopes),
+		ExpiresAt: time.Unix(t.ExpiresAt, 0).Format(time.DateTime),
+		Ctime:     time.Unix(t.Ctime, 0).Format(time.DateTime),
+	}
+	if t.LastUsed != 0 {
+		res.LastUsed = time.Unix(t.LastUsed, 0).Format(time.DateTime)
+	}
+
+	return res
+}
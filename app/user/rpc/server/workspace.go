@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/crazyfrankie/todolist/app/common/rpc_gen/user"
+	"github.com/crazyfrankie/todolist/app/user/biz/repository/dao"
+	"github.com/crazyfrankie/todolist/app/user/biz/service"
+)
+
+type WorkspaceServer struct {
+	svc *service.WorkspaceService
+	user.UnimplementedWorkspaceServiceServer
+}
+
+func NewWorkspaceServer(svc *service.WorkspaceService) *WorkspaceServer {
+	return &WorkspaceServer{svc: svc}
+}
+
+func (s *WorkspaceServer) RegisterServer(server *grpc.Server) {
+	user.RegisterWorkspaceServiceServer(server, s)
+}
+
+func (s *WorkspaceServer) CreateWorkspace(ctx context.Context, request *user.CreateWorkspaceRequest) (*user.CreateWorkspaceResponse, error) {
+	w, err := s.svc.Create(ctx, request.GetName())
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.CreateWorkspaceResponse{
+		Workspace: toWorkspace(w),
+	}, nil
+}
+
+func (s *WorkspaceServer) ListWorkspaces(ctx context.Context, request *user.ListWorkspacesRequest) (*user.ListWorkspacesResponse, error) {
+	ws, err := s.svc.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.Workspace, 0, len(ws))
+	for _, w := range ws {
+		results = append(results, toWorkspace(w))
+	}
+
+	return &user.ListWorkspacesResponse{
+		Workspaces: results,
+	}, nil
+}
+
+func (s *WorkspaceServer) GetWorkspace(ctx context.Context, request *user.GetWorkspaceRequest) (*user.GetWorkspaceResponse, error) {
+	w, members, err := s.svc.Get(ctx, int(request.GetId()))
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	results := make([]*user.WorkspaceMember, 0, len(members))
+	for _, m := range members {
+		results = append(results, &user.WorkspaceMember{
+			UserId:      int32(m.UserId),
+			Name:        m.Name,
+			DisplayName: m.DisplayName,
+			Avatar:      m.Avatar,
+			Role:        m.Role,
+			JoinedAt:    time.Unix(m.Ctime, 0).Format(time.DateTime),
+		})
+	}
+
+	return &user.GetWorkspaceResponse{
+		Workspace: toWorkspace(w),
+		Members:   results,
+	}, nil
+}
+
+func (s *WorkspaceServer) RenameWorkspace(ctx context.Context, request *user.RenameWorkspaceRequest) (*user.RenameWorkspaceResponse, error) {
+	if err := s.svc.Rename(ctx, int(request.GetId()), request.GetName()); err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.RenameWorkspaceResponse{}, nil
+}
+
+func (s *WorkspaceServer) SetMemberRole(ctx context.Context, request *user.SetMemberRoleRequest) (*user.SetMemberRoleResponse, error) {
+	err := s.svc.SetRole(ctx, int(request.GetWorkspaceId()), int(request.GetUserId()), request.GetRole())
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.SetMemberRoleResponse{}, nil
+}
+
+func (s *WorkspaceServer) RemoveMember(ctx context.Context, request *user.RemoveMemberRequest) (*user.RemoveMemberResponse, error) {
+	if err := s.svc.RemoveMember(ctx, int(request.GetWorkspaceId()), int(request.GetUserId())); err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.RemoveMemberResponse{}, nil
+}
+
+func (s *WorkspaceServer) CreateInvite(ctx context.Context, request *user.CreateInviteRequest) (*user.CreateInviteResponse, error) {
+	i, token, err := s.svc.CreateInvite(ctx, int(request.GetWorkspaceId()), request.GetEmail(), request.GetRole())
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.CreateInviteResponse{
+		Invite: toInvite(i, ""),
+		Token:  token,
+	}, nil
+}
+
+func (s *WorkspaceServer) ListInvites(ctx context.Context, request *user.ListInvitesRequest) (*user.ListInvitesResponse, error) {
+	w, is, err := s.svc.ListInvites(ctx, int(request.GetWorkspaceId()))
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	results := make([]*user.WorkspaceInvite, 0, len(is))
+	for _, i := range is {
+		results = append(results, toInvite(i, w.Name))
+	}
+
+	return &user.ListInvitesResponse{
+		Invites: results,
+	}, nil
+}
+
+func (s *WorkspaceServer) RevokeInvite(ctx context.Context, request *user.RevokeInviteRequest) (*user.RevokeInviteResponse, error) {
+	if err := s.svc.RevokeInvite(ctx, int(request.GetWorkspaceId()), int(request.GetId())); err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.RevokeInviteResponse{}, nil
+}
+
+func (s *WorkspaceServer) AcceptInvite(ctx context.Context, request *user.AcceptInviteRequest) (*user.AcceptInviteResponse, error) {
+	w, err := s.svc.Accept(ctx, request.GetToken())
+	if err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.AcceptInviteResponse{
+		Workspace: toWorkspace(w),
+	}, nil
+}
+
+func (s *WorkspaceServer) DeclineInvite(ctx context.Context, request *user.DeclineInviteRequest) (*user.DeclineInviteResponse, error) {
+	if err := s.svc.Decline(ctx, request.GetToken()); err != nil {
+		return nil, workspaceError(err)
+	}
+
+	return &user.DeclineInviteResponse{}, nil
+}
+
+func (s *WorkspaceServer) CheckMembership(ctx context.Context, request *user.CheckMembershipRequest) (*user.CheckMembershipResponse, error) {
+	role, err := s.svc.Role(ctx, int(request.GetWorkspaceId()), int(request.GetUserId()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.CheckMembershipResponse{
+		Role: role,
+	}, nil
+}
+
+func workspaceError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidWorkspace), errors.Is(err, service.ErrInvalidMemberRole),
+		errors.Is(err, service.ErrInvalidEmail):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrMemberNotFound),
+		errors.Is(err, service.ErrInvalidInvite):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrNotWorkspaceAdmin), errors.Is(err, service.ErrNotWorkspaceOwner),
+		errors.Is(err, service.ErrInviteEmail):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrOwnerCannotLeave), errors.Is(err, service.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrAlreadyMember):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return err
+	}
+}
+
+func toWorkspace(w dao.Membership) *user.Workspace {
+	return &user.Workspace{
+		Id:          int32(w.Id),
+		Name:        w.Name,
+		OwnerId:     int32(w.OwnerId),
+		Role:        w.Role,
+		MemberCount: int32(w.MemberCount),
+		Ctime:       time.Unix(w.Ctime, 0).Format(time.DateTime),
+	}
+}
+
+func toInvite(i *dao.WorkspaceInvite, workspace string) *user.WorkspaceInvite {
+	return &user.WorkspaceInvite{
+		Id:            int32(i.Id),
+		WorkspaceId:   int32(i.WorkspaceId),
+		WorkspaceName: workspace,
+		Email:         i.Email,
+		Role:          i.Role,
+		InviterId:     int32(i.InviterId),
+		ExpiresAt:     time.Unix(i.ExpiresAt, 0).Format(time.DateTime),
+		Ctime:         time.Unix(i.Ctime, 0).Format(time.DateTime),
+	}
+}